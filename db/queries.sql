@@ -15,17 +15,6 @@ INSERT INTO users (
 )
 RETURNING *;
 
--- name: SetUserOnline :exec
-UPDATE users
-SET is_online = true
-WHERE id = $1;
-
--- name: SetUserOffline :exec
-UPDATE users
-SET is_online = false,
-    last_online = NOW()
-WHERE id = $1;
-
 -- name: GetUserLastOnline :one
 SELECT last_online FROM users
 WHERE id = $1 LIMIT 1;
@@ -217,8 +206,18 @@ WHERE liker_user_id = $1
 -- name: GetHomeFeed :many
 WITH RequestingUser AS (
     SELECT
-        u.id, u.latitude, u.longitude, u.gender, u.date_of_birth, u.spotlight_active_until
-    FROM users u WHERE u.id = $1
+        u.id,
+        COALESCE(tl.latitude, u.latitude) AS latitude,
+        COALESCE(tl.longitude, u.longitude) AS longitude,
+        u.gender, u.date_of_birth, u.spotlight_active_until
+    FROM users u
+    LEFT JOIN user_travel_locations tl ON tl.user_id = u.id
+        AND tl.expires_at > NOW()
+        AND EXISTS (
+            SELECT 1 FROM user_subscriptions s
+            WHERE s.user_id = tl.user_id AND s.feature_type = 'travel_mode' AND s.expires_at > NOW()
+        )
+    WHERE u.id = $1
 ), RequestingUserFilters AS (
     SELECT
         f.user_id, f.who_you_want_to_see, f.radius_km, f.active_today, f.age_min, f.age_max
@@ -241,19 +240,28 @@ WITH RequestingUser AS (
 SELECT
     target_user.*,
     COALESCE(ap.prompts, '[]'::jsonb) as prompts,
-    haversine(ru.latitude, ru.longitude, target_user.latitude, target_user.longitude) AS distance_km
+    ttl.city AS visiting_city,
+    ttl.latitude AS visiting_latitude,
+    ttl.longitude AS visiting_longitude,
+    haversine(ru.latitude, ru.longitude, COALESCE(ttl.latitude, target_user.latitude), COALESCE(ttl.longitude, target_user.longitude)) AS distance_km
 FROM users AS target_user
 JOIN RequestingUser ru ON target_user.id != ru.id
 JOIN RequestingUserFilters rf ON ru.id = rf.user_id
 LEFT JOIN filters AS target_user_filters ON target_user.id = target_user_filters.user_id
 LEFT JOIN AggregatedPrompts ap ON target_user.id = ap.user_id
+LEFT JOIN user_travel_locations ttl ON ttl.user_id = target_user.id
+    AND ttl.expires_at > NOW()
+    AND EXISTS (
+        SELECT 1 FROM user_subscriptions s
+        WHERE s.user_id = ttl.user_id AND s.feature_type = 'travel_mode' AND s.expires_at > NOW()
+    )
 WHERE
-    target_user.latitude IS NOT NULL AND target_user.longitude IS NOT NULL
+    COALESCE(ttl.latitude, target_user.latitude) IS NOT NULL AND COALESCE(ttl.longitude, target_user.longitude) IS NOT NULL
     AND ru.latitude IS NOT NULL AND ru.longitude IS NOT NULL
     AND ru.gender IS NOT NULL
     AND rf.who_you_want_to_see IS NOT NULL
     AND rf.age_min IS NOT NULL AND rf.age_max IS NOT NULL
-    AND (rf.radius_km IS NULL OR haversine(ru.latitude, ru.longitude, target_user.latitude, target_user.longitude) <= rf.radius_km)
+    AND (rf.radius_km IS NULL OR haversine(ru.latitude, ru.longitude, COALESCE(ttl.latitude, target_user.latitude), COALESCE(ttl.longitude, target_user.longitude)) <= rf.radius_km)
     AND target_user.gender = rf.who_you_want_to_see
     AND (target_user_filters.user_id IS NULL OR target_user_filters.who_you_want_to_see IS NULL OR target_user_filters.who_you_want_to_see = ru.gender)
     AND target_user.date_of_birth IS NOT NULL
@@ -264,6 +272,17 @@ WHERE
     AND NOT EXISTS (SELECT 1 FROM dislikes d WHERE d.disliker_user_id = ru.id AND d.disliked_user_id = target_user.id)
     AND NOT EXISTS (SELECT 1 FROM dislikes d WHERE d.disliker_user_id = target_user.id AND d.disliked_user_id = ru.id)
     AND NOT EXISTS (SELECT 1 FROM likes l WHERE l.liker_user_id = ru.id AND l.liked_user_id = target_user.id)
+    AND NOT EXISTS (SELECT 1 FROM account_deletions ad WHERE ad.user_id = target_user.id)
+    AND NOT EXISTS (
+        SELECT 1 FROM user_sanctions us
+        WHERE us.user_id = target_user.id AND (us.expires_at IS NULL OR us.expires_at > NOW())
+    )
+    AND NOT EXISTS (SELECT 1 FROM user_risk_scores rs WHERE rs.user_id = target_user.id AND rs.auto_hidden)
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks b
+        WHERE (b.blocker_user_id = ru.id AND b.blocked_user_id = target_user.id)
+           OR (b.blocker_user_id = target_user.id AND b.blocked_user_id = ru.id)
+    )
 ORDER BY
     CASE WHEN target_user.spotlight_active_until > NOW() THEN 0 ELSE 1 END ASC,
     distance_km ASC,
@@ -277,24 +296,44 @@ LIMIT $2;
 -- name: GetQuickFeed :many
 SELECT
     target_user.*,
-    haversine($1, $2, target_user.latitude, target_user.longitude) AS distance_km
+    ttl.city AS visiting_city,
+    ttl.latitude AS visiting_latitude,
+    ttl.longitude AS visiting_longitude,
+    haversine($1, $2, COALESCE(ttl.latitude, target_user.latitude), COALESCE(ttl.longitude, target_user.longitude)) AS distance_km
 FROM users AS target_user
+LEFT JOIN user_travel_locations ttl ON ttl.user_id = target_user.id
+    AND ttl.expires_at > NOW()
+    AND EXISTS (
+        SELECT 1 FROM user_subscriptions s
+        WHERE s.user_id = ttl.user_id AND s.feature_type = 'travel_mode' AND s.expires_at > NOW()
+    )
 WHERE
       target_user.id != $3
-  AND target_user.latitude IS NOT NULL
-  AND target_user.longitude IS NOT NULL
+  AND COALESCE(ttl.latitude, target_user.latitude) IS NOT NULL
+  AND COALESCE(ttl.longitude, target_user.longitude) IS NOT NULL
   AND target_user.gender = $4
   AND target_user.name IS NOT NULL AND target_user.name != ''
   AND target_user.date_of_birth IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM account_deletions ad WHERE ad.user_id = target_user.id)
+  AND NOT EXISTS (
+      SELECT 1 FROM user_sanctions us
+      WHERE us.user_id = target_user.id AND (us.expires_at IS NULL OR us.expires_at > NOW())
+  )
+  AND NOT EXISTS (SELECT 1 FROM user_risk_scores rs WHERE rs.user_id = target_user.id AND rs.auto_hidden)
+  AND NOT EXISTS (
+      SELECT 1 FROM blocks b
+      WHERE (b.blocker_user_id = $3 AND b.blocked_user_id = target_user.id)
+         OR (b.blocker_user_id = target_user.id AND b.blocked_user_id = $3)
+  )
 ORDER BY
     distance_km ASC
 LIMIT $5;
 
 -- name: AddUserSubscription :one
 INSERT INTO user_subscriptions (
-    user_id, feature_type, expires_at, activated_at
+    user_id, feature_type, expires_at, purchase_id, activated_at
 ) VALUES (
-    $1, $2, $3, NOW()
+    $1, $2, $3, $4, NOW()
 )
 RETURNING *;
 
@@ -323,20 +362,43 @@ SELECT
     l.created_at as liked_at,
     u.name,
     u.last_name,
-    u.media_urls
+    u.media_urls,
+    (CASE WHEN l.interaction_type = 'rose' THEN 0 ELSE 2 END
+        + CASE WHEN COALESCE(l.is_seen, false) THEN 1 ELSE 0 END)::int AS sort_rank
 FROM likes l
 JOIN users u ON l.liker_user_id = u.id
-WHERE l.liked_user_id = $1
+WHERE l.liked_user_id = @liked_user_id
   AND NOT EXISTS (
       SELECT 1
       FROM likes l2
       WHERE l2.liker_user_id = l.liked_user_id
         AND l2.liked_user_id = l.liker_user_id
   )
+  AND NOT EXISTS (
+      SELECT 1
+      FROM blocks b
+      WHERE (b.blocker_user_id = l.liked_user_id AND b.blocked_user_id = l.liker_user_id)
+         OR (b.blocker_user_id = l.liker_user_id AND b.blocked_user_id = l.liked_user_id)
+  )
+  AND NOT EXISTS (
+      SELECT 1
+      FROM user_sanctions us
+      WHERE us.user_id = l.liker_user_id AND (us.expires_at IS NULL OR us.expires_at > NOW())
+  )
+  AND (
+      (CASE WHEN l.interaction_type = 'rose' THEN 0 ELSE 2 END
+          + CASE WHEN COALESCE(l.is_seen, false) THEN 1 ELSE 0 END) > @after_rank::int
+      OR (
+          (CASE WHEN l.interaction_type = 'rose' THEN 0 ELSE 2 END
+              + CASE WHEN COALESCE(l.is_seen, false) THEN 1 ELSE 0 END) = @after_rank::int
+          AND (l.created_at, l.id) < (@after_created_at::timestamptz, @after_id::int)
+      )
+  )
 ORDER BY
-    (l.interaction_type = 'rose') DESC,
-    l.is_seen ASC,
-    l.created_at DESC;
+    sort_rank ASC,
+    l.created_at DESC,
+    l.id DESC
+LIMIT @page_limit::int;
 
 -- name: GetLikeDetails :one
 SELECT
@@ -354,24 +416,120 @@ INSERT INTO chat_messages (
     message_text,
     media_url,
     media_type,
-    reply_to_message_id
+    reply_to_message_id,
+    kind,
+    payload
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7, $8
 ) RETURNING *;
 
 -- name: GetConversationMessages :many
-WITH MessageReactionsAgg AS (
+-- Messages up to the user's cleared_before for this conversation are hidden
+-- from them only.
+WITH cleared AS (
+    SELECT COALESCE(
+        (SELECT cs.cleared_before FROM conversation_settings cs WHERE cs.user_id = @user_id AND cs.peer_user_id = @other_user_id),
+        '-infinity'::timestamptz
+    ) AS before
+),
+page AS (
+    SELECT * FROM (
+        (
+            SELECT cm1.id, cm1.sender_user_id, cm1.recipient_user_id, cm1.message_text, cm1.media_url, cm1.media_type, cm1.sent_at, cm1.is_read, cm1.reply_to_message_id, cm1.delivered_at, cm1.edited_at, cm1.deleted_at, cm1.kind, cm1.payload
+            FROM chat_messages cm1
+            WHERE cm1.sender_user_id = @user_id AND cm1.recipient_user_id = @other_user_id
+              AND cm1.sent_at > (SELECT before FROM cleared)
+              AND cm1.sent_at <= @before_sent_at::timestamptz
+              AND (cm1.sent_at < @before_sent_at::timestamptz OR cm1.id < @before_id::bigint)
+            ORDER BY cm1.sent_at DESC, cm1.id DESC
+            LIMIT @page_limit::int
+        )
+        UNION ALL
+        (
+            SELECT cm2.id, cm2.sender_user_id, cm2.recipient_user_id, cm2.message_text, cm2.media_url, cm2.media_type, cm2.sent_at, cm2.is_read, cm2.reply_to_message_id, cm2.delivered_at, cm2.edited_at, cm2.deleted_at, cm2.kind, cm2.payload
+            FROM chat_messages cm2
+            WHERE cm2.sender_user_id = @other_user_id AND cm2.recipient_user_id = @user_id
+              AND cm2.sent_at > (SELECT before FROM cleared)
+              AND cm2.sent_at <= @before_sent_at::timestamptz
+              AND (cm2.sent_at < @before_sent_at::timestamptz OR cm2.id < @before_id::bigint)
+            ORDER BY cm2.sent_at DESC, cm2.id DESC
+            LIMIT @page_limit::int
+        )
+    ) AS both_directions
+    ORDER BY sent_at DESC, id DESC
+    LIMIT @page_limit::int
+),
+MessageReactionsAgg AS (
     SELECT
         message_id,
         jsonb_object_agg(emoji, count) FILTER (WHERE emoji IS NOT NULL) AS reactions_summary_json
      FROM (
         SELECT message_id, emoji, COUNT(user_id) as count
         FROM message_reactions
-        WHERE message_id IN (
-            SELECT id FROM chat_messages
-            WHERE (sender_user_id = $1 AND recipient_user_id = $2)
-               OR (sender_user_id = $2 AND recipient_user_id = $1)
+        WHERE message_id IN (SELECT id FROM page)
+        GROUP BY message_id, emoji
+     ) AS grouped_reactions
+    GROUP BY message_id
+)
+SELECT
+    cm.id, cm.sender_user_id, cm.recipient_user_id, cm.message_text, cm.media_url, cm.media_type, cm.sent_at, cm.is_read,
+    COALESCE(mra.reactions_summary_json, '{}'::jsonb) AS reactions_data,
+    cm.reply_to_message_id,
+    replied_msg.sender_user_id AS replied_message_sender_id,
+    COALESCE(substring(replied_msg.message_text for 50)::TEXT, '') AS replied_message_text_snippet,
+    replied_msg.media_type AS replied_message_media_type,
+    cm.edited_at,
+    cm.deleted_at,
+    cm.delivered_at,
+    cm.kind,
+    cm.payload
+FROM page cm
+LEFT JOIN MessageReactionsAgg mra ON cm.id = mra.message_id
+LEFT JOIN chat_messages replied_msg ON cm.reply_to_message_id = replied_msg.id
+ORDER BY cm.sent_at ASC, cm.id ASC;
+
+-- name: GetConversationMessagesAfter :many
+WITH cleared AS (
+    SELECT COALESCE(
+        (SELECT cs.cleared_before FROM conversation_settings cs WHERE cs.user_id = @user_id AND cs.peer_user_id = @other_user_id),
+        '-infinity'::timestamptz
+    ) AS before
+),
+page AS (
+    SELECT * FROM (
+        (
+            SELECT cm1.id, cm1.sender_user_id, cm1.recipient_user_id, cm1.message_text, cm1.media_url, cm1.media_type, cm1.sent_at, cm1.is_read, cm1.reply_to_message_id, cm1.delivered_at, cm1.edited_at, cm1.deleted_at, cm1.kind, cm1.payload
+            FROM chat_messages cm1
+            WHERE cm1.sender_user_id = @user_id AND cm1.recipient_user_id = @other_user_id
+              AND cm1.sent_at > (SELECT before FROM cleared)
+              AND cm1.sent_at >= @after_sent_at::timestamptz
+              AND (cm1.sent_at > @after_sent_at::timestamptz OR cm1.id > @after_id::bigint)
+            ORDER BY cm1.sent_at ASC, cm1.id ASC
+            LIMIT @page_limit::int
         )
+        UNION ALL
+        (
+            SELECT cm2.id, cm2.sender_user_id, cm2.recipient_user_id, cm2.message_text, cm2.media_url, cm2.media_type, cm2.sent_at, cm2.is_read, cm2.reply_to_message_id, cm2.delivered_at, cm2.edited_at, cm2.deleted_at, cm2.kind, cm2.payload
+            FROM chat_messages cm2
+            WHERE cm2.sender_user_id = @other_user_id AND cm2.recipient_user_id = @user_id
+              AND cm2.sent_at > (SELECT before FROM cleared)
+              AND cm2.sent_at >= @after_sent_at::timestamptz
+              AND (cm2.sent_at > @after_sent_at::timestamptz OR cm2.id > @after_id::bigint)
+            ORDER BY cm2.sent_at ASC, cm2.id ASC
+            LIMIT @page_limit::int
+        )
+    ) AS both_directions
+    ORDER BY sent_at ASC, id ASC
+    LIMIT @page_limit::int
+),
+MessageReactionsAgg AS (
+    SELECT
+        message_id,
+        jsonb_object_agg(emoji, count) FILTER (WHERE emoji IS NOT NULL) AS reactions_summary_json
+     FROM (
+        SELECT message_id, emoji, COUNT(user_id) as count
+        FROM message_reactions
+        WHERE message_id IN (SELECT id FROM page)
         GROUP BY message_id, emoji
      ) AS grouped_reactions
     GROUP BY message_id
@@ -382,13 +540,16 @@ SELECT
     cm.reply_to_message_id,
     replied_msg.sender_user_id AS replied_message_sender_id,
     COALESCE(substring(replied_msg.message_text for 50)::TEXT, '') AS replied_message_text_snippet,
-    replied_msg.media_type AS replied_message_media_type
-FROM chat_messages cm
+    replied_msg.media_type AS replied_message_media_type,
+    cm.edited_at,
+    cm.deleted_at,
+    cm.delivered_at,
+    cm.kind,
+    cm.payload
+FROM page cm
 LEFT JOIN MessageReactionsAgg mra ON cm.id = mra.message_id
 LEFT JOIN chat_messages replied_msg ON cm.reply_to_message_id = replied_msg.id
-WHERE (cm.sender_user_id = $1 AND cm.recipient_user_id = $2)
-   OR (cm.sender_user_id = $2 AND cm.recipient_user_id = $1)
-ORDER BY cm.sent_at ASC;
+ORDER BY cm.sent_at ASC, cm.id ASC;
 
 -- name: GetUserReactionsForMessages :many
 SELECT message_id, emoji
@@ -397,15 +558,28 @@ WHERE user_id = $1 AND message_id = ANY($2::bigint[]);
 
 -- name: MarkMessagesAsReadUntil :execresult
 UPDATE chat_messages
-SET is_read = true
+SET is_read = true, delivered_at = COALESCE(delivered_at, NOW())
 WHERE recipient_user_id = $1
   AND sender_user_id = $2
   AND id <= $3
   AND is_read = false;
 
+-- name: MarkMessagesDeliveredUntil :execrows
+UPDATE chat_messages
+SET delivered_at = NOW()
+WHERE recipient_user_id = $1
+  AND sender_user_id = $2
+  AND id <= $3
+  AND delivered_at IS NULL;
+
 -- name: CheckMutualLikeExists :one
 SELECT EXISTS (SELECT 1 FROM likes l1 WHERE l1.liker_user_id = $1 AND l1.liked_user_id = $2)
-   AND EXISTS (SELECT 1 FROM likes l2 WHERE l2.liker_user_id = $2 AND l2.liked_user_id = $1);
+   AND EXISTS (SELECT 1 FROM likes l2 WHERE l2.liker_user_id = $2 AND l2.liked_user_id = $1)
+   AND NOT EXISTS (
+       SELECT 1 FROM blocks b
+       WHERE (b.blocker_user_id = $1 AND b.blocked_user_id = $2)
+          OR (b.blocker_user_id = $2 AND b.blocked_user_id = $1)
+   );
 
 -- name: DeleteLikesBetweenUsers :exec
 DELETE FROM likes
@@ -429,10 +603,15 @@ SELECT EXISTS (
 );
 
 -- name: GetTotalUnreadCount :one
+-- Muted conversations and cleared history don't count towards the badge.
 SELECT COUNT(*)
-FROM chat_messages
-WHERE recipient_user_id = $1
-  AND is_read = false;
+FROM chat_messages cm
+LEFT JOIN conversation_settings cs
+    ON cs.user_id = cm.recipient_user_id AND cs.peer_user_id = cm.sender_user_id
+WHERE cm.recipient_user_id = $1
+  AND cm.is_read = false
+  AND (cs.muted_until IS NULL OR cs.muted_until <= NOW())
+  AND (cs.cleared_before IS NULL OR cm.sent_at > cs.cleared_before);
 
 -- name: GetUnseenLikeCount :one
 SELECT COUNT(*)
@@ -481,7 +660,7 @@ WHERE message_id = $1 AND user_id = $2
 LIMIT 1;
 
 -- name: GetMessageSenderRecipient :one
-SELECT sender_user_id, recipient_user_id
+SELECT sender_user_id, recipient_user_id, deleted_at
 FROM chat_messages
 WHERE id = $1
 LIMIT 1;
@@ -514,7 +693,13 @@ SELECT
         WHERE cm_unread.recipient_user_id = l1.liker_user_id
           AND cm_unread.sender_user_id = l1.liked_user_id
           AND cm_unread.is_read = false
-    ) AS unread_message_count
+          AND cm_unread.sent_at > COALESCE(cs.cleared_before, '-infinity'::timestamptz)
+    ) AS unread_message_count,
+    cs.muted_until,
+    COALESCE(cs.pinned, false) AS pinned,
+    COALESCE(cs.archived, false) AS archived,
+    (CASE WHEN COALESCE(cs.pinned, false) THEN 0 ELSE 1 END)::int AS sort_rank,
+    COALESCE(last_event.event_at, to_timestamp(0))::timestamptz AS sort_event_at
 FROM
     likes l1
 JOIN
@@ -524,21 +709,30 @@ JOIN
     likes l2
     ON l1.liked_user_id = l2.liker_user_id
    AND l1.liker_user_id = l2.liked_user_id
+LEFT JOIN
+    conversation_settings cs
+    ON cs.user_id = l1.liker_user_id
+   AND cs.peer_user_id = l1.liked_user_id
 LEFT JOIN LATERAL (
     (
         SELECT
             cm.sent_at AS event_at,
             cm.sender_user_id AS event_user_id,
             CASE
+                WHEN cm.deleted_at IS NOT NULL THEN 'deleted'
+                WHEN cm.kind IN ('location', 'date_proposal') THEN cm.kind::TEXT
                 WHEN cm.message_text IS NOT NULL THEN 'text'
                 ELSE 'media'
             END AS event_type,
-            COALESCE(cm.message_text, cm.media_type) AS event_content,
+            COALESCE(cm.message_text, cm.media_type, cm.payload->>'name', cm.payload->>'place_name') AS event_content,
             cm.media_url AS event_extra
         FROM chat_messages cm
         WHERE
-            (cm.sender_user_id = l1.liker_user_id AND cm.recipient_user_id = l1.liked_user_id)
-            OR (cm.sender_user_id = l1.liked_user_id AND cm.recipient_user_id = l1.liker_user_id)
+            (
+                (cm.sender_user_id = l1.liker_user_id AND cm.recipient_user_id = l1.liked_user_id)
+                OR (cm.sender_user_id = l1.liked_user_id AND cm.recipient_user_id = l1.liker_user_id)
+            )
+            AND cm.sent_at > COALESCE(cs.cleared_before, '-infinity'::timestamptz)
 
         UNION ALL
 
@@ -557,15 +751,38 @@ LEFT JOIN LATERAL (
                 (cm_react.sender_user_id = l1.liker_user_id AND cm_react.recipient_user_id = l1.liked_user_id)
                 OR (cm_react.sender_user_id = l1.liked_user_id AND cm_react.recipient_user_id = l1.liker_user_id)
             )
+            AND cm_react.sent_at > COALESCE(cs.cleared_before, '-infinity'::timestamptz)
     )
     ORDER BY event_at DESC
     LIMIT 1
 ) AS last_event ON true
 WHERE
-    l1.liker_user_id = $1
+    l1.liker_user_id = @liker_user_id
+    AND NOT EXISTS (
+        SELECT 1
+        FROM blocks b
+        WHERE (b.blocker_user_id = l1.liker_user_id AND b.blocked_user_id = l1.liked_user_id)
+           OR (b.blocker_user_id = l1.liked_user_id AND b.blocked_user_id = l1.liker_user_id)
+    )
+    AND COALESCE(cs.archived, false) = @archived::boolean
+    AND (
+        (CASE WHEN COALESCE(cs.pinned, false) THEN 0 ELSE 1 END) > @after_rank::int
+        OR (
+            (CASE WHEN COALESCE(cs.pinned, false) THEN 0 ELSE 1 END) = @after_rank::int
+            AND (
+                COALESCE(last_event.event_at, to_timestamp(0)) < @after_event_at::timestamptz
+                OR (
+                    COALESCE(last_event.event_at, to_timestamp(0)) = @after_event_at::timestamptz
+                    AND target_user.id > @after_user_id::int
+                )
+            )
+        )
+    )
 ORDER BY
-    COALESCE(last_event.event_at, '1970-01-01'::timestamptz) DESC,
-    target_user.id;
+    sort_rank ASC,
+    COALESCE(last_event.event_at, to_timestamp(0)) DESC,
+    target_user.id
+LIMIT @page_limit::int;
 
 -- name: GetMatchIDs :many
 SELECT
@@ -577,7 +794,13 @@ JOIN
   ON l1.liker_user_id = l2.liked_user_id
   AND l1.liked_user_id = l2.liker_user_id
 WHERE
-  l1.liker_user_id = $1;
+  l1.liker_user_id = $1
+  AND NOT EXISTS (
+    SELECT 1
+    FROM blocks b
+    WHERE (b.blocker_user_id = l1.liker_user_id AND b.blocked_user_id = l1.liked_user_id)
+       OR (b.blocker_user_id = l1.liked_user_id AND b.blocked_user_id = l1.liker_user_id)
+  );
 
 -- name: UpdateLastOnline :exec
 UPDATE users
@@ -695,20 +918,37 @@ WHERE shown_user_id = @shown_user_id
   AND (@end_date::timestamptz IS NULL OR impression_timestamp <= @end_date);
 
 -- name: GetUserSpotlightActivationTimes :many
-SELECT
-    updated_at as potentially_activated_at,
-    u.spotlight_active_until as expires_at
-FROM user_consumables uc
-JOIN users u ON uc.user_id = u.id
-WHERE uc.user_id = @user_id
-  AND uc.consumable_type = 'spotlight'
-  AND u.spotlight_active_until IS NOT NULL
-  AND (
-       (@start_date::timestamptz IS NULL OR u.spotlight_active_until >= @start_date)
-       AND
-       (@end_date::timestamptz IS NULL OR uc.updated_at <= @end_date)
-      )
-ORDER BY u.spotlight_active_until DESC;
+SELECT activated_at, expires_at
+FROM spotlight_activations
+WHERE user_id = @user_id
+  AND (@start_date::timestamptz IS NULL OR expires_at >= @start_date)
+  AND (@end_date::timestamptz IS NULL OR activated_at <= @end_date)
+ORDER BY activated_at DESC;
+
+-- name: StartUserSpotlight :one
+-- Starts the user's spotlight unless one is already running.
+UPDATE users
+SET spotlight_active_until = NOW() + make_interval(secs => @duration_seconds::float8)
+WHERE id = @id
+  AND (spotlight_active_until IS NULL OR spotlight_active_until <= NOW())
+RETURNING spotlight_active_until;
+
+-- name: CreateSpotlightActivation :one
+INSERT INTO spotlight_activations (user_id, expires_at)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: ClaimExpiredSpotlights :many
+UPDATE spotlight_activations
+SET expiry_notified_at = NOW()
+WHERE id IN (
+    SELECT id FROM spotlight_activations
+    WHERE expiry_notified_at IS NULL AND expires_at <= NOW()
+    ORDER BY expires_at
+    LIMIT @batch_size
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
 
 -- name: LogPhotoViewDuration :exec
 INSERT INTO photo_view_durations (
@@ -728,3 +968,769 @@ WHERE
     AND (@end_date::timestamptz IS NULL OR view_timestamp <= @end_date)
 GROUP BY photo_index
 ORDER BY photo_index;
+
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetRefreshTokenByHashForUpdate :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: MarkRefreshTokenRotated :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    replaced_by_id = $2
+WHERE id = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE family_id = $1
+  AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+  AND revoked_at IS NULL;
+
+-- name: StartLegacyTokenGrace :one
+INSERT INTO legacy_token_grace (id) VALUES (TRUE)
+ON CONFLICT (id) DO UPDATE SET id = legacy_token_grace.id
+RETURNING started_at;
+
+-- name: RevokeSession :exec
+INSERT INTO revoked_sessions (session_id, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (session_id) DO NOTHING;
+
+-- name: SetUserSessionCutoff :exec
+-- Token iat claims have whole seconds, so the cutoff is truncated to match;
+-- otherwise a login in the same second as the logout would be revoked.
+INSERT INTO user_session_cutoffs (user_id, revoked_before)
+VALUES ($1, date_trunc('second', NOW()))
+ON CONFLICT (user_id) DO UPDATE
+SET revoked_before = date_trunc('second', NOW()),
+    updated_at = NOW();
+
+-- name: IsTokenRevoked :one
+SELECT (
+    EXISTS (SELECT 1 FROM revoked_sessions rs WHERE rs.session_id = @session_id)
+    OR EXISTS (
+        SELECT 1 FROM user_session_cutoffs usc
+        WHERE usc.user_id = @user_id AND usc.revoked_before > @issued_at
+    )
+)::boolean AS revoked;
+
+-- name: GetUserIDByIdentity :one
+SELECT user_id FROM user_identities
+WHERE provider = $1 AND subject = $2;
+
+-- name: UpsertUserIdentity :exec
+INSERT INTO user_identities (user_id, provider, subject, email)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (provider, subject) DO UPDATE
+SET last_used_at = NOW(),
+    email = COALESCE(EXCLUDED.email, user_identities.email);
+
+-- name: GetUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CreateImpersonationAuditLog :one
+INSERT INTO impersonation_audit_log (admin_user_id, target_user_id, reason, token_id, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: RequestAccountDeletion :one
+INSERT INTO account_deletions (user_id, purge_after)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET purge_after = account_deletions.purge_after
+RETURNING *;
+
+-- name: CancelAccountDeletion :execrows
+DELETE FROM account_deletions
+WHERE user_id = $1;
+
+-- name: ListAccountsDueForPurge :many
+SELECT user_id FROM account_deletions
+WHERE purge_after <= NOW()
+ORDER BY purge_after
+LIMIT $1;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1;
+
+-- name: GetLikesSentByUser :many
+SELECT * FROM likes
+WHERE liker_user_id = $1
+ORDER BY created_at;
+
+-- name: GetAllMessagesForUser :many
+SELECT * FROM chat_messages
+WHERE sender_user_id = $1 OR recipient_user_id = $1
+ORDER BY sent_at, id;
+
+-- name: GetReportsFiledByUser :many
+SELECT * FROM reports
+WHERE reporter_user_id = $1
+ORDER BY created_at;
+
+-- name: GetProfileImpressionsByViewer :many
+SELECT * FROM user_profile_impressions
+WHERE viewer_user_id = $1
+ORDER BY impression_timestamp;
+
+-- name: GetLikeProfileViewsByViewer :many
+SELECT * FROM like_profile_views
+WHERE viewer_user_id = $1
+ORDER BY view_timestamp;
+
+-- name: GetPhotoViewDurationsByViewer :many
+SELECT * FROM photo_view_durations
+WHERE viewer_user_id = $1
+ORDER BY view_timestamp;
+
+-- name: BlockUser :exec
+INSERT INTO blocks (blocker_user_id, blocked_user_id)
+VALUES ($1, $2)
+ON CONFLICT (blocker_user_id, blocked_user_id) DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM blocks
+WHERE blocker_user_id = $1 AND blocked_user_id = $2;
+
+-- name: GetBlockedUsers :many
+SELECT
+    b.blocked_user_id,
+    b.created_at AS blocked_at,
+    u.name,
+    u.last_name,
+    u.media_urls
+FROM blocks b
+JOIN users u ON u.id = b.blocked_user_id
+WHERE b.blocker_user_id = $1
+ORDER BY b.created_at DESC;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_user_id = $1 AND blocked_user_id = $2)
+       OR (blocker_user_id = $2 AND blocked_user_id = $1)
+) AS blocked;
+
+-- name: GetReportQueue :many
+SELECT
+    q.reported_user_id,
+    u.name,
+    u.last_name,
+    u.media_urls,
+    q.open_report_count,
+    q.reason_counts,
+    q.first_reported_at,
+    q.last_reported_at
+FROM (
+    SELECT
+        per_reason.reported_user_id,
+        SUM(per_reason.report_count)::bigint AS open_report_count,
+        jsonb_object_agg(per_reason.reason, per_reason.report_count) AS reason_counts,
+        MIN(per_reason.first_reported_at)::timestamptz AS first_reported_at,
+        MAX(per_reason.last_reported_at)::timestamptz AS last_reported_at
+    FROM (
+        SELECT
+            r.reported_user_id,
+            r.reason,
+            COUNT(*) AS report_count,
+            MIN(r.created_at) AS first_reported_at,
+            MAX(r.created_at) AS last_reported_at
+        FROM reports r
+        WHERE NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id)
+        GROUP BY r.reported_user_id, r.reason
+    ) per_reason
+    GROUP BY per_reason.reported_user_id
+) q
+JOIN users u ON u.id = q.reported_user_id
+ORDER BY q.open_report_count DESC, q.last_reported_at DESC
+LIMIT $1 OFFSET $2;
+
+-- name: GetOpenReportsForUser :many
+SELECT r.* FROM reports r
+WHERE r.reported_user_id = $1
+  AND NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id)
+ORDER BY r.created_at DESC;
+
+-- name: GetChatExcerpt :many
+SELECT * FROM chat_messages
+WHERE (sender_user_id = $1 AND recipient_user_id = $2)
+   OR (sender_user_id = $2 AND recipient_user_id = $1)
+ORDER BY sent_at DESC, id DESC
+LIMIT $3;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (admin_user_id, target_user_id, action, reason, suspended_until)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetModerationActionsForUser :many
+SELECT * FROM moderation_actions
+WHERE target_user_id = $1
+ORDER BY created_at DESC;
+
+-- name: ResolveOpenReportsForUser :execrows
+INSERT INTO report_resolutions (report_id, action_id)
+SELECT r.id, @action_id::bigint
+FROM reports r
+WHERE r.reported_user_id = @reported_user_id
+  AND NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id);
+
+-- name: UpsertUserSanction :exec
+INSERT INTO user_sanctions (user_id, action_id, is_ban, reason, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET action_id = EXCLUDED.action_id,
+    is_ban = EXCLUDED.is_ban,
+    reason = EXCLUDED.reason,
+    expires_at = EXCLUDED.expires_at,
+    created_at = NOW();
+
+-- name: DeleteUserSanction :execrows
+DELETE FROM user_sanctions
+WHERE user_id = $1;
+
+-- name: GetActiveUserSanction :one
+SELECT * FROM user_sanctions
+WHERE user_id = $1
+  AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: GetOpenReportSignals :one
+SELECT
+    COUNT(*) FILTER (WHERE r.created_at >= @velocity_since::timestamptz) AS reports_in_window,
+    COUNT(DISTINCT r.reporter_user_id) AS distinct_reporters,
+    COUNT(*) FILTER (WHERE r.reason = 'minor') AS minor_reports,
+    COUNT(*) FILTER (WHERE r.reason = 'fakeProfile') AS fake_profile_reports
+FROM reports r
+WHERE r.reported_user_id = @reported_user_id
+  AND NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id);
+
+-- name: UpsertUserRiskScore :exec
+INSERT INTO user_risk_scores (user_id, score, reasons, auto_hidden, evaluated_at)
+VALUES ($1, $2, $3, $4, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET score = EXCLUDED.score,
+    reasons = EXCLUDED.reasons,
+    auto_hidden = user_risk_scores.auto_hidden OR EXCLUDED.auto_hidden,
+    evaluated_at = NOW();
+
+-- name: ClearRiskHold :exec
+UPDATE user_risk_scores
+SET auto_hidden = false, reviewed_at = NOW()
+WHERE user_id = $1;
+
+-- name: ListRiskCandidates :many
+SELECT DISTINCT r.reported_user_id AS user_id
+FROM reports r
+WHERE NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id)
+UNION
+SELECT rs.user_id
+FROM user_risk_scores rs
+WHERE rs.score > 0;
+
+-- name: GetAutoHiddenUsers :many
+SELECT
+    rs.user_id,
+    rs.score,
+    rs.reasons,
+    rs.evaluated_at,
+    u.name,
+    u.last_name,
+    u.media_urls
+FROM user_risk_scores rs
+JOIN users u ON u.id = rs.user_id
+WHERE rs.auto_hidden
+ORDER BY rs.score DESC
+LIMIT $1 OFFSET $2;
+
+-- name: GetChatMessageForUpdate :one
+SELECT * FROM chat_messages
+WHERE id = $1
+FOR UPDATE;
+
+-- name: CreateChatMessageEdit :exec
+INSERT INTO chat_message_edits (message_id, previous_text)
+VALUES ($1, $2);
+
+-- name: UpdateChatMessageText :one
+UPDATE chat_messages
+SET message_text = $2, edited_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: TombstoneChatMessage :one
+UPDATE chat_messages
+SET message_text = NULL, media_url = NULL, media_type = NULL, payload = NULL, deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: RespondToDateProposal :one
+UPDATE chat_messages
+SET payload = jsonb_set(
+        jsonb_set(payload, '{status}', to_jsonb(@status::text)),
+        '{responded_at}', to_jsonb(NOW())
+    )
+WHERE id = @id
+  AND recipient_user_id = @recipient_user_id
+  AND kind = 'date_proposal'
+  AND deleted_at IS NULL
+  AND payload->>'status' = 'pending'
+RETURNING *;
+
+-- name: GetConversationSettings :one
+SELECT * FROM conversation_settings
+WHERE user_id = $1 AND peer_user_id = $2;
+
+-- name: UpsertConversationSettings :one
+INSERT INTO conversation_settings (user_id, peer_user_id, muted_until, pinned, archived)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, peer_user_id) DO UPDATE
+SET muted_until = EXCLUDED.muted_until,
+    pinned = EXCLUDED.pinned,
+    archived = EXCLUDED.archived,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: ClearConversationHistory :one
+INSERT INTO conversation_settings (user_id, peer_user_id, cleared_before)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, peer_user_id) DO UPDATE
+SET cleared_before = NOW(),
+    updated_at = NOW()
+RETURNING *;
+
+-- name: CountPinnedConversations :one
+-- Pins left on conversations that ended (unmatch, block) don't count.
+SELECT COUNT(*) FROM conversation_settings cs
+WHERE cs.user_id = $1 AND cs.pinned AND cs.peer_user_id <> $2
+  AND EXISTS (SELECT 1 FROM likes l1 WHERE l1.liker_user_id = cs.user_id AND l1.liked_user_id = cs.peer_user_id)
+  AND EXISTS (SELECT 1 FROM likes l2 WHERE l2.liker_user_id = cs.peer_user_id AND l2.liked_user_id = cs.user_id)
+  AND NOT EXISTS (
+      SELECT 1 FROM blocks b
+      WHERE (b.blocker_user_id = cs.user_id AND b.blocked_user_id = cs.peer_user_id)
+         OR (b.blocker_user_id = cs.peer_user_id AND b.blocked_user_id = cs.user_id)
+  );
+
+-- name: DeleteChatMessageEdits :exec
+DELETE FROM chat_message_edits
+WHERE message_id = $1;
+
+-- name: GetChatMessageEdits :many
+SELECT * FROM chat_message_edits
+WHERE message_id = $1
+ORDER BY edited_at ASC, id ASC;
+
+-- name: AppendUserEvent :one
+WITH next_seq AS (
+    INSERT INTO user_event_sequences (user_id, last_seq)
+    VALUES (@user_id, 1)
+    ON CONFLICT (user_id) DO UPDATE
+    SET last_seq = user_event_sequences.last_seq + 1
+    RETURNING last_seq
+)
+INSERT INTO user_events (user_id, seq, event_type, payload)
+SELECT @user_id, last_seq, @event_type, @payload
+FROM next_seq
+RETURNING seq;
+
+-- name: GetUserEventBounds :one
+SELECT
+    COALESCE((SELECT last_seq FROM user_event_sequences s WHERE s.user_id = $1), 0)::bigint AS latest_seq,
+    COALESCE((SELECT MIN(seq) FROM user_events e WHERE e.user_id = $1), 0)::bigint AS oldest_seq;
+
+-- name: GetUserEventsAfter :many
+SELECT * FROM user_events
+WHERE user_id = $1 AND seq > $2
+ORDER BY seq ASC
+LIMIT $3;
+
+-- name: PruneUserEvents :execrows
+DELETE FROM user_events
+WHERE created_at < $1;
+
+-- name: SearchChatMessages :many
+-- Only conversations that are still matches, using the same conditions as
+-- CheckMutualLikeExists (likes both ways, no block either way).
+WITH search AS (
+    SELECT websearch_to_tsquery('simple', @query::text) AS query
+),
+current_matches AS (
+    SELECT l1.liked_user_id AS other_user_id,
+           COALESCE(cs.cleared_before, '-infinity'::timestamptz) AS cleared_before
+    FROM likes l1
+    LEFT JOIN conversation_settings cs
+        ON cs.user_id = l1.liker_user_id AND cs.peer_user_id = l1.liked_user_id
+    WHERE l1.liker_user_id = @user_id
+      AND EXISTS (SELECT 1 FROM likes l2 WHERE l2.liker_user_id = l1.liked_user_id AND l2.liked_user_id = l1.liker_user_id)
+      AND NOT EXISTS (
+          SELECT 1 FROM blocks b
+          WHERE (b.blocker_user_id = l1.liker_user_id AND b.blocked_user_id = l1.liked_user_id)
+             OR (b.blocker_user_id = l1.liked_user_id AND b.blocked_user_id = l1.liker_user_id)
+      )
+)
+SELECT
+    cm.id,
+    cm.sender_user_id,
+    cm.sent_at,
+    m.other_user_id,
+    u.name AS other_user_name,
+    u.last_name AS other_user_last_name,
+    u.media_urls AS other_user_media_urls,
+    -- The text is HTML-escaped before highlighting, so the only markup in
+    -- the snippet is the <mark> tags ts_headline adds.
+    ts_headline('simple',
+        replace(replace(replace(replace(replace(COALESCE(cm.message_text, ''),
+            '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'),
+        search.query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')::text AS snippet
+FROM search, current_matches m
+JOIN chat_messages cm
+    ON (cm.sender_user_id = @user_id AND cm.recipient_user_id = m.other_user_id)
+    OR (cm.sender_user_id = m.other_user_id AND cm.recipient_user_id = @user_id)
+JOIN users u ON u.id = m.other_user_id
+WHERE to_tsvector('simple', COALESCE(cm.message_text, '')) @@ search.query
+  AND cm.deleted_at IS NULL
+  AND cm.sent_at > m.cleared_before
+  AND cm.sent_at <= @before_sent_at::timestamptz
+  AND (cm.sent_at < @before_sent_at::timestamptz OR cm.id < @before_id::bigint)
+ORDER BY cm.sent_at DESC, cm.id DESC
+LIMIT @page_limit::int;
+
+-- name: UpsertDevicePushToken :one
+INSERT INTO device_push_tokens (user_id, platform, token, session_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (token) DO UPDATE
+SET user_id = EXCLUDED.user_id,
+    platform = EXCLUDED.platform,
+    session_id = EXCLUDED.session_id,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteDevicePushToken :execrows
+DELETE FROM device_push_tokens
+WHERE user_id = $1 AND token = $2;
+
+-- name: DeleteInvalidDevicePushToken :exec
+DELETE FROM device_push_tokens
+WHERE token = $1;
+
+-- name: DeleteSessionDevicePushTokens :exec
+DELETE FROM device_push_tokens
+WHERE user_id = $1 AND session_id = $2;
+
+-- name: DeleteUserDevicePushTokens :exec
+DELETE FROM device_push_tokens
+WHERE user_id = $1;
+
+-- name: GetUserDevicePushTokens :many
+SELECT * FROM device_push_tokens
+WHERE user_id = $1
+ORDER BY updated_at DESC
+LIMIT 10;
+
+-- name: GetNotificationPreferences :one
+SELECT * FROM notification_preferences
+WHERE user_id = $1;
+
+-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (
+    user_id, new_message, new_like, new_match, quiet_hours_start, quiet_hours_end, timezone
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+)
+ON CONFLICT (user_id) DO UPDATE
+SET new_message = EXCLUDED.new_message,
+    new_like = EXCLUDED.new_like,
+    new_match = EXCLUDED.new_match,
+    quiet_hours_start = EXCLUDED.quiet_hours_start,
+    quiet_hours_end = EXCLUDED.quiet_hours_end,
+    timezone = EXCLUDED.timezone,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: EnqueuePushNotification :exec
+INSERT INTO push_outbox (user_id, notification_type, collapse_key, title, body, data, next_attempt_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (user_id, collapse_key) WHERE status = 'pending' DO UPDATE
+SET title = EXCLUDED.title,
+    body = EXCLUDED.body,
+    data = EXCLUDED.data,
+    collapsed_count = push_outbox.collapsed_count + 1,
+    updated_at = NOW();
+
+-- name: ClaimDuePushNotifications :many
+-- Rows left in 'sending' by a crashed dispatcher become due again once
+-- their lease runs out.
+UPDATE push_outbox
+SET status = 'sending',
+    attempts = attempts + 1,
+    next_attempt_at = NOW() + make_interval(secs => @lease_seconds::int),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM push_outbox
+    WHERE status IN ('pending', 'sending')
+      AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    LIMIT @batch_size::int
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkPushNotificationsSent :exec
+UPDATE push_outbox
+SET status = 'sent', last_error = NULL, updated_at = NOW()
+WHERE id = ANY(@ids::bigint[]);
+
+-- name: MarkPushNotificationFailed :exec
+UPDATE push_outbox
+SET status = 'failed', last_error = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: RetryPushNotification :execrows
+-- Does nothing if a newer notification with the same collapse key is
+-- already pending; that one supersedes the retry.
+UPDATE push_outbox p
+SET status = 'pending', next_attempt_at = $2, last_error = $3, updated_at = NOW()
+WHERE p.id = $1
+  AND NOT EXISTS (
+      SELECT 1 FROM push_outbox o
+      WHERE o.user_id = p.user_id
+        AND o.collapse_key = p.collapse_key
+        AND o.status = 'pending'
+  );
+
+-- name: PrunePushOutbox :execrows
+DELETE FROM push_outbox
+WHERE status IN ('sent', 'failed')
+  AND created_at < $1;
+
+-- name: EnqueueOutboxEvent :exec
+INSERT INTO event_outbox (user_id, sender_user_id, event_type, payload)
+VALUES ($1, $2, $3, $4);
+
+-- name: ClaimOutboxEvents :many
+-- Events claimed by a relay that dies before publishing them become due
+-- again once their lease runs out.
+UPDATE event_outbox
+SET attempts = attempts + 1,
+    next_attempt_at = NOW() + make_interval(secs => @lease_seconds::int)
+WHERE id IN (
+    SELECT id FROM event_outbox
+    WHERE published_at IS NULL
+      AND next_attempt_at <= NOW()
+    ORDER BY id
+    LIMIT @batch_size::int
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkOutboxEventsPublished :exec
+UPDATE event_outbox
+SET published_at = NOW()
+WHERE id = ANY(@ids::bigint[]);
+
+-- name: PruneEventOutbox :execrows
+-- Unpublished events are dropped too once they are older than the event
+-- log retention; clients that missed them get a sync_reset.
+DELETE FROM event_outbox
+WHERE (published_at IS NOT NULL AND published_at < @published_before)
+   OR created_at < @created_before;
+
+-- name: SyncUserPresence :exec
+-- Writes presence tracked in Redis back to users. last_online never moves
+-- backwards, since app opens also set it.
+UPDATE users u
+SET is_online = p.is_online,
+    last_online = GREATEST(u.last_online, p.last_online)
+FROM (
+    SELECT
+        unnest(@user_ids::int[]) AS user_id,
+        unnest(@last_onlines::timestamptz[]) AS last_online,
+        unnest(@online_flags::bool[]) AS is_online
+) p
+WHERE u.id = p.user_id;
+
+-- name: GetTravelLocation :one
+SELECT * FROM user_travel_locations
+WHERE user_id = $1;
+
+-- name: GetActiveTravelLocation :one
+-- The user's travel location if it and their travel_mode subscription are
+-- both unexpired.
+SELECT tl.* FROM user_travel_locations tl
+WHERE tl.user_id = $1
+  AND tl.expires_at > NOW()
+  AND EXISTS (
+      SELECT 1 FROM user_subscriptions s
+      WHERE s.user_id = tl.user_id AND s.feature_type = 'travel_mode' AND s.expires_at > NOW()
+  );
+
+-- name: UpsertTravelLocation :one
+INSERT INTO user_travel_locations (user_id, latitude, longitude, city, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET latitude = EXCLUDED.latitude,
+    longitude = EXCLUDED.longitude,
+    city = EXCLUDED.city,
+    expires_at = EXCLUDED.expires_at,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteTravelLocation :exec
+DELETE FROM user_travel_locations
+WHERE user_id = $1;
+
+-- name: RecordPurchase :one
+-- Returns no row if the purchase was already recorded.
+INSERT INTO purchases (
+    user_id, platform, transaction_id, original_transaction_id, purchase_token,
+    product_id, environment, purchased_at, expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+ON CONFLICT (platform, transaction_id) DO NOTHING
+RETURNING *;
+
+-- name: GetPurchaseByTransaction :one
+SELECT * FROM purchases
+WHERE platform = $1 AND transaction_id = $2;
+
+-- name: GetSubscriptionsForStoreSubscription :many
+-- Finds the subscriptions paid for by a store subscription, identified by
+-- the App Store original transaction ID or the Play purchase token, and
+-- locks them. Bundles pay for one per feature.
+SELECT us.* FROM user_subscriptions us
+JOIN purchases p ON p.id = us.purchase_id
+WHERE p.platform = $1
+  AND (p.original_transaction_id = $2 OR p.purchase_token = $2)
+ORDER BY us.feature_type, us.expires_at DESC
+FOR UPDATE OF us;
+
+-- name: UpdateSubscriptionFromStore :one
+UPDATE user_subscriptions
+SET expires_at = $2,
+    purchase_id = COALESCE($3, purchase_id)
+WHERE id = $1
+RETURNING *;
+
+-- name: EndUserSubscription :one
+-- Returns no row if the subscription had already ended.
+UPDATE user_subscriptions
+SET expires_at = NOW()
+WHERE id = $1 AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokePurchase :one
+-- Returns no row if the purchase is unknown or was already revoked.
+UPDATE purchases
+SET revoked_at = NOW()
+WHERE platform = $1 AND transaction_id = $2 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: ClawBackUserConsumable :one
+-- Takes back up to quantity, as much as the user hasn't spent yet, and
+-- returns how much was taken.
+WITH previous AS (
+    SELECT quantity FROM user_consumables
+    WHERE user_id = $1 AND consumable_type = $2
+    FOR UPDATE
+)
+UPDATE user_consumables uc
+SET quantity = GREATEST(uc.quantity - $3, 0),
+    updated_at = NOW()
+FROM previous
+WHERE uc.user_id = $1 AND uc.consumable_type = $2
+RETURNING (previous.quantity - uc.quantity)::int AS clawed_back;
+
+-- name: RecordEntitlementEvent :exec
+INSERT INTO entitlement_history (
+    user_id, purchase_id, user_subscription_id, feature_type, event,
+    quantity, expires_at, source, notification_type
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+);
+
+-- name: GetPurchaseGrants :many
+-- What a purchase granted, to undo on refund.
+SELECT * FROM entitlement_history
+WHERE purchase_id = $1 AND event IN ('granted', 'renewed')
+ORDER BY id;
+
+-- name: RecordStoreNotification :one
+-- Returns no row if the notification was already applied.
+INSERT INTO store_notifications (platform, notification_id, notification_type)
+VALUES ($1, $2, $3)
+ON CONFLICT (platform, notification_id) DO NOTHING
+RETURNING notification_id;
+
+-- name: AdvanceStoreSubscriptionState :one
+-- Returns no row if a newer state of the subscription was already applied.
+INSERT INTO store_subscription_states (platform, subscription_key, last_signed_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (platform, subscription_key) DO UPDATE
+SET last_signed_at = EXCLUDED.last_signed_at,
+    updated_at = NOW()
+WHERE store_subscription_states.last_signed_at <= EXCLUDED.last_signed_at
+RETURNING last_signed_at;
+
+-- name: ListStoreProducts :many
+SELECT * FROM store_products
+ORDER BY sort_order, product_id;
+
+-- name: ListActiveStoreProducts :many
+SELECT * FROM store_products
+WHERE active
+ORDER BY sort_order, product_id;
+
+-- name: GetStoreProduct :one
+SELECT * FROM store_products
+WHERE product_id = $1;
+
+-- name: ListStoreProductGrants :many
+SELECT * FROM store_product_grants
+WHERE product_id = ANY(@product_ids::text[])
+ORDER BY product_id, id;
+
+-- name: CreateStoreProduct :one
+-- Returns no row if the product already exists.
+INSERT INTO store_products (product_id, display_name, description, subscription, active, sort_order)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (product_id) DO NOTHING
+RETURNING *;
+
+-- name: UpdateStoreProduct :one
+UPDATE store_products
+SET display_name = $2,
+    description = $3,
+    subscription = $4,
+    active = $5,
+    sort_order = $6,
+    updated_at = NOW()
+WHERE product_id = $1
+RETURNING *;
+
+-- name: DeleteStoreProduct :one
+DELETE FROM store_products
+WHERE product_id = $1
+RETURNING product_id;
+
+-- name: DeleteStoreProductGrants :exec
+DELETE FROM store_product_grants
+WHERE product_id = $1;
+
+-- name: AddStoreProductGrant :one
+INSERT INTO store_product_grants (product_id, feature_type, quantity, duration)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
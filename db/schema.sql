@@ -106,6 +106,17 @@ CREATE TYPE report_reason AS ENUM (
     'spam'
 );
 
+CREATE TYPE chat_message_kind AS ENUM (
+    'text',
+    'image',
+    'video',
+    'voice',
+    'gif',
+    'location',
+    'date_proposal',
+    'link_preview'
+);
+
 CREATE TABLE users (
     id SERIAL PRIMARY KEY,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
@@ -131,6 +142,7 @@ CREATE TABLE users (
     audio_prompt_question audio_prompt,
     audio_prompt_answer TEXT,
     spotlight_active_until TIMESTAMPTZ NULL,
+    -- Presence lives in Redis; these are written back from it periodically.
     last_online TIMESTAMPTZ,
     is_online BOOLEAN NOT NULL DEFAULT false
 );
@@ -230,16 +242,45 @@ CREATE TABLE likes (
 CREATE INDEX idx_likes_liked_user ON likes (liked_user_id);
 CREATE INDEX idx_likes_liker_user ON likes (liker_user_id);
 
+CREATE TYPE purchase_platform AS ENUM ('ios', 'android');
+
+-- Store purchases that have been verified and granted. The unique
+-- (platform, transaction_id) lets each purchase grant its features once,
+-- however often it is reported. Rows outlive the account so a deleted
+-- user's receipts can't be replayed on a new one.
+CREATE TABLE purchases (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    platform purchase_platform NOT NULL,
+    transaction_id TEXT NOT NULL,
+    original_transaction_id TEXT NULL, -- App Store: first purchase of a subscription
+    purchase_token TEXT NULL, -- Play
+    product_id TEXT NOT NULL,
+    environment TEXT NOT NULL,
+    purchased_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NULL,
+    revoked_at TIMESTAMPTZ NULL, -- refunded or revoked by the store
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT uq_purchases_platform_transaction UNIQUE (platform, transaction_id)
+);
+CREATE INDEX idx_purchases_user ON purchases (user_id);
+CREATE INDEX idx_purchases_original_transaction ON purchases (platform, original_transaction_id) WHERE original_transaction_id IS NOT NULL;
+CREATE INDEX idx_purchases_purchase_token ON purchases (platform, purchase_token) WHERE purchase_token IS NOT NULL;
+
 CREATE TABLE user_subscriptions (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     feature_type premium_feature_type NOT NULL,
     activated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     expires_at TIMESTAMPTZ NOT NULL,
+    -- The latest store purchase paying for it. Renewals of the same store
+    -- subscription extend this row instead of adding one.
+    purchase_id BIGINT NULL REFERENCES purchases(id) ON DELETE SET NULL,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     CHECK (feature_type IN ('unlimited_likes', 'travel_mode'))
 );
 CREATE INDEX idx_user_subscriptions_user_expires ON user_subscriptions (user_id, feature_type, expires_at);
+CREATE INDEX idx_user_subscriptions_purchase ON user_subscriptions (purchase_id);
 
 CREATE TABLE user_consumables (
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -251,6 +292,21 @@ CREATE TABLE user_consumables (
     CHECK (quantity >= 0)
 );
 
+-- Where a travel_mode subscriber is browsing from. While the row and the
+-- subscription are both unexpired, feeds use it instead of the user's own
+-- latitude/longitude, both for their feed and when others see them.
+CREATE TABLE user_travel_locations (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    city TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (latitude BETWEEN -90 AND 90),
+    CHECK (longitude BETWEEN -180 AND 180)
+);
+
 CREATE TABLE chat_messages (
     id BIGSERIAL PRIMARY KEY,
     sender_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -261,20 +317,58 @@ CREATE TABLE chat_messages (
     sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     is_read BOOLEAN NOT NULL DEFAULT false,
     reply_to_message_id BIGINT NULL REFERENCES chat_messages(id) ON DELETE SET NULL,
+    delivered_at TIMESTAMPTZ NULL, -- set when a recipient device acknowledges the message
+    edited_at TIMESTAMPTZ NULL,
+    deleted_at TIMESTAMPTZ NULL,
+    kind chat_message_kind NOT NULL DEFAULT 'text',
+    payload JSONB NULL, -- kind-specific metadata, validated by the chat service
     CONSTRAINT chk_sender_recipient_different CHECK (sender_user_id <> recipient_user_id),
     CONSTRAINT chk_message_content CHECK (
     (
-      message_text IS NOT NULL
+      deleted_at IS NULL
+      AND kind = 'text'
+      AND message_text IS NOT NULL
       AND media_url IS NULL
       AND media_type IS NULL
+      AND payload IS NULL
       AND char_length(message_text) BETWEEN 1 AND 500
     )
     OR
     (
-      message_text IS NULL
+      deleted_at IS NULL
+      AND kind IN ('image', 'video', 'voice', 'gif')
+      AND message_text IS NULL
       AND media_url IS NOT NULL
       AND media_type IS NOT NULL
     )
+    OR
+    (
+      deleted_at IS NULL
+      AND kind IN ('location', 'date_proposal')
+      AND message_text IS NULL
+      AND media_url IS NULL
+      AND media_type IS NULL
+      AND payload IS NOT NULL
+    )
+    OR
+    (
+      deleted_at IS NULL
+      AND kind = 'link_preview'
+      AND message_text IS NOT NULL
+      AND media_url IS NULL
+      AND media_type IS NULL
+      AND payload IS NOT NULL
+      AND char_length(message_text) BETWEEN 1 AND 500
+    )
+    OR
+    (
+      -- Unsent messages keep their row as a tombstone so replies still resolve.
+      deleted_at IS NOT NULL
+      AND message_text IS NULL
+      AND media_url IS NULL
+      AND media_type IS NULL
+      AND payload IS NULL
+    )
   )
 );
 
@@ -313,6 +407,19 @@ BEFORE UPDATE ON message_reactions
 FOR EACH ROW
 EXECUTE FUNCTION update_updated_at_column();
 
+-- One row per spotlight a user activated. expiry_notified_at is set once
+-- the spotlight_expired event has been queued.
+CREATE TABLE spotlight_activations (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    activated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    expiry_notified_at TIMESTAMPTZ NULL,
+    CHECK (expires_at > activated_at)
+);
+CREATE INDEX idx_spotlight_activations_user ON spotlight_activations (user_id, activated_at DESC);
+CREATE INDEX idx_spotlight_activations_unnotified ON spotlight_activations (expires_at) WHERE expiry_notified_at IS NULL;
+
 CREATE TABLE user_profile_impressions (
     impression_id BIGSERIAL PRIMARY KEY,
     viewer_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -349,3 +456,339 @@ CREATE TABLE photo_view_durations (
 );
 
 CREATE INDEX idx_photo_view_durations_viewed_photo_time ON photo_view_durations (viewed_user_id, photo_index, view_timestamp DESC);
+
+CREATE TABLE refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    family_id TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ,
+    replaced_by_id BIGINT REFERENCES refresh_tokens(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+-- Sessions are keyed by the access token's sid (refresh token family) or,
+-- for tokens without one, its jti.
+CREATE TABLE revoked_sessions (
+    session_id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_revoked_sessions_expires_at ON revoked_sessions (expires_at);
+
+-- Any token issued before revoked_before is rejected ("log out everywhere").
+CREATE TABLE user_session_cutoffs (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    revoked_before TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Single row: when the first server issuing expiring access tokens started.
+-- Tokens from before then stay valid for LEGACY_TOKEN_GRACE_PERIOD after it,
+-- however often the servers restart.
+CREATE TABLE legacy_token_grace (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT uq_user_identities_provider_subject UNIQUE (provider, subject)
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+
+-- Audit trail of admin impersonation tokens. No foreign keys so the trail
+-- outlives deleted accounts.
+CREATE TABLE impersonation_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    admin_user_id INTEGER NOT NULL,
+    target_user_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    token_id TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_impersonation_audit_log_admin ON impersonation_audit_log (admin_user_id, created_at DESC);
+CREATE INDEX idx_impersonation_audit_log_target ON impersonation_audit_log (target_user_id, created_at DESC);
+
+-- Accounts scheduled for deletion. Signing in before purge_after cancels the
+-- request; afterwards the purge job deletes the user row and its S3 objects.
+CREATE TABLE account_deletions (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    purge_after TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_account_deletions_purge_after ON account_deletions (purge_after);
+
+-- Blocks hide two users from each other everywhere (feeds, likes, matches,
+-- chat, presence) without touching their likes, so unblocking restores the
+-- previous state.
+CREATE TABLE blocks (
+    blocker_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_user_id, blocked_user_id),
+    CONSTRAINT chk_blocker_blocked_different CHECK (blocker_user_id <> blocked_user_id)
+);
+CREATE INDEX idx_blocks_blocked_user_id ON blocks (blocked_user_id);
+
+CREATE TYPE moderation_action_type AS ENUM (
+    'dismiss',
+    'warn',
+    'suspend',
+    'ban',
+    'lift'
+);
+
+-- Audit log of every admin moderation decision; user_sanctions holds the
+-- resulting state. No foreign keys, as in impersonation_audit_log, so a
+-- banned user deleting their account does not erase why they were banned.
+CREATE TABLE moderation_actions (
+    id BIGSERIAL PRIMARY KEY,
+    admin_user_id INTEGER NOT NULL,
+    target_user_id INTEGER NOT NULL,
+    action moderation_action_type NOT NULL,
+    reason TEXT NOT NULL,
+    suspended_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_moderation_actions_target ON moderation_actions (target_user_id, created_at DESC);
+CREATE INDEX idx_moderation_actions_admin ON moderation_actions (admin_user_id, created_at DESC);
+
+-- A report leaves the moderation queue once an action resolves it.
+CREATE TABLE report_resolutions (
+    report_id BIGINT PRIMARY KEY REFERENCES reports(id) ON DELETE CASCADE,
+    action_id BIGINT NOT NULL REFERENCES moderation_actions(id),
+    resolved_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Current suspension or ban. expires_at is NULL for bans.
+CREATE TABLE user_sanctions (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    action_id BIGINT NOT NULL REFERENCES moderation_actions(id),
+    is_ban BOOLEAN NOT NULL,
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Output of the automatic risk rules (pkg/risk). auto_hidden keeps a user out
+-- of the feeds until an admin reviews them.
+CREATE TABLE user_risk_scores (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    reasons TEXT[] NOT NULL DEFAULT '{}',
+    auto_hidden BOOLEAN NOT NULL DEFAULT false,
+    evaluated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    reviewed_at TIMESTAMPTZ
+);
+CREATE INDEX idx_user_risk_scores_auto_hidden ON user_risk_scores (score DESC) WHERE auto_hidden;
+
+-- Text a chat message had before each edit. Cleared when the message is unsent.
+CREATE TABLE chat_message_edits (
+    id BIGSERIAL PRIMARY KEY,
+    message_id BIGINT NOT NULL REFERENCES chat_messages(id) ON DELETE CASCADE,
+    previous_text TEXT NOT NULL,
+    edited_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_chat_message_edits_message ON chat_message_edits (message_id, edited_at);
+
+-- One user's view of a conversation. Rows are only created once the user
+-- changes something; a missing row means the defaults below.
+CREATE TABLE conversation_settings (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    peer_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    muted_until TIMESTAMPTZ NULL, -- 'infinity' mutes until turned off
+    pinned BOOLEAN NOT NULL DEFAULT false,
+    archived BOOLEAN NOT NULL DEFAULT false,
+    cleared_before TIMESTAMPTZ NULL, -- messages sent up to here are hidden from user_id
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, peer_user_id),
+    CONSTRAINT chk_conversation_settings_peer CHECK (user_id <> peer_user_id),
+    CONSTRAINT chk_conversation_settings_pin_archive CHECK (NOT (pinned AND archived))
+);
+
+-- Durable per-user log of WebSocket events (messages, reactions, reads,
+-- likes, matches...) so reconnecting clients can replay what they missed.
+-- seq is allocated from user_event_sequences and increases per user.
+CREATE TABLE user_event_sequences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_seq BIGINT NOT NULL
+);
+
+CREATE TABLE user_events (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, seq)
+);
+
+CREATE INDEX idx_user_events_created_at ON user_events (created_at);
+
+-- Full-text search over chat (GET /api/chat/search). 'simple' avoids
+-- language-specific stemming since conversations are in many languages.
+CREATE INDEX idx_chat_messages_search ON chat_messages USING GIN (to_tsvector('simple', COALESCE(message_text, '')));
+
+-- Push notifications for users with no open WebSocket connection.
+CREATE TYPE push_platform AS ENUM ('ios', 'android');
+
+CREATE TYPE notification_type AS ENUM ('new_message', 'new_like', 'new_match');
+
+CREATE TYPE push_status AS ENUM ('pending', 'sending', 'sent', 'failed');
+
+CREATE TABLE device_push_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform push_platform NOT NULL,
+    token TEXT NOT NULL UNIQUE, -- a token moves to whoever registered it last
+    session_id TEXT NULL, -- removed when this session logs out
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_device_push_tokens_user ON device_push_tokens (user_id);
+
+CREATE TABLE notification_preferences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    new_message BOOLEAN NOT NULL DEFAULT true,
+    new_like BOOLEAN NOT NULL DEFAULT true,
+    new_match BOOLEAN NOT NULL DEFAULT true,
+    quiet_hours_start SMALLINT NULL, -- minutes after local midnight
+    quiet_hours_end SMALLINT NULL,
+    timezone TEXT NOT NULL DEFAULT 'UTC', -- IANA name, for quiet hours
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT chk_quiet_hours CHECK (
+        (quiet_hours_start IS NULL) = (quiet_hours_end IS NULL)
+        AND quiet_hours_start BETWEEN 0 AND 1439
+        AND quiet_hours_end BETWEEN 0 AND 1439
+    )
+);
+
+-- Notifications waiting to be pushed. A new notification with the same
+-- collapse_key as a pending one is merged into it, so a burst of messages
+-- from one sender becomes a single push. Rows are claimed by moving them to
+-- 'sending' with next_attempt_at as a lease, and retried with backoff.
+CREATE TABLE push_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    notification_type notification_type NOT NULL,
+    collapse_key TEXT NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}'::jsonb,
+    collapsed_count INTEGER NOT NULL DEFAULT 1,
+    status push_status NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX uq_push_outbox_pending_collapse ON push_outbox (user_id, collapse_key) WHERE status = 'pending';
+CREATE INDEX idx_push_outbox_due ON push_outbox (next_attempt_at) WHERE status IN ('pending', 'sending');
+CREATE INDEX idx_push_outbox_created_at ON push_outbox (created_at);
+
+-- Transactional outbox for WebSocket events. Events are written in the same
+-- transaction as the change they describe and published to Redis by the
+-- event relay at least once; clients drop repeats by event_id.
+CREATE TABLE event_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sender_user_id INTEGER NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_event_outbox_unpublished ON event_outbox (next_attempt_at, id) WHERE published_at IS NULL;
+CREATE INDEX idx_event_outbox_created_at ON event_outbox (created_at);
+
+CREATE TYPE entitlement_event AS ENUM ('granted', 'renewed', 'expired', 'refunded');
+
+-- Every change to what a user has paid for: grants from verified purchases,
+-- and renewals, expiries and refunds reported by the stores. A refund undoes
+-- the purchase's 'granted' and 'renewed' rows.
+CREATE TABLE entitlement_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    purchase_id BIGINT NULL REFERENCES purchases(id) ON DELETE SET NULL,
+    user_subscription_id INTEGER NULL REFERENCES user_subscriptions(id) ON DELETE SET NULL,
+    feature_type premium_feature_type NOT NULL,
+    event entitlement_event NOT NULL,
+    quantity INTEGER NULL, -- consumables: change to the balance
+    expires_at TIMESTAMPTZ NULL, -- subscriptions: expiry after the change
+    source TEXT NOT NULL, -- 'app', 'appstore' or 'play'
+    notification_type TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_entitlement_history_user ON entitlement_history (user_id, created_at DESC);
+CREATE INDEX idx_entitlement_history_purchase ON entitlement_history (purchase_id);
+
+-- Store notifications already applied. Both stores redeliver until they
+-- get a 2xx, so each is applied once.
+CREATE TABLE store_notifications (
+    platform purchase_platform NOT NULL,
+    notification_id TEXT NOT NULL,
+    notification_type TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (platform, notification_id)
+);
+
+-- When the store state last applied to each store subscription (App Store
+-- original transaction ID or Play purchase token) was produced, so that a
+-- late notification can't roll its expiry back.
+CREATE TABLE store_subscription_states (
+    platform purchase_platform NOT NULL,
+    subscription_key TEXT NOT NULL,
+    last_signed_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (platform, subscription_key)
+);
+
+-- The store catalog: what buying each App Store and Play product grants.
+-- subscription records how the stores sell it: as an auto-renewing
+-- subscription, or as a one-time purchase, which may still grant a
+-- subscription feature for its duration. A product with several grants is
+-- a bundle. It starts empty: add
+-- each product set up in App Store Connect and the Play Console through
+-- POST /api/admin/store/products, under the same product ID.
+CREATE TABLE store_products (
+    product_id TEXT PRIMARY KEY,
+    display_name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    subscription BOOLEAN NOT NULL DEFAULT false,
+    active BOOLEAN NOT NULL DEFAULT true, -- listed in the app's store
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE store_product_grants (
+    id SERIAL PRIMARY KEY,
+    product_id TEXT NOT NULL REFERENCES store_products(product_id) ON DELETE CASCADE,
+    feature_type premium_feature_type NOT NULL,
+    quantity INTEGER NULL, -- consumables
+    duration TEXT NULL, -- subscriptions: ISO-8601, e.g. P7D or P1M
+    CONSTRAINT uq_store_product_grants_feature UNIQUE (product_id, feature_type),
+    CHECK (
+        (feature_type IN ('rose', 'spotlight') AND quantity > 0 AND duration IS NULL)
+        OR (feature_type IN ('unlimited_likes', 'travel_mode') AND duration IS NOT NULL AND quantity IS NULL)
+    )
+);
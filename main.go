@@ -10,10 +10,16 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/arnnvv/peeple-api/pkg/account"
 	"github.com/arnnvv/peeple-api/pkg/db"
 	"github.com/arnnvv/peeple-api/pkg/handlers"
+	"github.com/arnnvv/peeple-api/pkg/iap"
+	"github.com/arnnvv/peeple-api/pkg/identity"
 	"github.com/arnnvv/peeple-api/pkg/pbsb"
+	"github.com/arnnvv/peeple-api/pkg/push"
 	"github.com/arnnvv/peeple-api/pkg/ratelimit"
+	"github.com/arnnvv/peeple-api/pkg/risk"
+	"github.com/arnnvv/peeple-api/pkg/spotlight"
 	"github.com/arnnvv/peeple-api/pkg/token"
 	"github.com/arnnvv/peeple-api/pkg/ws"
 	"github.com/go-redis/redis_rate/v10"
@@ -87,15 +93,52 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to get DB queries for Hub: %v", err)
 	}
+	if err := token.StartLegacyGrace(context.Background(), queries); err != nil {
+		log.Printf("WARNING: %v; legacy token grace period runs from this start", err)
+	}
 	hub := ws.NewHub(queries, redisClient, rateLimiter)
 	go hub.Run()
 
+	pushProviders, err := push.NewProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure push providers: %v", err)
+	}
+	var pushDispatcher *push.Dispatcher
+	if len(pushProviders) > 0 {
+		pushDispatcher = push.NewDispatcher(queries, pushProviders)
+		hub.SetPushDispatcher(pushDispatcher)
+	} else {
+		log.Println("Push notifications disabled: no provider configured.")
+	}
+
+	verifiers, err := iap.NewVerifiersFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure receipt verification: %v", err)
+	}
+	if len(verifiers) == 0 {
+		log.Println("In-app purchases disabled: no receipt verifier configured.")
+	}
+	storeNotifications := iap.NewNotificationsFromEnv(verifiers)
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	go account.NewPurgerFromEnv(queries).Run(jobsCtx)
+	go risk.RunScheduler(jobsCtx, queries)
+	go ws.RunEventLogPruner(jobsCtx, queries)
+	if pool, err := db.GetPool(); err != nil {
+		log.Printf("WARNING: Spotlight expiry job disabled: %v", err)
+	} else {
+		go spotlight.RunExpiryNotifier(jobsCtx, pool, queries, hub)
+	}
+	if pushDispatcher != nil {
+		go pushDispatcher.Run(jobsCtx)
+	}
+
 	server := &http.Server{
 		Addr:              ":" + cfg.Port,
 		ReadHeaderTimeout: cfg.ServerTimeout.ReadHeader,
 		WriteTimeout:      cfg.ServerTimeout.Write,
 		IdleTimeout:       cfg.ServerTimeout.Idle,
-		Handler:           setupRoutes(hub, rateLimiter),
+		Handler:           setupRoutes(hub, rateLimiter, verifiers, storeNotifications),
 	}
 
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
@@ -108,6 +151,7 @@ func main() {
 		log.Println("Stopping Hub...")
 		hub.Stop()
 		log.Println("Hub stopped.")
+		stopJobs()
 		shutdownCtx, cancel := context.WithTimeout(serverCtx, 30*time.Second)
 		defer cancel()
 		go func() {
@@ -131,7 +175,7 @@ func main() {
 	log.Println("Server stopped")
 }
 
-func setupRoutes(hub *ws.Hub, limiter *redis_rate.Limiter) http.Handler {
+func setupRoutes(hub *ws.Hub, limiter *redis_rate.Limiter, verifiers iap.Verifiers, storeNotifications iap.Notifications) http.Handler {
 	mux := http.NewServeMux()
 
 	authMiddlewareFunc := token.AuthMiddleware
@@ -160,13 +204,30 @@ func setupRoutes(hub *ws.Hub, limiter *redis_rate.Limiter) http.Handler {
 	adaptFeedRateLimit := adapt(feedRateLimitMW)
 	adaptUploadRateLimit := adapt(uploadRateLimitMW)
 
+	identityProviders := identity.NewRegistryFromEnv()
+
 	actualChatHandler := handlers.ChatHandler(hub)
 	mux.HandleFunc("/chat", authMiddlewareFunc(actualChatHandler))
 
 	mux.HandleFunc("/api/auth/google/verify", handlers.GoogleAuthHandler)
-	mux.HandleFunc("/token", token.GenerateTokenHandler)
+	mux.HandleFunc("/api/auth/signin", apply(handlers.IdentitySignInHandler(identityProviders), adaptEditRateLimit))
+	mux.HandleFunc("/api/auth/refresh", apply(handlers.RefreshTokenHandler, adaptEditRateLimit))
+	if getEnv("APP_ENV", "production") == "development" {
+		log.Println("WARNING: APP_ENV=development, unauthenticated /token dev login is enabled.")
+		mux.HandleFunc("/token", token.GenerateTokenHandler)
+	}
+	mux.HandleFunc("/.well-known/jwks.json", token.JWKSHandler)
+	// Store webhooks authenticate with the stores' signatures, not user tokens.
+	mux.HandleFunc("/api/iap/notifications/appstore", handlers.AppStoreNotificationHandler(storeNotifications.AppStore))
+	mux.HandleFunc("/api/iap/notifications/play", handlers.PlayNotificationHandler(storeNotifications.Play))
 	mux.HandleFunc("/test", handlers.TestHandler)
 
+	mux.HandleFunc("/api/auth/logout", apply(handlers.LogoutHandler(hub), adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/auth/logout-all", apply(handlers.LogoutAllHandler(hub), adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/auth/identities", apply(handlers.GetLinkedIdentitiesHandler, adaptGeneralRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/auth/identities/link", apply(handlers.LinkIdentityHandler(identityProviders), adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/account", apply(handlers.DeleteAccountHandler(hub), adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/account/export", apply(handlers.ExportAccountDataHandler, adaptEditRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/auth-status", apply(handlers.CheckAuthStatus, adaptGeneralRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/profile", apply(handlers.CreateProfile, adaptEditRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/profile/location-gender", apply(handlers.UpdateLocationGenderHandler, adaptEditRateLimit, authMiddlewareFunc))
@@ -181,24 +242,40 @@ func setupRoutes(hub *ws.Hub, limiter *redis_rate.Limiter) http.Handler {
 	mux.HandleFunc("/api/app-opened", apply(handlers.LogAppOpenHandler, adaptGeneralRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/homefeed", apply(handlers.GetHomeFeedHandler, adaptFeedRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/quickfeed", apply(handlers.GetQuickFeedHandler, adaptFeedRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/travel-location", apply(handlers.TravelLocationHandler, adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/blocks", apply(handlers.BlocksHandler(hub), adaptEditRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/report", apply(handlers.ReportHandler, adaptEditRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/likes/received", apply(handlers.GetWhoLikedYouHandler, adaptFeedRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/likes/seen-until", apply(handlers.MarkLikesSeenUntilHandler, adaptEditRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/liker-profile/", apply(handlers.GetLikerProfileHandler, adaptFeedRateLimit, authMiddlewareFunc))
-	mux.HandleFunc("/api/matches", apply(handlers.GetMatchesHandler, adaptFeedRateLimit, authMiddlewareFunc))
-	mux.HandleFunc("/api/iap/verify", apply(handlers.VerifyPurchaseHandler, adaptEditRateLimit, authMiddlewareFunc))
-	mux.HandleFunc("/api/conversation", apply(handlers.GetConversationHandler, adaptFeedRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/matches", apply(handlers.GetMatchesHandler(hub), adaptFeedRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/push/tokens", apply(handlers.PushTokensHandler, adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/push/preferences", apply(handlers.NotificationPreferencesHandler, adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/iap/verify", apply(handlers.VerifyPurchaseHandler(verifiers), adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/store/products", apply(handlers.GetStoreProductsHandler, adaptGeneralRateLimit))
+	mux.HandleFunc("/api/conversation", apply(handlers.GetConversationHandler(hub), adaptFeedRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/conversation/settings", apply(handlers.ConversationSettingsHandler(hub), adaptEditRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/chat/search", apply(handlers.ChatSearchHandler, adaptFeedRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/chat/message/edits", apply(handlers.GetMessageEditHistoryHandler, adaptFeedRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/chat/upload", apply(handlers.GenerateChatMediaPresignedURL, adaptUploadRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/unread-chat-count", apply(handlers.GetUnreadCountHandler, adaptFeedRateLimit, authMiddlewareFunc))
-	mux.HandleFunc("/api/user/last-online", apply(handlers.FetchLastOnlineHandler, adaptFeedRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/user/last-online", apply(handlers.FetchLastOnlineHandler(hub), adaptFeedRateLimit, authMiddlewareFunc))
 
 	mux.HandleFunc("/api/set-admin", apply(handlers.SetAdminHandler, adaptGeneralRateLimit, adminAuthMiddlewareFunc))
 	mux.HandleFunc("/api/admin/verifications", apply(handlers.GetPendingVerificationsHandler, adaptGeneralRateLimit, adminAuthMiddlewareFunc))
 	mux.HandleFunc("/api/admin/verify", apply(handlers.UpdateVerificationStatusHandler, adaptGeneralRateLimit, adminAuthMiddlewareFunc))
+	mux.HandleFunc("/api/admin/reports", apply(handlers.GetReportQueueHandler, adaptGeneralRateLimit, adminAuthMiddlewareFunc))
+	mux.HandleFunc("/api/admin/reports/", apply(handlers.GetReportDetailHandler, adaptGeneralRateLimit, adminAuthMiddlewareFunc))
+	mux.HandleFunc("/api/admin/store/products", apply(handlers.AdminStoreProductsHandler, adaptGeneralRateLimit, adminAuthMiddlewareFunc))
+	mux.HandleFunc("/api/admin/store/products/", apply(handlers.AdminStoreProductHandler, adaptGeneralRateLimit, adminAuthMiddlewareFunc))
+	mux.HandleFunc("/api/admin/risk/hidden", apply(handlers.GetAutoHiddenUsersHandler, adaptGeneralRateLimit, adminAuthMiddlewareFunc))
+	mux.HandleFunc("/api/admin/moderation/action", apply(handlers.ModerationActionHandler(hub), adaptGeneralRateLimit, adminAuthMiddlewareFunc))
+	mux.HandleFunc("/api/admin/impersonate", apply(handlers.ImpersonateUserHandler, adaptEditRateLimit, adminAuthMiddlewareFunc))
 
 	mux.HandleFunc("/", apply(handlers.ProtectedHandler, adaptGeneralRateLimit, authMiddlewareFunc))
 
 	mux.HandleFunc("/api/analytics/summary", apply(handlers.GetAnalyticsSummaryHandler, adaptGeneralRateLimit, authMiddlewareFunc))
+	mux.HandleFunc("/api/spotlight/activate", apply(handlers.ActivateSpotlightHandler, adaptEditRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/analytics/spotlight", apply(handlers.GetSpotlightAnalyticsHandler, adaptGeneralRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/analytics/log-like-profile-view", apply(handlers.LogLikeProfileViewHandler, adaptGeneralRateLimit, authMiddlewareFunc))
 	mux.HandleFunc("/api/analytics/log-photo-views", apply(handlers.LogPhotoViewsHandler, adaptGeneralRateLimit, authMiddlewareFunc))
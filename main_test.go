@@ -17,9 +17,11 @@ import (
 	"github.com/arnnvv/peeple-api/migrations"
 	"github.com/arnnvv/peeple-api/pkg/db"
 	"github.com/arnnvv/peeple-api/pkg/handlers"
-
+	"github.com/arnnvv/peeple-api/pkg/iap"
+	"github.com/arnnvv/peeple-api/pkg/pbsb"
 	"github.com/arnnvv/peeple-api/pkg/token"
 	"github.com/arnnvv/peeple-api/pkg/ws"
+	"github.com/go-redis/redis_rate/v10"
 
 	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -65,6 +67,7 @@ func TestMain(m *testing.M) {
 		log.Fatal("FATAL: JWT_SECRET environment variable not set.")
 	}
 	os.Setenv("PORT", testPort)
+	os.Setenv("APP_ENV", "development") // mounts the /token dev login used below
 
 	err = setupTestDatabase(testDbURL)
 	if err != nil {
@@ -101,10 +104,15 @@ func TestMain(m *testing.M) {
 		if dbErr != nil || queries == nil {
 			log.Fatalf("FATAL: Could not get DB queries for test server Hub: %v", dbErr)
 		}
-		hub := ws.NewHub(queries)
+		redisClient, redisErr := pbsb.NewRedisClient()
+		if redisErr != nil {
+			log.Fatalf("FATAL: Could not connect to Redis for test server Hub: %v", redisErr)
+		}
+		limiter := redis_rate.NewLimiter(redisClient)
+		hub := ws.NewHub(queries, redisClient, limiter)
 		go hub.Run()
 
-		mux := setupRoutes(hub)
+		mux := setupRoutes(hub, limiter, iap.Verifiers{}, iap.Notifications{})
 		server := &http.Server{
 			Addr:    ":" + testPort,
 			Handler: mux,
@@ -578,7 +586,7 @@ func TestLikesMatchesEndpoints(t *testing.T) {
 	})
 
 	t.Run("LikeContent_User13_Likes_User18_Photo0", func(t *testing.T) {
-		payload := handlers.ContentLikeRequest{
+		payload := ws.ContentLikeRequest{
 			LikedUserID:       testUserID18,
 			ContentType:       string(migrations.ContentLikeTypeMedia),
 			ContentIdentifier: "0",
@@ -613,7 +621,13 @@ func TestLikesMatchesEndpoints(t *testing.T) {
 
 	t.Run("MarkLikesSeen_User18", func(t *testing.T) {
 		queries, _ := db.GetDB()
-		likes, err := queries.GetLikersForUser(context.Background(), testUserID18)
+		likes, err := queries.GetLikersForUser(context.Background(), migrations.GetLikersForUserParams{
+			LikedUserID:    testUserID18,
+			AfterRank:      -1,
+			AfterCreatedAt: pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true},
+			AfterID:        1<<31 - 1,
+			PageLimit:      100,
+		})
 		require.NoError(t, err)
 		var likeID int32 = 0
 		for _, l := range likes {
@@ -644,7 +658,7 @@ func TestLikesMatchesEndpoints(t *testing.T) {
 	})
 
 	t.Run("LikeContent_User18_LikesBack_User13_Profile", func(t *testing.T) {
-		payload := handlers.ContentLikeRequest{
+		payload := ws.ContentLikeRequest{
 			LikedUserID:       testUserID13,
 			ContentType:       string(migrations.ContentLikeTypeProfile),
 			ContentIdentifier: "profile",
@@ -681,7 +695,7 @@ func TestLikesMatchesEndpoints(t *testing.T) {
 	})
 
 	t.Run("Dislike_User17_Dislikes_User13", func(t *testing.T) {
-		payload := handlers.DislikeRequest{DislikedUserID: testUserID13}
+		payload := ws.DislikeRequest{DislikedUserID: testUserID13}
 		jsonBody, _ := json.Marshal(payload)
 		req := makeRequest(t, "POST", "/api/dislike", &testUser17Token, bytes.NewBuffer(jsonBody))
 		resp := executeRequest(t, req)
@@ -699,7 +713,7 @@ func TestLikesMatchesEndpoints(t *testing.T) {
 	})
 
 	t.Run("Unmatch_User13_Unmatches_User12", func(t *testing.T) {
-		payload := handlers.UnmatchRequest{TargetUserID: testUserID12}
+		payload := ws.UnmatchRequest{TargetUserID: testUserID12}
 		jsonBody, _ := json.Marshal(payload)
 		req := makeRequest(t, "POST", "/api/unmatch", &testUser13Token, bytes.NewBuffer(jsonBody))
 		resp := executeRequest(t, req)
@@ -746,7 +760,7 @@ func TestChatAndRelatedEndpoints(t *testing.T) {
 
 		ackMsg := assertWsMessageType(t, conn13, "message_ack", wsReadWait)
 		require.NotNil(t, ackMsg.ID, "ACK should have message ID")
-		assert.Equal(t, "Message delivered.", *ackMsg.Content)
+		assert.Equal(t, "Message sent.", *ackMsg.Content)
 		savedMsgID := *ackMsg.ID
 
 		receivedMsg := assertWsMessageType(t, conn12, "chat_message", wsReadWait)
@@ -903,6 +917,46 @@ func TestChatAndRelatedEndpoints(t *testing.T) {
 		assert.NotNil(t, onlineResp.LastOnline, "LastOnline should not be nil even if online")
 	})
 
+	t.Run("WebSocket_DateProposal_OnlyRecipientRespondsOnce", func(t *testing.T) {
+		proposedAt := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+		err := writeWsMessage(t, conn13, ws.WsMessage{
+			Type:            "chat_message",
+			RecipientUserID: PtrInt32(testUserID12),
+			Kind:            ws.Ptr("date_proposal"),
+			Payload:         json.RawMessage(fmt.Sprintf(`{"proposed_at":%q,"place_name":"Blue Tokai"}`, proposedAt)),
+		})
+		require.NoError(t, err)
+		ackMsg := assertWsMessageType(t, conn13, "message_ack", wsReadWait)
+		require.NotNil(t, ackMsg.ID)
+		proposalID := *ackMsg.ID
+		receivedMsg := assertWsMessageType(t, conn12, "chat_message", wsReadWait)
+		require.NotNil(t, receivedMsg.Kind)
+		assert.Equal(t, "date_proposal", *receivedMsg.Kind)
+		assert.Equal(t, ws.DateProposalPending, proposalStatus(t, receivedMsg))
+
+		respond := func(conn *websocket.Conn, status string) {
+			err := writeWsMessage(t, conn, ws.WsMessage{Type: "respond_date_proposal", MessageID: ws.PtrInt64(proposalID), Status: ws.Ptr(status)})
+			require.NoError(t, err)
+		}
+
+		// The proposer cannot answer their own proposal.
+		respond(conn13, ws.DateProposalAccepted)
+		errMsg := assertWsMessageType(t, conn13, "error", wsReadWait)
+		assert.Contains(t, *errMsg.Content, "no pending date proposal")
+
+		respond(conn12, ws.DateProposalAccepted)
+		answered := assertWsMessageType(t, conn12, "date_proposal_ack", wsReadWait)
+		assert.Equal(t, ws.DateProposalAccepted, proposalStatus(t, answered))
+		updated := assertWsMessageType(t, conn13, "date_proposal_updated", wsReadWait)
+		require.NotNil(t, updated.MessageID)
+		assert.Equal(t, proposalID, *updated.MessageID)
+		assert.Equal(t, ws.DateProposalAccepted, proposalStatus(t, updated))
+
+		// An answered proposal cannot be changed.
+		respond(conn12, ws.DateProposalDeclined)
+		errMsg = assertWsMessageType(t, conn12, "error", wsReadWait)
+		assert.Contains(t, *errMsg.Content, "no pending date proposal")
+	})
 }
 
 func TestAdminEndpoints(t *testing.T) {
@@ -1074,6 +1128,14 @@ func TestMiscEndpoints(t *testing.T) {
 
 }
 
+// proposalStatus decodes the status of a date proposal event's payload.
+func proposalStatus(t *testing.T, msg ws.WsMessage) string {
+	t.Helper()
+	var p ws.DateProposalPayload
+	require.NoError(t, json.Unmarshal(msg.Payload, &p), "date proposal payload")
+	return p.Status
+}
+
 func PtrInt32(i int32) *int32 {
 	return &i
 }
@@ -87,6 +87,54 @@ func (ns NullAudioPrompt) Value() (driver.Value, error) {
 	return string(ns.AudioPrompt), nil
 }
 
+type ChatMessageKind string
+
+const (
+	ChatMessageKindText         ChatMessageKind = "text"
+	ChatMessageKindImage        ChatMessageKind = "image"
+	ChatMessageKindVideo        ChatMessageKind = "video"
+	ChatMessageKindVoice        ChatMessageKind = "voice"
+	ChatMessageKindGif          ChatMessageKind = "gif"
+	ChatMessageKindLocation     ChatMessageKind = "location"
+	ChatMessageKindDateProposal ChatMessageKind = "date_proposal"
+	ChatMessageKindLinkPreview  ChatMessageKind = "link_preview"
+)
+
+func (e *ChatMessageKind) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = ChatMessageKind(s)
+	case string:
+		*e = ChatMessageKind(s)
+	default:
+		return fmt.Errorf("unsupported scan type for ChatMessageKind: %T", src)
+	}
+	return nil
+}
+
+type NullChatMessageKind struct {
+	ChatMessageKind ChatMessageKind
+	Valid           bool // Valid is true if ChatMessageKind is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullChatMessageKind) Scan(value interface{}) error {
+	if value == nil {
+		ns.ChatMessageKind, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.ChatMessageKind.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullChatMessageKind) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.ChatMessageKind), nil
+}
+
 type ContentLikeType string
 
 const (
@@ -268,6 +316,50 @@ func (ns NullDrinkingSmokingHabits) Value() (driver.Value, error) {
 	return string(ns.DrinkingSmokingHabits), nil
 }
 
+type EntitlementEvent string
+
+const (
+	EntitlementEventGranted  EntitlementEvent = "granted"
+	EntitlementEventRenewed  EntitlementEvent = "renewed"
+	EntitlementEventExpired  EntitlementEvent = "expired"
+	EntitlementEventRefunded EntitlementEvent = "refunded"
+)
+
+func (e *EntitlementEvent) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = EntitlementEvent(s)
+	case string:
+		*e = EntitlementEvent(s)
+	default:
+		return fmt.Errorf("unsupported scan type for EntitlementEvent: %T", src)
+	}
+	return nil
+}
+
+type NullEntitlementEvent struct {
+	EntitlementEvent EntitlementEvent
+	Valid            bool // Valid is true if EntitlementEvent is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullEntitlementEvent) Scan(value interface{}) error {
+	if value == nil {
+		ns.EntitlementEvent, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.EntitlementEvent.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullEntitlementEvent) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.EntitlementEvent), nil
+}
+
 type GenderEnum string
 
 const (
@@ -402,6 +494,51 @@ func (ns NullLikeInteractionType) Value() (driver.Value, error) {
 	return string(ns.LikeInteractionType), nil
 }
 
+type ModerationActionType string
+
+const (
+	ModerationActionTypeDismiss ModerationActionType = "dismiss"
+	ModerationActionTypeWarn    ModerationActionType = "warn"
+	ModerationActionTypeSuspend ModerationActionType = "suspend"
+	ModerationActionTypeBan     ModerationActionType = "ban"
+	ModerationActionTypeLift    ModerationActionType = "lift"
+)
+
+func (e *ModerationActionType) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = ModerationActionType(s)
+	case string:
+		*e = ModerationActionType(s)
+	default:
+		return fmt.Errorf("unsupported scan type for ModerationActionType: %T", src)
+	}
+	return nil
+}
+
+type NullModerationActionType struct {
+	ModerationActionType ModerationActionType
+	Valid                bool // Valid is true if ModerationActionType is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullModerationActionType) Scan(value interface{}) error {
+	if value == nil {
+		ns.ModerationActionType, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.ModerationActionType.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullModerationActionType) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.ModerationActionType), nil
+}
+
 type MyTypePromptType string
 
 const (
@@ -453,6 +590,49 @@ func (ns NullMyTypePromptType) Value() (driver.Value, error) {
 	return string(ns.MyTypePromptType), nil
 }
 
+type NotificationType string
+
+const (
+	NotificationTypeNewMessage NotificationType = "new_message"
+	NotificationTypeNewLike    NotificationType = "new_like"
+	NotificationTypeNewMatch   NotificationType = "new_match"
+)
+
+func (e *NotificationType) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = NotificationType(s)
+	case string:
+		*e = NotificationType(s)
+	default:
+		return fmt.Errorf("unsupported scan type for NotificationType: %T", src)
+	}
+	return nil
+}
+
+type NullNotificationType struct {
+	NotificationType NotificationType
+	Valid            bool // Valid is true if NotificationType is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullNotificationType) Scan(value interface{}) error {
+	if value == nil {
+		ns.NotificationType, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.NotificationType.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullNotificationType) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.NotificationType), nil
+}
+
 type PremiumFeatureType string
 
 const (
@@ -497,6 +677,134 @@ func (ns NullPremiumFeatureType) Value() (driver.Value, error) {
 	return string(ns.PremiumFeatureType), nil
 }
 
+type PurchasePlatform string
+
+const (
+	PurchasePlatformIos     PurchasePlatform = "ios"
+	PurchasePlatformAndroid PurchasePlatform = "android"
+)
+
+func (e *PurchasePlatform) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = PurchasePlatform(s)
+	case string:
+		*e = PurchasePlatform(s)
+	default:
+		return fmt.Errorf("unsupported scan type for PurchasePlatform: %T", src)
+	}
+	return nil
+}
+
+type NullPurchasePlatform struct {
+	PurchasePlatform PurchasePlatform
+	Valid            bool // Valid is true if PurchasePlatform is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullPurchasePlatform) Scan(value interface{}) error {
+	if value == nil {
+		ns.PurchasePlatform, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.PurchasePlatform.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullPurchasePlatform) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.PurchasePlatform), nil
+}
+
+type PushPlatform string
+
+const (
+	PushPlatformIos     PushPlatform = "ios"
+	PushPlatformAndroid PushPlatform = "android"
+)
+
+func (e *PushPlatform) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = PushPlatform(s)
+	case string:
+		*e = PushPlatform(s)
+	default:
+		return fmt.Errorf("unsupported scan type for PushPlatform: %T", src)
+	}
+	return nil
+}
+
+type NullPushPlatform struct {
+	PushPlatform PushPlatform
+	Valid        bool // Valid is true if PushPlatform is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullPushPlatform) Scan(value interface{}) error {
+	if value == nil {
+		ns.PushPlatform, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.PushPlatform.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullPushPlatform) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.PushPlatform), nil
+}
+
+type PushStatus string
+
+const (
+	PushStatusPending PushStatus = "pending"
+	PushStatusSending PushStatus = "sending"
+	PushStatusSent    PushStatus = "sent"
+	PushStatusFailed  PushStatus = "failed"
+)
+
+func (e *PushStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = PushStatus(s)
+	case string:
+		*e = PushStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for PushStatus: %T", src)
+	}
+	return nil
+}
+
+type NullPushStatus struct {
+	PushStatus PushStatus
+	Valid      bool // Valid is true if PushStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullPushStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.PushStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.PushStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullPushStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.PushStatus), nil
+}
+
 type Religion string
 
 const (
@@ -727,6 +1035,18 @@ func (ns NullVerificationStatus) Value() (driver.Value, error) {
 	return string(ns.VerificationStatus), nil
 }
 
+type AccountDeletion struct {
+	UserID      int32
+	RequestedAt pgtype.Timestamptz
+	PurgeAfter  pgtype.Timestamptz
+}
+
+type Block struct {
+	BlockerUserID int32
+	BlockedUserID int32
+	CreatedAt     pgtype.Timestamptz
+}
+
 type ChatMessage struct {
 	ID               int64
 	SenderUserID     int32
@@ -737,6 +1057,28 @@ type ChatMessage struct {
 	SentAt           pgtype.Timestamptz
 	IsRead           bool
 	ReplyToMessageID pgtype.Int8
+	DeliveredAt      pgtype.Timestamptz
+	EditedAt         pgtype.Timestamptz
+	DeletedAt        pgtype.Timestamptz
+	Kind             ChatMessageKind
+	Payload          []byte
+}
+
+type ChatMessageEdit struct {
+	ID           int64
+	MessageID    int64
+	PreviousText string
+	EditedAt     pgtype.Timestamptz
+}
+
+type ConversationSetting struct {
+	UserID        int32
+	PeerUserID    int32
+	MutedUntil    pgtype.Timestamptz
+	Pinned        bool
+	Archived      bool
+	ClearedBefore pgtype.Timestamptz
+	UpdatedAt     pgtype.Timestamptz
 }
 
 type DateVibesPrompt struct {
@@ -746,12 +1088,48 @@ type DateVibesPrompt struct {
 	Answer   string
 }
 
+type DevicePushToken struct {
+	ID        int64
+	UserID    int32
+	Platform  PushPlatform
+	Token     string
+	SessionID pgtype.Text
+	CreatedAt pgtype.Timestamptz
+	UpdatedAt pgtype.Timestamptz
+}
+
 type Dislike struct {
 	DislikerUserID int32
 	DislikedUserID int32
 	CreatedAt      pgtype.Timestamptz
 }
 
+type EntitlementHistory struct {
+	ID                 int64
+	UserID             pgtype.Int4
+	PurchaseID         pgtype.Int8
+	UserSubscriptionID pgtype.Int4
+	FeatureType        PremiumFeatureType
+	Event              EntitlementEvent
+	Quantity           pgtype.Int4
+	ExpiresAt          pgtype.Timestamptz
+	Source             string
+	NotificationType   pgtype.Text
+	CreatedAt          pgtype.Timestamptz
+}
+
+type EventOutbox struct {
+	ID            int64
+	UserID        int32
+	SenderUserID  int32
+	EventType     string
+	Payload       []byte
+	Attempts      int32
+	NextAttemptAt pgtype.Timestamptz
+	PublishedAt   pgtype.Timestamptz
+	CreatedAt     pgtype.Timestamptz
+}
+
 type Filter struct {
 	UserID          int32
 	WhoYouWantToSee NullGenderEnum
@@ -770,6 +1148,21 @@ type GettingPersonalPrompt struct {
 	Answer   string
 }
 
+type ImpersonationAuditLog struct {
+	ID           int64
+	AdminUserID  int32
+	TargetUserID int32
+	Reason       string
+	TokenID      string
+	ExpiresAt    pgtype.Timestamptz
+	CreatedAt    pgtype.Timestamptz
+}
+
+type LegacyTokenGrace struct {
+	ID        bool
+	StartedAt pgtype.Timestamptz
+}
+
 type Like struct {
 	ID                int32
 	LikerUserID       int32
@@ -799,6 +1192,16 @@ type MessageReaction struct {
 	UpdatedAt pgtype.Timestamptz
 }
 
+type ModerationAction struct {
+	ID             int64
+	AdminUserID    int32
+	TargetUserID   int32
+	Action         ModerationActionType
+	Reason         string
+	SuspendedUntil pgtype.Timestamptz
+	CreatedAt      pgtype.Timestamptz
+}
+
 type MyTypePrompt struct {
 	ID       int32
 	UserID   int32
@@ -806,6 +1209,17 @@ type MyTypePrompt struct {
 	Answer   string
 }
 
+type NotificationPreference struct {
+	UserID          int32
+	NewMessage      bool
+	NewLike         bool
+	NewMatch        bool
+	QuietHoursStart pgtype.Int2
+	QuietHoursEnd   pgtype.Int2
+	Timezone        string
+	UpdatedAt       pgtype.Timestamptz
+}
+
 type PhotoViewDuration struct {
 	ViewID        int64
 	ViewerUserID  int32
@@ -815,6 +1229,49 @@ type PhotoViewDuration struct {
 	ViewTimestamp pgtype.Timestamptz
 }
 
+type Purchase struct {
+	ID                    int64
+	UserID                pgtype.Int4
+	Platform              PurchasePlatform
+	TransactionID         string
+	OriginalTransactionID pgtype.Text
+	PurchaseToken         pgtype.Text
+	ProductID             string
+	Environment           string
+	PurchasedAt           pgtype.Timestamptz
+	ExpiresAt             pgtype.Timestamptz
+	RevokedAt             pgtype.Timestamptz
+	CreatedAt             pgtype.Timestamptz
+}
+
+type PushOutbox struct {
+	ID               int64
+	UserID           int32
+	NotificationType NotificationType
+	CollapseKey      string
+	Title            string
+	Body             string
+	Data             []byte
+	CollapsedCount   int32
+	Status           PushStatus
+	Attempts         int32
+	NextAttemptAt    pgtype.Timestamptz
+	LastError        pgtype.Text
+	CreatedAt        pgtype.Timestamptz
+	UpdatedAt        pgtype.Timestamptz
+}
+
+type RefreshToken struct {
+	ID           int64
+	UserID       int32
+	TokenHash    string
+	FamilyID     string
+	ExpiresAt    pgtype.Timestamptz
+	CreatedAt    pgtype.Timestamptz
+	RevokedAt    pgtype.Timestamptz
+	ReplacedByID pgtype.Int8
+}
+
 type Report struct {
 	ID             int64
 	ReporterUserID int32
@@ -823,6 +1280,60 @@ type Report struct {
 	CreatedAt      pgtype.Timestamptz
 }
 
+type ReportResolution struct {
+	ReportID   int64
+	ActionID   int64
+	ResolvedAt pgtype.Timestamptz
+}
+
+type RevokedSession struct {
+	SessionID string
+	UserID    int32
+	RevokedAt pgtype.Timestamptz
+	ExpiresAt pgtype.Timestamptz
+}
+
+type SpotlightActivation struct {
+	ID               int64
+	UserID           int32
+	ActivatedAt      pgtype.Timestamptz
+	ExpiresAt        pgtype.Timestamptz
+	ExpiryNotifiedAt pgtype.Timestamptz
+}
+
+type StoreNotification struct {
+	Platform         PurchasePlatform
+	NotificationID   string
+	NotificationType string
+	ReceivedAt       pgtype.Timestamptz
+}
+
+type StoreProduct struct {
+	ProductID    string
+	DisplayName  string
+	Description  string
+	Subscription bool
+	Active       bool
+	SortOrder    int32
+	CreatedAt    pgtype.Timestamptz
+	UpdatedAt    pgtype.Timestamptz
+}
+
+type StoreProductGrant struct {
+	ID          int32
+	ProductID   string
+	FeatureType PremiumFeatureType
+	Quantity    pgtype.Int4
+	Duration    pgtype.Text
+}
+
+type StoreSubscriptionState struct {
+	Platform        PurchasePlatform
+	SubscriptionKey string
+	LastSignedAt    pgtype.Timestamptz
+	UpdatedAt       pgtype.Timestamptz
+}
+
 type StoryTimePrompt struct {
 	ID       int32
 	UserID   int32
@@ -866,6 +1377,29 @@ type UserConsumable struct {
 	UpdatedAt      pgtype.Timestamptz
 }
 
+type UserEvent struct {
+	UserID    int32
+	Seq       int64
+	EventType string
+	Payload   []byte
+	CreatedAt pgtype.Timestamptz
+}
+
+type UserEventSequence struct {
+	UserID  int32
+	LastSeq int64
+}
+
+type UserIdentity struct {
+	ID         int64
+	UserID     int32
+	Provider   string
+	Subject    string
+	Email      pgtype.Text
+	CreatedAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+}
+
 type UserProfileImpression struct {
 	ImpressionID        int64
 	ViewerUserID        int32
@@ -874,11 +1408,46 @@ type UserProfileImpression struct {
 	Source              string
 }
 
+type UserRiskScore struct {
+	UserID      int32
+	Score       float64
+	Reasons     []string
+	AutoHidden  bool
+	EvaluatedAt pgtype.Timestamptz
+	ReviewedAt  pgtype.Timestamptz
+}
+
+type UserSanction struct {
+	UserID    int32
+	ActionID  int64
+	IsBan     bool
+	Reason    string
+	ExpiresAt pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
+type UserSessionCutoff struct {
+	UserID        int32
+	RevokedBefore pgtype.Timestamptz
+	UpdatedAt     pgtype.Timestamptz
+}
+
 type UserSubscription struct {
 	ID          int32
 	UserID      int32
 	FeatureType PremiumFeatureType
 	ActivatedAt pgtype.Timestamptz
 	ExpiresAt   pgtype.Timestamptz
+	PurchaseID  pgtype.Int8
 	CreatedAt   pgtype.Timestamptz
 }
+
+type UserTravelLocation struct {
+	UserID    int32
+	Latitude  float64
+	Longitude float64
+	City      string
+	ExpiresAt pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+	UpdatedAt pgtype.Timestamptz
+}
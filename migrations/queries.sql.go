@@ -77,23 +77,60 @@ func (q *Queries) AddDislike(ctx context.Context, arg AddDislikeParams) error {
 	return err
 }
 
+const addStoreProductGrant = `-- name: AddStoreProductGrant :one
+INSERT INTO store_product_grants (product_id, feature_type, quantity, duration)
+VALUES ($1, $2, $3, $4)
+RETURNING id, product_id, feature_type, quantity, duration
+`
+
+type AddStoreProductGrantParams struct {
+	ProductID   string
+	FeatureType PremiumFeatureType
+	Quantity    pgtype.Int4
+	Duration    pgtype.Text
+}
+
+func (q *Queries) AddStoreProductGrant(ctx context.Context, arg AddStoreProductGrantParams) (StoreProductGrant, error) {
+	row := q.db.QueryRow(ctx, addStoreProductGrant,
+		arg.ProductID,
+		arg.FeatureType,
+		arg.Quantity,
+		arg.Duration,
+	)
+	var i StoreProductGrant
+	err := row.Scan(
+		&i.ID,
+		&i.ProductID,
+		&i.FeatureType,
+		&i.Quantity,
+		&i.Duration,
+	)
+	return i, err
+}
+
 const addUserSubscription = `-- name: AddUserSubscription :one
 INSERT INTO user_subscriptions (
-    user_id, feature_type, expires_at, activated_at
+    user_id, feature_type, expires_at, purchase_id, activated_at
 ) VALUES (
-    $1, $2, $3, NOW()
+    $1, $2, $3, $4, NOW()
 )
-RETURNING id, user_id, feature_type, activated_at, expires_at, created_at
+RETURNING id, user_id, feature_type, activated_at, expires_at, purchase_id, created_at
 `
 
 type AddUserSubscriptionParams struct {
 	UserID      int32
 	FeatureType PremiumFeatureType
 	ExpiresAt   pgtype.Timestamptz
+	PurchaseID  pgtype.Int8
 }
 
 func (q *Queries) AddUserSubscription(ctx context.Context, arg AddUserSubscriptionParams) (UserSubscription, error) {
-	row := q.db.QueryRow(ctx, addUserSubscription, arg.UserID, arg.FeatureType, arg.ExpiresAt)
+	row := q.db.QueryRow(ctx, addUserSubscription,
+		arg.UserID,
+		arg.FeatureType,
+		arg.ExpiresAt,
+		arg.PurchaseID,
+	)
 	var i UserSubscription
 	err := row.Scan(
 		&i.ID,
@@ -101,11 +138,92 @@ func (q *Queries) AddUserSubscription(ctx context.Context, arg AddUserSubscripti
 		&i.FeatureType,
 		&i.ActivatedAt,
 		&i.ExpiresAt,
+		&i.PurchaseID,
 		&i.CreatedAt,
 	)
 	return i, err
 }
 
+const advanceStoreSubscriptionState = `-- name: AdvanceStoreSubscriptionState :one
+INSERT INTO store_subscription_states (platform, subscription_key, last_signed_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (platform, subscription_key) DO UPDATE
+SET last_signed_at = EXCLUDED.last_signed_at,
+    updated_at = NOW()
+WHERE store_subscription_states.last_signed_at <= EXCLUDED.last_signed_at
+RETURNING last_signed_at
+`
+
+type AdvanceStoreSubscriptionStateParams struct {
+	Platform        PurchasePlatform
+	SubscriptionKey string
+	LastSignedAt    pgtype.Timestamptz
+}
+
+// Returns no row if a newer state of the subscription was already applied.
+func (q *Queries) AdvanceStoreSubscriptionState(ctx context.Context, arg AdvanceStoreSubscriptionStateParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, advanceStoreSubscriptionState, arg.Platform, arg.SubscriptionKey, arg.LastSignedAt)
+	var last_signed_at pgtype.Timestamptz
+	err := row.Scan(&last_signed_at)
+	return last_signed_at, err
+}
+
+const appendUserEvent = `-- name: AppendUserEvent :one
+WITH next_seq AS (
+    INSERT INTO user_event_sequences (user_id, last_seq)
+    VALUES ($1, 1)
+    ON CONFLICT (user_id) DO UPDATE
+    SET last_seq = user_event_sequences.last_seq + 1
+    RETURNING last_seq
+)
+INSERT INTO user_events (user_id, seq, event_type, payload)
+SELECT $1, last_seq, $2, $3
+FROM next_seq
+RETURNING seq
+`
+
+type AppendUserEventParams struct {
+	UserID    int32
+	EventType string
+	Payload   []byte
+}
+
+func (q *Queries) AppendUserEvent(ctx context.Context, arg AppendUserEventParams) (int64, error) {
+	row := q.db.QueryRow(ctx, appendUserEvent, arg.UserID, arg.EventType, arg.Payload)
+	var seq int64
+	err := row.Scan(&seq)
+	return seq, err
+}
+
+const blockUser = `-- name: BlockUser :exec
+INSERT INTO blocks (blocker_user_id, blocked_user_id)
+VALUES ($1, $2)
+ON CONFLICT (blocker_user_id, blocked_user_id) DO NOTHING
+`
+
+type BlockUserParams struct {
+	BlockerUserID int32
+	BlockedUserID int32
+}
+
+func (q *Queries) BlockUser(ctx context.Context, arg BlockUserParams) error {
+	_, err := q.db.Exec(ctx, blockUser, arg.BlockerUserID, arg.BlockedUserID)
+	return err
+}
+
+const cancelAccountDeletion = `-- name: CancelAccountDeletion :execrows
+DELETE FROM account_deletions
+WHERE user_id = $1
+`
+
+func (q *Queries) CancelAccountDeletion(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, cancelAccountDeletion, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const checkLikeExists = `-- name: CheckLikeExists :one
 SELECT EXISTS (
     SELECT 1 FROM likes
@@ -149,6 +267,11 @@ func (q *Queries) CheckLikeExistsForRecipient(ctx context.Context, arg CheckLike
 const checkMutualLikeExists = `-- name: CheckMutualLikeExists :one
 SELECT EXISTS (SELECT 1 FROM likes l1 WHERE l1.liker_user_id = $1 AND l1.liked_user_id = $2)
    AND EXISTS (SELECT 1 FROM likes l2 WHERE l2.liker_user_id = $2 AND l2.liked_user_id = $1)
+   AND NOT EXISTS (
+       SELECT 1 FROM blocks b
+       WHERE (b.blocker_user_id = $1 AND b.blocked_user_id = $2)
+          OR (b.blocker_user_id = $2 AND b.blocked_user_id = $1)
+   )
 `
 
 type CheckMutualLikeExistsParams struct {
@@ -163,6 +286,225 @@ func (q *Queries) CheckMutualLikeExists(ctx context.Context, arg CheckMutualLike
 	return column_1, err
 }
 
+const claimDuePushNotifications = `-- name: ClaimDuePushNotifications :many
+UPDATE push_outbox
+SET status = 'sending',
+    attempts = attempts + 1,
+    next_attempt_at = NOW() + make_interval(secs => $1::int),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM push_outbox
+    WHERE status IN ('pending', 'sending')
+      AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    LIMIT $2::int
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id, notification_type, collapse_key, title, body, data, collapsed_count, status, attempts, next_attempt_at, last_error, created_at, updated_at
+`
+
+type ClaimDuePushNotificationsParams struct {
+	LeaseSeconds int32
+	BatchSize    int32
+}
+
+// Rows left in 'sending' by a crashed dispatcher become due again once
+// their lease runs out.
+func (q *Queries) ClaimDuePushNotifications(ctx context.Context, arg ClaimDuePushNotificationsParams) ([]PushOutbox, error) {
+	rows, err := q.db.Query(ctx, claimDuePushNotifications, arg.LeaseSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PushOutbox
+	for rows.Next() {
+		var i PushOutbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.NotificationType,
+			&i.CollapseKey,
+			&i.Title,
+			&i.Body,
+			&i.Data,
+			&i.CollapsedCount,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimExpiredSpotlights = `-- name: ClaimExpiredSpotlights :many
+UPDATE spotlight_activations
+SET expiry_notified_at = NOW()
+WHERE id IN (
+    SELECT id FROM spotlight_activations
+    WHERE expiry_notified_at IS NULL AND expires_at <= NOW()
+    ORDER BY expires_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id, activated_at, expires_at, expiry_notified_at
+`
+
+func (q *Queries) ClaimExpiredSpotlights(ctx context.Context, batchSize int32) ([]SpotlightActivation, error) {
+	rows, err := q.db.Query(ctx, claimExpiredSpotlights, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SpotlightActivation
+	for rows.Next() {
+		var i SpotlightActivation
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ActivatedAt,
+			&i.ExpiresAt,
+			&i.ExpiryNotifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimOutboxEvents = `-- name: ClaimOutboxEvents :many
+UPDATE event_outbox
+SET attempts = attempts + 1,
+    next_attempt_at = NOW() + make_interval(secs => $1::int)
+WHERE id IN (
+    SELECT id FROM event_outbox
+    WHERE published_at IS NULL
+      AND next_attempt_at <= NOW()
+    ORDER BY id
+    LIMIT $2::int
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id, sender_user_id, event_type, payload, attempts, next_attempt_at, published_at, created_at
+`
+
+type ClaimOutboxEventsParams struct {
+	LeaseSeconds int32
+	BatchSize    int32
+}
+
+// Events claimed by a relay that dies before publishing them become due
+// again once their lease runs out.
+func (q *Queries) ClaimOutboxEvents(ctx context.Context, arg ClaimOutboxEventsParams) ([]EventOutbox, error) {
+	rows, err := q.db.Query(ctx, claimOutboxEvents, arg.LeaseSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EventOutbox
+	for rows.Next() {
+		var i EventOutbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.SenderUserID,
+			&i.EventType,
+			&i.Payload,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.PublishedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const clawBackUserConsumable = `-- name: ClawBackUserConsumable :one
+WITH previous AS (
+    SELECT quantity FROM user_consumables
+    WHERE user_id = $1 AND consumable_type = $2
+    FOR UPDATE
+)
+UPDATE user_consumables uc
+SET quantity = GREATEST(uc.quantity - $3, 0),
+    updated_at = NOW()
+FROM previous
+WHERE uc.user_id = $1 AND uc.consumable_type = $2
+RETURNING (previous.quantity - uc.quantity)::int AS clawed_back
+`
+
+type ClawBackUserConsumableParams struct {
+	UserID         int32
+	ConsumableType PremiumFeatureType
+	Quantity       int32
+}
+
+// Takes back up to quantity, as much as the user hasn't spent yet, and
+// returns how much was taken.
+func (q *Queries) ClawBackUserConsumable(ctx context.Context, arg ClawBackUserConsumableParams) (int32, error) {
+	row := q.db.QueryRow(ctx, clawBackUserConsumable, arg.UserID, arg.ConsumableType, arg.Quantity)
+	var clawed_back int32
+	err := row.Scan(&clawed_back)
+	return clawed_back, err
+}
+
+const clearConversationHistory = `-- name: ClearConversationHistory :one
+INSERT INTO conversation_settings (user_id, peer_user_id, cleared_before)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, peer_user_id) DO UPDATE
+SET cleared_before = NOW(),
+    updated_at = NOW()
+RETURNING user_id, peer_user_id, muted_until, pinned, archived, cleared_before, updated_at
+`
+
+type ClearConversationHistoryParams struct {
+	UserID     int32
+	PeerUserID int32
+}
+
+func (q *Queries) ClearConversationHistory(ctx context.Context, arg ClearConversationHistoryParams) (ConversationSetting, error) {
+	row := q.db.QueryRow(ctx, clearConversationHistory, arg.UserID, arg.PeerUserID)
+	var i ConversationSetting
+	err := row.Scan(
+		&i.UserID,
+		&i.PeerUserID,
+		&i.MutedUntil,
+		&i.Pinned,
+		&i.Archived,
+		&i.ClearedBefore,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const clearRiskHold = `-- name: ClearRiskHold :exec
+UPDATE user_risk_scores
+SET auto_hidden = false, reviewed_at = NOW()
+WHERE user_id = $1
+`
+
+func (q *Queries) ClearRiskHold(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, clearRiskHold, userID)
+	return err
+}
+
 const clearUserMediaURLs = `-- name: ClearUserMediaURLs :exec
 UPDATE users
 SET media_urls = '{}'
@@ -240,6 +582,31 @@ func (q *Queries) CountImpressionsDuringSpotlight(ctx context.Context, arg Count
 	return count, err
 }
 
+const countPinnedConversations = `-- name: CountPinnedConversations :one
+SELECT COUNT(*) FROM conversation_settings cs
+WHERE cs.user_id = $1 AND cs.pinned AND cs.peer_user_id <> $2
+  AND EXISTS (SELECT 1 FROM likes l1 WHERE l1.liker_user_id = cs.user_id AND l1.liked_user_id = cs.peer_user_id)
+  AND EXISTS (SELECT 1 FROM likes l2 WHERE l2.liker_user_id = cs.peer_user_id AND l2.liked_user_id = cs.user_id)
+  AND NOT EXISTS (
+      SELECT 1 FROM blocks b
+      WHERE (b.blocker_user_id = cs.user_id AND b.blocked_user_id = cs.peer_user_id)
+         OR (b.blocker_user_id = cs.peer_user_id AND b.blocked_user_id = cs.user_id)
+  )
+`
+
+type CountPinnedConversationsParams struct {
+	UserID     int32
+	PeerUserID int32
+}
+
+// Pins left on conversations that ended (unmatch, block) don't count.
+func (q *Queries) CountPinnedConversations(ctx context.Context, arg CountPinnedConversationsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countPinnedConversations, arg.UserID, arg.PeerUserID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countProfileImpressions = `-- name: CountProfileImpressions :one
 SELECT COUNT(*)
 FROM user_profile_impressions
@@ -303,10 +670,12 @@ INSERT INTO chat_messages (
     message_text,
     media_url,
     media_type,
-    reply_to_message_id
+    reply_to_message_id,
+    kind,
+    payload
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
-) RETURNING id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id
+    $1, $2, $3, $4, $5, $6, $7, $8
+) RETURNING id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload
 `
 
 type CreateChatMessageParams struct {
@@ -316,6 +685,8 @@ type CreateChatMessageParams struct {
 	MediaUrl         pgtype.Text
 	MediaType        pgtype.Text
 	ReplyToMessageID pgtype.Int8
+	Kind             ChatMessageKind
+	Payload          []byte
 }
 
 func (q *Queries) CreateChatMessage(ctx context.Context, arg CreateChatMessageParams) (ChatMessage, error) {
@@ -326,6 +697,8 @@ func (q *Queries) CreateChatMessage(ctx context.Context, arg CreateChatMessagePa
 		arg.MediaUrl,
 		arg.MediaType,
 		arg.ReplyToMessageID,
+		arg.Kind,
+		arg.Payload,
 	)
 	var i ChatMessage
 	err := row.Scan(
@@ -338,10 +711,30 @@ func (q *Queries) CreateChatMessage(ctx context.Context, arg CreateChatMessagePa
 		&i.SentAt,
 		&i.IsRead,
 		&i.ReplyToMessageID,
+		&i.DeliveredAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.Kind,
+		&i.Payload,
 	)
 	return i, err
 }
 
+const createChatMessageEdit = `-- name: CreateChatMessageEdit :exec
+INSERT INTO chat_message_edits (message_id, previous_text)
+VALUES ($1, $2)
+`
+
+type CreateChatMessageEditParams struct {
+	MessageID    int64
+	PreviousText string
+}
+
+func (q *Queries) CreateChatMessageEdit(ctx context.Context, arg CreateChatMessageEditParams) error {
+	_, err := q.db.Exec(ctx, createChatMessageEdit, arg.MessageID, arg.PreviousText)
+	return err
+}
+
 const createDateVibesPrompt = `-- name: CreateDateVibesPrompt :one
 INSERT INTO date_vibes_prompts (user_id, question, answer)
 VALUES ($1, $2, $3)
@@ -390,6 +783,76 @@ func (q *Queries) CreateGettingPersonalPrompt(ctx context.Context, arg CreateGet
 	return i, err
 }
 
+const createImpersonationAuditLog = `-- name: CreateImpersonationAuditLog :one
+INSERT INTO impersonation_audit_log (admin_user_id, target_user_id, reason, token_id, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, admin_user_id, target_user_id, reason, token_id, expires_at, created_at
+`
+
+type CreateImpersonationAuditLogParams struct {
+	AdminUserID  int32
+	TargetUserID int32
+	Reason       string
+	TokenID      string
+	ExpiresAt    pgtype.Timestamptz
+}
+
+func (q *Queries) CreateImpersonationAuditLog(ctx context.Context, arg CreateImpersonationAuditLogParams) (ImpersonationAuditLog, error) {
+	row := q.db.QueryRow(ctx, createImpersonationAuditLog,
+		arg.AdminUserID,
+		arg.TargetUserID,
+		arg.Reason,
+		arg.TokenID,
+		arg.ExpiresAt,
+	)
+	var i ImpersonationAuditLog
+	err := row.Scan(
+		&i.ID,
+		&i.AdminUserID,
+		&i.TargetUserID,
+		&i.Reason,
+		&i.TokenID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createModerationAction = `-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (admin_user_id, target_user_id, action, reason, suspended_until)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, admin_user_id, target_user_id, action, reason, suspended_until, created_at
+`
+
+type CreateModerationActionParams struct {
+	AdminUserID    int32
+	TargetUserID   int32
+	Action         ModerationActionType
+	Reason         string
+	SuspendedUntil pgtype.Timestamptz
+}
+
+func (q *Queries) CreateModerationAction(ctx context.Context, arg CreateModerationActionParams) (ModerationAction, error) {
+	row := q.db.QueryRow(ctx, createModerationAction,
+		arg.AdminUserID,
+		arg.TargetUserID,
+		arg.Action,
+		arg.Reason,
+		arg.SuspendedUntil,
+	)
+	var i ModerationAction
+	err := row.Scan(
+		&i.ID,
+		&i.AdminUserID,
+		&i.TargetUserID,
+		&i.Action,
+		&i.Reason,
+		&i.SuspendedUntil,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const createMyTypePrompt = `-- name: CreateMyTypePrompt :one
 INSERT INTO my_type_prompts (user_id, question, answer)
 VALUES ($1, $2, $3)
@@ -414,6 +877,40 @@ func (q *Queries) CreateMyTypePrompt(ctx context.Context, arg CreateMyTypePrompt
 	return i, err
 }
 
+const createRefreshToken = `-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, token_hash, family_id, expires_at, created_at, revoked_at, replaced_by_id
+`
+
+type CreateRefreshTokenParams struct {
+	UserID    int32
+	TokenHash string
+	FamilyID  string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, createRefreshToken,
+		arg.UserID,
+		arg.TokenHash,
+		arg.FamilyID,
+		arg.ExpiresAt,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.FamilyID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+		&i.ReplacedByID,
+	)
+	return i, err
+}
+
 const createReport = `-- name: CreateReport :one
 INSERT INTO reports (
     reporter_user_id,
@@ -444,6 +941,70 @@ func (q *Queries) CreateReport(ctx context.Context, arg CreateReportParams) (Rep
 	return i, err
 }
 
+const createSpotlightActivation = `-- name: CreateSpotlightActivation :one
+INSERT INTO spotlight_activations (user_id, expires_at)
+VALUES ($1, $2)
+RETURNING id, user_id, activated_at, expires_at, expiry_notified_at
+`
+
+type CreateSpotlightActivationParams struct {
+	UserID    int32
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateSpotlightActivation(ctx context.Context, arg CreateSpotlightActivationParams) (SpotlightActivation, error) {
+	row := q.db.QueryRow(ctx, createSpotlightActivation, arg.UserID, arg.ExpiresAt)
+	var i SpotlightActivation
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ActivatedAt,
+		&i.ExpiresAt,
+		&i.ExpiryNotifiedAt,
+	)
+	return i, err
+}
+
+const createStoreProduct = `-- name: CreateStoreProduct :one
+INSERT INTO store_products (product_id, display_name, description, subscription, active, sort_order)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (product_id) DO NOTHING
+RETURNING product_id, display_name, description, subscription, active, sort_order, created_at, updated_at
+`
+
+type CreateStoreProductParams struct {
+	ProductID    string
+	DisplayName  string
+	Description  string
+	Subscription bool
+	Active       bool
+	SortOrder    int32
+}
+
+// Returns no row if the product already exists.
+func (q *Queries) CreateStoreProduct(ctx context.Context, arg CreateStoreProductParams) (StoreProduct, error) {
+	row := q.db.QueryRow(ctx, createStoreProduct,
+		arg.ProductID,
+		arg.DisplayName,
+		arg.Description,
+		arg.Subscription,
+		arg.Active,
+		arg.SortOrder,
+	)
+	var i StoreProduct
+	err := row.Scan(
+		&i.ProductID,
+		&i.DisplayName,
+		&i.Description,
+		&i.Subscription,
+		&i.Active,
+		&i.SortOrder,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const createStoryTimePrompt = `-- name: CreateStoryTimePrompt :one
 INSERT INTO story_time_prompts (user_id, question, answer)
 VALUES ($1, $2, $3)
@@ -541,6 +1102,44 @@ func (q *Queries) DecrementUserConsumable(ctx context.Context, arg DecrementUser
 	return i, err
 }
 
+const deleteChatMessageEdits = `-- name: DeleteChatMessageEdits :exec
+DELETE FROM chat_message_edits
+WHERE message_id = $1
+`
+
+func (q *Queries) DeleteChatMessageEdits(ctx context.Context, messageID int64) error {
+	_, err := q.db.Exec(ctx, deleteChatMessageEdits, messageID)
+	return err
+}
+
+const deleteDevicePushToken = `-- name: DeleteDevicePushToken :execrows
+DELETE FROM device_push_tokens
+WHERE user_id = $1 AND token = $2
+`
+
+type DeleteDevicePushTokenParams struct {
+	UserID int32
+	Token  string
+}
+
+func (q *Queries) DeleteDevicePushToken(ctx context.Context, arg DeleteDevicePushTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteDevicePushToken, arg.UserID, arg.Token)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteInvalidDevicePushToken = `-- name: DeleteInvalidDevicePushToken :exec
+DELETE FROM device_push_tokens
+WHERE token = $1
+`
+
+func (q *Queries) DeleteInvalidDevicePushToken(ctx context.Context, token string) error {
+	_, err := q.db.Exec(ctx, deleteInvalidDevicePushToken, token)
+	return err
+}
+
 const deleteLikesBetweenUsers = `-- name: DeleteLikesBetweenUsers :exec
 DELETE FROM likes
 WHERE (liker_user_id = $1 AND liked_user_id = $2)
@@ -572,8 +1171,69 @@ func (q *Queries) DeleteMessageReactionByUser(ctx context.Context, arg DeleteMes
 	return q.db.Exec(ctx, deleteMessageReactionByUser, arg.MessageID, arg.UserID)
 }
 
-const deleteUserDateVibesPrompts = `-- name: DeleteUserDateVibesPrompts :exec
-DELETE FROM date_vibes_prompts WHERE user_id = $1
+const deleteSessionDevicePushTokens = `-- name: DeleteSessionDevicePushTokens :exec
+DELETE FROM device_push_tokens
+WHERE user_id = $1 AND session_id = $2
+`
+
+type DeleteSessionDevicePushTokensParams struct {
+	UserID    int32
+	SessionID pgtype.Text
+}
+
+func (q *Queries) DeleteSessionDevicePushTokens(ctx context.Context, arg DeleteSessionDevicePushTokensParams) error {
+	_, err := q.db.Exec(ctx, deleteSessionDevicePushTokens, arg.UserID, arg.SessionID)
+	return err
+}
+
+const deleteStoreProduct = `-- name: DeleteStoreProduct :one
+DELETE FROM store_products
+WHERE product_id = $1
+RETURNING product_id
+`
+
+func (q *Queries) DeleteStoreProduct(ctx context.Context, productID string) (string, error) {
+	row := q.db.QueryRow(ctx, deleteStoreProduct, productID)
+	var product_id string
+	err := row.Scan(&product_id)
+	return product_id, err
+}
+
+const deleteStoreProductGrants = `-- name: DeleteStoreProductGrants :exec
+DELETE FROM store_product_grants
+WHERE product_id = $1
+`
+
+func (q *Queries) DeleteStoreProductGrants(ctx context.Context, productID string) error {
+	_, err := q.db.Exec(ctx, deleteStoreProductGrants, productID)
+	return err
+}
+
+const deleteTravelLocation = `-- name: DeleteTravelLocation :exec
+DELETE FROM user_travel_locations
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteTravelLocation(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, deleteTravelLocation, userID)
+	return err
+}
+
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUserDateVibesPrompts = `-- name: DeleteUserDateVibesPrompts :exec
+DELETE FROM date_vibes_prompts WHERE user_id = $1
 `
 
 func (q *Queries) DeleteUserDateVibesPrompts(ctx context.Context, userID int32) error {
@@ -581,6 +1241,16 @@ func (q *Queries) DeleteUserDateVibesPrompts(ctx context.Context, userID int32)
 	return err
 }
 
+const deleteUserDevicePushTokens = `-- name: DeleteUserDevicePushTokens :exec
+DELETE FROM device_push_tokens
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserDevicePushTokens(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, deleteUserDevicePushTokens, userID)
+	return err
+}
+
 const deleteUserGettingPersonalPrompts = `-- name: DeleteUserGettingPersonalPrompts :exec
 DELETE FROM getting_personal_prompts WHERE user_id = $1
 `
@@ -599,6 +1269,19 @@ func (q *Queries) DeleteUserMyTypePrompts(ctx context.Context, userID int32) err
 	return err
 }
 
+const deleteUserSanction = `-- name: DeleteUserSanction :execrows
+DELETE FROM user_sanctions
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserSanction(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserSanction, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deleteUserStoryTimePrompts = `-- name: DeleteUserStoryTimePrompts :exec
 DELETE FROM story_time_prompts WHERE user_id = $1
 `
@@ -608,8 +1291,87 @@ func (q *Queries) DeleteUserStoryTimePrompts(ctx context.Context, userID int32)
 	return err
 }
 
+const endUserSubscription = `-- name: EndUserSubscription :one
+UPDATE user_subscriptions
+SET expires_at = NOW()
+WHERE id = $1 AND expires_at > NOW()
+RETURNING id, user_id, feature_type, activated_at, expires_at, purchase_id, created_at
+`
+
+// Returns no row if the subscription had already ended.
+func (q *Queries) EndUserSubscription(ctx context.Context, id int32) (UserSubscription, error) {
+	row := q.db.QueryRow(ctx, endUserSubscription, id)
+	var i UserSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FeatureType,
+		&i.ActivatedAt,
+		&i.ExpiresAt,
+		&i.PurchaseID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const enqueueOutboxEvent = `-- name: EnqueueOutboxEvent :exec
+INSERT INTO event_outbox (user_id, sender_user_id, event_type, payload)
+VALUES ($1, $2, $3, $4)
+`
+
+type EnqueueOutboxEventParams struct {
+	UserID       int32
+	SenderUserID int32
+	EventType    string
+	Payload      []byte
+}
+
+func (q *Queries) EnqueueOutboxEvent(ctx context.Context, arg EnqueueOutboxEventParams) error {
+	_, err := q.db.Exec(ctx, enqueueOutboxEvent,
+		arg.UserID,
+		arg.SenderUserID,
+		arg.EventType,
+		arg.Payload,
+	)
+	return err
+}
+
+const enqueuePushNotification = `-- name: EnqueuePushNotification :exec
+INSERT INTO push_outbox (user_id, notification_type, collapse_key, title, body, data, next_attempt_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (user_id, collapse_key) WHERE status = 'pending' DO UPDATE
+SET title = EXCLUDED.title,
+    body = EXCLUDED.body,
+    data = EXCLUDED.data,
+    collapsed_count = push_outbox.collapsed_count + 1,
+    updated_at = NOW()
+`
+
+type EnqueuePushNotificationParams struct {
+	UserID           int32
+	NotificationType NotificationType
+	CollapseKey      string
+	Title            string
+	Body             string
+	Data             []byte
+	NextAttemptAt    pgtype.Timestamptz
+}
+
+func (q *Queries) EnqueuePushNotification(ctx context.Context, arg EnqueuePushNotificationParams) error {
+	_, err := q.db.Exec(ctx, enqueuePushNotification,
+		arg.UserID,
+		arg.NotificationType,
+		arg.CollapseKey,
+		arg.Title,
+		arg.Body,
+		arg.Data,
+		arg.NextAttemptAt,
+	)
+	return err
+}
+
 const getActiveSubscription = `-- name: GetActiveSubscription :one
-SELECT id, user_id, feature_type, activated_at, expires_at, created_at FROM user_subscriptions
+SELECT id, user_id, feature_type, activated_at, expires_at, purchase_id, created_at FROM user_subscriptions
 WHERE user_id = $1
   AND feature_type = $2 -- e.g., 'unlimited_likes'
   AND expires_at > NOW()
@@ -630,11 +1392,100 @@ func (q *Queries) GetActiveSubscription(ctx context.Context, arg GetActiveSubscr
 		&i.FeatureType,
 		&i.ActivatedAt,
 		&i.ExpiresAt,
+		&i.PurchaseID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getActiveTravelLocation = `-- name: GetActiveTravelLocation :one
+SELECT tl.user_id, tl.latitude, tl.longitude, tl.city, tl.expires_at, tl.created_at, tl.updated_at FROM user_travel_locations tl
+WHERE tl.user_id = $1
+  AND tl.expires_at > NOW()
+  AND EXISTS (
+      SELECT 1 FROM user_subscriptions s
+      WHERE s.user_id = tl.user_id AND s.feature_type = 'travel_mode' AND s.expires_at > NOW()
+  )
+`
+
+// The user's travel location if it and their travel_mode subscription are
+// both unexpired.
+func (q *Queries) GetActiveTravelLocation(ctx context.Context, userID int32) (UserTravelLocation, error) {
+	row := q.db.QueryRow(ctx, getActiveTravelLocation, userID)
+	var i UserTravelLocation
+	err := row.Scan(
+		&i.UserID,
+		&i.Latitude,
+		&i.Longitude,
+		&i.City,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getActiveUserSanction = `-- name: GetActiveUserSanction :one
+SELECT user_id, action_id, is_ban, reason, expires_at, created_at FROM user_sanctions
+WHERE user_id = $1
+  AND (expires_at IS NULL OR expires_at > NOW())
+`
+
+func (q *Queries) GetActiveUserSanction(ctx context.Context, userID int32) (UserSanction, error) {
+	row := q.db.QueryRow(ctx, getActiveUserSanction, userID)
+	var i UserSanction
+	err := row.Scan(
+		&i.UserID,
+		&i.ActionID,
+		&i.IsBan,
+		&i.Reason,
+		&i.ExpiresAt,
 		&i.CreatedAt,
 	)
 	return i, err
 }
 
+const getAllMessagesForUser = `-- name: GetAllMessagesForUser :many
+SELECT id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload FROM chat_messages
+WHERE sender_user_id = $1 OR recipient_user_id = $1
+ORDER BY sent_at, id
+`
+
+func (q *Queries) GetAllMessagesForUser(ctx context.Context, senderUserID int32) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getAllMessagesForUser, senderUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatMessage
+	for rows.Next() {
+		var i ChatMessage
+		if err := rows.Scan(
+			&i.ID,
+			&i.SenderUserID,
+			&i.RecipientUserID,
+			&i.MessageText,
+			&i.MediaUrl,
+			&i.MediaType,
+			&i.SentAt,
+			&i.IsRead,
+			&i.ReplyToMessageID,
+			&i.DeliveredAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.Payload,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getApproximateProfileViewTimeSeconds = `-- name: GetApproximateProfileViewTimeSeconds :one
 WITH UserInteractions AS (
     SELECT
@@ -685,6 +1536,65 @@ func (q *Queries) GetApproximateProfileViewTimeSeconds(ctx context.Context, arg
 	return column_1, err
 }
 
+const getAutoHiddenUsers = `-- name: GetAutoHiddenUsers :many
+SELECT
+    rs.user_id,
+    rs.score,
+    rs.reasons,
+    rs.evaluated_at,
+    u.name,
+    u.last_name,
+    u.media_urls
+FROM user_risk_scores rs
+JOIN users u ON u.id = rs.user_id
+WHERE rs.auto_hidden
+ORDER BY rs.score DESC
+LIMIT $1 OFFSET $2
+`
+
+type GetAutoHiddenUsersParams struct {
+	Limit  int32
+	Offset int32
+}
+
+type GetAutoHiddenUsersRow struct {
+	UserID      int32
+	Score       float64
+	Reasons     []string
+	EvaluatedAt pgtype.Timestamptz
+	Name        pgtype.Text
+	LastName    pgtype.Text
+	MediaUrls   []string
+}
+
+func (q *Queries) GetAutoHiddenUsers(ctx context.Context, arg GetAutoHiddenUsersParams) ([]GetAutoHiddenUsersRow, error) {
+	rows, err := q.db.Query(ctx, getAutoHiddenUsers, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAutoHiddenUsersRow
+	for rows.Next() {
+		var i GetAutoHiddenUsersRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Score,
+			&i.Reasons,
+			&i.EvaluatedAt,
+			&i.Name,
+			&i.LastName,
+			&i.MediaUrls,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getBasicMatchInfo = `-- name: GetBasicMatchInfo :one
 SELECT
     id,
@@ -749,68 +1659,76 @@ func (q *Queries) GetBasicUserInfo(ctx context.Context, id int32) (GetBasicUserI
 	return i, err
 }
 
-const getConversationMessages = `-- name: GetConversationMessages :many
-WITH MessageReactionsAgg AS (
-    SELECT
-        message_id,
-        jsonb_object_agg(emoji, count) FILTER (WHERE emoji IS NOT NULL) AS reactions_summary_json
-     FROM (
-        SELECT message_id, emoji, COUNT(user_id) as count
-        FROM message_reactions
-        WHERE message_id IN (
-            SELECT id FROM chat_messages
-            WHERE (sender_user_id = $1 AND recipient_user_id = $2)
-               OR (sender_user_id = $2 AND recipient_user_id = $1)
-        )
-        GROUP BY message_id, emoji
-     ) AS grouped_reactions
-    GROUP BY message_id
-)
+const getBlockedUsers = `-- name: GetBlockedUsers :many
 SELECT
-    cm.id, cm.sender_user_id, cm.recipient_user_id, cm.message_text, cm.media_url, cm.media_type, cm.sent_at, cm.is_read,
-    COALESCE(mra.reactions_summary_json, '{}'::jsonb) AS reactions_data,
-    cm.reply_to_message_id,
-    replied_msg.sender_user_id AS replied_message_sender_id,
-    COALESCE(substring(replied_msg.message_text for 50)::TEXT, '') AS replied_message_text_snippet,
-    replied_msg.media_type AS replied_message_media_type
-FROM chat_messages cm
-LEFT JOIN MessageReactionsAgg mra ON cm.id = mra.message_id
-LEFT JOIN chat_messages replied_msg ON cm.reply_to_message_id = replied_msg.id
-WHERE (cm.sender_user_id = $1 AND cm.recipient_user_id = $2)
-   OR (cm.sender_user_id = $2 AND cm.recipient_user_id = $1)
-ORDER BY cm.sent_at ASC
+    b.blocked_user_id,
+    b.created_at AS blocked_at,
+    u.name,
+    u.last_name,
+    u.media_urls
+FROM blocks b
+JOIN users u ON u.id = b.blocked_user_id
+WHERE b.blocker_user_id = $1
+ORDER BY b.created_at DESC
 `
 
-type GetConversationMessagesParams struct {
-	SenderUserID    int32
-	RecipientUserID int32
+type GetBlockedUsersRow struct {
+	BlockedUserID int32
+	BlockedAt     pgtype.Timestamptz
+	Name          pgtype.Text
+	LastName      pgtype.Text
+	MediaUrls     []string
 }
 
-type GetConversationMessagesRow struct {
-	ID                        int64
-	SenderUserID              int32
-	RecipientUserID           int32
-	MessageText               pgtype.Text
-	MediaUrl                  pgtype.Text
-	MediaType                 pgtype.Text
-	SentAt                    pgtype.Timestamptz
-	IsRead                    bool
-	ReactionsData             []byte
-	ReplyToMessageID          pgtype.Int8
-	RepliedMessageSenderID    pgtype.Int4
-	RepliedMessageTextSnippet interface{}
-	RepliedMessageMediaType   pgtype.Text
+func (q *Queries) GetBlockedUsers(ctx context.Context, blockerUserID int32) ([]GetBlockedUsersRow, error) {
+	rows, err := q.db.Query(ctx, getBlockedUsers, blockerUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetBlockedUsersRow
+	for rows.Next() {
+		var i GetBlockedUsersRow
+		if err := rows.Scan(
+			&i.BlockedUserID,
+			&i.BlockedAt,
+			&i.Name,
+			&i.LastName,
+			&i.MediaUrls,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) GetConversationMessages(ctx context.Context, arg GetConversationMessagesParams) ([]GetConversationMessagesRow, error) {
-	rows, err := q.db.Query(ctx, getConversationMessages, arg.SenderUserID, arg.RecipientUserID)
+const getChatExcerpt = `-- name: GetChatExcerpt :many
+SELECT id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload FROM chat_messages
+WHERE (sender_user_id = $1 AND recipient_user_id = $2)
+   OR (sender_user_id = $2 AND recipient_user_id = $1)
+ORDER BY sent_at DESC, id DESC
+LIMIT $3
+`
+
+type GetChatExcerptParams struct {
+	SenderUserID    int32
+	RecipientUserID int32
+	Limit           int32
+}
+
+func (q *Queries) GetChatExcerpt(ctx context.Context, arg GetChatExcerptParams) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getChatExcerpt, arg.SenderUserID, arg.RecipientUserID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetConversationMessagesRow
+	var items []ChatMessage
 	for rows.Next() {
-		var i GetConversationMessagesRow
+		var i ChatMessage
 		if err := rows.Scan(
 			&i.ID,
 			&i.SenderUserID,
@@ -820,11 +1738,12 @@ func (q *Queries) GetConversationMessages(ctx context.Context, arg GetConversati
 			&i.MediaType,
 			&i.SentAt,
 			&i.IsRead,
-			&i.ReactionsData,
 			&i.ReplyToMessageID,
-			&i.RepliedMessageSenderID,
-			&i.RepliedMessageTextSnippet,
-			&i.RepliedMessageMediaType,
+			&i.DeliveredAt,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.Payload,
 		); err != nil {
 			return nil, err
 		}
@@ -836,46 +1755,427 @@ func (q *Queries) GetConversationMessages(ctx context.Context, arg GetConversati
 	return items, nil
 }
 
-const getHomeFeed = `-- name: GetHomeFeed :many
-WITH RequestingUser AS (
-    SELECT
-        u.id, u.latitude, u.longitude, u.gender, u.date_of_birth, u.spotlight_active_until
-    FROM users u WHERE u.id = $1
-), RequestingUserFilters AS (
-    SELECT
-        f.user_id, f.who_you_want_to_see, f.radius_km, f.active_today, f.age_min, f.age_max
-    FROM filters f WHERE f.user_id = $1
-), AllPrompts AS (
-    SELECT user_id, 'storyTime' as category, question::text, answer FROM story_time_prompts
-    UNION ALL
-    SELECT user_id, 'myType' as category, question::text, answer FROM my_type_prompts
-    UNION ALL
-    SELECT user_id, 'gettingPersonal' as category, question::text, answer FROM getting_personal_prompts
-    UNION ALL
-    SELECT user_id, 'dateVibes' as category, question::text, answer FROM date_vibes_prompts
-), AggregatedPrompts AS (
-    SELECT
-        user_id,
-        jsonb_agg(jsonb_build_object('category', category, 'question', question, 'answer', answer)) as prompts
+const getChatMessageEdits = `-- name: GetChatMessageEdits :many
+SELECT id, message_id, previous_text, edited_at FROM chat_message_edits
+WHERE message_id = $1
+ORDER BY edited_at ASC, id ASC
+`
+
+func (q *Queries) GetChatMessageEdits(ctx context.Context, messageID int64) ([]ChatMessageEdit, error) {
+	rows, err := q.db.Query(ctx, getChatMessageEdits, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatMessageEdit
+	for rows.Next() {
+		var i ChatMessageEdit
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.PreviousText,
+			&i.EditedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChatMessageForUpdate = `-- name: GetChatMessageForUpdate :one
+SELECT id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload FROM chat_messages
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetChatMessageForUpdate(ctx context.Context, id int64) (ChatMessage, error) {
+	row := q.db.QueryRow(ctx, getChatMessageForUpdate, id)
+	var i ChatMessage
+	err := row.Scan(
+		&i.ID,
+		&i.SenderUserID,
+		&i.RecipientUserID,
+		&i.MessageText,
+		&i.MediaUrl,
+		&i.MediaType,
+		&i.SentAt,
+		&i.IsRead,
+		&i.ReplyToMessageID,
+		&i.DeliveredAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.Kind,
+		&i.Payload,
+	)
+	return i, err
+}
+
+const getConversationMessages = `-- name: GetConversationMessages :many
+WITH cleared AS (
+    SELECT COALESCE(
+        (SELECT cs.cleared_before FROM conversation_settings cs WHERE cs.user_id = $1 AND cs.peer_user_id = $2),
+        '-infinity'::timestamptz
+    ) AS before
+),
+page AS (
+    SELECT id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload FROM (
+        (
+            SELECT cm1.id, cm1.sender_user_id, cm1.recipient_user_id, cm1.message_text, cm1.media_url, cm1.media_type, cm1.sent_at, cm1.is_read, cm1.reply_to_message_id, cm1.delivered_at, cm1.edited_at, cm1.deleted_at, cm1.kind, cm1.payload
+            FROM chat_messages cm1
+            WHERE cm1.sender_user_id = $1 AND cm1.recipient_user_id = $2
+              AND cm1.sent_at > (SELECT before FROM cleared)
+              AND cm1.sent_at <= $3::timestamptz
+              AND (cm1.sent_at < $3::timestamptz OR cm1.id < $4::bigint)
+            ORDER BY cm1.sent_at DESC, cm1.id DESC
+            LIMIT $5::int
+        )
+        UNION ALL
+        (
+            SELECT cm2.id, cm2.sender_user_id, cm2.recipient_user_id, cm2.message_text, cm2.media_url, cm2.media_type, cm2.sent_at, cm2.is_read, cm2.reply_to_message_id, cm2.delivered_at, cm2.edited_at, cm2.deleted_at, cm2.kind, cm2.payload
+            FROM chat_messages cm2
+            WHERE cm2.sender_user_id = $2 AND cm2.recipient_user_id = $1
+              AND cm2.sent_at > (SELECT before FROM cleared)
+              AND cm2.sent_at <= $3::timestamptz
+              AND (cm2.sent_at < $3::timestamptz OR cm2.id < $4::bigint)
+            ORDER BY cm2.sent_at DESC, cm2.id DESC
+            LIMIT $5::int
+        )
+    ) AS both_directions
+    ORDER BY sent_at DESC, id DESC
+    LIMIT $5::int
+),
+MessageReactionsAgg AS (
+    SELECT
+        message_id,
+        jsonb_object_agg(emoji, count) FILTER (WHERE emoji IS NOT NULL) AS reactions_summary_json
+     FROM (
+        SELECT message_id, emoji, COUNT(user_id) as count
+        FROM message_reactions
+        WHERE message_id IN (SELECT id FROM page)
+        GROUP BY message_id, emoji
+     ) AS grouped_reactions
+    GROUP BY message_id
+)
+SELECT
+    cm.id, cm.sender_user_id, cm.recipient_user_id, cm.message_text, cm.media_url, cm.media_type, cm.sent_at, cm.is_read,
+    COALESCE(mra.reactions_summary_json, '{}'::jsonb) AS reactions_data,
+    cm.reply_to_message_id,
+    replied_msg.sender_user_id AS replied_message_sender_id,
+    COALESCE(substring(replied_msg.message_text for 50)::TEXT, '') AS replied_message_text_snippet,
+    replied_msg.media_type AS replied_message_media_type,
+    cm.edited_at,
+    cm.deleted_at,
+    cm.delivered_at,
+    cm.kind,
+    cm.payload
+FROM page cm
+LEFT JOIN MessageReactionsAgg mra ON cm.id = mra.message_id
+LEFT JOIN chat_messages replied_msg ON cm.reply_to_message_id = replied_msg.id
+ORDER BY cm.sent_at ASC, cm.id ASC
+`
+
+type GetConversationMessagesParams struct {
+	UserID       int32
+	OtherUserID  int32
+	BeforeSentAt pgtype.Timestamptz
+	BeforeID     int64
+	PageLimit    int32
+}
+
+type GetConversationMessagesRow struct {
+	ID                        int64
+	SenderUserID              int32
+	RecipientUserID           int32
+	MessageText               pgtype.Text
+	MediaUrl                  pgtype.Text
+	MediaType                 pgtype.Text
+	SentAt                    pgtype.Timestamptz
+	IsRead                    bool
+	ReactionsData             []byte
+	ReplyToMessageID          pgtype.Int8
+	RepliedMessageSenderID    pgtype.Int4
+	RepliedMessageTextSnippet interface{}
+	RepliedMessageMediaType   pgtype.Text
+	EditedAt                  pgtype.Timestamptz
+	DeletedAt                 pgtype.Timestamptz
+	DeliveredAt               pgtype.Timestamptz
+	Kind                      ChatMessageKind
+	Payload                   []byte
+}
+
+// Messages up to the user's cleared_before for this conversation are hidden
+// from them only.
+func (q *Queries) GetConversationMessages(ctx context.Context, arg GetConversationMessagesParams) ([]GetConversationMessagesRow, error) {
+	rows, err := q.db.Query(ctx, getConversationMessages,
+		arg.UserID,
+		arg.OtherUserID,
+		arg.BeforeSentAt,
+		arg.BeforeID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetConversationMessagesRow
+	for rows.Next() {
+		var i GetConversationMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SenderUserID,
+			&i.RecipientUserID,
+			&i.MessageText,
+			&i.MediaUrl,
+			&i.MediaType,
+			&i.SentAt,
+			&i.IsRead,
+			&i.ReactionsData,
+			&i.ReplyToMessageID,
+			&i.RepliedMessageSenderID,
+			&i.RepliedMessageTextSnippet,
+			&i.RepliedMessageMediaType,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeliveredAt,
+			&i.Kind,
+			&i.Payload,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConversationMessagesAfter = `-- name: GetConversationMessagesAfter :many
+WITH cleared AS (
+    SELECT COALESCE(
+        (SELECT cs.cleared_before FROM conversation_settings cs WHERE cs.user_id = $1 AND cs.peer_user_id = $2),
+        '-infinity'::timestamptz
+    ) AS before
+),
+page AS (
+    SELECT id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload FROM (
+        (
+            SELECT cm1.id, cm1.sender_user_id, cm1.recipient_user_id, cm1.message_text, cm1.media_url, cm1.media_type, cm1.sent_at, cm1.is_read, cm1.reply_to_message_id, cm1.delivered_at, cm1.edited_at, cm1.deleted_at, cm1.kind, cm1.payload
+            FROM chat_messages cm1
+            WHERE cm1.sender_user_id = $1 AND cm1.recipient_user_id = $2
+              AND cm1.sent_at > (SELECT before FROM cleared)
+              AND cm1.sent_at >= $3::timestamptz
+              AND (cm1.sent_at > $3::timestamptz OR cm1.id > $4::bigint)
+            ORDER BY cm1.sent_at ASC, cm1.id ASC
+            LIMIT $5::int
+        )
+        UNION ALL
+        (
+            SELECT cm2.id, cm2.sender_user_id, cm2.recipient_user_id, cm2.message_text, cm2.media_url, cm2.media_type, cm2.sent_at, cm2.is_read, cm2.reply_to_message_id, cm2.delivered_at, cm2.edited_at, cm2.deleted_at, cm2.kind, cm2.payload
+            FROM chat_messages cm2
+            WHERE cm2.sender_user_id = $2 AND cm2.recipient_user_id = $1
+              AND cm2.sent_at > (SELECT before FROM cleared)
+              AND cm2.sent_at >= $3::timestamptz
+              AND (cm2.sent_at > $3::timestamptz OR cm2.id > $4::bigint)
+            ORDER BY cm2.sent_at ASC, cm2.id ASC
+            LIMIT $5::int
+        )
+    ) AS both_directions
+    ORDER BY sent_at ASC, id ASC
+    LIMIT $5::int
+),
+MessageReactionsAgg AS (
+    SELECT
+        message_id,
+        jsonb_object_agg(emoji, count) FILTER (WHERE emoji IS NOT NULL) AS reactions_summary_json
+     FROM (
+        SELECT message_id, emoji, COUNT(user_id) as count
+        FROM message_reactions
+        WHERE message_id IN (SELECT id FROM page)
+        GROUP BY message_id, emoji
+     ) AS grouped_reactions
+    GROUP BY message_id
+)
+SELECT
+    cm.id, cm.sender_user_id, cm.recipient_user_id, cm.message_text, cm.media_url, cm.media_type, cm.sent_at, cm.is_read,
+    COALESCE(mra.reactions_summary_json, '{}'::jsonb) AS reactions_data,
+    cm.reply_to_message_id,
+    replied_msg.sender_user_id AS replied_message_sender_id,
+    COALESCE(substring(replied_msg.message_text for 50)::TEXT, '') AS replied_message_text_snippet,
+    replied_msg.media_type AS replied_message_media_type,
+    cm.edited_at,
+    cm.deleted_at,
+    cm.delivered_at,
+    cm.kind,
+    cm.payload
+FROM page cm
+LEFT JOIN MessageReactionsAgg mra ON cm.id = mra.message_id
+LEFT JOIN chat_messages replied_msg ON cm.reply_to_message_id = replied_msg.id
+ORDER BY cm.sent_at ASC, cm.id ASC
+`
+
+type GetConversationMessagesAfterParams struct {
+	UserID      int32
+	OtherUserID int32
+	AfterSentAt pgtype.Timestamptz
+	AfterID     int64
+	PageLimit   int32
+}
+
+type GetConversationMessagesAfterRow struct {
+	ID                        int64
+	SenderUserID              int32
+	RecipientUserID           int32
+	MessageText               pgtype.Text
+	MediaUrl                  pgtype.Text
+	MediaType                 pgtype.Text
+	SentAt                    pgtype.Timestamptz
+	IsRead                    bool
+	ReactionsData             []byte
+	ReplyToMessageID          pgtype.Int8
+	RepliedMessageSenderID    pgtype.Int4
+	RepliedMessageTextSnippet interface{}
+	RepliedMessageMediaType   pgtype.Text
+	EditedAt                  pgtype.Timestamptz
+	DeletedAt                 pgtype.Timestamptz
+	DeliveredAt               pgtype.Timestamptz
+	Kind                      ChatMessageKind
+	Payload                   []byte
+}
+
+func (q *Queries) GetConversationMessagesAfter(ctx context.Context, arg GetConversationMessagesAfterParams) ([]GetConversationMessagesAfterRow, error) {
+	rows, err := q.db.Query(ctx, getConversationMessagesAfter,
+		arg.UserID,
+		arg.OtherUserID,
+		arg.AfterSentAt,
+		arg.AfterID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetConversationMessagesAfterRow
+	for rows.Next() {
+		var i GetConversationMessagesAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SenderUserID,
+			&i.RecipientUserID,
+			&i.MessageText,
+			&i.MediaUrl,
+			&i.MediaType,
+			&i.SentAt,
+			&i.IsRead,
+			&i.ReactionsData,
+			&i.ReplyToMessageID,
+			&i.RepliedMessageSenderID,
+			&i.RepliedMessageTextSnippet,
+			&i.RepliedMessageMediaType,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.DeliveredAt,
+			&i.Kind,
+			&i.Payload,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConversationSettings = `-- name: GetConversationSettings :one
+SELECT user_id, peer_user_id, muted_until, pinned, archived, cleared_before, updated_at FROM conversation_settings
+WHERE user_id = $1 AND peer_user_id = $2
+`
+
+type GetConversationSettingsParams struct {
+	UserID     int32
+	PeerUserID int32
+}
+
+func (q *Queries) GetConversationSettings(ctx context.Context, arg GetConversationSettingsParams) (ConversationSetting, error) {
+	row := q.db.QueryRow(ctx, getConversationSettings, arg.UserID, arg.PeerUserID)
+	var i ConversationSetting
+	err := row.Scan(
+		&i.UserID,
+		&i.PeerUserID,
+		&i.MutedUntil,
+		&i.Pinned,
+		&i.Archived,
+		&i.ClearedBefore,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getHomeFeed = `-- name: GetHomeFeed :many
+WITH RequestingUser AS (
+    SELECT
+        u.id,
+        COALESCE(tl.latitude, u.latitude) AS latitude,
+        COALESCE(tl.longitude, u.longitude) AS longitude,
+        u.gender, u.date_of_birth, u.spotlight_active_until
+    FROM users u
+    LEFT JOIN user_travel_locations tl ON tl.user_id = u.id
+        AND tl.expires_at > NOW()
+        AND EXISTS (
+            SELECT 1 FROM user_subscriptions s
+            WHERE s.user_id = tl.user_id AND s.feature_type = 'travel_mode' AND s.expires_at > NOW()
+        )
+    WHERE u.id = $1
+), RequestingUserFilters AS (
+    SELECT
+        f.user_id, f.who_you_want_to_see, f.radius_km, f.active_today, f.age_min, f.age_max
+    FROM filters f WHERE f.user_id = $1
+), AllPrompts AS (
+    SELECT user_id, 'storyTime' as category, question::text, answer FROM story_time_prompts
+    UNION ALL
+    SELECT user_id, 'myType' as category, question::text, answer FROM my_type_prompts
+    UNION ALL
+    SELECT user_id, 'gettingPersonal' as category, question::text, answer FROM getting_personal_prompts
+    UNION ALL
+    SELECT user_id, 'dateVibes' as category, question::text, answer FROM date_vibes_prompts
+), AggregatedPrompts AS (
+    SELECT
+        user_id,
+        jsonb_agg(jsonb_build_object('category', category, 'question', question, 'answer', answer)) as prompts
     FROM AllPrompts
     GROUP BY user_id
 )
 SELECT
     target_user.id, target_user.created_at, target_user.name, target_user.last_name, target_user.email, target_user.date_of_birth, target_user.latitude, target_user.longitude, target_user.gender, target_user.dating_intention, target_user.height, target_user.hometown, target_user.job_title, target_user.education, target_user.religious_beliefs, target_user.drinking_habit, target_user.smoking_habit, target_user.media_urls, target_user.verification_status, target_user.verification_pic, target_user.role, target_user.audio_prompt_question, target_user.audio_prompt_answer, target_user.spotlight_active_until, target_user.last_online, target_user.is_online,
     COALESCE(ap.prompts, '[]'::jsonb) as prompts,
-    haversine(ru.latitude, ru.longitude, target_user.latitude, target_user.longitude) AS distance_km
+    ttl.city AS visiting_city,
+    ttl.latitude AS visiting_latitude,
+    ttl.longitude AS visiting_longitude,
+    haversine(ru.latitude, ru.longitude, COALESCE(ttl.latitude, target_user.latitude), COALESCE(ttl.longitude, target_user.longitude)) AS distance_km
 FROM users AS target_user
 JOIN RequestingUser ru ON target_user.id != ru.id
 JOIN RequestingUserFilters rf ON ru.id = rf.user_id
 LEFT JOIN filters AS target_user_filters ON target_user.id = target_user_filters.user_id
 LEFT JOIN AggregatedPrompts ap ON target_user.id = ap.user_id
+LEFT JOIN user_travel_locations ttl ON ttl.user_id = target_user.id
+    AND ttl.expires_at > NOW()
+    AND EXISTS (
+        SELECT 1 FROM user_subscriptions s
+        WHERE s.user_id = ttl.user_id AND s.feature_type = 'travel_mode' AND s.expires_at > NOW()
+    )
 WHERE
-    target_user.latitude IS NOT NULL AND target_user.longitude IS NOT NULL
+    COALESCE(ttl.latitude, target_user.latitude) IS NOT NULL AND COALESCE(ttl.longitude, target_user.longitude) IS NOT NULL
     AND ru.latitude IS NOT NULL AND ru.longitude IS NOT NULL
     AND ru.gender IS NOT NULL
     AND rf.who_you_want_to_see IS NOT NULL
     AND rf.age_min IS NOT NULL AND rf.age_max IS NOT NULL
-    AND (rf.radius_km IS NULL OR haversine(ru.latitude, ru.longitude, target_user.latitude, target_user.longitude) <= rf.radius_km)
+    AND (rf.radius_km IS NULL OR haversine(ru.latitude, ru.longitude, COALESCE(ttl.latitude, target_user.latitude), COALESCE(ttl.longitude, target_user.longitude)) <= rf.radius_km)
     AND target_user.gender = rf.who_you_want_to_see
     AND (target_user_filters.user_id IS NULL OR target_user_filters.who_you_want_to_see IS NULL OR target_user_filters.who_you_want_to_see = ru.gender)
     AND target_user.date_of_birth IS NOT NULL
@@ -886,6 +2186,17 @@ WHERE
     AND NOT EXISTS (SELECT 1 FROM dislikes d WHERE d.disliker_user_id = ru.id AND d.disliked_user_id = target_user.id)
     AND NOT EXISTS (SELECT 1 FROM dislikes d WHERE d.disliker_user_id = target_user.id AND d.disliked_user_id = ru.id)
     AND NOT EXISTS (SELECT 1 FROM likes l WHERE l.liker_user_id = ru.id AND l.liked_user_id = target_user.id)
+    AND NOT EXISTS (SELECT 1 FROM account_deletions ad WHERE ad.user_id = target_user.id)
+    AND NOT EXISTS (
+        SELECT 1 FROM user_sanctions us
+        WHERE us.user_id = target_user.id AND (us.expires_at IS NULL OR us.expires_at > NOW())
+    )
+    AND NOT EXISTS (SELECT 1 FROM user_risk_scores rs WHERE rs.user_id = target_user.id AND rs.auto_hidden)
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks b
+        WHERE (b.blocker_user_id = ru.id AND b.blocked_user_id = target_user.id)
+           OR (b.blocker_user_id = target_user.id AND b.blocked_user_id = ru.id)
+    )
 ORDER BY
     CASE WHEN target_user.spotlight_active_until > NOW() THEN 0 ELSE 1 END ASC,
     distance_km ASC,
@@ -930,6 +2241,9 @@ type GetHomeFeedRow struct {
 	LastOnline           pgtype.Timestamptz
 	IsOnline             bool
 	Prompts              []byte
+	VisitingCity         pgtype.Text
+	VisitingLatitude     pgtype.Float8
+	VisitingLongitude    pgtype.Float8
 	DistanceKm           float64
 }
 
@@ -970,6 +2284,9 @@ func (q *Queries) GetHomeFeed(ctx context.Context, arg GetHomeFeedParams) ([]Get
 			&i.LastOnline,
 			&i.IsOnline,
 			&i.Prompts,
+			&i.VisitingCity,
+			&i.VisitingLatitude,
+			&i.VisitingLongitude,
 			&i.DistanceKm,
 		); err != nil {
 			return nil, err
@@ -1009,6 +2326,38 @@ func (q *Queries) GetLikeDetails(ctx context.Context, arg GetLikeDetailsParams)
 	return i, err
 }
 
+const getLikeProfileViewsByViewer = `-- name: GetLikeProfileViewsByViewer :many
+SELECT view_id, viewer_user_id, liker_user_id, like_id, view_timestamp FROM like_profile_views
+WHERE viewer_user_id = $1
+ORDER BY view_timestamp
+`
+
+func (q *Queries) GetLikeProfileViewsByViewer(ctx context.Context, viewerUserID int32) ([]LikeProfileView, error) {
+	rows, err := q.db.Query(ctx, getLikeProfileViewsByViewer, viewerUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LikeProfileView
+	for rows.Next() {
+		var i LikeProfileView
+		if err := rows.Scan(
+			&i.ViewID,
+			&i.ViewerUserID,
+			&i.LikerUserID,
+			&i.LikeID,
+			&i.ViewTimestamp,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getLikersForUser = `-- name: GetLikersForUser :many
 SELECT
     l.id AS like_id,
@@ -1019,7 +2368,9 @@ SELECT
     l.created_at as liked_at,
     u.name,
     u.last_name,
-    u.media_urls
+    u.media_urls,
+    (CASE WHEN l.interaction_type = 'rose' THEN 0 ELSE 2 END
+        + CASE WHEN COALESCE(l.is_seen, false) THEN 1 ELSE 0 END)::int AS sort_rank
 FROM likes l
 JOIN users u ON l.liker_user_id = u.id
 WHERE l.liked_user_id = $1
@@ -1029,15 +2380,44 @@ WHERE l.liked_user_id = $1
       WHERE l2.liker_user_id = l.liked_user_id
         AND l2.liked_user_id = l.liker_user_id
   )
-ORDER BY
-    (l.interaction_type = 'rose') DESC,
-    l.is_seen ASC,
-    l.created_at DESC
-`
-
-type GetLikersForUserRow struct {
-	LikeID          int32
-	LikerUserID     int32
+  AND NOT EXISTS (
+      SELECT 1
+      FROM blocks b
+      WHERE (b.blocker_user_id = l.liked_user_id AND b.blocked_user_id = l.liker_user_id)
+         OR (b.blocker_user_id = l.liker_user_id AND b.blocked_user_id = l.liked_user_id)
+  )
+  AND NOT EXISTS (
+      SELECT 1
+      FROM user_sanctions us
+      WHERE us.user_id = l.liker_user_id AND (us.expires_at IS NULL OR us.expires_at > NOW())
+  )
+  AND (
+      (CASE WHEN l.interaction_type = 'rose' THEN 0 ELSE 2 END
+          + CASE WHEN COALESCE(l.is_seen, false) THEN 1 ELSE 0 END) > $2::int
+      OR (
+          (CASE WHEN l.interaction_type = 'rose' THEN 0 ELSE 2 END
+              + CASE WHEN COALESCE(l.is_seen, false) THEN 1 ELSE 0 END) = $2::int
+          AND (l.created_at, l.id) < ($3::timestamptz, $4::int)
+      )
+  )
+ORDER BY
+    sort_rank ASC,
+    l.created_at DESC,
+    l.id DESC
+LIMIT $5::int
+`
+
+type GetLikersForUserParams struct {
+	LikedUserID    int32
+	AfterRank      int32
+	AfterCreatedAt pgtype.Timestamptz
+	AfterID        int32
+	PageLimit      int32
+}
+
+type GetLikersForUserRow struct {
+	LikeID          int32
+	LikerUserID     int32
 	Comment         pgtype.Text
 	InteractionType LikeInteractionType
 	IsSeen          pgtype.Bool
@@ -1045,10 +2425,17 @@ type GetLikersForUserRow struct {
 	Name            pgtype.Text
 	LastName        pgtype.Text
 	MediaUrls       []string
+	SortRank        int32
 }
 
-func (q *Queries) GetLikersForUser(ctx context.Context, likedUserID int32) ([]GetLikersForUserRow, error) {
-	rows, err := q.db.Query(ctx, getLikersForUser, likedUserID)
+func (q *Queries) GetLikersForUser(ctx context.Context, arg GetLikersForUserParams) ([]GetLikersForUserRow, error) {
+	rows, err := q.db.Query(ctx, getLikersForUser,
+		arg.LikedUserID,
+		arg.AfterRank,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -1066,6 +2453,43 @@ func (q *Queries) GetLikersForUser(ctx context.Context, likedUserID int32) ([]Ge
 			&i.Name,
 			&i.LastName,
 			&i.MediaUrls,
+			&i.SortRank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLikesSentByUser = `-- name: GetLikesSentByUser :many
+SELECT id, liker_user_id, liked_user_id, content_type, content_identifier, comment, interaction_type, is_seen, created_at FROM likes
+WHERE liker_user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetLikesSentByUser(ctx context.Context, likerUserID int32) ([]Like, error) {
+	rows, err := q.db.Query(ctx, getLikesSentByUser, likerUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Like
+	for rows.Next() {
+		var i Like
+		if err := rows.Scan(
+			&i.ID,
+			&i.LikerUserID,
+			&i.LikedUserID,
+			&i.ContentType,
+			&i.ContentIdentifier,
+			&i.Comment,
+			&i.InteractionType,
+			&i.IsSeen,
+			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1088,6 +2512,12 @@ JOIN
   AND l1.liked_user_id = l2.liker_user_id
 WHERE
   l1.liker_user_id = $1
+  AND NOT EXISTS (
+    SELECT 1
+    FROM blocks b
+    WHERE (b.blocker_user_id = l1.liker_user_id AND b.blocked_user_id = l1.liked_user_id)
+       OR (b.blocker_user_id = l1.liked_user_id AND b.blocked_user_id = l1.liker_user_id)
+  )
 `
 
 func (q *Queries) GetMatchIDs(ctx context.Context, likerUserID int32) ([]int32, error) {
@@ -1129,7 +2559,13 @@ SELECT
         WHERE cm_unread.recipient_user_id = l1.liker_user_id
           AND cm_unread.sender_user_id = l1.liked_user_id
           AND cm_unread.is_read = false
-    ) AS unread_message_count
+          AND cm_unread.sent_at > COALESCE(cs.cleared_before, '-infinity'::timestamptz)
+    ) AS unread_message_count,
+    cs.muted_until,
+    COALESCE(cs.pinned, false) AS pinned,
+    COALESCE(cs.archived, false) AS archived,
+    (CASE WHEN COALESCE(cs.pinned, false) THEN 0 ELSE 1 END)::int AS sort_rank,
+    COALESCE(last_event.event_at, to_timestamp(0))::timestamptz AS sort_event_at
 FROM
     likes l1
 JOIN
@@ -1139,21 +2575,30 @@ JOIN
     likes l2
     ON l1.liked_user_id = l2.liker_user_id
    AND l1.liker_user_id = l2.liked_user_id
+LEFT JOIN
+    conversation_settings cs
+    ON cs.user_id = l1.liker_user_id
+   AND cs.peer_user_id = l1.liked_user_id
 LEFT JOIN LATERAL (
     (
         SELECT
             cm.sent_at AS event_at,
             cm.sender_user_id AS event_user_id,
             CASE
+                WHEN cm.deleted_at IS NOT NULL THEN 'deleted'
+                WHEN cm.kind IN ('location', 'date_proposal') THEN cm.kind::TEXT
                 WHEN cm.message_text IS NOT NULL THEN 'text'
                 ELSE 'media'
             END AS event_type,
-            COALESCE(cm.message_text, cm.media_type) AS event_content,
+            COALESCE(cm.message_text, cm.media_type, cm.payload->>'name', cm.payload->>'place_name') AS event_content,
             cm.media_url AS event_extra
         FROM chat_messages cm
         WHERE
-            (cm.sender_user_id = l1.liker_user_id AND cm.recipient_user_id = l1.liked_user_id)
-            OR (cm.sender_user_id = l1.liked_user_id AND cm.recipient_user_id = l1.liker_user_id)
+            (
+                (cm.sender_user_id = l1.liker_user_id AND cm.recipient_user_id = l1.liked_user_id)
+                OR (cm.sender_user_id = l1.liked_user_id AND cm.recipient_user_id = l1.liker_user_id)
+            )
+            AND cm.sent_at > COALESCE(cs.cleared_before, '-infinity'::timestamptz)
 
         UNION ALL
 
@@ -1172,17 +2617,49 @@ LEFT JOIN LATERAL (
                 (cm_react.sender_user_id = l1.liker_user_id AND cm_react.recipient_user_id = l1.liked_user_id)
                 OR (cm_react.sender_user_id = l1.liked_user_id AND cm_react.recipient_user_id = l1.liker_user_id)
             )
+            AND cm_react.sent_at > COALESCE(cs.cleared_before, '-infinity'::timestamptz)
     )
     ORDER BY event_at DESC
     LIMIT 1
 ) AS last_event ON true
 WHERE
     l1.liker_user_id = $1
+    AND NOT EXISTS (
+        SELECT 1
+        FROM blocks b
+        WHERE (b.blocker_user_id = l1.liker_user_id AND b.blocked_user_id = l1.liked_user_id)
+           OR (b.blocker_user_id = l1.liked_user_id AND b.blocked_user_id = l1.liker_user_id)
+    )
+    AND COALESCE(cs.archived, false) = $2::boolean
+    AND (
+        (CASE WHEN COALESCE(cs.pinned, false) THEN 0 ELSE 1 END) > $3::int
+        OR (
+            (CASE WHEN COALESCE(cs.pinned, false) THEN 0 ELSE 1 END) = $3::int
+            AND (
+                COALESCE(last_event.event_at, to_timestamp(0)) < $4::timestamptz
+                OR (
+                    COALESCE(last_event.event_at, to_timestamp(0)) = $4::timestamptz
+                    AND target_user.id > $5::int
+                )
+            )
+        )
+    )
 ORDER BY
-    COALESCE(last_event.event_at, '1970-01-01'::timestamptz) DESC,
+    sort_rank ASC,
+    COALESCE(last_event.event_at, to_timestamp(0)) DESC,
     target_user.id
+LIMIT $6::int
 `
 
+type GetMatchesWithLastEventParams struct {
+	LikerUserID  int32
+	Archived     bool
+	AfterRank    int32
+	AfterEventAt pgtype.Timestamptz
+	AfterUserID  int32
+	PageLimit    int32
+}
+
 type GetMatchesWithLastEventRow struct {
 	MatchedUserID         int32
 	MatchedUserName       pgtype.Text
@@ -1196,10 +2673,22 @@ type GetMatchesWithLastEventRow struct {
 	LastEventContent      string
 	LastEventExtra        string
 	UnreadMessageCount    int64
+	MutedUntil            pgtype.Timestamptz
+	Pinned                bool
+	Archived              bool
+	SortRank              int32
+	SortEventAt           pgtype.Timestamptz
 }
 
-func (q *Queries) GetMatchesWithLastEvent(ctx context.Context, likerUserID int32) ([]GetMatchesWithLastEventRow, error) {
-	rows, err := q.db.Query(ctx, getMatchesWithLastEvent, likerUserID)
+func (q *Queries) GetMatchesWithLastEvent(ctx context.Context, arg GetMatchesWithLastEventParams) ([]GetMatchesWithLastEventRow, error) {
+	rows, err := q.db.Query(ctx, getMatchesWithLastEvent,
+		arg.LikerUserID,
+		arg.Archived,
+		arg.AfterRank,
+		arg.AfterEventAt,
+		arg.AfterUserID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -1220,6 +2709,11 @@ func (q *Queries) GetMatchesWithLastEvent(ctx context.Context, likerUserID int32
 			&i.LastEventContent,
 			&i.LastEventExtra,
 			&i.UnreadMessageCount,
+			&i.MutedUntil,
+			&i.Pinned,
+			&i.Archived,
+			&i.SortRank,
+			&i.SortEventAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1232,7 +2726,7 @@ func (q *Queries) GetMatchesWithLastEvent(ctx context.Context, likerUserID int32
 }
 
 const getMessageSenderRecipient = `-- name: GetMessageSenderRecipient :one
-SELECT sender_user_id, recipient_user_id
+SELECT sender_user_id, recipient_user_id, deleted_at
 FROM chat_messages
 WHERE id = $1
 LIMIT 1
@@ -1241,15 +2735,139 @@ LIMIT 1
 type GetMessageSenderRecipientRow struct {
 	SenderUserID    int32
 	RecipientUserID int32
+	DeletedAt       pgtype.Timestamptz
 }
 
 func (q *Queries) GetMessageSenderRecipient(ctx context.Context, id int64) (GetMessageSenderRecipientRow, error) {
 	row := q.db.QueryRow(ctx, getMessageSenderRecipient, id)
 	var i GetMessageSenderRecipientRow
-	err := row.Scan(&i.SenderUserID, &i.RecipientUserID)
+	err := row.Scan(&i.SenderUserID, &i.RecipientUserID, &i.DeletedAt)
+	return i, err
+}
+
+const getModerationActionsForUser = `-- name: GetModerationActionsForUser :many
+SELECT id, admin_user_id, target_user_id, action, reason, suspended_until, created_at FROM moderation_actions
+WHERE target_user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetModerationActionsForUser(ctx context.Context, targetUserID int32) ([]ModerationAction, error) {
+	rows, err := q.db.Query(ctx, getModerationActionsForUser, targetUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ModerationAction
+	for rows.Next() {
+		var i ModerationAction
+		if err := rows.Scan(
+			&i.ID,
+			&i.AdminUserID,
+			&i.TargetUserID,
+			&i.Action,
+			&i.Reason,
+			&i.SuspendedUntil,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNotificationPreferences = `-- name: GetNotificationPreferences :one
+SELECT user_id, new_message, new_like, new_match, quiet_hours_start, quiet_hours_end, timezone, updated_at FROM notification_preferences
+WHERE user_id = $1
+`
+
+func (q *Queries) GetNotificationPreferences(ctx context.Context, userID int32) (NotificationPreference, error) {
+	row := q.db.QueryRow(ctx, getNotificationPreferences, userID)
+	var i NotificationPreference
+	err := row.Scan(
+		&i.UserID,
+		&i.NewMessage,
+		&i.NewLike,
+		&i.NewMatch,
+		&i.QuietHoursStart,
+		&i.QuietHoursEnd,
+		&i.Timezone,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getOpenReportSignals = `-- name: GetOpenReportSignals :one
+SELECT
+    COUNT(*) FILTER (WHERE r.created_at >= $1::timestamptz) AS reports_in_window,
+    COUNT(DISTINCT r.reporter_user_id) AS distinct_reporters,
+    COUNT(*) FILTER (WHERE r.reason = 'minor') AS minor_reports,
+    COUNT(*) FILTER (WHERE r.reason = 'fakeProfile') AS fake_profile_reports
+FROM reports r
+WHERE r.reported_user_id = $2
+  AND NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id)
+`
+
+type GetOpenReportSignalsParams struct {
+	VelocitySince  pgtype.Timestamptz
+	ReportedUserID int32
+}
+
+type GetOpenReportSignalsRow struct {
+	ReportsInWindow    int64
+	DistinctReporters  int64
+	MinorReports       int64
+	FakeProfileReports int64
+}
+
+func (q *Queries) GetOpenReportSignals(ctx context.Context, arg GetOpenReportSignalsParams) (GetOpenReportSignalsRow, error) {
+	row := q.db.QueryRow(ctx, getOpenReportSignals, arg.VelocitySince, arg.ReportedUserID)
+	var i GetOpenReportSignalsRow
+	err := row.Scan(
+		&i.ReportsInWindow,
+		&i.DistinctReporters,
+		&i.MinorReports,
+		&i.FakeProfileReports,
+	)
 	return i, err
 }
 
+const getOpenReportsForUser = `-- name: GetOpenReportsForUser :many
+SELECT r.id, r.reporter_user_id, r.reported_user_id, r.reason, r.created_at FROM reports r
+WHERE r.reported_user_id = $1
+  AND NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id)
+ORDER BY r.created_at DESC
+`
+
+func (q *Queries) GetOpenReportsForUser(ctx context.Context, reportedUserID int32) ([]Report, error) {
+	rows, err := q.db.Query(ctx, getOpenReportsForUser, reportedUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Report
+	for rows.Next() {
+		var i Report
+		if err := rows.Scan(
+			&i.ID,
+			&i.ReporterUserID,
+			&i.ReportedUserID,
+			&i.Reason,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPendingVerificationUsers = `-- name: GetPendingVerificationUsers :many
 SELECT id, created_at, name, last_name, email, date_of_birth, latitude, longitude, gender, dating_intention, height, hometown, job_title, education, religious_beliefs, drinking_habit, smoking_habit, media_urls, verification_status, verification_pic, role, audio_prompt_question, audio_prompt_answer, spotlight_active_until, last_online, is_online FROM users
 WHERE verification_status = $1
@@ -1346,18 +2964,172 @@ func (q *Queries) GetPhotoAverageViewDurations(ctx context.Context, arg GetPhoto
 	return items, nil
 }
 
+const getPhotoViewDurationsByViewer = `-- name: GetPhotoViewDurationsByViewer :many
+SELECT view_id, viewer_user_id, viewed_user_id, photo_index, duration_ms, view_timestamp FROM photo_view_durations
+WHERE viewer_user_id = $1
+ORDER BY view_timestamp
+`
+
+func (q *Queries) GetPhotoViewDurationsByViewer(ctx context.Context, viewerUserID int32) ([]PhotoViewDuration, error) {
+	rows, err := q.db.Query(ctx, getPhotoViewDurationsByViewer, viewerUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PhotoViewDuration
+	for rows.Next() {
+		var i PhotoViewDuration
+		if err := rows.Scan(
+			&i.ViewID,
+			&i.ViewerUserID,
+			&i.ViewedUserID,
+			&i.PhotoIndex,
+			&i.DurationMs,
+			&i.ViewTimestamp,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getProfileImpressionsByViewer = `-- name: GetProfileImpressionsByViewer :many
+SELECT impression_id, viewer_user_id, shown_user_id, impression_timestamp, source FROM user_profile_impressions
+WHERE viewer_user_id = $1
+ORDER BY impression_timestamp
+`
+
+func (q *Queries) GetProfileImpressionsByViewer(ctx context.Context, viewerUserID int32) ([]UserProfileImpression, error) {
+	rows, err := q.db.Query(ctx, getProfileImpressionsByViewer, viewerUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserProfileImpression
+	for rows.Next() {
+		var i UserProfileImpression
+		if err := rows.Scan(
+			&i.ImpressionID,
+			&i.ViewerUserID,
+			&i.ShownUserID,
+			&i.ImpressionTimestamp,
+			&i.Source,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPurchaseByTransaction = `-- name: GetPurchaseByTransaction :one
+SELECT id, user_id, platform, transaction_id, original_transaction_id, purchase_token, product_id, environment, purchased_at, expires_at, revoked_at, created_at FROM purchases
+WHERE platform = $1 AND transaction_id = $2
+`
+
+type GetPurchaseByTransactionParams struct {
+	Platform      PurchasePlatform
+	TransactionID string
+}
+
+func (q *Queries) GetPurchaseByTransaction(ctx context.Context, arg GetPurchaseByTransactionParams) (Purchase, error) {
+	row := q.db.QueryRow(ctx, getPurchaseByTransaction, arg.Platform, arg.TransactionID)
+	var i Purchase
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Platform,
+		&i.TransactionID,
+		&i.OriginalTransactionID,
+		&i.PurchaseToken,
+		&i.ProductID,
+		&i.Environment,
+		&i.PurchasedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getPurchaseGrants = `-- name: GetPurchaseGrants :many
+SELECT id, user_id, purchase_id, user_subscription_id, feature_type, event, quantity, expires_at, source, notification_type, created_at FROM entitlement_history
+WHERE purchase_id = $1 AND event IN ('granted', 'renewed')
+ORDER BY id
+`
+
+// What a purchase granted, to undo on refund.
+func (q *Queries) GetPurchaseGrants(ctx context.Context, purchaseID pgtype.Int8) ([]EntitlementHistory, error) {
+	rows, err := q.db.Query(ctx, getPurchaseGrants, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EntitlementHistory
+	for rows.Next() {
+		var i EntitlementHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.PurchaseID,
+			&i.UserSubscriptionID,
+			&i.FeatureType,
+			&i.Event,
+			&i.Quantity,
+			&i.ExpiresAt,
+			&i.Source,
+			&i.NotificationType,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getQuickFeed = `-- name: GetQuickFeed :many
 SELECT
     target_user.id, target_user.created_at, target_user.name, target_user.last_name, target_user.email, target_user.date_of_birth, target_user.latitude, target_user.longitude, target_user.gender, target_user.dating_intention, target_user.height, target_user.hometown, target_user.job_title, target_user.education, target_user.religious_beliefs, target_user.drinking_habit, target_user.smoking_habit, target_user.media_urls, target_user.verification_status, target_user.verification_pic, target_user.role, target_user.audio_prompt_question, target_user.audio_prompt_answer, target_user.spotlight_active_until, target_user.last_online, target_user.is_online,
-    haversine($1, $2, target_user.latitude, target_user.longitude) AS distance_km
+    ttl.city AS visiting_city,
+    ttl.latitude AS visiting_latitude,
+    ttl.longitude AS visiting_longitude,
+    haversine($1, $2, COALESCE(ttl.latitude, target_user.latitude), COALESCE(ttl.longitude, target_user.longitude)) AS distance_km
 FROM users AS target_user
+LEFT JOIN user_travel_locations ttl ON ttl.user_id = target_user.id
+    AND ttl.expires_at > NOW()
+    AND EXISTS (
+        SELECT 1 FROM user_subscriptions s
+        WHERE s.user_id = ttl.user_id AND s.feature_type = 'travel_mode' AND s.expires_at > NOW()
+    )
 WHERE
       target_user.id != $3
-  AND target_user.latitude IS NOT NULL
-  AND target_user.longitude IS NOT NULL
+  AND COALESCE(ttl.latitude, target_user.latitude) IS NOT NULL
+  AND COALESCE(ttl.longitude, target_user.longitude) IS NOT NULL
   AND target_user.gender = $4
   AND target_user.name IS NOT NULL AND target_user.name != ''
   AND target_user.date_of_birth IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM account_deletions ad WHERE ad.user_id = target_user.id)
+  AND NOT EXISTS (
+      SELECT 1 FROM user_sanctions us
+      WHERE us.user_id = target_user.id AND (us.expires_at IS NULL OR us.expires_at > NOW())
+  )
+  AND NOT EXISTS (SELECT 1 FROM user_risk_scores rs WHERE rs.user_id = target_user.id AND rs.auto_hidden)
+  AND NOT EXISTS (
+      SELECT 1 FROM blocks b
+      WHERE (b.blocker_user_id = $3 AND b.blocked_user_id = target_user.id)
+         OR (b.blocker_user_id = target_user.id AND b.blocked_user_id = $3)
+  )
 ORDER BY
     distance_km ASC
 LIMIT $5
@@ -1398,6 +3170,9 @@ type GetQuickFeedRow struct {
 	SpotlightActiveUntil pgtype.Timestamptz
 	LastOnline           pgtype.Timestamptz
 	IsOnline             bool
+	VisitingCity         pgtype.Text
+	VisitingLatitude     pgtype.Float8
+	VisitingLongitude    pgtype.Float8
 	DistanceKm           float64
 }
 
@@ -1443,6 +3218,9 @@ func (q *Queries) GetQuickFeed(ctx context.Context, arg GetQuickFeedParams) ([]G
 			&i.SpotlightActiveUntil,
 			&i.LastOnline,
 			&i.IsOnline,
+			&i.VisitingCity,
+			&i.VisitingLatitude,
+			&i.VisitingLongitude,
 			&i.DistanceKm,
 		); err != nil {
 			return nil, err
@@ -1455,64 +3233,289 @@ func (q *Queries) GetQuickFeed(ctx context.Context, arg GetQuickFeedParams) ([]G
 	return items, nil
 }
 
-const getSingleReactionByUser = `-- name: GetSingleReactionByUser :one
-SELECT id, message_id, user_id, emoji, created_at, updated_at
-FROM message_reactions
-WHERE message_id = $1 AND user_id = $2
-LIMIT 1
+const getRefreshTokenByHashForUpdate = `-- name: GetRefreshTokenByHashForUpdate :one
+SELECT id, user_id, token_hash, family_id, expires_at, created_at, revoked_at, replaced_by_id FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE
 `
 
-type GetSingleReactionByUserParams struct {
-	MessageID int64
-	UserID    int32
-}
-
-func (q *Queries) GetSingleReactionByUser(ctx context.Context, arg GetSingleReactionByUserParams) (MessageReaction, error) {
-	row := q.db.QueryRow(ctx, getSingleReactionByUser, arg.MessageID, arg.UserID)
-	var i MessageReaction
+func (q *Queries) GetRefreshTokenByHashForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, getRefreshTokenByHashForUpdate, tokenHash)
+	var i RefreshToken
 	err := row.Scan(
 		&i.ID,
-		&i.MessageID,
 		&i.UserID,
-		&i.Emoji,
+		&i.TokenHash,
+		&i.FamilyID,
+		&i.ExpiresAt,
 		&i.CreatedAt,
-		&i.UpdatedAt,
+		&i.RevokedAt,
+		&i.ReplacedByID,
 	)
 	return i, err
 }
 
-const getTotalUnreadCount = `-- name: GetTotalUnreadCount :one
-SELECT COUNT(*)
-FROM chat_messages
-WHERE recipient_user_id = $1
-  AND is_read = false
+const getReportQueue = `-- name: GetReportQueue :many
+SELECT
+    q.reported_user_id,
+    u.name,
+    u.last_name,
+    u.media_urls,
+    q.open_report_count,
+    q.reason_counts,
+    q.first_reported_at,
+    q.last_reported_at
+FROM (
+    SELECT
+        per_reason.reported_user_id,
+        SUM(per_reason.report_count)::bigint AS open_report_count,
+        jsonb_object_agg(per_reason.reason, per_reason.report_count) AS reason_counts,
+        MIN(per_reason.first_reported_at)::timestamptz AS first_reported_at,
+        MAX(per_reason.last_reported_at)::timestamptz AS last_reported_at
+    FROM (
+        SELECT
+            r.reported_user_id,
+            r.reason,
+            COUNT(*) AS report_count,
+            MIN(r.created_at) AS first_reported_at,
+            MAX(r.created_at) AS last_reported_at
+        FROM reports r
+        WHERE NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id)
+        GROUP BY r.reported_user_id, r.reason
+    ) per_reason
+    GROUP BY per_reason.reported_user_id
+) q
+JOIN users u ON u.id = q.reported_user_id
+ORDER BY q.open_report_count DESC, q.last_reported_at DESC
+LIMIT $1 OFFSET $2
 `
 
-func (q *Queries) GetTotalUnreadCount(ctx context.Context, recipientUserID int32) (int64, error) {
-	row := q.db.QueryRow(ctx, getTotalUnreadCount, recipientUserID)
-	var count int64
-	err := row.Scan(&count)
-	return count, err
+type GetReportQueueParams struct {
+	Limit  int32
+	Offset int32
 }
 
-const getUnseenLikeCount = `-- name: GetUnseenLikeCount :one
-SELECT COUNT(*)
-FROM likes l
-WHERE l.liked_user_id = $1 -- The user receiving the likes
-  AND l.is_seen = false
-  AND NOT EXISTS ( -- Ensure it's not a mutual like
-      SELECT 1
-      FROM likes l2
-      WHERE l2.liker_user_id = l.liked_user_id -- The recipient liked the liker back
-        AND l2.liked_user_id = l.liker_user_id
-  )
-`
-
-func (q *Queries) GetUnseenLikeCount(ctx context.Context, likedUserID int32) (int64, error) {
-	row := q.db.QueryRow(ctx, getUnseenLikeCount, likedUserID)
-	var count int64
-	err := row.Scan(&count)
-	return count, err
+type GetReportQueueRow struct {
+	ReportedUserID  int32
+	Name            pgtype.Text
+	LastName        pgtype.Text
+	MediaUrls       []string
+	OpenReportCount int64
+	ReasonCounts    []byte
+	FirstReportedAt pgtype.Timestamptz
+	LastReportedAt  pgtype.Timestamptz
+}
+
+func (q *Queries) GetReportQueue(ctx context.Context, arg GetReportQueueParams) ([]GetReportQueueRow, error) {
+	rows, err := q.db.Query(ctx, getReportQueue, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReportQueueRow
+	for rows.Next() {
+		var i GetReportQueueRow
+		if err := rows.Scan(
+			&i.ReportedUserID,
+			&i.Name,
+			&i.LastName,
+			&i.MediaUrls,
+			&i.OpenReportCount,
+			&i.ReasonCounts,
+			&i.FirstReportedAt,
+			&i.LastReportedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReportsFiledByUser = `-- name: GetReportsFiledByUser :many
+SELECT id, reporter_user_id, reported_user_id, reason, created_at FROM reports
+WHERE reporter_user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetReportsFiledByUser(ctx context.Context, reporterUserID int32) ([]Report, error) {
+	rows, err := q.db.Query(ctx, getReportsFiledByUser, reporterUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Report
+	for rows.Next() {
+		var i Report
+		if err := rows.Scan(
+			&i.ID,
+			&i.ReporterUserID,
+			&i.ReportedUserID,
+			&i.Reason,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSingleReactionByUser = `-- name: GetSingleReactionByUser :one
+SELECT id, message_id, user_id, emoji, created_at, updated_at
+FROM message_reactions
+WHERE message_id = $1 AND user_id = $2
+LIMIT 1
+`
+
+type GetSingleReactionByUserParams struct {
+	MessageID int64
+	UserID    int32
+}
+
+func (q *Queries) GetSingleReactionByUser(ctx context.Context, arg GetSingleReactionByUserParams) (MessageReaction, error) {
+	row := q.db.QueryRow(ctx, getSingleReactionByUser, arg.MessageID, arg.UserID)
+	var i MessageReaction
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.UserID,
+		&i.Emoji,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getStoreProduct = `-- name: GetStoreProduct :one
+SELECT product_id, display_name, description, subscription, active, sort_order, created_at, updated_at FROM store_products
+WHERE product_id = $1
+`
+
+func (q *Queries) GetStoreProduct(ctx context.Context, productID string) (StoreProduct, error) {
+	row := q.db.QueryRow(ctx, getStoreProduct, productID)
+	var i StoreProduct
+	err := row.Scan(
+		&i.ProductID,
+		&i.DisplayName,
+		&i.Description,
+		&i.Subscription,
+		&i.Active,
+		&i.SortOrder,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getSubscriptionsForStoreSubscription = `-- name: GetSubscriptionsForStoreSubscription :many
+SELECT us.id, us.user_id, us.feature_type, us.activated_at, us.expires_at, us.purchase_id, us.created_at FROM user_subscriptions us
+JOIN purchases p ON p.id = us.purchase_id
+WHERE p.platform = $1
+  AND (p.original_transaction_id = $2 OR p.purchase_token = $2)
+ORDER BY us.feature_type, us.expires_at DESC
+FOR UPDATE OF us
+`
+
+type GetSubscriptionsForStoreSubscriptionParams struct {
+	Platform              PurchasePlatform
+	OriginalTransactionID pgtype.Text
+}
+
+// Finds the subscriptions paid for by a store subscription, identified by
+// the App Store original transaction ID or the Play purchase token, and
+// locks them. Bundles pay for one per feature.
+func (q *Queries) GetSubscriptionsForStoreSubscription(ctx context.Context, arg GetSubscriptionsForStoreSubscriptionParams) ([]UserSubscription, error) {
+	rows, err := q.db.Query(ctx, getSubscriptionsForStoreSubscription, arg.Platform, arg.OriginalTransactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserSubscription
+	for rows.Next() {
+		var i UserSubscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.FeatureType,
+			&i.ActivatedAt,
+			&i.ExpiresAt,
+			&i.PurchaseID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTotalUnreadCount = `-- name: GetTotalUnreadCount :one
+SELECT COUNT(*)
+FROM chat_messages cm
+LEFT JOIN conversation_settings cs
+    ON cs.user_id = cm.recipient_user_id AND cs.peer_user_id = cm.sender_user_id
+WHERE cm.recipient_user_id = $1
+  AND cm.is_read = false
+  AND (cs.muted_until IS NULL OR cs.muted_until <= NOW())
+  AND (cs.cleared_before IS NULL OR cm.sent_at > cs.cleared_before)
+`
+
+// Muted conversations and cleared history don't count towards the badge.
+func (q *Queries) GetTotalUnreadCount(ctx context.Context, recipientUserID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, getTotalUnreadCount, recipientUserID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getTravelLocation = `-- name: GetTravelLocation :one
+SELECT user_id, latitude, longitude, city, expires_at, created_at, updated_at FROM user_travel_locations
+WHERE user_id = $1
+`
+
+func (q *Queries) GetTravelLocation(ctx context.Context, userID int32) (UserTravelLocation, error) {
+	row := q.db.QueryRow(ctx, getTravelLocation, userID)
+	var i UserTravelLocation
+	err := row.Scan(
+		&i.UserID,
+		&i.Latitude,
+		&i.Longitude,
+		&i.City,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getUnseenLikeCount = `-- name: GetUnseenLikeCount :one
+SELECT COUNT(*)
+FROM likes l
+WHERE l.liked_user_id = $1 -- The user receiving the likes
+  AND l.is_seen = false
+  AND NOT EXISTS ( -- Ensure it's not a mutual like
+      SELECT 1
+      FROM likes l2
+      WHERE l2.liker_user_id = l.liked_user_id -- The recipient liked the liker back
+        AND l2.liked_user_id = l.liker_user_id
+  )
+`
+
+func (q *Queries) GetUnseenLikeCount(ctx context.Context, likedUserID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, getUnseenLikeCount, likedUserID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
 }
 
 const getUserAudioPrompt = `-- name: GetUserAudioPrompt :one
@@ -1664,6 +3667,98 @@ func (q *Queries) GetUserDateVibesPrompts(ctx context.Context, userID int32) ([]
 	return items, nil
 }
 
+const getUserDevicePushTokens = `-- name: GetUserDevicePushTokens :many
+SELECT id, user_id, platform, token, session_id, created_at, updated_at FROM device_push_tokens
+WHERE user_id = $1
+ORDER BY updated_at DESC
+LIMIT 10
+`
+
+func (q *Queries) GetUserDevicePushTokens(ctx context.Context, userID int32) ([]DevicePushToken, error) {
+	rows, err := q.db.Query(ctx, getUserDevicePushTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DevicePushToken
+	for rows.Next() {
+		var i DevicePushToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Platform,
+			&i.Token,
+			&i.SessionID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserEventBounds = `-- name: GetUserEventBounds :one
+SELECT
+    COALESCE((SELECT last_seq FROM user_event_sequences s WHERE s.user_id = $1), 0)::bigint AS latest_seq,
+    COALESCE((SELECT MIN(seq) FROM user_events e WHERE e.user_id = $1), 0)::bigint AS oldest_seq
+`
+
+type GetUserEventBoundsRow struct {
+	LatestSeq int64
+	OldestSeq int64
+}
+
+func (q *Queries) GetUserEventBounds(ctx context.Context, userID int32) (GetUserEventBoundsRow, error) {
+	row := q.db.QueryRow(ctx, getUserEventBounds, userID)
+	var i GetUserEventBoundsRow
+	err := row.Scan(&i.LatestSeq, &i.OldestSeq)
+	return i, err
+}
+
+const getUserEventsAfter = `-- name: GetUserEventsAfter :many
+SELECT user_id, seq, event_type, payload, created_at FROM user_events
+WHERE user_id = $1 AND seq > $2
+ORDER BY seq ASC
+LIMIT $3
+`
+
+type GetUserEventsAfterParams struct {
+	UserID int32
+	Seq    int64
+	Limit  int32
+}
+
+func (q *Queries) GetUserEventsAfter(ctx context.Context, arg GetUserEventsAfterParams) ([]UserEvent, error) {
+	rows, err := q.db.Query(ctx, getUserEventsAfter, arg.UserID, arg.Seq, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserEvent
+	for rows.Next() {
+		var i UserEvent
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Seq,
+			&i.EventType,
+			&i.Payload,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserFilters = `-- name: GetUserFilters :one
 SELECT user_id, who_you_want_to_see, radius_km, active_today, age_min, age_max, created_at, updated_at FROM filters
 WHERE user_id = $1 LIMIT 1
@@ -1714,6 +3809,57 @@ func (q *Queries) GetUserGettingPersonalPrompts(ctx context.Context, userID int3
 	return items, nil
 }
 
+const getUserIDByIdentity = `-- name: GetUserIDByIdentity :one
+SELECT user_id FROM user_identities
+WHERE provider = $1 AND subject = $2
+`
+
+type GetUserIDByIdentityParams struct {
+	Provider string
+	Subject  string
+}
+
+func (q *Queries) GetUserIDByIdentity(ctx context.Context, arg GetUserIDByIdentityParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getUserIDByIdentity, arg.Provider, arg.Subject)
+	var user_id int32
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const getUserIdentities = `-- name: GetUserIdentities :many
+SELECT id, user_id, provider, subject, email, created_at, last_used_at FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetUserIdentities(ctx context.Context, userID int32) ([]UserIdentity, error) {
+	rows, err := q.db.Query(ctx, getUserIdentities, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserIdentity
+	for rows.Next() {
+		var i UserIdentity
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Provider,
+			&i.Subject,
+			&i.Email,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserLastOnline = `-- name: GetUserLastOnline :one
 SELECT last_online FROM users
 WHERE id = $1 LIMIT 1
@@ -1804,20 +3950,12 @@ func (q *Queries) GetUserReactionsForMessages(ctx context.Context, arg GetUserRe
 }
 
 const getUserSpotlightActivationTimes = `-- name: GetUserSpotlightActivationTimes :many
-SELECT
-    updated_at as potentially_activated_at,
-    u.spotlight_active_until as expires_at
-FROM user_consumables uc
-JOIN users u ON uc.user_id = u.id
-WHERE uc.user_id = $1
-  AND uc.consumable_type = 'spotlight'
-  AND u.spotlight_active_until IS NOT NULL
-  AND (
-       ($2::timestamptz IS NULL OR u.spotlight_active_until >= $2)
-       AND
-       ($3::timestamptz IS NULL OR uc.updated_at <= $3)
-      )
-ORDER BY u.spotlight_active_until DESC
+SELECT activated_at, expires_at
+FROM spotlight_activations
+WHERE user_id = $1
+  AND ($2::timestamptz IS NULL OR expires_at >= $2)
+  AND ($3::timestamptz IS NULL OR activated_at <= $3)
+ORDER BY activated_at DESC
 `
 
 type GetUserSpotlightActivationTimesParams struct {
@@ -1827,8 +3965,8 @@ type GetUserSpotlightActivationTimesParams struct {
 }
 
 type GetUserSpotlightActivationTimesRow struct {
-	PotentiallyActivatedAt pgtype.Timestamptz
-	ExpiresAt              pgtype.Timestamptz
+	ActivatedAt pgtype.Timestamptz
+	ExpiresAt   pgtype.Timestamptz
 }
 
 func (q *Queries) GetUserSpotlightActivationTimes(ctx context.Context, arg GetUserSpotlightActivationTimesParams) ([]GetUserSpotlightActivationTimesRow, error) {
@@ -1840,7 +3978,7 @@ func (q *Queries) GetUserSpotlightActivationTimes(ctx context.Context, arg GetUs
 	var items []GetUserSpotlightActivationTimesRow
 	for rows.Next() {
 		var i GetUserSpotlightActivationTimesRow
-		if err := rows.Scan(&i.PotentiallyActivatedAt, &i.ExpiresAt); err != nil {
+		if err := rows.Scan(&i.ActivatedAt, &i.ExpiresAt); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -1880,31 +4018,232 @@ func (q *Queries) GetUserStoryTimePrompts(ctx context.Context, userID int32) ([]
 	return items, nil
 }
 
-const logLikeProfileView = `-- name: LogLikeProfileView :exec
-INSERT INTO like_profile_views (
-    viewer_user_id, liker_user_id, like_id
-) VALUES (
-    $1, $2, $3
-)
+const isBlockedBetween = `-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_user_id = $1 AND blocked_user_id = $2)
+       OR (blocker_user_id = $2 AND blocked_user_id = $1)
+) AS blocked
 `
 
-type LogLikeProfileViewParams struct {
-	ViewerUserID int32
-	LikerUserID  int32
-	LikeID       int32
+type IsBlockedBetweenParams struct {
+	BlockerUserID int32
+	BlockedUserID int32
 }
 
-func (q *Queries) LogLikeProfileView(ctx context.Context, arg LogLikeProfileViewParams) error {
-	_, err := q.db.Exec(ctx, logLikeProfileView, arg.ViewerUserID, arg.LikerUserID, arg.LikeID)
-	return err
+func (q *Queries) IsBlockedBetween(ctx context.Context, arg IsBlockedBetweenParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isBlockedBetween, arg.BlockerUserID, arg.BlockedUserID)
+	var blocked bool
+	err := row.Scan(&blocked)
+	return blocked, err
 }
 
-const logPhotoViewDuration = `-- name: LogPhotoViewDuration :exec
-INSERT INTO photo_view_durations (
-    viewer_user_id, viewed_user_id, photo_index, duration_ms
-) VALUES (
-    $1, $2, $3, $4
-)
+const isTokenRevoked = `-- name: IsTokenRevoked :one
+SELECT (
+    EXISTS (SELECT 1 FROM revoked_sessions rs WHERE rs.session_id = $1)
+    OR EXISTS (
+        SELECT 1 FROM user_session_cutoffs usc
+        WHERE usc.user_id = $2 AND usc.revoked_before > $3
+    )
+)::boolean AS revoked
+`
+
+type IsTokenRevokedParams struct {
+	SessionID string
+	UserID    int32
+	IssuedAt  pgtype.Timestamptz
+}
+
+func (q *Queries) IsTokenRevoked(ctx context.Context, arg IsTokenRevokedParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isTokenRevoked, arg.SessionID, arg.UserID, arg.IssuedAt)
+	var revoked bool
+	err := row.Scan(&revoked)
+	return revoked, err
+}
+
+const listAccountsDueForPurge = `-- name: ListAccountsDueForPurge :many
+SELECT user_id FROM account_deletions
+WHERE purge_after <= NOW()
+ORDER BY purge_after
+LIMIT $1
+`
+
+func (q *Queries) ListAccountsDueForPurge(ctx context.Context, limit int32) ([]int32, error) {
+	rows, err := q.db.Query(ctx, listAccountsDueForPurge, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var user_id int32
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listActiveStoreProducts = `-- name: ListActiveStoreProducts :many
+SELECT product_id, display_name, description, subscription, active, sort_order, created_at, updated_at FROM store_products
+WHERE active
+ORDER BY sort_order, product_id
+`
+
+func (q *Queries) ListActiveStoreProducts(ctx context.Context) ([]StoreProduct, error) {
+	rows, err := q.db.Query(ctx, listActiveStoreProducts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StoreProduct
+	for rows.Next() {
+		var i StoreProduct
+		if err := rows.Scan(
+			&i.ProductID,
+			&i.DisplayName,
+			&i.Description,
+			&i.Subscription,
+			&i.Active,
+			&i.SortOrder,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRiskCandidates = `-- name: ListRiskCandidates :many
+SELECT DISTINCT r.reported_user_id AS user_id
+FROM reports r
+WHERE NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id)
+UNION
+SELECT rs.user_id
+FROM user_risk_scores rs
+WHERE rs.score > 0
+`
+
+func (q *Queries) ListRiskCandidates(ctx context.Context) ([]int32, error) {
+	rows, err := q.db.Query(ctx, listRiskCandidates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var user_id int32
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStoreProductGrants = `-- name: ListStoreProductGrants :many
+SELECT id, product_id, feature_type, quantity, duration FROM store_product_grants
+WHERE product_id = ANY($1::text[])
+ORDER BY product_id, id
+`
+
+func (q *Queries) ListStoreProductGrants(ctx context.Context, productIds []string) ([]StoreProductGrant, error) {
+	rows, err := q.db.Query(ctx, listStoreProductGrants, productIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StoreProductGrant
+	for rows.Next() {
+		var i StoreProductGrant
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProductID,
+			&i.FeatureType,
+			&i.Quantity,
+			&i.Duration,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStoreProducts = `-- name: ListStoreProducts :many
+SELECT product_id, display_name, description, subscription, active, sort_order, created_at, updated_at FROM store_products
+ORDER BY sort_order, product_id
+`
+
+func (q *Queries) ListStoreProducts(ctx context.Context) ([]StoreProduct, error) {
+	rows, err := q.db.Query(ctx, listStoreProducts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StoreProduct
+	for rows.Next() {
+		var i StoreProduct
+		if err := rows.Scan(
+			&i.ProductID,
+			&i.DisplayName,
+			&i.Description,
+			&i.Subscription,
+			&i.Active,
+			&i.SortOrder,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const logLikeProfileView = `-- name: LogLikeProfileView :exec
+INSERT INTO like_profile_views (
+    viewer_user_id, liker_user_id, like_id
+) VALUES (
+    $1, $2, $3
+)
+`
+
+type LogLikeProfileViewParams struct {
+	ViewerUserID int32
+	LikerUserID  int32
+	LikeID       int32
+}
+
+func (q *Queries) LogLikeProfileView(ctx context.Context, arg LogLikeProfileViewParams) error {
+	_, err := q.db.Exec(ctx, logLikeProfileView, arg.ViewerUserID, arg.LikerUserID, arg.LikeID)
+	return err
+}
+
+const logPhotoViewDuration = `-- name: LogPhotoViewDuration :exec
+INSERT INTO photo_view_durations (
+    viewer_user_id, viewed_user_id, photo_index, duration_ms
+) VALUES (
+    $1, $2, $3, $4
+)
 `
 
 type LogPhotoViewDurationParams struct {
@@ -1924,101 +4263,724 @@ func (q *Queries) LogPhotoViewDuration(ctx context.Context, arg LogPhotoViewDura
 	return err
 }
 
-const logUserProfileImpression = `-- name: LogUserProfileImpression :exec
-INSERT INTO user_profile_impressions (
-    viewer_user_id, shown_user_id, source
-) VALUES (
-    $1, $2, $3
+const logUserProfileImpression = `-- name: LogUserProfileImpression :exec
+INSERT INTO user_profile_impressions (
+    viewer_user_id, shown_user_id, source
+) VALUES (
+    $1, $2, $3
+)
+`
+
+type LogUserProfileImpressionParams struct {
+	ViewerUserID int32
+	ShownUserID  int32
+	Source       string
+}
+
+func (q *Queries) LogUserProfileImpression(ctx context.Context, arg LogUserProfileImpressionParams) error {
+	_, err := q.db.Exec(ctx, logUserProfileImpression, arg.ViewerUserID, arg.ShownUserID, arg.Source)
+	return err
+}
+
+const markChatAsReadOnUnmatch = `-- name: MarkChatAsReadOnUnmatch :execresult
+UPDATE chat_messages
+SET is_read = true
+WHERE is_read = false
+  AND (
+       (recipient_user_id = $1 AND sender_user_id = $2)
+    OR (recipient_user_id = $2 AND sender_user_id = $1)
+  )
+`
+
+type MarkChatAsReadOnUnmatchParams struct {
+	RecipientUserID int32
+	SenderUserID    int32
+}
+
+func (q *Queries) MarkChatAsReadOnUnmatch(ctx context.Context, arg MarkChatAsReadOnUnmatchParams) (pgconn.CommandTag, error) {
+	return q.db.Exec(ctx, markChatAsReadOnUnmatch, arg.RecipientUserID, arg.SenderUserID)
+}
+
+const markLikesAsSeenUntil = `-- name: MarkLikesAsSeenUntil :execresult
+UPDATE likes
+SET is_seen = true
+WHERE liked_user_id = $1
+  AND id <= $2
+  AND is_seen = false
+`
+
+type MarkLikesAsSeenUntilParams struct {
+	LikedUserID int32
+	ID          int32
+}
+
+func (q *Queries) MarkLikesAsSeenUntil(ctx context.Context, arg MarkLikesAsSeenUntilParams) (pgconn.CommandTag, error) {
+	return q.db.Exec(ctx, markLikesAsSeenUntil, arg.LikedUserID, arg.ID)
+}
+
+const markMessagesAsReadUntil = `-- name: MarkMessagesAsReadUntil :execresult
+UPDATE chat_messages
+SET is_read = true, delivered_at = COALESCE(delivered_at, NOW())
+WHERE recipient_user_id = $1
+  AND sender_user_id = $2
+  AND id <= $3
+  AND is_read = false
+`
+
+type MarkMessagesAsReadUntilParams struct {
+	RecipientUserID int32
+	SenderUserID    int32
+	ID              int64
+}
+
+func (q *Queries) MarkMessagesAsReadUntil(ctx context.Context, arg MarkMessagesAsReadUntilParams) (pgconn.CommandTag, error) {
+	return q.db.Exec(ctx, markMessagesAsReadUntil, arg.RecipientUserID, arg.SenderUserID, arg.ID)
+}
+
+const markMessagesDeliveredUntil = `-- name: MarkMessagesDeliveredUntil :execrows
+UPDATE chat_messages
+SET delivered_at = NOW()
+WHERE recipient_user_id = $1
+  AND sender_user_id = $2
+  AND id <= $3
+  AND delivered_at IS NULL
+`
+
+type MarkMessagesDeliveredUntilParams struct {
+	RecipientUserID int32
+	SenderUserID    int32
+	ID              int64
+}
+
+func (q *Queries) MarkMessagesDeliveredUntil(ctx context.Context, arg MarkMessagesDeliveredUntilParams) (int64, error) {
+	result, err := q.db.Exec(ctx, markMessagesDeliveredUntil, arg.RecipientUserID, arg.SenderUserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const markOutboxEventsPublished = `-- name: MarkOutboxEventsPublished :exec
+UPDATE event_outbox
+SET published_at = NOW()
+WHERE id = ANY($1::bigint[])
+`
+
+func (q *Queries) MarkOutboxEventsPublished(ctx context.Context, ids []int64) error {
+	_, err := q.db.Exec(ctx, markOutboxEventsPublished, ids)
+	return err
+}
+
+const markPushNotificationFailed = `-- name: MarkPushNotificationFailed :exec
+UPDATE push_outbox
+SET status = 'failed', last_error = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type MarkPushNotificationFailedParams struct {
+	ID        int64
+	LastError pgtype.Text
+}
+
+func (q *Queries) MarkPushNotificationFailed(ctx context.Context, arg MarkPushNotificationFailedParams) error {
+	_, err := q.db.Exec(ctx, markPushNotificationFailed, arg.ID, arg.LastError)
+	return err
+}
+
+const markPushNotificationsSent = `-- name: MarkPushNotificationsSent :exec
+UPDATE push_outbox
+SET status = 'sent', last_error = NULL, updated_at = NOW()
+WHERE id = ANY($1::bigint[])
+`
+
+func (q *Queries) MarkPushNotificationsSent(ctx context.Context, ids []int64) error {
+	_, err := q.db.Exec(ctx, markPushNotificationsSent, ids)
+	return err
+}
+
+const markRefreshTokenRotated = `-- name: MarkRefreshTokenRotated :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    replaced_by_id = $2
+WHERE id = $1
+`
+
+type MarkRefreshTokenRotatedParams struct {
+	ID           int64
+	ReplacedByID pgtype.Int8
+}
+
+func (q *Queries) MarkRefreshTokenRotated(ctx context.Context, arg MarkRefreshTokenRotatedParams) error {
+	_, err := q.db.Exec(ctx, markRefreshTokenRotated, arg.ID, arg.ReplacedByID)
+	return err
+}
+
+const pruneEventOutbox = `-- name: PruneEventOutbox :execrows
+DELETE FROM event_outbox
+WHERE (published_at IS NOT NULL AND published_at < $1)
+   OR created_at < $2
+`
+
+type PruneEventOutboxParams struct {
+	PublishedBefore pgtype.Timestamptz
+	CreatedBefore   pgtype.Timestamptz
+}
+
+// Unpublished events are dropped too once they are older than the event
+// log retention; clients that missed them get a sync_reset.
+func (q *Queries) PruneEventOutbox(ctx context.Context, arg PruneEventOutboxParams) (int64, error) {
+	result, err := q.db.Exec(ctx, pruneEventOutbox, arg.PublishedBefore, arg.CreatedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const prunePushOutbox = `-- name: PrunePushOutbox :execrows
+DELETE FROM push_outbox
+WHERE status IN ('sent', 'failed')
+  AND created_at < $1
+`
+
+func (q *Queries) PrunePushOutbox(ctx context.Context, createdAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, prunePushOutbox, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const pruneUserEvents = `-- name: PruneUserEvents :execrows
+DELETE FROM user_events
+WHERE created_at < $1
+`
+
+func (q *Queries) PruneUserEvents(ctx context.Context, createdAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, pruneUserEvents, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recordEntitlementEvent = `-- name: RecordEntitlementEvent :exec
+INSERT INTO entitlement_history (
+    user_id, purchase_id, user_subscription_id, feature_type, event,
+    quantity, expires_at, source, notification_type
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+`
+
+type RecordEntitlementEventParams struct {
+	UserID             pgtype.Int4
+	PurchaseID         pgtype.Int8
+	UserSubscriptionID pgtype.Int4
+	FeatureType        PremiumFeatureType
+	Event              EntitlementEvent
+	Quantity           pgtype.Int4
+	ExpiresAt          pgtype.Timestamptz
+	Source             string
+	NotificationType   pgtype.Text
+}
+
+func (q *Queries) RecordEntitlementEvent(ctx context.Context, arg RecordEntitlementEventParams) error {
+	_, err := q.db.Exec(ctx, recordEntitlementEvent,
+		arg.UserID,
+		arg.PurchaseID,
+		arg.UserSubscriptionID,
+		arg.FeatureType,
+		arg.Event,
+		arg.Quantity,
+		arg.ExpiresAt,
+		arg.Source,
+		arg.NotificationType,
+	)
+	return err
+}
+
+const recordPurchase = `-- name: RecordPurchase :one
+INSERT INTO purchases (
+    user_id, platform, transaction_id, original_transaction_id, purchase_token,
+    product_id, environment, purchased_at, expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+ON CONFLICT (platform, transaction_id) DO NOTHING
+RETURNING id, user_id, platform, transaction_id, original_transaction_id, purchase_token, product_id, environment, purchased_at, expires_at, revoked_at, created_at
+`
+
+type RecordPurchaseParams struct {
+	UserID                pgtype.Int4
+	Platform              PurchasePlatform
+	TransactionID         string
+	OriginalTransactionID pgtype.Text
+	PurchaseToken         pgtype.Text
+	ProductID             string
+	Environment           string
+	PurchasedAt           pgtype.Timestamptz
+	ExpiresAt             pgtype.Timestamptz
+}
+
+// Returns no row if the purchase was already recorded.
+func (q *Queries) RecordPurchase(ctx context.Context, arg RecordPurchaseParams) (Purchase, error) {
+	row := q.db.QueryRow(ctx, recordPurchase,
+		arg.UserID,
+		arg.Platform,
+		arg.TransactionID,
+		arg.OriginalTransactionID,
+		arg.PurchaseToken,
+		arg.ProductID,
+		arg.Environment,
+		arg.PurchasedAt,
+		arg.ExpiresAt,
+	)
+	var i Purchase
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Platform,
+		&i.TransactionID,
+		&i.OriginalTransactionID,
+		&i.PurchaseToken,
+		&i.ProductID,
+		&i.Environment,
+		&i.PurchasedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const recordStoreNotification = `-- name: RecordStoreNotification :one
+INSERT INTO store_notifications (platform, notification_id, notification_type)
+VALUES ($1, $2, $3)
+ON CONFLICT (platform, notification_id) DO NOTHING
+RETURNING notification_id
+`
+
+type RecordStoreNotificationParams struct {
+	Platform         PurchasePlatform
+	NotificationID   string
+	NotificationType string
+}
+
+// Returns no row if the notification was already applied.
+func (q *Queries) RecordStoreNotification(ctx context.Context, arg RecordStoreNotificationParams) (string, error) {
+	row := q.db.QueryRow(ctx, recordStoreNotification, arg.Platform, arg.NotificationID, arg.NotificationType)
+	var notification_id string
+	err := row.Scan(&notification_id)
+	return notification_id, err
+}
+
+const requestAccountDeletion = `-- name: RequestAccountDeletion :one
+INSERT INTO account_deletions (user_id, purge_after)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET purge_after = account_deletions.purge_after
+RETURNING user_id, requested_at, purge_after
+`
+
+type RequestAccountDeletionParams struct {
+	UserID     int32
+	PurgeAfter pgtype.Timestamptz
+}
+
+func (q *Queries) RequestAccountDeletion(ctx context.Context, arg RequestAccountDeletionParams) (AccountDeletion, error) {
+	row := q.db.QueryRow(ctx, requestAccountDeletion, arg.UserID, arg.PurgeAfter)
+	var i AccountDeletion
+	err := row.Scan(&i.UserID, &i.RequestedAt, &i.PurgeAfter)
+	return i, err
+}
+
+const resolveOpenReportsForUser = `-- name: ResolveOpenReportsForUser :execrows
+INSERT INTO report_resolutions (report_id, action_id)
+SELECT r.id, $1::bigint
+FROM reports r
+WHERE r.reported_user_id = $2
+  AND NOT EXISTS (SELECT 1 FROM report_resolutions rr WHERE rr.report_id = r.id)
+`
+
+type ResolveOpenReportsForUserParams struct {
+	ActionID       int64
+	ReportedUserID int32
+}
+
+func (q *Queries) ResolveOpenReportsForUser(ctx context.Context, arg ResolveOpenReportsForUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, resolveOpenReportsForUser, arg.ActionID, arg.ReportedUserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const respondToDateProposal = `-- name: RespondToDateProposal :one
+UPDATE chat_messages
+SET payload = jsonb_set(
+        jsonb_set(payload, '{status}', to_jsonb($1::text)),
+        '{responded_at}', to_jsonb(NOW())
+    )
+WHERE id = $2
+  AND recipient_user_id = $3
+  AND kind = 'date_proposal'
+  AND deleted_at IS NULL
+  AND payload->>'status' = 'pending'
+RETURNING id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload
+`
+
+type RespondToDateProposalParams struct {
+	Status          string
+	ID              int64
+	RecipientUserID int32
+}
+
+func (q *Queries) RespondToDateProposal(ctx context.Context, arg RespondToDateProposalParams) (ChatMessage, error) {
+	row := q.db.QueryRow(ctx, respondToDateProposal, arg.Status, arg.ID, arg.RecipientUserID)
+	var i ChatMessage
+	err := row.Scan(
+		&i.ID,
+		&i.SenderUserID,
+		&i.RecipientUserID,
+		&i.MessageText,
+		&i.MediaUrl,
+		&i.MediaType,
+		&i.SentAt,
+		&i.IsRead,
+		&i.ReplyToMessageID,
+		&i.DeliveredAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.Kind,
+		&i.Payload,
+	)
+	return i, err
+}
+
+const retryPushNotification = `-- name: RetryPushNotification :execrows
+UPDATE push_outbox p
+SET status = 'pending', next_attempt_at = $2, last_error = $3, updated_at = NOW()
+WHERE p.id = $1
+  AND NOT EXISTS (
+      SELECT 1 FROM push_outbox o
+      WHERE o.user_id = p.user_id
+        AND o.collapse_key = p.collapse_key
+        AND o.status = 'pending'
+  )
+`
+
+type RetryPushNotificationParams struct {
+	ID            int64
+	NextAttemptAt pgtype.Timestamptz
+	LastError     pgtype.Text
+}
+
+// Does nothing if a newer notification with the same collapse key is
+// already pending; that one supersedes the retry.
+func (q *Queries) RetryPushNotification(ctx context.Context, arg RetryPushNotificationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, retryPushNotification, arg.ID, arg.NextAttemptAt, arg.LastError)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokePurchase = `-- name: RevokePurchase :one
+UPDATE purchases
+SET revoked_at = NOW()
+WHERE platform = $1 AND transaction_id = $2 AND revoked_at IS NULL
+RETURNING id, user_id, platform, transaction_id, original_transaction_id, purchase_token, product_id, environment, purchased_at, expires_at, revoked_at, created_at
+`
+
+type RevokePurchaseParams struct {
+	Platform      PurchasePlatform
+	TransactionID string
+}
+
+// Returns no row if the purchase is unknown or was already revoked.
+func (q *Queries) RevokePurchase(ctx context.Context, arg RevokePurchaseParams) (Purchase, error) {
+	row := q.db.QueryRow(ctx, revokePurchase, arg.Platform, arg.TransactionID)
+	var i Purchase
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Platform,
+		&i.TransactionID,
+		&i.OriginalTransactionID,
+		&i.PurchaseToken,
+		&i.ProductID,
+		&i.Environment,
+		&i.PurchasedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE family_id = $1
+  AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	_, err := q.db.Exec(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :exec
+INSERT INTO revoked_sessions (session_id, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (session_id) DO NOTHING
+`
+
+type RevokeSessionParams struct {
+	SessionID string
+	UserID    int32
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) error {
+	_, err := q.db.Exec(ctx, revokeSession, arg.SessionID, arg.UserID, arg.ExpiresAt)
+	return err
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+  AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, revokeUserRefreshTokens, userID)
+	return err
+}
+
+const searchChatMessages = `-- name: SearchChatMessages :many
+WITH search AS (
+    SELECT websearch_to_tsquery('simple', $5::text) AS query
+),
+current_matches AS (
+    SELECT l1.liked_user_id AS other_user_id,
+           COALESCE(cs.cleared_before, '-infinity'::timestamptz) AS cleared_before
+    FROM likes l1
+    LEFT JOIN conversation_settings cs
+        ON cs.user_id = l1.liker_user_id AND cs.peer_user_id = l1.liked_user_id
+    WHERE l1.liker_user_id = $1
+      AND EXISTS (SELECT 1 FROM likes l2 WHERE l2.liker_user_id = l1.liked_user_id AND l2.liked_user_id = l1.liker_user_id)
+      AND NOT EXISTS (
+          SELECT 1 FROM blocks b
+          WHERE (b.blocker_user_id = l1.liker_user_id AND b.blocked_user_id = l1.liked_user_id)
+             OR (b.blocker_user_id = l1.liked_user_id AND b.blocked_user_id = l1.liker_user_id)
+      )
 )
+SELECT
+    cm.id,
+    cm.sender_user_id,
+    cm.sent_at,
+    m.other_user_id,
+    u.name AS other_user_name,
+    u.last_name AS other_user_last_name,
+    u.media_urls AS other_user_media_urls,
+    -- The text is HTML-escaped before highlighting, so the only markup in
+    -- the snippet is the <mark> tags ts_headline adds.
+    ts_headline('simple',
+        replace(replace(replace(replace(replace(COALESCE(cm.message_text, ''),
+            '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'),
+        search.query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')::text AS snippet
+FROM search, current_matches m
+JOIN chat_messages cm
+    ON (cm.sender_user_id = $1 AND cm.recipient_user_id = m.other_user_id)
+    OR (cm.sender_user_id = m.other_user_id AND cm.recipient_user_id = $1)
+JOIN users u ON u.id = m.other_user_id
+WHERE to_tsvector('simple', COALESCE(cm.message_text, '')) @@ search.query
+  AND cm.deleted_at IS NULL
+  AND cm.sent_at > m.cleared_before
+  AND cm.sent_at <= $2::timestamptz
+  AND (cm.sent_at < $2::timestamptz OR cm.id < $3::bigint)
+ORDER BY cm.sent_at DESC, cm.id DESC
+LIMIT $4::int
 `
 
-type LogUserProfileImpressionParams struct {
-	ViewerUserID int32
-	ShownUserID  int32
-	Source       string
+type SearchChatMessagesParams struct {
+	UserID       int32
+	BeforeSentAt pgtype.Timestamptz
+	BeforeID     int64
+	PageLimit    int32
+	Query        string
+}
+
+type SearchChatMessagesRow struct {
+	ID                 int64
+	SenderUserID       int32
+	SentAt             pgtype.Timestamptz
+	OtherUserID        int32
+	OtherUserName      pgtype.Text
+	OtherUserLastName  pgtype.Text
+	OtherUserMediaUrls []string
+	Snippet            string
+}
+
+// Only conversations that are still matches, using the same conditions as
+// CheckMutualLikeExists (likes both ways, no block either way).
+func (q *Queries) SearchChatMessages(ctx context.Context, arg SearchChatMessagesParams) ([]SearchChatMessagesRow, error) {
+	rows, err := q.db.Query(ctx, searchChatMessages,
+		arg.UserID,
+		arg.BeforeSentAt,
+		arg.BeforeID,
+		arg.PageLimit,
+		arg.Query,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChatMessagesRow
+	for rows.Next() {
+		var i SearchChatMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SenderUserID,
+			&i.SentAt,
+			&i.OtherUserID,
+			&i.OtherUserName,
+			&i.OtherUserLastName,
+			&i.OtherUserMediaUrls,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) LogUserProfileImpression(ctx context.Context, arg LogUserProfileImpressionParams) error {
-	_, err := q.db.Exec(ctx, logUserProfileImpression, arg.ViewerUserID, arg.ShownUserID, arg.Source)
+const setUserSessionCutoff = `-- name: SetUserSessionCutoff :exec
+INSERT INTO user_session_cutoffs (user_id, revoked_before)
+VALUES ($1, date_trunc('second', NOW()))
+ON CONFLICT (user_id) DO UPDATE
+SET revoked_before = date_trunc('second', NOW()),
+    updated_at = NOW()
+`
+
+// Token iat claims have whole seconds, so the cutoff is truncated to match;
+// otherwise a login in the same second as the logout would be revoked.
+func (q *Queries) SetUserSessionCutoff(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, setUserSessionCutoff, userID)
 	return err
 }
 
-const markChatAsReadOnUnmatch = `-- name: MarkChatAsReadOnUnmatch :execresult
-UPDATE chat_messages
-SET is_read = true
-WHERE is_read = false
-  AND (
-       (recipient_user_id = $1 AND sender_user_id = $2)
-    OR (recipient_user_id = $2 AND sender_user_id = $1)
-  )
+const startLegacyTokenGrace = `-- name: StartLegacyTokenGrace :one
+INSERT INTO legacy_token_grace (id) VALUES (TRUE)
+ON CONFLICT (id) DO UPDATE SET id = legacy_token_grace.id
+RETURNING started_at
 `
 
-type MarkChatAsReadOnUnmatchParams struct {
-	RecipientUserID int32
-	SenderUserID    int32
-}
-
-func (q *Queries) MarkChatAsReadOnUnmatch(ctx context.Context, arg MarkChatAsReadOnUnmatchParams) (pgconn.CommandTag, error) {
-	return q.db.Exec(ctx, markChatAsReadOnUnmatch, arg.RecipientUserID, arg.SenderUserID)
+func (q *Queries) StartLegacyTokenGrace(ctx context.Context) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, startLegacyTokenGrace)
+	var started_at pgtype.Timestamptz
+	err := row.Scan(&started_at)
+	return started_at, err
 }
 
-const markLikesAsSeenUntil = `-- name: MarkLikesAsSeenUntil :execresult
-UPDATE likes
-SET is_seen = true
-WHERE liked_user_id = $1
-  AND id <= $2
-  AND is_seen = false
+const startUserSpotlight = `-- name: StartUserSpotlight :one
+UPDATE users
+SET spotlight_active_until = NOW() + make_interval(secs => $1::float8)
+WHERE id = $2
+  AND (spotlight_active_until IS NULL OR spotlight_active_until <= NOW())
+RETURNING spotlight_active_until
 `
 
-type MarkLikesAsSeenUntilParams struct {
-	LikedUserID int32
-	ID          int32
+type StartUserSpotlightParams struct {
+	DurationSeconds float64
+	ID              int32
 }
 
-func (q *Queries) MarkLikesAsSeenUntil(ctx context.Context, arg MarkLikesAsSeenUntilParams) (pgconn.CommandTag, error) {
-	return q.db.Exec(ctx, markLikesAsSeenUntil, arg.LikedUserID, arg.ID)
+// Starts the user's spotlight unless one is already running.
+func (q *Queries) StartUserSpotlight(ctx context.Context, arg StartUserSpotlightParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, startUserSpotlight, arg.DurationSeconds, arg.ID)
+	var spotlight_active_until pgtype.Timestamptz
+	err := row.Scan(&spotlight_active_until)
+	return spotlight_active_until, err
 }
 
-const markMessagesAsReadUntil = `-- name: MarkMessagesAsReadUntil :execresult
-UPDATE chat_messages
-SET is_read = true
-WHERE recipient_user_id = $1
-  AND sender_user_id = $2
-  AND id <= $3
-  AND is_read = false
+const syncUserPresence = `-- name: SyncUserPresence :exec
+UPDATE users u
+SET is_online = p.is_online,
+    last_online = GREATEST(u.last_online, p.last_online)
+FROM (
+    SELECT
+        unnest($1::int[]) AS user_id,
+        unnest($2::timestamptz[]) AS last_online,
+        unnest($3::bool[]) AS is_online
+) p
+WHERE u.id = p.user_id
 `
 
-type MarkMessagesAsReadUntilParams struct {
-	RecipientUserID int32
-	SenderUserID    int32
-	ID              int64
+type SyncUserPresenceParams struct {
+	UserIds     []int32
+	LastOnlines []pgtype.Timestamptz
+	OnlineFlags []bool
 }
 
-func (q *Queries) MarkMessagesAsReadUntil(ctx context.Context, arg MarkMessagesAsReadUntilParams) (pgconn.CommandTag, error) {
-	return q.db.Exec(ctx, markMessagesAsReadUntil, arg.RecipientUserID, arg.SenderUserID, arg.ID)
+// Writes presence tracked in Redis back to users. last_online never moves
+// backwards, since app opens also set it.
+func (q *Queries) SyncUserPresence(ctx context.Context, arg SyncUserPresenceParams) error {
+	_, err := q.db.Exec(ctx, syncUserPresence, arg.UserIds, arg.LastOnlines, arg.OnlineFlags)
+	return err
 }
 
-const setUserOffline = `-- name: SetUserOffline :exec
-UPDATE users
-SET is_online = false,
-    last_online = NOW()
-WHERE id = $1
+const tombstoneChatMessage = `-- name: TombstoneChatMessage :one
+UPDATE chat_messages
+SET message_text = NULL, media_url = NULL, media_type = NULL, payload = NULL, deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload
 `
 
-func (q *Queries) SetUserOffline(ctx context.Context, id int32) error {
-	_, err := q.db.Exec(ctx, setUserOffline, id)
-	return err
+func (q *Queries) TombstoneChatMessage(ctx context.Context, id int64) (ChatMessage, error) {
+	row := q.db.QueryRow(ctx, tombstoneChatMessage, id)
+	var i ChatMessage
+	err := row.Scan(
+		&i.ID,
+		&i.SenderUserID,
+		&i.RecipientUserID,
+		&i.MessageText,
+		&i.MediaUrl,
+		&i.MediaType,
+		&i.SentAt,
+		&i.IsRead,
+		&i.ReplyToMessageID,
+		&i.DeliveredAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.Kind,
+		&i.Payload,
+	)
+	return i, err
 }
 
-const setUserOnline = `-- name: SetUserOnline :exec
-UPDATE users
-SET is_online = true
-WHERE id = $1
+const unblockUser = `-- name: UnblockUser :execrows
+DELETE FROM blocks
+WHERE blocker_user_id = $1 AND blocked_user_id = $2
 `
 
-func (q *Queries) SetUserOnline(ctx context.Context, id int32) error {
-	_, err := q.db.Exec(ctx, setUserOnline, id)
-	return err
+type UnblockUserParams struct {
+	BlockerUserID int32
+	BlockedUserID int32
+}
+
+func (q *Queries) UnblockUser(ctx context.Context, arg UnblockUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, unblockUser, arg.BlockerUserID, arg.BlockedUserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const updateAudioPrompt = `-- name: UpdateAudioPrompt :one
@@ -2047,6 +5009,40 @@ func (q *Queries) UpdateAudioPrompt(ctx context.Context, arg UpdateAudioPromptPa
 	return i, err
 }
 
+const updateChatMessageText = `-- name: UpdateChatMessageText :one
+UPDATE chat_messages
+SET message_text = $2, edited_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, sender_user_id, recipient_user_id, message_text, media_url, media_type, sent_at, is_read, reply_to_message_id, delivered_at, edited_at, deleted_at, kind, payload
+`
+
+type UpdateChatMessageTextParams struct {
+	ID          int64
+	MessageText pgtype.Text
+}
+
+func (q *Queries) UpdateChatMessageText(ctx context.Context, arg UpdateChatMessageTextParams) (ChatMessage, error) {
+	row := q.db.QueryRow(ctx, updateChatMessageText, arg.ID, arg.MessageText)
+	var i ChatMessage
+	err := row.Scan(
+		&i.ID,
+		&i.SenderUserID,
+		&i.RecipientUserID,
+		&i.MessageText,
+		&i.MediaUrl,
+		&i.MediaType,
+		&i.SentAt,
+		&i.IsRead,
+		&i.ReplyToMessageID,
+		&i.DeliveredAt,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.Kind,
+		&i.Payload,
+	)
+	return i, err
+}
+
 const updateLastOnline = `-- name: UpdateLastOnline :exec
 UPDATE users
 SET last_online = NOW()
@@ -2058,6 +5054,79 @@ func (q *Queries) UpdateLastOnline(ctx context.Context, id int32) error {
 	return err
 }
 
+const updateStoreProduct = `-- name: UpdateStoreProduct :one
+UPDATE store_products
+SET display_name = $2,
+    description = $3,
+    subscription = $4,
+    active = $5,
+    sort_order = $6,
+    updated_at = NOW()
+WHERE product_id = $1
+RETURNING product_id, display_name, description, subscription, active, sort_order, created_at, updated_at
+`
+
+type UpdateStoreProductParams struct {
+	ProductID    string
+	DisplayName  string
+	Description  string
+	Subscription bool
+	Active       bool
+	SortOrder    int32
+}
+
+func (q *Queries) UpdateStoreProduct(ctx context.Context, arg UpdateStoreProductParams) (StoreProduct, error) {
+	row := q.db.QueryRow(ctx, updateStoreProduct,
+		arg.ProductID,
+		arg.DisplayName,
+		arg.Description,
+		arg.Subscription,
+		arg.Active,
+		arg.SortOrder,
+	)
+	var i StoreProduct
+	err := row.Scan(
+		&i.ProductID,
+		&i.DisplayName,
+		&i.Description,
+		&i.Subscription,
+		&i.Active,
+		&i.SortOrder,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const updateSubscriptionFromStore = `-- name: UpdateSubscriptionFromStore :one
+UPDATE user_subscriptions
+SET expires_at = $2,
+    purchase_id = COALESCE($3, purchase_id)
+WHERE id = $1
+RETURNING id, user_id, feature_type, activated_at, expires_at, purchase_id, created_at
+`
+
+type UpdateSubscriptionFromStoreParams struct {
+	ID         int32
+	ExpiresAt  pgtype.Timestamptz
+	PurchaseID pgtype.Int8
+}
+
+func (q *Queries) UpdateSubscriptionFromStore(ctx context.Context, arg UpdateSubscriptionFromStoreParams) (UserSubscription, error) {
+	row := q.db.QueryRow(ctx, updateSubscriptionFromStore, arg.ID, arg.ExpiresAt, arg.PurchaseID)
+	var i UserSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FeatureType,
+		&i.ActivatedAt,
+		&i.ExpiresAt,
+		&i.PurchaseID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const updateUserLocationGender = `-- name: UpdateUserLocationGender :one
 UPDATE users SET
     latitude = $1,
@@ -2358,6 +5427,84 @@ func (q *Queries) UpdateUserVerificationStatus(ctx context.Context, arg UpdateUs
 	return i, err
 }
 
+const upsertConversationSettings = `-- name: UpsertConversationSettings :one
+INSERT INTO conversation_settings (user_id, peer_user_id, muted_until, pinned, archived)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, peer_user_id) DO UPDATE
+SET muted_until = EXCLUDED.muted_until,
+    pinned = EXCLUDED.pinned,
+    archived = EXCLUDED.archived,
+    updated_at = NOW()
+RETURNING user_id, peer_user_id, muted_until, pinned, archived, cleared_before, updated_at
+`
+
+type UpsertConversationSettingsParams struct {
+	UserID     int32
+	PeerUserID int32
+	MutedUntil pgtype.Timestamptz
+	Pinned     bool
+	Archived   bool
+}
+
+func (q *Queries) UpsertConversationSettings(ctx context.Context, arg UpsertConversationSettingsParams) (ConversationSetting, error) {
+	row := q.db.QueryRow(ctx, upsertConversationSettings,
+		arg.UserID,
+		arg.PeerUserID,
+		arg.MutedUntil,
+		arg.Pinned,
+		arg.Archived,
+	)
+	var i ConversationSetting
+	err := row.Scan(
+		&i.UserID,
+		&i.PeerUserID,
+		&i.MutedUntil,
+		&i.Pinned,
+		&i.Archived,
+		&i.ClearedBefore,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertDevicePushToken = `-- name: UpsertDevicePushToken :one
+INSERT INTO device_push_tokens (user_id, platform, token, session_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (token) DO UPDATE
+SET user_id = EXCLUDED.user_id,
+    platform = EXCLUDED.platform,
+    session_id = EXCLUDED.session_id,
+    updated_at = NOW()
+RETURNING id, user_id, platform, token, session_id, created_at, updated_at
+`
+
+type UpsertDevicePushTokenParams struct {
+	UserID    int32
+	Platform  PushPlatform
+	Token     string
+	SessionID pgtype.Text
+}
+
+func (q *Queries) UpsertDevicePushToken(ctx context.Context, arg UpsertDevicePushTokenParams) (DevicePushToken, error) {
+	row := q.db.QueryRow(ctx, upsertDevicePushToken,
+		arg.UserID,
+		arg.Platform,
+		arg.Token,
+		arg.SessionID,
+	)
+	var i DevicePushToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Platform,
+		&i.Token,
+		&i.SessionID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const upsertMessageReaction = `-- name: UpsertMessageReaction :one
 INSERT INTO message_reactions (message_id, user_id, emoji)
 VALUES ($1, $2, $3)
@@ -2387,6 +5534,98 @@ func (q *Queries) UpsertMessageReaction(ctx context.Context, arg UpsertMessageRe
 	return i, err
 }
 
+const upsertNotificationPreferences = `-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (
+    user_id, new_message, new_like, new_match, quiet_hours_start, quiet_hours_end, timezone
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+)
+ON CONFLICT (user_id) DO UPDATE
+SET new_message = EXCLUDED.new_message,
+    new_like = EXCLUDED.new_like,
+    new_match = EXCLUDED.new_match,
+    quiet_hours_start = EXCLUDED.quiet_hours_start,
+    quiet_hours_end = EXCLUDED.quiet_hours_end,
+    timezone = EXCLUDED.timezone,
+    updated_at = NOW()
+RETURNING user_id, new_message, new_like, new_match, quiet_hours_start, quiet_hours_end, timezone, updated_at
+`
+
+type UpsertNotificationPreferencesParams struct {
+	UserID          int32
+	NewMessage      bool
+	NewLike         bool
+	NewMatch        bool
+	QuietHoursStart pgtype.Int2
+	QuietHoursEnd   pgtype.Int2
+	Timezone        string
+}
+
+func (q *Queries) UpsertNotificationPreferences(ctx context.Context, arg UpsertNotificationPreferencesParams) (NotificationPreference, error) {
+	row := q.db.QueryRow(ctx, upsertNotificationPreferences,
+		arg.UserID,
+		arg.NewMessage,
+		arg.NewLike,
+		arg.NewMatch,
+		arg.QuietHoursStart,
+		arg.QuietHoursEnd,
+		arg.Timezone,
+	)
+	var i NotificationPreference
+	err := row.Scan(
+		&i.UserID,
+		&i.NewMessage,
+		&i.NewLike,
+		&i.NewMatch,
+		&i.QuietHoursStart,
+		&i.QuietHoursEnd,
+		&i.Timezone,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertTravelLocation = `-- name: UpsertTravelLocation :one
+INSERT INTO user_travel_locations (user_id, latitude, longitude, city, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET latitude = EXCLUDED.latitude,
+    longitude = EXCLUDED.longitude,
+    city = EXCLUDED.city,
+    expires_at = EXCLUDED.expires_at,
+    updated_at = NOW()
+RETURNING user_id, latitude, longitude, city, expires_at, created_at, updated_at
+`
+
+type UpsertTravelLocationParams struct {
+	UserID    int32
+	Latitude  float64
+	Longitude float64
+	City      string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) UpsertTravelLocation(ctx context.Context, arg UpsertTravelLocationParams) (UserTravelLocation, error) {
+	row := q.db.QueryRow(ctx, upsertTravelLocation,
+		arg.UserID,
+		arg.Latitude,
+		arg.Longitude,
+		arg.City,
+		arg.ExpiresAt,
+	)
+	var i UserTravelLocation
+	err := row.Scan(
+		&i.UserID,
+		&i.Latitude,
+		&i.Longitude,
+		&i.City,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const upsertUserConsumable = `-- name: UpsertUserConsumable :one
 INSERT INTO user_consumables (user_id, consumable_type, quantity)
 VALUES ($1, $2, $3) -- $3 is the quantity to add
@@ -2461,3 +5700,85 @@ func (q *Queries) UpsertUserFilters(ctx context.Context, arg UpsertUserFiltersPa
 	)
 	return i, err
 }
+
+const upsertUserIdentity = `-- name: UpsertUserIdentity :exec
+INSERT INTO user_identities (user_id, provider, subject, email)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (provider, subject) DO UPDATE
+SET last_used_at = NOW(),
+    email = COALESCE(EXCLUDED.email, user_identities.email)
+`
+
+type UpsertUserIdentityParams struct {
+	UserID   int32
+	Provider string
+	Subject  string
+	Email    pgtype.Text
+}
+
+func (q *Queries) UpsertUserIdentity(ctx context.Context, arg UpsertUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, upsertUserIdentity,
+		arg.UserID,
+		arg.Provider,
+		arg.Subject,
+		arg.Email,
+	)
+	return err
+}
+
+const upsertUserRiskScore = `-- name: UpsertUserRiskScore :exec
+INSERT INTO user_risk_scores (user_id, score, reasons, auto_hidden, evaluated_at)
+VALUES ($1, $2, $3, $4, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET score = EXCLUDED.score,
+    reasons = EXCLUDED.reasons,
+    auto_hidden = user_risk_scores.auto_hidden OR EXCLUDED.auto_hidden,
+    evaluated_at = NOW()
+`
+
+type UpsertUserRiskScoreParams struct {
+	UserID     int32
+	Score      float64
+	Reasons    []string
+	AutoHidden bool
+}
+
+func (q *Queries) UpsertUserRiskScore(ctx context.Context, arg UpsertUserRiskScoreParams) error {
+	_, err := q.db.Exec(ctx, upsertUserRiskScore,
+		arg.UserID,
+		arg.Score,
+		arg.Reasons,
+		arg.AutoHidden,
+	)
+	return err
+}
+
+const upsertUserSanction = `-- name: UpsertUserSanction :exec
+INSERT INTO user_sanctions (user_id, action_id, is_ban, reason, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET action_id = EXCLUDED.action_id,
+    is_ban = EXCLUDED.is_ban,
+    reason = EXCLUDED.reason,
+    expires_at = EXCLUDED.expires_at,
+    created_at = NOW()
+`
+
+type UpsertUserSanctionParams struct {
+	UserID    int32
+	ActionID  int64
+	IsBan     bool
+	Reason    string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) UpsertUserSanction(ctx context.Context, arg UpsertUserSanctionParams) error {
+	_, err := q.db.Exec(ctx, upsertUserSanction,
+		arg.UserID,
+		arg.ActionID,
+		arg.IsBan,
+		arg.Reason,
+		arg.ExpiresAt,
+	)
+	return err
+}
@@ -0,0 +1,32 @@
+package account
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arnnvv/peeple-api/pkg/utils"
+)
+
+const (
+	defaultGracePeriod   = 30 * 24 * time.Hour
+	defaultPurgeInterval = time.Hour
+	purgeBatchSize       = 50
+)
+
+// GracePeriod returns how long a deletion request can still be cancelled by
+// signing in again. Configured with ACCOUNT_DELETION_GRACE_PERIOD.
+func GracePeriod() time.Duration {
+	return utils.DurationFromEnv("ACCOUNT_DELETION_GRACE_PERIOD", defaultGracePeriod)
+}
+
+// ObjectPrefixes lists the S3 key prefixes the upload handlers write a
+// user's files under. Keep in sync with imagehandler.go, audio.go,
+// chatMediaHandler.go and verifyProfileHandler.go.
+func ObjectPrefixes(userID int32) []string {
+	return []string{
+		fmt.Sprintf("uploads/%d/", userID),
+		fmt.Sprintf("users/%d/", userID),
+		fmt.Sprintf("chat-media/%d/", userID),
+		fmt.Sprintf("verification/%d/", userID),
+	}
+}
@@ -0,0 +1,157 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Purger permanently deletes accounts whose grace period has expired. The
+// user's S3 objects go first; the users row is deleted afterwards and the
+// schema cascades to everything else.
+type Purger struct {
+	queries  *migrations.Queries
+	s3       *s3.S3
+	bucket   string
+	interval time.Duration
+}
+
+// NewPurgerFromEnv builds a Purger using the same AWS settings as the upload
+// handlers. Without them only database rows are purged.
+func NewPurgerFromEnv(queries *migrations.Queries) *Purger {
+	p := &Purger{
+		queries:  queries,
+		interval: utils.DurationFromEnv("ACCOUNT_PURGE_INTERVAL", defaultPurgeInterval),
+	}
+
+	awsRegion := os.Getenv("AWS_REGION")
+	awsAccessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	awsSecretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	p.bucket = os.Getenv("S3_BUCKET")
+	if awsRegion == "" || awsAccessKey == "" || awsSecretKey == "" || p.bucket == "" {
+		log.Println("WARNING: account: AWS configuration missing, purged accounts will keep their S3 objects")
+		return p
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(awsRegion),
+		Credentials: credentials.NewStaticCredentials(awsAccessKey, awsSecretKey, ""),
+	})
+	if err != nil {
+		log.Printf("WARNING: account: failed to create AWS session, purged accounts will keep their S3 objects: %v", err)
+		return p
+	}
+	p.s3 = s3.New(sess)
+	return p
+}
+
+// Run purges due accounts every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	log.Printf("Account purge job started (interval %s, grace period %s)", p.interval, GracePeriod())
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := p.PurgeDue(ctx); err != nil {
+			log.Printf("ERROR: account: purge run failed after %d accounts: %v", n, err)
+		} else if n > 0 {
+			log.Printf("INFO: account: purged %d accounts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Account purge job stopped.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDue deletes every account past its grace period and returns how many
+// were removed. An account whose S3 objects cannot be deleted is left for
+// the next run.
+func (p *Purger) PurgeDue(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		userIDs, err := p.queries.ListAccountsDueForPurge(ctx, purgeBatchSize)
+		if err != nil {
+			return purged, fmt.Errorf("listing due accounts: %w", err)
+		}
+		if len(userIDs) == 0 {
+			return purged, nil
+		}
+
+		progressed := false
+		for _, userID := range userIDs {
+			if ctx.Err() != nil {
+				return purged, ctx.Err()
+			}
+			if err := p.purgeUser(ctx, userID); err != nil {
+				log.Printf("ERROR: account: failed to purge user %d: %v", userID, err)
+				continue
+			}
+			purged++
+			progressed = true
+		}
+		if !progressed || len(userIDs) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+func (p *Purger) purgeUser(ctx context.Context, userID int32) error {
+	if p.s3 != nil {
+		for _, prefix := range ObjectPrefixes(userID) {
+			if err := p.deletePrefix(ctx, prefix); err != nil {
+				return fmt.Errorf("deleting s3 prefix %s: %w", prefix, err)
+			}
+		}
+	}
+	if _, err := p.queries.DeleteUser(ctx, userID); err != nil {
+		return fmt.Errorf("deleting user row: %w", err)
+	}
+	log.Printf("INFO: account: user %d purged", userID)
+	return nil
+}
+
+func (p *Purger) deletePrefix(ctx context.Context, prefix string) error {
+	var deleteErr error
+	err := p.s3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(p.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		if len(page.Contents) == 0 {
+			return true
+		}
+		objects := make([]*s3.ObjectIdentifier, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			objects = append(objects, &s3.ObjectIdentifier{Key: obj.Key})
+		}
+		out, err := p.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(p.bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			deleteErr = err
+			return false
+		}
+		if len(out.Errors) > 0 {
+			deleteErr = fmt.Errorf("%d objects not deleted, first: %s", len(out.Errors), aws.StringValue(out.Errors[0].Message))
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return deleteErr
+}
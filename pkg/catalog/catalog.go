@@ -0,0 +1,261 @@
+// Package catalog is the store's product catalog: what buying each App
+// Store and Play product grants.
+//
+// A grant is either a quantity of a consumable (roses, spotlights) or a
+// subscription feature (unlimited likes, travel mode) for an ISO-8601
+// duration. A product is sold either as an auto-renewing subscription or
+// as a one-time purchase, as set up in the stores, and a product with
+// several grants is a bundle. Products are kept in store_products and
+// store_product_grants and managed through the admin API.
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxProductIDLength = 150
+
+var (
+	ErrNotFound = errors.New("product not found")
+	ErrExists   = errors.New("product already exists")
+	// ErrInvalidProduct wraps the reason a product can't be saved.
+	ErrInvalidProduct = errors.New("invalid product")
+)
+
+// Grant is one thing a product grants.
+type Grant struct {
+	FeatureType migrations.PremiumFeatureType
+	Quantity    int32  // consumables
+	Duration    string // subscriptions
+}
+
+// IsConsumable reports whether the grant adds to a consumable balance
+// rather than granting a subscription.
+func (g Grant) IsConsumable() bool {
+	return g.FeatureType == migrations.PremiumFeatureTypeRose || g.FeatureType == migrations.PremiumFeatureTypeSpotlight
+}
+
+// Product is a store product and what it grants.
+type Product struct {
+	ProductID   string
+	DisplayName string
+	Description string
+	// Subscription is set for products the stores sell as auto-renewing
+	// subscriptions rather than one-time purchases.
+	Subscription bool
+	Active       bool // listed in the app's store
+	SortOrder    int32
+	Grants       []Grant
+}
+
+// Validate checks that p can be saved. Errors wrap ErrInvalidProduct.
+func (p Product) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidProduct, fmt.Sprintf(format, args...))
+	}
+	switch {
+	case p.ProductID == "":
+		return invalid("product_id is required")
+	case len(p.ProductID) > maxProductIDLength:
+		return invalid("product_id is longer than %d characters", maxProductIDLength)
+	case strings.ContainsAny(p.ProductID, "/ \t\n"):
+		return invalid("product_id must not contain slashes or spaces")
+	case strings.TrimSpace(p.DisplayName) == "":
+		return invalid("display_name is required")
+	case len(p.Grants) == 0:
+		return invalid("a product must grant something")
+	}
+	if p.Subscription && !slices.ContainsFunc(p.Grants, func(g Grant) bool { return !g.IsConsumable() }) {
+		return invalid("a subscription must grant unlimited_likes or travel_mode")
+	}
+	seen := make(map[migrations.PremiumFeatureType]bool, len(p.Grants))
+	for _, g := range p.Grants {
+		if seen[g.FeatureType] {
+			return invalid("%s is granted more than once", g.FeatureType)
+		}
+		seen[g.FeatureType] = true
+		switch g.FeatureType {
+		case migrations.PremiumFeatureTypeRose, migrations.PremiumFeatureTypeSpotlight:
+			if g.Quantity <= 0 || g.Duration != "" {
+				return invalid("%s needs a positive quantity and no duration", g.FeatureType)
+			}
+		case migrations.PremiumFeatureTypeUnlimitedLikes, migrations.PremiumFeatureTypeTravelMode:
+			if g.Quantity != 0 {
+				return invalid("%s needs a duration and no quantity", g.FeatureType)
+			}
+			if _, err := ParseDuration(g.Duration); err != nil {
+				return invalid("%s: %v", g.FeatureType, err)
+			}
+		default:
+			return invalid("unknown feature_type %q", g.FeatureType)
+		}
+	}
+	return nil
+}
+
+// List returns the catalog in display order, only the listed products if
+// activeOnly is set.
+func List(ctx context.Context, queries *migrations.Queries, activeOnly bool) ([]Product, error) {
+	var rows []migrations.StoreProduct
+	var err error
+	if activeOnly {
+		rows, err = queries.ListActiveStoreProducts(ctx)
+	} else {
+		rows, err = queries.ListStoreProducts(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing products: %w", err)
+	}
+	return withGrants(ctx, queries, rows)
+}
+
+// Get returns a product, listed or not. It fails with ErrNotFound if the
+// catalog doesn't have it.
+func Get(ctx context.Context, queries *migrations.Queries, productID string) (Product, error) {
+	row, err := queries.GetStoreProduct(ctx, productID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Product{}, ErrNotFound
+	}
+	if err != nil {
+		return Product{}, fmt.Errorf("getting product %s: %w", productID, err)
+	}
+	products, err := withGrants(ctx, queries, []migrations.StoreProduct{row})
+	if err != nil {
+		return Product{}, err
+	}
+	return products[0], nil
+}
+
+func withGrants(ctx context.Context, queries *migrations.Queries, rows []migrations.StoreProduct) ([]Product, error) {
+	products := make([]Product, len(rows))
+	ids := make([]string, len(rows))
+	index := make(map[string]int, len(rows))
+	for i, row := range rows {
+		products[i] = Product{
+			ProductID:    row.ProductID,
+			DisplayName:  row.DisplayName,
+			Description:  row.Description,
+			Subscription: row.Subscription,
+			Active:       row.Active,
+			SortOrder:    row.SortOrder,
+			Grants:       []Grant{},
+		}
+		ids[i] = row.ProductID
+		index[row.ProductID] = i
+	}
+	if len(ids) == 0 {
+		return products, nil
+	}
+	grants, err := queries.ListStoreProductGrants(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("listing product grants: %w", err)
+	}
+	for _, g := range grants {
+		i := index[g.ProductID]
+		products[i].Grants = append(products[i].Grants, Grant{
+			FeatureType: g.FeatureType,
+			Quantity:    g.Quantity.Int32,
+			Duration:    g.Duration.String,
+		})
+	}
+	return products, nil
+}
+
+// Create adds p to the catalog. It fails with ErrExists if its product ID
+// is taken.
+func Create(ctx context.Context, pool *pgxpool.Pool, queries *migrations.Queries, p Product) (Product, error) {
+	return save(ctx, pool, queries, p, true)
+}
+
+// Update replaces the product with p's product ID, grants included. It
+// fails with ErrNotFound if there is none.
+func Update(ctx context.Context, pool *pgxpool.Pool, queries *migrations.Queries, p Product) (Product, error) {
+	return save(ctx, pool, queries, p, false)
+}
+
+func save(ctx context.Context, pool *pgxpool.Pool, queries *migrations.Queries, p Product, create bool) (Product, error) {
+	if err := p.Validate(); err != nil {
+		return Product{}, err
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return Product{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	if create {
+		_, err = qtx.CreateStoreProduct(ctx, migrations.CreateStoreProductParams{
+			ProductID:    p.ProductID,
+			DisplayName:  p.DisplayName,
+			Description:  p.Description,
+			Subscription: p.Subscription,
+			Active:       p.Active,
+			SortOrder:    p.SortOrder,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Product{}, ErrExists
+		}
+	} else {
+		_, err = qtx.UpdateStoreProduct(ctx, migrations.UpdateStoreProductParams{
+			ProductID:    p.ProductID,
+			DisplayName:  p.DisplayName,
+			Description:  p.Description,
+			Subscription: p.Subscription,
+			Active:       p.Active,
+			SortOrder:    p.SortOrder,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Product{}, ErrNotFound
+		}
+	}
+	if err != nil {
+		return Product{}, fmt.Errorf("saving product %s: %w", p.ProductID, err)
+	}
+
+	if err := qtx.DeleteStoreProductGrants(ctx, p.ProductID); err != nil {
+		return Product{}, fmt.Errorf("clearing grants of %s: %w", p.ProductID, err)
+	}
+	for _, g := range p.Grants {
+		_, err := qtx.AddStoreProductGrant(ctx, migrations.AddStoreProductGrantParams{
+			ProductID:   p.ProductID,
+			FeatureType: g.FeatureType,
+			Quantity:    pgtype.Int4{Int32: g.Quantity, Valid: g.IsConsumable()},
+			Duration:    pgtype.Text{String: g.Duration, Valid: !g.IsConsumable()},
+		})
+		if err != nil {
+			return Product{}, fmt.Errorf("saving grant %s of %s: %w", g.FeatureType, p.ProductID, err)
+		}
+	}
+	saved, err := Get(ctx, qtx, p.ProductID)
+	if err != nil {
+		return Product{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Product{}, fmt.Errorf("commit: %w", err)
+	}
+	return saved, nil
+}
+
+// Delete removes a product from the catalog. Purchases of it that were
+// already granted are unaffected, and refunds of them still take back
+// what they granted. It fails with ErrNotFound if there is none.
+func Delete(ctx context.Context, queries *migrations.Queries, productID string) error {
+	_, err := queries.DeleteStoreProduct(ctx, productID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("deleting product %s: %w", productID, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Duration
+	}{
+		{"P1D", Duration{Days: 1}},
+		{"P1W", Duration{Days: 7}},
+		{"P1W2D", Duration{Days: 9}},
+		{"P1M", Duration{Months: 1}},
+		{"P1Y", Duration{Years: 1}},
+		{"PT12H", Duration{Clock: 12 * time.Hour}},
+		{"P1DT1H30M15S", Duration{Days: 1, Clock: time.Hour + 30*time.Minute + 15*time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDuration(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, in := range []string{"", "P", "PT", "P1DT", "P0D", "1week", "P1.5D", "P-1D", "p1d", "PT1D", "P1H"} {
+		_, err := ParseDuration(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestDurationAddTo(t *testing.T) {
+	start := time.Date(2025, time.January, 31, 10, 0, 0, 0, time.UTC)
+	month, _ := ParseDuration("P1M")
+	assert.Equal(t, time.Date(2025, time.March, 3, 10, 0, 0, 0, time.UTC), month.AddTo(start))
+	week, _ := ParseDuration("P1WT2H")
+	assert.Equal(t, time.Date(2025, time.February, 7, 12, 0, 0, 0, time.UTC), week.AddTo(start))
+}
+
+func TestProductValidate(t *testing.T) {
+	roses := Grant{FeatureType: migrations.PremiumFeatureTypeRose, Quantity: 5}
+	likes := Grant{FeatureType: migrations.PremiumFeatureTypeUnlimitedLikes, Duration: "P7D"}
+	valid := Product{ProductID: "com.peeple.bundle", DisplayName: "Bundle", Grants: []Grant{roses, likes}}
+	require.NoError(t, valid.Validate())
+	pass := Product{ProductID: "com.peeple.likes_1week", DisplayName: "Likes", Grants: []Grant{likes}}
+	require.NoError(t, pass.Validate(), "one-time purchase of a subscription feature")
+	pass.Subscription = true
+	require.NoError(t, pass.Validate())
+
+	tests := map[string]func(p *Product){
+		"no product ID":         func(p *Product) { p.ProductID = "" },
+		"slash in product ID":   func(p *Product) { p.ProductID = "com.peeple/rose" },
+		"no display name":       func(p *Product) { p.DisplayName = " " },
+		"no grants":             func(p *Product) { p.Grants = nil },
+		"duplicate feature":     func(p *Product) { p.Grants = []Grant{roses, roses} },
+		"subscription of roses": func(p *Product) { p.Subscription, p.Grants = true, []Grant{roses} },
+		"unknown feature":       func(p *Product) { p.Grants = []Grant{{FeatureType: "superlike", Quantity: 1}} },
+		"consumable duration": func(p *Product) {
+			p.Grants = []Grant{{FeatureType: migrations.PremiumFeatureTypeSpotlight, Quantity: 1, Duration: "P1D"}}
+		},
+		"zero quantity": func(p *Product) { p.Grants = []Grant{{FeatureType: migrations.PremiumFeatureTypeRose}} },
+		"subscription quantity": func(p *Product) {
+			p.Grants = []Grant{{FeatureType: migrations.PremiumFeatureTypeTravelMode, Quantity: 1, Duration: "P1D"}}
+		},
+		"bad duration": func(p *Product) {
+			p.Grants = []Grant{{FeatureType: migrations.PremiumFeatureTypeTravelMode, Duration: "1week"}}
+		},
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := valid
+			p.Grants = append([]Grant(nil), valid.Grants...)
+			mutate(&p)
+			assert.ErrorIs(t, p.Validate(), ErrInvalidProduct)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// Duration is an ISO-8601 duration such as P7D, P1M or PT12H. Years,
+// months and days are calendar units, so P1M from January 31st ends on
+// March 3rd or 2nd, as time.AddDate does.
+type Duration struct {
+	Years, Months, Days int
+	Clock               time.Duration // the part after T
+}
+
+// ParseDuration parses an ISO-8601 duration made of whole numbers of
+// years, months, weeks, days, hours, minutes and seconds. It must be
+// longer than zero.
+func ParseDuration(s string) (Duration, error) {
+	m := isoDurationPattern.FindStringSubmatch(s)
+	if m == nil || s == "P" || s == "PT" || s[len(s)-1] == 'T' {
+		return Duration{}, fmt.Errorf("%q is not an ISO-8601 duration like P7D or P1M", s)
+	}
+	n := make([]int, len(m))
+	for i := 1; i < len(m); i++ {
+		if m[i] == "" {
+			continue
+		}
+		v, err := strconv.Atoi(m[i])
+		if err != nil || v > 100000 {
+			return Duration{}, fmt.Errorf("duration %q is too long", s)
+		}
+		n[i] = v
+	}
+	d := Duration{
+		Years:  n[1],
+		Months: n[2],
+		Days:   n[3]*7 + n[4],
+		Clock:  time.Duration(n[5])*time.Hour + time.Duration(n[6])*time.Minute + time.Duration(n[7])*time.Second,
+	}
+	if d.Years == 0 && d.Months == 0 && d.Days == 0 && d.Clock == 0 {
+		return Duration{}, fmt.Errorf("duration %q is zero", s)
+	}
+	return d, nil
+}
+
+// AddTo returns t plus d.
+func (d Duration) AddTo(t time.Time) time.Time {
+	return t.AddDate(d.Years, d.Months, d.Days).Add(d.Clock)
+}
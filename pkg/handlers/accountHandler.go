@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/account"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/arnnvv/peeple-api/pkg/ws"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type DeleteAccountResponse struct {
+	Success    bool      `json:"success"`
+	Message    string    `json:"message"`
+	PurgeAfter time.Time `json:"purge_after,omitempty"`
+}
+
+type AccountExport struct {
+	ExportedAt   time.Time                `json:"exported_at"`
+	Profile      *UserProfileData         `json:"profile"`
+	LikesSent    []migrations.Like        `json:"likes_sent"`
+	Messages     []migrations.ChatMessage `json:"messages"`
+	ReportsFiled []migrations.Report      `json:"reports_filed"`
+	Analytics    AccountExportAnalytics   `json:"analytics"`
+}
+
+type AccountExportAnalytics struct {
+	ProfileImpressions []migrations.UserProfileImpression `json:"profile_impressions"`
+	LikeProfileViews   []migrations.LikeProfileView       `json:"like_profile_views"`
+	PhotoViewDurations []migrations.PhotoViewDuration     `json:"photo_view_durations"`
+}
+
+// cancelPendingAccountDeletion is called on every sign-in: coming back
+// within the grace period keeps the account.
+func cancelPendingAccountDeletion(ctx context.Context, queries *migrations.Queries, userID int32) error {
+	n, err := queries.CancelAccountDeletion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("INFO: Pending account deletion for user %d cancelled by sign-in", userID)
+	}
+	return nil
+}
+
+// DeleteAccountHandler schedules the account for deletion after
+// account.GracePeriod, signs it out everywhere and hides it from feeds.
+// The purge itself is done by account.Purger.
+func DeleteAccountHandler(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, _ := db.GetDB()
+
+		if r.Method != http.MethodDelete {
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use DELETE")
+			return
+		}
+
+		claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		userID := int32(claims.UserID)
+
+		if claims.IsImpersonated() {
+			utils.RespondWithError(w, http.StatusForbidden, "Not allowed while impersonating a user")
+			return
+		}
+
+		deletion, err := queries.RequestAccountDeletion(ctx, migrations.RequestAccountDeletionParams{
+			UserID:     userID,
+			PurgeAfter: pgtype.Timestamptz{Time: time.Now().Add(account.GracePeriod()), Valid: true},
+		})
+		if err != nil {
+			log.Printf("ERROR: DeleteAccountHandler: Failed to schedule deletion for user %d: %v", userID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete account")
+			return
+		}
+
+		if err := token.RevokeAllSessions(ctx, userID); err != nil {
+			log.Printf("ERROR: DeleteAccountHandler: Failed to revoke sessions for user %d: %v", userID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete account")
+			return
+		}
+		hub.DisconnectUser(userID, "")
+
+		log.Printf("INFO: DeleteAccountHandler: User %d scheduled for deletion after %s", userID, deletion.PurgeAfter.Time.Format(time.RFC3339))
+		utils.RespondWithJSON(w, http.StatusOK, DeleteAccountResponse{
+			Success:    true,
+			Message:    "Account scheduled for deletion. Sign in again before purge_after to cancel.",
+			PurgeAfter: deletion.PurgeAfter.Time,
+		})
+	}
+}
+
+// ExportAccountDataHandler returns everything stored about the user, as a
+// single JSON document (?format=json, default) or a ZIP of JSON files
+// (?format=zip).
+func ExportAccountDataHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+
+	if r.Method != http.MethodGet {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET")
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	userID := int32(claims.UserID)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		utils.RespondWithError(w, http.StatusBadRequest, "format must be 'json' or 'zip'")
+		return
+	}
+
+	export, err := buildAccountExport(ctx, queries, userID)
+	if err != nil {
+		log.Printf("ERROR: ExportAccountDataHandler: Failed to build export for user %d: %v", userID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to export account data")
+		return
+	}
+
+	filename := fmt.Sprintf("peeple-export-%d-%s", userID, export.ExportedAt.Format("20060102"))
+	if format == "json" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		utils.RespondWithJSON(w, http.StatusOK, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"likes_sent.json", export.LikesSent},
+		{"messages.json", export.Messages},
+		{"reports_filed.json", export.ReportsFiled},
+		{"analytics.json", export.Analytics},
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err == nil {
+			enc := json.NewEncoder(fw)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(f.data)
+		}
+		if err != nil {
+			// Headers are already sent; the truncated archive is the only signal left.
+			log.Printf("ERROR: ExportAccountDataHandler: Failed writing %s for user %d: %v", f.name, userID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("ERROR: ExportAccountDataHandler: Failed to finalize archive for user %d: %v", userID, err)
+		return
+	}
+	log.Printf("INFO: ExportAccountDataHandler: Exported data for user %d (%s)", userID, format)
+}
+
+func buildAccountExport(ctx context.Context, queries *migrations.Queries, userID int32) (*AccountExport, error) {
+	profile, err := fetchFullUserProfileData(ctx, queries, userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &AccountExport{ExportedAt: time.Now().UTC(), Profile: profile}
+
+	if export.LikesSent, err = queries.GetLikesSentByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("likes sent: %w", err)
+	}
+	if export.Messages, err = queries.GetAllMessagesForUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("messages: %w", err)
+	}
+	if export.ReportsFiled, err = queries.GetReportsFiledByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("reports filed: %w", err)
+	}
+	if export.Analytics.ProfileImpressions, err = queries.GetProfileImpressionsByViewer(ctx, userID); err != nil {
+		return nil, fmt.Errorf("profile impressions: %w", err)
+	}
+	if export.Analytics.LikeProfileViews, err = queries.GetLikeProfileViewsByViewer(ctx, userID); err != nil {
+		return nil, fmt.Errorf("like profile views: %w", err)
+	}
+	if export.Analytics.PhotoViewDurations, err = queries.GetPhotoViewDurationsByViewer(ctx, userID); err != nil {
+		return nil, fmt.Errorf("photo view durations: %w", err)
+	}
+	return export, nil
+}
@@ -55,7 +55,7 @@ func GetSpotlightAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("GetSpotlightAnalytics: UserID=%d, StartDate='%s' (Valid: %t), EndDate='%s' (Valid: %t)",
 		userID, startDateStr, startDate.Valid, endDateStr, endDate.Valid)
 
-	// 1. Fetch potential spotlight periods for the user relevant to the date range
+	// 1. Fetch the user's spotlight activations overlapping the date range
 	spotlightPeriods, err := queries.GetUserSpotlightActivationTimes(ctx, migrations.GetUserSpotlightActivationTimesParams{
 		UserID:    userID,
 		StartDate: startDate,
@@ -71,28 +71,23 @@ func GetSpotlightAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 2. For each period, fetch the impressions specifically during that activation
 	for _, period := range spotlightPeriods {
-		if !period.ExpiresAt.Valid || !period.PotentiallyActivatedAt.Valid {
-			log.Printf("WARN: Skipping spotlight period for user %d due to invalid activation/expiry.", userID)
-			continue // Skip if essential timestamps are missing
-		}
-
 		// IMPORTANT: Query impressions using the *actual* activation/expiry times of this specific period,
 		// NOT the potentially wider query range parameters (startDate, endDate).
 		impressionCount, errImp := queries.CountImpressionsDuringSpotlight(ctx, migrations.CountImpressionsDuringSpotlightParams{
 			ShownUserID: userID,
-			StartDate:   period.PotentiallyActivatedAt, // Use the period's start
-			EndDate:     period.ExpiresAt,              // Use the period's end
+			StartDate:   period.ActivatedAt, // Use the period's start
+			EndDate:     period.ExpiresAt,   // Use the period's end
 		})
 
 		if errImp != nil {
 			log.Printf("Error counting spotlight impressions for user %d during %v to %v: %v",
-				userID, period.PotentiallyActivatedAt.Time, period.ExpiresAt.Time, errImp)
+				userID, period.ActivatedAt.Time, period.ExpiresAt.Time, errImp)
 			// Optionally skip this period or return 0 impressions
 			impressionCount = 0 // Default to 0 if count fails for this specific period
 		}
 
 		analytic := SpotlightAnalytic{
-			ActivatedAt:       period.PotentiallyActivatedAt.Time.UTC().Format(time.RFC3339),
+			ActivatedAt:       period.ActivatedAt.Time.UTC().Format(time.RFC3339),
 			ExpiresAt:         period.ExpiresAt.Time.UTC().Format(time.RFC3339),
 			ImpressionsDuring: impressionCount,
 		}
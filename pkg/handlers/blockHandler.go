@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/arnnvv/peeple-api/pkg/ws"
+)
+
+type BlockedUserInfo struct {
+	UserID             int32     `json:"user_id"`
+	Name               string    `json:"name"`
+	FirstProfilePicURL string    `json:"first_profile_pic_url,omitempty"`
+	BlockedAt          time.Time `json:"blocked_at"`
+}
+
+type BlockedUsersResponse struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message,omitempty"`
+	Blocked []BlockedUserInfo `json:"blocked"`
+}
+
+type BlockResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// BlocksHandler serves /api/blocks: GET lists the users the caller blocked,
+// POST {"blocked_user_id"} blocks a user and DELETE {"blocked_user_id"}
+// unblocks them.
+func BlocksHandler(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, _ := db.GetDB()
+
+		claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		userID := int32(claims.UserID)
+
+		switch r.Method {
+		case http.MethodGet:
+			rows, err := queries.GetBlockedUsers(ctx, userID)
+			if err != nil {
+				log.Printf("ERROR: BlocksHandler: Failed to list blocks for user %d: %v", userID, err)
+				utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch blocked users")
+				return
+			}
+			blocked := make([]BlockedUserInfo, 0, len(rows))
+			for _, row := range rows {
+				blocked = append(blocked, BlockedUserInfo{
+					UserID:             row.BlockedUserID,
+					Name:               buildFullName(row.Name, row.LastName),
+					FirstProfilePicURL: getFirstMediaURL(row.MediaUrls),
+					BlockedAt:          row.BlockedAt.Time,
+				})
+			}
+			utils.RespondWithJSON(w, http.StatusOK, BlockedUsersResponse{Success: true, Blocked: blocked})
+
+		case http.MethodPost:
+			var req ws.BlockRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body format")
+				return
+			}
+			defer r.Body.Close()
+
+			pool, err := db.GetPool()
+			if err != nil {
+				utils.RespondWithError(w, http.StatusInternalServerError, "Database connection not available")
+				return
+			}
+			if err := ws.ProcessBlock(ctx, queries, pool, hub, userID, req); err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			utils.RespondWithJSON(w, http.StatusOK, BlockResponse{Success: true, Message: "User blocked"})
+
+		case http.MethodDelete:
+			var req ws.BlockRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body format")
+				return
+			}
+			defer r.Body.Close()
+
+			if req.BlockedUserID <= 0 {
+				utils.RespondWithError(w, http.StatusBadRequest, "Valid blocked_user_id is required")
+				return
+			}
+			n, err := queries.UnblockUser(ctx, migrations.UnblockUserParams{
+				BlockerUserID: userID,
+				BlockedUserID: req.BlockedUserID,
+			})
+			if err != nil {
+				log.Printf("ERROR: BlocksHandler: Failed to unblock %d for user %d: %v", req.BlockedUserID, userID, err)
+				utils.RespondWithError(w, http.StatusInternalServerError, "Failed to unblock user")
+				return
+			}
+			if n == 0 {
+				utils.RespondWithError(w, http.StatusNotFound, "User is not blocked")
+				return
+			}
+			log.Printf("INFO: BlocksHandler: User %d unblocked user %d", userID, req.BlockedUserID)
+			utils.RespondWithJSON(w, http.StatusOK, BlockResponse{Success: true, Message: "User unblocked"})
+
+		default:
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET, POST or DELETE")
+		}
+	}
+}
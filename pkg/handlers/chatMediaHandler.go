@@ -19,7 +19,7 @@ import (
 )
 
 // --- Define allowed MIME types SPECIFICALLY for chat ---
-// Allowing only Images and Audio as requested.
+// Images, short videos and audio (voice notes).
 var allowedChatMimeTypes = map[string]bool{
 	// Images
 	"image/jpeg": true,
@@ -28,6 +28,11 @@ var allowedChatMimeTypes = map[string]bool{
 	"image/webp": true,
 	"image/jpg":  true, // Alias for jpeg often used
 
+	// Video
+	"video/mp4":       true,
+	"video/quicktime": true, // MOV from iOS
+	"video/webm":      true,
+
 	// Audio (Common types including the ones from the error log)
 	"audio/mpeg":  true, // MP3
 	"audio/ogg":   true, // OGG Vorbis/Opus
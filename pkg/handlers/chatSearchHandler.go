@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+)
+
+const (
+	minChatSearchQueryLength = 2
+	maxChatSearchQueryLength = 200
+	defaultChatSearchLimit   = 20
+	maxChatSearchLimit       = 50
+)
+
+type ChatSearchHit struct {
+	MessageID    int64     `json:"message_id"`
+	SenderUserID int32     `json:"sender_user_id"`
+	SentAt       time.Time `json:"sent_at"`
+	Snippet      string    `json:"snippet"` // safe HTML: escaped text, matched terms wrapped in <mark></mark>
+}
+
+type ChatSearchConversation struct {
+	OtherUserID        int32           `json:"other_user_id"`
+	Name               string          `json:"name"`
+	FirstProfilePicURL string          `json:"first_profile_pic_url"`
+	Hits               []ChatSearchHit `json:"hits"`
+}
+
+type ChatSearchResponse struct {
+	Success       bool                     `json:"success"`
+	Message       string                   `json:"message,omitempty"`
+	Conversations []ChatSearchConversation `json:"conversations"`
+	HasMore       bool                     `json:"has_more"`
+	NextCursor    string                   `json:"next_cursor,omitempty"` // pass back as ?before= for older hits
+}
+
+// ChatSearchHandler searches the caller's messages with current matches,
+// newest first. Each page is grouped by conversation, ordered by each
+// conversation's newest hit on the page.
+func ChatSearchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, errDb := db.GetDB()
+	if errDb != nil || queries == nil {
+		utils.RespondWithJSON(w, http.StatusInternalServerError, ChatSearchResponse{Success: false, Message: "Database connection error"})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		utils.RespondWithJSON(w, http.StatusMethodNotAllowed, ChatSearchResponse{Success: false, Message: "Method Not Allowed: Use GET"})
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithJSON(w, http.StatusUnauthorized, ChatSearchResponse{Success: false, Message: "Authentication required"})
+		return
+	}
+	userID := int32(claims.UserID)
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if n := utf8.RuneCountInString(q); n < minChatSearchQueryLength || n > maxChatSearchQueryLength {
+		utils.RespondWithJSON(w, http.StatusBadRequest, ChatSearchResponse{Success: false, Message: "Query parameter q must be 2-200 characters"})
+		return
+	}
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"), defaultChatSearchLimit, maxChatSearchLimit)
+	if err != nil {
+		utils.RespondWithJSON(w, http.StatusBadRequest, ChatSearchResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	params := migrations.SearchChatMessagesParams{
+		Query:        q,
+		UserID:       userID,
+		BeforeSentAt: timestampPosInf,
+		BeforeID:     maxCursorID64,
+		PageLimit:    limit + 1,
+	}
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		c, cursorErr := decodeCursor(raw)
+		if cursorErr != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, ChatSearchResponse{Success: false, Message: "Invalid cursor"})
+			return
+		}
+		params.BeforeSentAt = cursorTimestamp(c.At)
+		params.BeforeID = c.ID
+	}
+
+	rows, err := queries.SearchChatMessages(ctx, params)
+	if err != nil {
+		log.Printf("ERROR: ChatSearchHandler: Search failed for user %d: %v", userID, err)
+		utils.RespondWithJSON(w, http.StatusInternalServerError, ChatSearchResponse{Success: false, Message: "Error searching messages"})
+		return
+	}
+
+	hasMore := len(rows) > int(limit)
+	var nextCursor string
+	if hasMore {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		nextCursor = encodeCursor(pageCursor{At: last.SentAt.Time, ID: last.ID})
+	}
+
+	conversations := make([]ChatSearchConversation, 0)
+	index := make(map[int32]int)
+	for _, row := range rows {
+		i, seen := index[row.OtherUserID]
+		if !seen {
+			i = len(conversations)
+			index[row.OtherUserID] = i
+			conversations = append(conversations, ChatSearchConversation{
+				OtherUserID:        row.OtherUserID,
+				Name:               buildFullName(row.OtherUserName, row.OtherUserLastName),
+				FirstProfilePicURL: getFirstMediaURL(row.OtherUserMediaUrls),
+				Hits:               []ChatSearchHit{},
+			})
+		}
+		conversations[i].Hits = append(conversations[i].Hits, ChatSearchHit{
+			MessageID:    row.ID,
+			SenderUserID: row.SenderUserID,
+			SentAt:       row.SentAt.Time,
+			Snippet:      row.Snippet,
+		})
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, ChatSearchResponse{
+		Success:       true,
+		Conversations: conversations,
+		HasMore:       hasMore,
+		NextCursor:    nextCursor,
+	})
+}
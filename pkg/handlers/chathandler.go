@@ -8,6 +8,8 @@ import (
 	"github.com/arnnvv/peeple-api/pkg/ws"
 )
 
+const maxDeviceIDLength = 128
+
 func ChatHandler(hub *ws.Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := r.Context().Value(token.ClaimsContextKey).(*token.Claims)
@@ -18,6 +20,15 @@ func ChatHandler(hub *ws.Hub) http.HandlerFunc {
 		}
 		userID := int32(claims.UserID)
 
-		ws.ServeWs(hub, w, r, userID)
+		// Each device keeps its own connection; without a device_id the
+		// session is used, so reconnecting with the same token replaces the
+		// old connection.
+		deviceID := r.URL.Query().Get("device_id")
+		if len(deviceID) > maxDeviceIDLength {
+			http.Error(w, "device_id too long", http.StatusBadRequest)
+			return
+		}
+
+		ws.ServeWs(hub, w, r, userID, claims.SessionKey(), deviceID)
 	}
 }
@@ -7,18 +7,31 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/arnnvv/peeple-api/migrations"
 	"github.com/arnnvv/peeple-api/pkg/db"
 	"github.com/arnnvv/peeple-api/pkg/token"
 	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/arnnvv/peeple-api/pkg/ws"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const (
+	defaultConversationPageLimit = 50
+	maxConversationPageLimit     = 200
+)
+
+// GetConversationRequest pages through a conversation. With no cursor the
+// newest page is returned; "before" walks back through history and "after"
+// fetches messages newer than a previously returned page.
 type GetConversationRequest struct {
-	OtherUserID int32 `json:"other_user_id"`
+	OtherUserID int32  `json:"other_user_id"`
+	Before      string `json:"before,omitempty"`
+	After       string `json:"after,omitempty"`
+	Limit       int64  `json:"limit,omitempty"`
 }
 
 type GetConversationResponse struct {
@@ -27,6 +40,10 @@ type GetConversationResponse struct {
 	OtherUserIsOnline   bool                          `json:"other_user_is_online"`
 	OtherUserLastOnline *time.Time                    `json:"other_user_last_online,omitempty"`
 	Messages            []ConversationMessageResponse `json:"messages"`
+	HasMore             bool                          `json:"has_more"`
+	// NextCursor continues in the direction that was requested: the oldest
+	// message for "before" pages, the newest for "after" pages.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type RepliedToInfo struct {
@@ -40,214 +57,327 @@ type ConversationMessageResponse struct {
 	ID                  int64              `json:"id"`
 	SenderUserID        int32              `json:"sender_user_id"`
 	RecipientUserID     int32              `json:"recipient_user_id"`
+	Kind                string             `json:"kind"`
 	MessageText         pgtype.Text        `json:"message_text"`
 	MediaUrl            pgtype.Text        `json:"media_url"`
 	MediaType           pgtype.Text        `json:"media_type"`
+	Payload             json.RawMessage    `json:"payload,omitempty"` // kind-specific metadata
 	SentAt              pgtype.Timestamptz `json:"sent_at"`
 	IsRead              bool               `json:"is_read"`
+	DeliveredAt         *time.Time         `json:"delivered_at,omitempty"`
+	Status              string             `json:"status"` // sent, delivered or read
 	Reactions           json.RawMessage    `json:"reactions"`
 	CurrentUserReaction *string            `json:"current_user_reaction,omitempty"`
 	ReplyTo             *RepliedToInfo     `json:"reply_to,omitempty"`
+	EditedAt            *time.Time         `json:"edited_at,omitempty"`
+	DeletedAt           *time.Time         `json:"deleted_at,omitempty"` // set for unsent messages, which have no content
 }
 
-func GetConversationHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	ctx := r.Context()
-	queries, errDb := db.GetDB()
-	if errDb != nil || queries == nil {
-		utils.RespondWithJSON(w, http.StatusInternalServerError,
-			GetConversationResponse{
-				Success: false,
-				Message: "Database connection error",
-			})
-		return
-	}
+func GetConversationHandler(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, errDb := db.GetDB()
+		if errDb != nil || queries == nil {
+			utils.RespondWithJSON(w, http.StatusInternalServerError,
+				GetConversationResponse{
+					Success: false,
+					Message: "Database connection error",
+				})
+			return
+		}
 
-	if r.Method != http.MethodPost {
-		utils.RespondWithJSON(w, http.StatusMethodNotAllowed,
-			GetConversationResponse{
-				Success: false,
-				Message: "Method Not Allowed: Use POST",
-			})
-		return
-	}
+		if r.Method != http.MethodPost {
+			utils.RespondWithJSON(w, http.StatusMethodNotAllowed,
+				GetConversationResponse{
+					Success: false,
+					Message: "Method Not Allowed: Use POST",
+				})
+			return
+		}
 
-	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
-	if !ok || claims == nil || claims.UserID <= 0 {
-		utils.RespondWithJSON(w, http.StatusUnauthorized,
-			GetConversationResponse{
-				Success: false,
-				Message: "Authentication required",
-			})
-		return
-	}
-	requestingUserID := int32(claims.UserID)
-
-	var req GetConversationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest,
-			GetConversationResponse{
-				Success: false,
-				Message: "Invalid request body format",
-			})
-		return
-	}
-	defer r.Body.Close()
-	otherUserID := req.OtherUserID
-
-	if otherUserID <= 0 || otherUserID == requestingUserID {
-		utils.RespondWithJSON(w, http.StatusBadRequest,
-			GetConversationResponse{
-				Success: false,
-				Message: "Valid other_user_id (different from self) is required",
-			})
-		return
-	}
+		claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithJSON(w, http.StatusUnauthorized,
+				GetConversationResponse{
+					Success: false,
+					Message: "Authentication required",
+				})
+			return
+		}
+		requestingUserID := int32(claims.UserID)
 
-	otherUserData, userErr := queries.GetUserByID(ctx, otherUserID)
-	if userErr != nil {
-		if errors.Is(userErr, pgx.ErrNoRows) {
-			utils.RespondWithJSON(w, http.StatusNotFound,
+		var req GetConversationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest,
 				GetConversationResponse{
 					Success: false,
-					Message: "The other user does not exist",
+					Message: "Invalid request body format",
 				})
-		} else {
-			log.Printf("ERROR: GetConversationHandler: Error fetching other user %d data: %v", otherUserID, userErr)
-			utils.RespondWithJSON(w, http.StatusInternalServerError,
+			return
+		}
+		defer r.Body.Close()
+		otherUserID := req.OtherUserID
+
+		if otherUserID <= 0 || otherUserID == requestingUserID {
+			utils.RespondWithJSON(w, http.StatusBadRequest,
 				GetConversationResponse{
 					Success: false,
-					Message: "Error checking user existence",
+					Message: "Valid other_user_id (different from self) is required",
 				})
+			return
 		}
-		return
-	}
 
-	mutualLikeParams := migrations.CheckMutualLikeExistsParams{LikerUserID: requestingUserID, LikedUserID: otherUserID}
-	mutualLikeResult, checkErr := queries.CheckMutualLikeExists(ctx, mutualLikeParams)
-	if checkErr != nil {
-		log.Printf("ERROR: GetConversationHandler: Failed to check mutual like between %d and %d: %v", requestingUserID, otherUserID, checkErr)
-		utils.RespondWithJSON(w, http.StatusInternalServerError,
-			GetConversationResponse{
-				Success: false,
-				Message: "Error checking match status",
-			})
-		return
-	}
-	if !mutualLikeResult.Valid || !mutualLikeResult.Bool {
-		utils.RespondWithJSON(w, http.StatusForbidden,
-			GetConversationResponse{
-				Success:  false,
-				Message:  "You can only view conversations with users you have matched with.",
-				Messages: []ConversationMessageResponse{},
-			})
-		return
-	}
+		if req.Before != "" && req.After != "" {
+			utils.RespondWithJSON(w, http.StatusBadRequest,
+				GetConversationResponse{
+					Success: false,
+					Message: "Only one of before or after may be set",
+				})
+			return
+		}
+		limit, limitErr := clampPageLimit(req.Limit, defaultConversationPageLimit, maxConversationPageLimit)
+		if limitErr != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest,
+				GetConversationResponse{
+					Success: false,
+					Message: limitErr.Error(),
+				})
+			return
+		}
+		var cursor *pageCursor
+		if raw := req.Before + req.After; raw != "" {
+			c, cursorErr := decodeCursor(raw)
+			if cursorErr != nil {
+				utils.RespondWithJSON(w, http.StatusBadRequest,
+					GetConversationResponse{
+						Success: false,
+						Message: "Invalid cursor",
+					})
+				return
+			}
+			cursor = &c
+		}
 
-	log.Printf("INFO: GetConversationHandler: Fetching conversation between %d and %d", requestingUserID, otherUserID)
+		otherUserData, userErr := queries.GetUserByID(ctx, otherUserID)
+		if userErr != nil {
+			if errors.Is(userErr, pgx.ErrNoRows) {
+				utils.RespondWithJSON(w, http.StatusNotFound,
+					GetConversationResponse{
+						Success: false,
+						Message: "The other user does not exist",
+					})
+			} else {
+				log.Printf("ERROR: GetConversationHandler: Error fetching other user %d data: %v", otherUserID, userErr)
+				utils.RespondWithJSON(w, http.StatusInternalServerError,
+					GetConversationResponse{
+						Success: false,
+						Message: "Error checking user existence",
+					})
+			}
+			return
+		}
 
-	params := migrations.GetConversationMessagesParams{
-		SenderUserID:    requestingUserID,
-		RecipientUserID: otherUserID,
-	}
-	dbMessages, err := queries.GetConversationMessages(ctx, params)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		log.Printf("ERROR: GetConversationHandler: queries.GetConversationMessages failed: %v", err)
-		utils.RespondWithJSON(w, http.StatusInternalServerError,
-			GetConversationResponse{
-				Success: false,
-				Message: "Error retrieving conversation",
-			})
-		return
-	}
+		mutualLikeParams := migrations.CheckMutualLikeExistsParams{LikerUserID: requestingUserID, LikedUserID: otherUserID}
+		mutualLikeResult, checkErr := queries.CheckMutualLikeExists(ctx, mutualLikeParams)
+		if checkErr != nil {
+			log.Printf("ERROR: GetConversationHandler: Failed to check mutual like between %d and %d: %v", requestingUserID, otherUserID, checkErr)
+			utils.RespondWithJSON(w, http.StatusInternalServerError,
+				GetConversationResponse{
+					Success: false,
+					Message: "Error checking match status",
+				})
+			return
+		}
+		if !mutualLikeResult.Valid || !mutualLikeResult.Bool {
+			utils.RespondWithJSON(w, http.StatusForbidden,
+				GetConversationResponse{
+					Success:  false,
+					Message:  "You can only view conversations with users you have matched with.",
+					Messages: []ConversationMessageResponse{},
+				})
+			return
+		}
+
+		log.Printf("INFO: GetConversationHandler: Fetching conversation between %d and %d", requestingUserID, otherUserID)
 
-	responseMessages := make([]ConversationMessageResponse, 0, len(dbMessages))
-	var lastMessageID int64 = 0
-	if len(dbMessages) > 0 {
-		userReactionsMap, userReactionsErr := fetchUserReactionsForMessages(ctx, queries, dbMessages, requestingUserID)
-		if userReactionsErr != nil {
-			log.Printf("WARN: GetConversationHandler: Failed to pre-fetch user reactions for user %d: %v. Proceeding without CurrentUserReaction.", requestingUserID, userReactionsErr)
-			userReactionsMap = make(map[int64]string)
+		dbMessages, hasMore, err := fetchConversationPage(ctx, queries, requestingUserID, otherUserID, req.After != "", cursor, limit)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("ERROR: GetConversationHandler: fetching conversation page failed: %v", err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError,
+				GetConversationResponse{
+					Success: false,
+					Message: "Error retrieving conversation",
+				})
+			return
 		}
 
-		for _, msg := range dbMessages {
-			var currentUserReaction *string
-			if emoji, found := userReactionsMap[msg.ID]; found {
-				tempEmoji := emoji
-				currentUserReaction = &tempEmoji
+		responseMessages := make([]ConversationMessageResponse, 0, len(dbMessages))
+		var lastMessageID int64 = 0
+		if len(dbMessages) > 0 {
+			userReactionsMap, userReactionsErr := fetchUserReactionsForMessages(ctx, queries, dbMessages, requestingUserID)
+			if userReactionsErr != nil {
+				log.Printf("WARN: GetConversationHandler: Failed to pre-fetch user reactions for user %d: %v. Proceeding without CurrentUserReaction.", requestingUserID, userReactionsErr)
+				userReactionsMap = make(map[int64]string)
 			}
-			reactionsJSON := msg.ReactionsData
-			if len(reactionsJSON) == 0 || string(reactionsJSON) == "null" {
-				reactionsJSON = []byte("{}")
-			}
-			var replyInfo *RepliedToInfo = nil
-			if msg.ReplyToMessageID.Valid && msg.RepliedMessageSenderID.Valid {
-				replyInfo = &RepliedToInfo{
-					MessageID:               msg.ReplyToMessageID.Int64,
-					SenderID:                msg.RepliedMessageSenderID.Int32,
-					TextSnippet:             nil,
-					RepliedMessageMediaType: nil,
+
+			for _, msg := range dbMessages {
+				var currentUserReaction *string
+				if emoji, found := userReactionsMap[msg.ID]; found {
+					tempEmoji := emoji
+					currentUserReaction = &tempEmoji
+				}
+				reactionsJSON := msg.ReactionsData
+				if len(reactionsJSON) == 0 || string(reactionsJSON) == "null" {
+					reactionsJSON = []byte("{}")
 				}
-				if snippetValue := msg.RepliedMessageTextSnippet; snippetValue != nil {
-					snippetStr, ok := snippetValue.(string)
-					if ok && snippetStr != "" {
-						replyInfo.TextSnippet = &snippetStr
+				var replyInfo *RepliedToInfo = nil
+				if msg.ReplyToMessageID.Valid && msg.RepliedMessageSenderID.Valid {
+					replyInfo = &RepliedToInfo{
+						MessageID:               msg.ReplyToMessageID.Int64,
+						SenderID:                msg.RepliedMessageSenderID.Int32,
+						TextSnippet:             nil,
+						RepliedMessageMediaType: nil,
+					}
+					if snippetValue := msg.RepliedMessageTextSnippet; snippetValue != nil {
+						snippetStr, ok := snippetValue.(string)
+						if ok && snippetStr != "" {
+							replyInfo.TextSnippet = &snippetStr
+						}
+					}
+					if msg.RepliedMessageMediaType.Valid {
+						mediaType := msg.RepliedMessageMediaType.String
+						replyInfo.RepliedMessageMediaType = &mediaType
 					}
 				}
-				if msg.RepliedMessageMediaType.Valid {
-					mediaType := msg.RepliedMessageMediaType.String
-					replyInfo.RepliedMessageMediaType = &mediaType
+
+				responseMsg := ConversationMessageResponse{
+					ID:                  msg.ID,
+					SenderUserID:        msg.SenderUserID,
+					RecipientUserID:     msg.RecipientUserID,
+					Kind:                string(msg.Kind),
+					MessageText:         msg.MessageText,
+					MediaUrl:            msg.MediaUrl,
+					MediaType:           msg.MediaType,
+					Payload:             json.RawMessage(msg.Payload),
+					SentAt:              msg.SentAt,
+					IsRead:              msg.IsRead,
+					DeliveredAt:         pgTimestampToTimePtr(msg.DeliveredAt),
+					Status:              messageStatus(msg.IsRead, msg.DeliveredAt),
+					Reactions:           json.RawMessage(reactionsJSON),
+					CurrentUserReaction: currentUserReaction,
+					ReplyTo:             replyInfo,
+					EditedAt:            pgTimestampToTimePtr(msg.EditedAt),
+					DeletedAt:           pgTimestampToTimePtr(msg.DeletedAt),
+				}
+				responseMessages = append(responseMessages, responseMsg)
+				if msg.ID > lastMessageID {
+					lastMessageID = msg.ID
 				}
 			}
+		} else if dbMessages == nil {
+			responseMessages = []ConversationMessageResponse{}
+		}
 
-			responseMsg := ConversationMessageResponse{
-				ID:                  msg.ID,
-				SenderUserID:        msg.SenderUserID,
-				RecipientUserID:     msg.RecipientUserID,
-				MessageText:         msg.MessageText,
-				MediaUrl:            msg.MediaUrl,
-				MediaType:           msg.MediaType,
-				SentAt:              msg.SentAt,
-				IsRead:              msg.IsRead,
-				Reactions:           json.RawMessage(reactionsJSON),
-				CurrentUserReaction: currentUserReaction,
-				ReplyTo:             replyInfo,
-			}
-			responseMessages = append(responseMessages, responseMsg)
-			if msg.ID > lastMessageID {
-				lastMessageID = msg.ID
+		var nextCursor string
+		if len(dbMessages) > 0 {
+			if req.After != "" {
+				last := dbMessages[len(dbMessages)-1]
+				nextCursor = encodeCursor(pageCursor{At: last.SentAt.Time, ID: last.ID})
+			} else if hasMore {
+				nextCursor = encodeCursor(pageCursor{At: dbMessages[0].SentAt.Time, ID: dbMessages[0].ID})
 			}
 		}
-	} else if dbMessages == nil {
-		responseMessages = []ConversationMessageResponse{}
+
+		log.Printf("INFO: GetConversationHandler: Successfully processed %d messages for conversation between %d and %d.", len(responseMessages), requestingUserID, otherUserID)
+
+		presence := userPresence(ctx, hub, []int32{otherUserID})
+		otherIsOnline, otherLastOnline := ws.ResolvePresence(presence, otherUserID, otherUserData.IsOnline, otherUserData.LastOnline)
+		utils.RespondWithJSON(w, http.StatusOK, GetConversationResponse{
+			Success:             true,
+			OtherUserIsOnline:   otherIsOnline,
+			OtherUserLastOnline: otherLastOnline,
+			Messages:            responseMessages,
+			HasMore:             hasMore,
+			NextCursor:          nextCursor,
+		})
+
+		if lastMessageID > 0 {
+			go func(lastID int64) {
+				bgCtx := context.Background()
+				queriesBG, errDbBG := db.GetDB()
+				if errDbBG != nil || queriesBG == nil {
+					log.Printf("WARN: GetConversationHandler Goroutine: Cannot get DB queries: %v", errDbBG)
+					return
+				}
+				markReadParams := migrations.MarkMessagesAsReadUntilParams{RecipientUserID: requestingUserID, SenderUserID: otherUserID, ID: lastID}
+				_, errMark := queriesBG.MarkMessagesAsReadUntil(bgCtx, markReadParams)
+				if errMark != nil {
+					log.Printf("WARN: GetConversationHandler Goroutine: Failed mark read until ID %d: %v", lastID, errMark)
+				} else {
+					log.Printf("INFO: GetConversationHandler Goroutine: Marked messages read until ID %d", lastID)
+				}
+			}(lastMessageID)
+		}
 	}
+}
 
-	log.Printf("INFO: GetConversationHandler: Successfully processed %d messages for conversation between %d and %d.", len(responseMessages), requestingUserID, otherUserID)
+func messageStatus(isRead bool, deliveredAt pgtype.Timestamptz) string {
+	switch {
+	case isRead:
+		return "read"
+	case deliveredAt.Valid:
+		return "delivered"
+	}
+	return "sent"
+}
 
-	utils.RespondWithJSON(w, http.StatusOK, GetConversationResponse{
-		Success:             true,
-		OtherUserIsOnline:   otherUserData.IsOnline,
-		OtherUserLastOnline: pgTimestampToTimePtr(otherUserData.LastOnline),
-		Messages:            responseMessages,
-	})
+// fetchConversationPage returns up to limit messages in chronological order,
+// either older than cursor or (when after is set) newer than it. One extra row
+// is requested to tell whether another page exists.
+func fetchConversationPage(ctx context.Context, queries *migrations.Queries, userID, otherUserID int32, after bool, cursor *pageCursor, limit int32) ([]migrations.GetConversationMessagesRow, bool, error) {
+	if after {
+		rows, err := queries.GetConversationMessagesAfter(ctx, migrations.GetConversationMessagesAfterParams{
+			UserID:      userID,
+			OtherUserID: otherUserID,
+			AfterSentAt: cursorTimestamp(cursor.At),
+			AfterID:     cursor.ID,
+			PageLimit:   limit + 1,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		hasMore := len(rows) > int(limit)
+		if hasMore {
+			rows = rows[:limit]
+		}
+		messages := make([]migrations.GetConversationMessagesRow, len(rows))
+		for i, row := range rows {
+			messages[i] = migrations.GetConversationMessagesRow(row)
+		}
+		return messages, hasMore, nil
+	}
 
-	if lastMessageID > 0 {
-		go func(lastID int64) {
-			bgCtx := context.Background()
-			queriesBG, errDbBG := db.GetDB()
-			if errDbBG != nil || queriesBG == nil {
-				log.Printf("WARN: GetConversationHandler Goroutine: Cannot get DB queries: %v", errDbBG)
-				return
-			}
-			markReadParams := migrations.MarkMessagesAsReadUntilParams{RecipientUserID: requestingUserID, SenderUserID: otherUserID, ID: lastID}
-			_, errMark := queriesBG.MarkMessagesAsReadUntil(bgCtx, markReadParams)
-			if errMark != nil {
-				log.Printf("WARN: GetConversationHandler Goroutine: Failed mark read until ID %d: %v", lastID, errMark)
-			} else {
-				log.Printf("INFO: GetConversationHandler Goroutine: Marked messages read until ID %d", lastID)
-			}
-		}(lastMessageID)
+	params := migrations.GetConversationMessagesParams{
+		UserID:       userID,
+		OtherUserID:  otherUserID,
+		BeforeSentAt: timestampPosInf,
+		BeforeID:     maxCursorID64,
+		PageLimit:    limit + 1,
+	}
+	if cursor != nil {
+		params.BeforeSentAt = cursorTimestamp(cursor.At)
+		params.BeforeID = cursor.ID
+	}
+	rows, err := queries.GetConversationMessages(ctx, params)
+	if err != nil {
+		return nil, false, err
 	}
+	hasMore := len(rows) > int(limit)
+	if hasMore {
+		rows = rows[1:]
+	}
+	return rows, hasMore, nil
 }
 
 func fetchUserReactionsForMessages(ctx context.Context, queries *migrations.Queries, messages []migrations.GetConversationMessagesRow, userID int32) (map[int64]string, error) {
@@ -280,3 +410,78 @@ func fetchUserReactionsForMessages(ctx context.Context, queries *migrations.Quer
 
 	return resultMap, nil
 }
+
+type MessageEditResponse struct {
+	PreviousText string    `json:"previous_text"`
+	EditedAt     time.Time `json:"edited_at"`
+}
+
+type MessageEditHistoryResponse struct {
+	Success bool                  `json:"success"`
+	Message string                `json:"message,omitempty"`
+	Edits   []MessageEditResponse `json:"edits"`
+}
+
+// GetMessageEditHistoryHandler returns the earlier versions of a message, oldest
+// first, to either participant of its conversation.
+func GetMessageEditHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, errDb := db.GetDB()
+	if errDb != nil || queries == nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database connection error")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET")
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	userID := int32(claims.UserID)
+
+	messageID, err := strconv.ParseInt(r.URL.Query().Get("message_id"), 10, 64)
+	if err != nil || messageID <= 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Valid message_id query parameter is required")
+		return
+	}
+
+	participants, err := queries.GetMessageSenderRecipient(ctx, messageID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "Message not found")
+			return
+		}
+		log.Printf("ERROR: GetMessageEditHistoryHandler: Failed fetch message %d: %v", messageID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving message")
+		return
+	}
+	if participants.SenderUserID != userID && participants.RecipientUserID != userID {
+		utils.RespondWithError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+
+	edits, err := queries.GetChatMessageEdits(ctx, messageID)
+	if err != nil {
+		log.Printf("ERROR: GetMessageEditHistoryHandler: Failed fetch edits for message %d: %v", messageID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving edit history")
+		return
+	}
+	response := make([]MessageEditResponse, 0, len(edits))
+	for _, edit := range edits {
+		response = append(response, MessageEditResponse{
+			PreviousText: edit.PreviousText,
+			EditedAt:     edit.EditedAt.Time,
+		})
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, MessageEditHistoryResponse{
+		Success: true,
+		Edits:   response,
+	})
+}
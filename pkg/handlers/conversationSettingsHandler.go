@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/arnnvv/peeple-api/pkg/ws"
+	"github.com/jackc/pgx/v5"
+)
+
+type ConversationSettingsResponse struct {
+	Success  bool                       `json:"success"`
+	Message  string                     `json:"message,omitempty"`
+	Settings *ws.WsConversationSettings `json:"settings,omitempty"`
+}
+
+// ConversationSettingsHandler reads (GET ?other_user_id=) and changes (PUT)
+// the caller's mute, pin, archive and cleared-history settings for one
+// conversation. Changes are pushed to the caller's other devices.
+func ConversationSettingsHandler(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, errDb := db.GetDB()
+		if errDb != nil || queries == nil {
+			utils.RespondWithJSON(w, http.StatusInternalServerError, ConversationSettingsResponse{Success: false, Message: "Database connection error"})
+			return
+		}
+
+		claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithJSON(w, http.StatusUnauthorized, ConversationSettingsResponse{Success: false, Message: "Authentication required"})
+			return
+		}
+		userID := int32(claims.UserID)
+
+		switch r.Method {
+		case http.MethodGet:
+			otherUserID, err := strconv.ParseInt(r.URL.Query().Get("other_user_id"), 10, 32)
+			if err != nil || otherUserID <= 0 {
+				utils.RespondWithJSON(w, http.StatusBadRequest, ConversationSettingsResponse{Success: false, Message: "Valid other_user_id is required"})
+				return
+			}
+			settings, err := queries.GetConversationSettings(ctx, migrations.GetConversationSettingsParams{
+				UserID:     userID,
+				PeerUserID: int32(otherUserID),
+			})
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				log.Printf("ERROR: ConversationSettingsHandler: Failed fetch settings %d -> %d: %v", userID, otherUserID, err)
+				utils.RespondWithJSON(w, http.StatusInternalServerError, ConversationSettingsResponse{Success: false, Message: "Error retrieving conversation settings"})
+				return
+			}
+			settings.PeerUserID = int32(otherUserID)
+			view := ws.ConversationSettingsView(settings)
+			utils.RespondWithJSON(w, http.StatusOK, ConversationSettingsResponse{Success: true, Settings: &view})
+
+		case http.MethodPut:
+			var req ws.ConversationSettingsRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				utils.RespondWithJSON(w, http.StatusBadRequest, ConversationSettingsResponse{Success: false, Message: "Invalid request body format"})
+				return
+			}
+			defer r.Body.Close()
+
+			settings, err := ws.ProcessConversationSettings(ctx, queries, hub, userID, req)
+			if err != nil {
+				utils.RespondWithJSON(w, http.StatusBadRequest, ConversationSettingsResponse{Success: false, Message: err.Error()})
+				return
+			}
+			view := ws.ConversationSettingsView(settings)
+			utils.RespondWithJSON(w, http.StatusOK, ConversationSettingsResponse{Success: true, Message: "Conversation settings updated", Settings: &view})
+
+		default:
+			utils.RespondWithJSON(w, http.StatusMethodNotAllowed, ConversationSettingsResponse{Success: false, Message: "Method Not Allowed: Use GET or PUT"})
+		}
+	}
+}
@@ -17,10 +17,12 @@ import (
 
 	"github.com/arnnvv/peeple-api/migrations"
 	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/identity"
 	"github.com/arnnvv/peeple-api/pkg/token"
 	"github.com/arnnvv/peeple-api/pkg/utils"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type GoogleAuthRequest struct {
@@ -43,9 +45,11 @@ type googleTokenInfoResponse struct {
 }
 
 type GoogleAuthResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
+	Success      bool   `json:"success"`
+	Message      string `json:"message"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
 }
 
 const googleTokenInfoURL = "https://www.googleapis.com/oauth2/v3/tokeninfo"
@@ -234,8 +238,28 @@ func GoogleAuthHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Existing user found: ID=%d, Email=%s", appUser.ID, appUser.Email)
 	}
 
+	if tokenInfo.UserID != "" {
+		linkErr := queries.UpsertUserIdentity(ctx, migrations.UpsertUserIdentityParams{
+			UserID:   appUser.ID,
+			Provider: identity.ProviderGoogle,
+			Subject:  tokenInfo.UserID,
+			Email:    pgtype.Text{String: tokenInfo.Email, Valid: true},
+		})
+		if linkErr != nil {
+			log.Printf("WARNING: Failed to record Google identity for user ID %d: %v", appUser.ID, linkErr)
+		}
+	}
+
+	if err := cancelPendingAccountDeletion(ctx, queries, appUser.ID); err != nil {
+		log.Printf("Failed to cancel pending deletion for user ID %d: %v", appUser.ID, err)
+		utils.RespondWithJSON(w, http.StatusInternalServerError, GoogleAuthResponse{
+			Success: false, Message: "Failed to sign in",
+		})
+		return
+	}
+
 	// --- Generate App Token ---
-	appToken, err := token.GenerateToken(appUser.ID)
+	tokens, err := token.IssueTokenPair(ctx, appUser.ID)
 	if err != nil {
 		log.Printf("Failed to generate application token for user ID %d: %v", appUser.ID, err)
 		utils.RespondWithJSON(w, http.StatusInternalServerError, GoogleAuthResponse{
@@ -246,8 +270,10 @@ func GoogleAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Google token verified and app token generated successfully for user ID: %d, Email: %s", appUser.ID, tokenInfo.Email)
 	utils.RespondWithJSON(w, http.StatusOK, GoogleAuthResponse{
-		Success: true,
-		Message: "Authentication successful",
-		Token:   appToken,
+		Success:      true,
+		Message:      "Authentication successful",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
 	})
 }
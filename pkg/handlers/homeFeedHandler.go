@@ -48,6 +48,9 @@ type ProfileFeedItem struct {
 	SpotlightActiveUntil pgtype.Timestamptz                   `json:"SpotlightActiveUntil"`
 	Prompts              json.RawMessage                      `json:"prompts"`
 	DistanceKm           float64                              `json:"distance_km"`
+	// VisitingCity is set while the profile is in travel mode; Latitude and
+	// Longitude are then the travel location.
+	VisitingCity *string `json:"visiting_city,omitempty"`
 }
 
 // --- HomeFeedResponse (No Changes) ---
@@ -104,8 +107,16 @@ func GetHomeFeedHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// --- Location Check ---
-	if !requestingUser.Latitude.Valid || !requestingUser.Longitude.Valid {
+	// --- Location Check (a travel location counts) ---
+	_, _, hasLocation, err := feedLocation(ctx, queries, requestingUser)
+	if err != nil {
+		log.Printf("GetHomeFeedHandler: Error fetching travel location for user %d: %v", requestingUserID, err)
+		utils.RespondWithJSON(w, http.StatusInternalServerError, HomeFeedResponse{
+			Success: false, Message: "Error retrieving user data.",
+		})
+		return
+	}
+	if !hasLocation {
 		log.Printf("GetHomeFeedHandler: Requesting user %d missing location data.", requestingUserID)
 		utils.RespondWithJSON(w, http.StatusBadRequest, HomeFeedResponse{
 			Success: false, Message: "Please set your location in your profile to use the feed.",
@@ -247,6 +258,11 @@ func GetHomeFeedHandler(w http.ResponseWriter, r *http.Request) {
 				Prompts:              dbProfile.Prompts,
 				DistanceKm:           dbProfile.DistanceKm,
 			}
+			if dbProfile.VisitingCity.Valid {
+				responseItem.VisitingCity = &dbProfile.VisitingCity.String
+				responseItem.Latitude = dbProfile.VisitingLatitude
+				responseItem.Longitude = dbProfile.VisitingLongitude
+			}
 			responseProfiles = append(responseProfiles, responseItem)
 		}
 	}
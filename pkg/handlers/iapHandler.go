@@ -7,14 +7,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/catalog"
 	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/iap"
 	"github.com/arnnvv/peeple-api/pkg/token"
 	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -24,6 +25,9 @@ type VerifyPurchaseRequest struct {
 	ReceiptData   string `json:"receipt_data"`
 	ProductID     string `json:"product_id"`
 	TransactionID string `json:"transaction_id"`
+	// ProductType is the store's type for the product, "consumable" or
+	// "subscription". It is only used for products not in the catalog.
+	ProductType string `json:"product_type,omitempty"`
 }
 
 // VerifyPurchaseResponse is sent back to the mobile app
@@ -32,224 +36,314 @@ type VerifyPurchaseResponse struct {
 	Message string `json:"message"`
 }
 
-// --- Placeholder Verification ---
-func verifyReceipt(platform, receiptData, productID, transactionID string) (bool, error) {
-	log.Printf("[DEBUG IAP Verify] Simulating receipt verification...")
-	log.Printf("[DEBUG IAP Verify]   Platform: %s", platform)
-	log.Printf("[DEBUG IAP Verify]   ProductID: %s", productID)
-	log.Printf("[DEBUG IAP Verify]   TxID: %s", transactionID)
-	if platform != "ios" && platform != "android" {
-		log.Printf("[ERROR IAP Verify] Invalid platform")
-		return false, errors.New("invalid platform specified")
-	}
-	if receiptData == "" || productID == "" || transactionID == "" {
-		log.Printf("[ERROR IAP Verify] Missing required data")
-		return false, errors.New("missing required purchase data for verification")
+// grantProduct grants everything product includes to userID for the
+// recorded purchase. Subscriptions run until the store's expiry for the
+// purchase when it reports one.
+func grantProduct(ctx context.Context, queries *migrations.Queries, userID int32, product catalog.Product, purchase migrations.Purchase) error {
+	for _, grant := range product.Grants {
+		if grant.IsConsumable() {
+			if err := grantConsumable(ctx, queries, userID, purchase.ID, grant.FeatureType, grant.Quantity); err != nil {
+				return err
+			}
+			continue
+		}
+		duration, err := catalog.ParseDuration(grant.Duration)
+		if err != nil {
+			return fmt.Errorf("product %s: %w", product.ProductID, err)
+		}
+		if err := grantSubscription(ctx, queries, userID, purchase, grant.FeatureType, duration); err != nil {
+			return err
+		}
 	}
-	time.Sleep(50 * time.Millisecond)
-	log.Printf("[DEBUG IAP Verify] Simulation successful.")
-	return true, nil
+	return nil
 }
 
-// VerifyPurchaseHandler handles requests from the app to verify IAPs
-func VerifyPurchaseHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	ctx := r.Context()
-	queries, _ := db.GetDB()
-	if queries == nil {
-		log.Println("ERROR: VerifyPurchaseHandler: Database connection not available.")
-		utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Database connection error"})
-		return
-	}
-
-	if r.Method != http.MethodPost {
-		utils.RespondWithJSON(w, http.StatusMethodNotAllowed, VerifyPurchaseResponse{Success: false, Message: "Method Not Allowed: Use POST"})
-		return
-	}
-
-	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
-	if !ok || claims == nil || claims.UserID <= 0 {
-		utils.RespondWithJSON(w, http.StatusUnauthorized, VerifyPurchaseResponse{Success: false, Message: "Authentication required"})
-		return
-	}
-	userID := int32(claims.UserID)
-
-	var req VerifyPurchaseRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "Invalid request body format"})
-		return
-	}
-	defer r.Body.Close()
-
-	if req.Platform == "" || req.ReceiptData == "" || req.ProductID == "" || req.TransactionID == "" {
-		utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "Missing required fields: platform, receipt_data, product_id, transaction_id"})
-		return
-	}
-	log.Printf("[DEBUG VerifyHandler] Processing IAP: User=%d, Product=%s, TxID=%s", userID, req.ProductID, req.TransactionID)
-
-	// --- Step 1: Verify Receipt (Placeholder) ---
-	verified, err := verifyReceipt(req.Platform, req.ReceiptData, req.ProductID, req.TransactionID)
-	if err != nil || !verified {
-		log.Printf("[ERROR VerifyHandler] IAP verification failed: User=%d, TxID=%s, Error=%v", userID, req.TransactionID, err)
-		utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "Purchase verification failed"})
-		return
-	}
-	log.Printf("[DEBUG VerifyHandler] IAP receipt/token verified (simulated): User=%d, TxID=%s", userID, req.TransactionID)
-
-	// --- Step 2: Check for Replay Attack (TODO) ---
-	log.Printf("[DEBUG VerifyHandler] Skipping replay check: User=%d, TxID=%s (TODO)", userID, req.TransactionID)
-
-	// --- Step 3: Grant Feature based on Product ID ---
-	var grantErr error
-	productParts := strings.Split(req.ProductID, "_")
-	log.Printf("[DEBUG VerifyHandler] Product ID Parts (Split by '_'): %q", productParts)
-
-	if len(productParts) < 3 {
-		log.Printf("[ERROR VerifyHandler] Invalid product ID format (expected at least 3 parts separated by _): User=%d, Product=%s, Parts=%d", userID, req.ProductID, len(productParts))
-		utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "Invalid product identifier format"})
-		return
-	}
+// VerifyPurchaseHandler verifies an in-app purchase with its store and
+// grants what it pays for. Each store transaction is granted once; reporting
+// it again succeeds without granting anything more. Purchases of products
+// missing from the catalog are recorded and refused with 503 until the
+// product is added.
+func VerifyPurchaseHandler(verifiers iap.Verifiers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, _ := db.GetDB()
+		pool, _ := db.GetPool()
+		if queries == nil || pool == nil {
+			log.Println("ERROR: VerifyPurchaseHandler: Database connection not available.")
+			utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Database connection error"})
+			return
+		}
 
-	// ** FINAL PARSING LOGIC **
-	detail := productParts[len(productParts)-1] // Value/Duration is always last.
-	log.Printf("[DEBUG VerifyHandler] Assumed Detail Part: %s", detail)
+		if r.Method != http.MethodPost {
+			utils.RespondWithJSON(w, http.StatusMethodNotAllowed, VerifyPurchaseResponse{Success: false, Message: "Method Not Allowed: Use POST"})
+			return
+		}
 
-	// Identify feature based on expected structure parts using HasSuffix for flexibility
-	actualFeatureType := ""
-	isConsumable := false
-	isSubscription := false
+		claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithJSON(w, http.StatusUnauthorized, VerifyPurchaseResponse{Success: false, Message: "Authentication required"})
+			return
+		}
+		userID := int32(claims.UserID)
 
-	partBeforeDetail := productParts[len(productParts)-2]
-	partTwoBeforeDetail := productParts[len(productParts)-3] // Part potentially containing the core feature name
+		var req VerifyPurchaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "Invalid request body format"})
+			return
+		}
+		defer r.Body.Close()
 
-	log.Printf("[DEBUG VerifyHandler] Part before detail: '%s'", partBeforeDetail)
-	log.Printf("[DEBUG VerifyHandler] Part two before detail: '%s'", partTwoBeforeDetail)
+		if req.Platform == "" || req.ReceiptData == "" || req.ProductID == "" || req.TransactionID == "" {
+			utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "Missing required fields: platform, receipt_data, product_id, transaction_id"})
+			return
+		}
+		platform := migrations.PurchasePlatform(req.Platform)
+		if platform != migrations.PurchasePlatformIos && platform != migrations.PurchasePlatformAndroid {
+			utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "platform must be ios or android"})
+			return
+		}
+		verifier, ok := verifiers[platform]
+		if !ok {
+			log.Printf("[ERROR VerifyHandler] No receipt verifier configured for %s", platform)
+			utils.RespondWithJSON(w, http.StatusServiceUnavailable, VerifyPurchaseResponse{Success: false, Message: "Purchases are not available on this platform"})
+			return
+		}
+		log.Printf("[DEBUG VerifyHandler] Processing IAP: User=%d, Product=%s, TxID=%s", userID, req.ProductID, req.TransactionID)
+
+		// --- Step 1: Look up what the product grants ---
+		// A product missing from the catalog was still paid for, so its
+		// purchase is verified and recorded, and granted when the app reports
+		// it again after the product has been added.
+		product, err := catalog.Get(ctx, queries, req.ProductID)
+		inCatalog := err == nil
+		if err != nil && !errors.Is(err, catalog.ErrNotFound) {
+			log.Printf("[ERROR VerifyHandler] Failed to load product %s: %v", req.ProductID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to load product"})
+			return
+		}
+		subscription := product.Subscription
+		if !inCatalog {
+			log.Printf("[ERROR VerifyHandler] Product not in catalog: Product=%s, User=%d", req.ProductID, userID)
+			subscription = req.ProductType == "subscription"
+		}
 
-	// Check Consumables: ..._feature_pack_VALUE
-	if partBeforeDetail == "pack" {
-		if strings.HasSuffix(partTwoBeforeDetail, "rose") { // Check if it ends with rose (e.g., com.yourapp.rose)
-			actualFeatureType = "rose"
-			isConsumable = true
-			log.Printf("[DEBUG VerifyHandler] Matched pattern: ..._rose_pack_...")
-		} else if strings.HasSuffix(partTwoBeforeDetail, "spotlight") { // Check if it ends with spotlight
-			actualFeatureType = "spotlight"
-			isConsumable = true
-			log.Printf("[DEBUG VerifyHandler] Matched pattern: ..._spotlight_pack_...")
+		// --- Step 2: Verify with the store ---
+		purchase, err := verifier.Verify(ctx, iap.Request{
+			ProductID:     req.ProductID,
+			TransactionID: req.TransactionID,
+			ReceiptData:   req.ReceiptData,
+			Subscription:  subscription,
+		})
+		if err != nil {
+			log.Printf("[ERROR VerifyHandler] IAP verification failed: User=%d, TxID=%s, Error=%v", userID, req.TransactionID, err)
+			if errors.Is(err, iap.ErrInvalidReceipt) || errors.Is(err, iap.ErrRevoked) {
+				utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "Purchase verification failed"})
+			} else {
+				utils.RespondWithJSON(w, http.StatusBadGateway, VerifyPurchaseResponse{Success: false, Message: "Could not reach the store, please try again"})
+			}
+			return
 		}
-		// Check Subscriptions: ..._feature_descriptor_VALUE
-	} else if partBeforeDetail == "likes" { // Descriptor is feature itself
-		if strings.HasSuffix(partTwoBeforeDetail, "unlimited") { // Check qualifier before
-			actualFeatureType = "likes"
-			isSubscription = true
-			log.Printf("[DEBUG VerifyHandler] Matched pattern: ..._unlimited_likes_...")
+		log.Printf("[DEBUG VerifyHandler] IAP verified by %s: User=%d, TxID=%s, Environment=%s", verifier.Name(), userID, purchase.TransactionID, purchase.Environment)
+
+		// --- Step 3: Record the purchase and grant it in one transaction ---
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			log.Printf("[ERROR VerifyHandler] Failed to begin transaction: User=%d, Error=%v", userID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to update user features"})
+			return
 		}
-	} else if partBeforeDetail == "mode" { // Descriptor is mode
-		if strings.HasSuffix(partTwoBeforeDetail, "travel") { // Check qualifier before
-			actualFeatureType = "travel"
-			isSubscription = true
-			log.Printf("[DEBUG VerifyHandler] Matched pattern: ..._travel_mode_...")
+		defer tx.Rollback(ctx)
+		qtx := queries.WithTx(tx)
+
+		recorded, err := qtx.RecordPurchase(ctx, recordPurchaseParams(userID, purchase))
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Replayed: granted when it was first reported, unless its product
+			// wasn't in the catalog yet.
+			existing, err := qtx.GetPurchaseByTransaction(ctx, migrations.GetPurchaseByTransactionParams{Platform: platform, TransactionID: purchase.TransactionID})
+			if err != nil {
+				log.Printf("[ERROR VerifyHandler] Failed to load recorded purchase: TxID=%s, Error=%v", purchase.TransactionID, err)
+				utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to update user features"})
+				return
+			}
+			if !existing.UserID.Valid || existing.UserID.Int32 != userID {
+				log.Printf("[WARN VerifyHandler] Purchase replayed by another account: User=%d, TxID=%s", userID, purchase.TransactionID)
+				utils.RespondWithJSON(w, http.StatusConflict, VerifyPurchaseResponse{Success: false, Message: "This purchase has already been redeemed"})
+				return
+			}
+			granted, err := qtx.GetPurchaseGrants(ctx, pgtype.Int8{Int64: existing.ID, Valid: true})
+			if err != nil {
+				log.Printf("[ERROR VerifyHandler] Failed to load purchase grants: TxID=%s, Error=%v", purchase.TransactionID, err)
+				utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to update user features"})
+				return
+			}
+			if len(granted) > 0 || existing.RevokedAt.Valid {
+				log.Printf("[INFO VerifyHandler] Purchase already processed: User=%d, TxID=%s", userID, purchase.TransactionID)
+				utils.RespondWithJSON(w, http.StatusOK, VerifyPurchaseResponse{Success: true, Message: "Purchase already processed"})
+				return
+			}
+			// Recorded while the product wasn't in the catalog.
+			recorded = existing
+		} else if err != nil {
+			log.Printf("[ERROR VerifyHandler] Failed to record purchase: User=%d, TxID=%s, Error=%v", userID, purchase.TransactionID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to update user features"})
+			return
 		}
-	}
 
-	// Final check if a type was identified
-	if actualFeatureType == "" {
-		log.Printf("[ERROR VerifyHandler] Could not match known product structure: Product='%s', User=%d", req.ProductID, userID)
-		utils.RespondWithJSON(w, http.StatusBadRequest, VerifyPurchaseResponse{Success: false, Message: "Unrecognized product structure"})
-		return
-	}
-	log.Printf("[DEBUG VerifyHandler] Determined Feature Type: '%s', Detail: '%s', IsConsumable: %t, IsSubscription: %t", actualFeatureType, detail, isConsumable, isSubscription)
+		if !inCatalog {
+			if err := tx.Commit(ctx); err != nil {
+				log.Printf("[ERROR VerifyHandler] Failed to commit purchase: User=%d, TxID=%s, Error=%v", userID, purchase.TransactionID, err)
+				utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to update user features"})
+				return
+			}
+			log.Printf("[WARN VerifyHandler] Recorded purchase of unknown product without granting it: Product=%s, User=%d, TxID=%s", req.ProductID, userID, purchase.TransactionID)
+			utils.RespondWithJSON(w, http.StatusServiceUnavailable, VerifyPurchaseResponse{Success: false, Message: "This product is not available yet. Your purchase is saved and will be granted when you retry."})
+			return
+		}
 
-	// Grant based on the identified feature key and type
-	if isConsumable {
-		switch actualFeatureType {
-		case "rose":
-			grantErr = grantConsumable(ctx, queries, userID, migrations.PremiumFeatureTypeRose, detail)
-		case "spotlight":
-			grantErr = grantConsumable(ctx, queries, userID, migrations.PremiumFeatureTypeSpotlight, detail)
-		default:
-			grantErr = fmt.Errorf("internal error: unknown consumable type '%s'", actualFeatureType)
+		if grantErr := grantProduct(ctx, qtx, userID, product, recorded); grantErr != nil {
+			log.Printf("[ERROR VerifyHandler] Failed to grant product: Product=%s, User=%d, Error=%v", req.ProductID, userID, grantErr)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to update user features"})
+			return
 		}
-	} else if isSubscription {
-		switch actualFeatureType {
-		case "likes":
-			grantErr = grantSubscription(ctx, queries, userID, migrations.PremiumFeatureTypeUnlimitedLikes, detail)
-		case "travel":
-			grantErr = grantSubscription(ctx, queries, userID, migrations.PremiumFeatureTypeTravelMode, detail)
-		default:
-			grantErr = fmt.Errorf("internal error: unknown subscription type '%s'", actualFeatureType)
+		if err := tx.Commit(ctx); err != nil {
+			log.Printf("[ERROR VerifyHandler] Failed to commit purchase: User=%d, TxID=%s, Error=%v", userID, purchase.TransactionID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to update user features"})
+			return
 		}
-	} else {
-		// Should not happen if logic above is complete
-		grantErr = fmt.Errorf("internal error: product identified but type (consumable/subscription) unknown")
-	}
-	// ** END OF FINAL PARSING LOGIC **
 
-	if grantErr != nil {
-		log.Printf("[ERROR VerifyHandler] Failed to grant feature: Product=%s, Type=%s, Detail=%s, User=%d, Error=%v", req.ProductID, actualFeatureType, detail, userID, grantErr)
-		utils.RespondWithJSON(w, http.StatusInternalServerError, VerifyPurchaseResponse{Success: false, Message: "Failed to update user features"})
-		return
+		// --- Step 4: Respond Success ---
+		log.Printf("[INFO VerifyHandler] Successfully processed IAP: User=%d, Product=%s, TxID=%s", userID, req.ProductID, purchase.TransactionID)
+		utils.RespondWithJSON(w, http.StatusOK, VerifyPurchaseResponse{Success: true, Message: "Purchase verified and feature granted"})
 	}
+}
 
-	// --- Step 4: Mark Transaction as Processed (TODO) ---
-	log.Printf("[DEBUG VerifyHandler] Skipping marking TxID %s as processed (TODO)", req.TransactionID)
+// recordPurchaseParams records a verified purchase as userID's.
+func recordPurchaseParams(userID int32, purchase iap.Purchase) migrations.RecordPurchaseParams {
+	var expiresAt pgtype.Timestamptz
+	if purchase.ExpiresAt != nil {
+		expiresAt = pgtype.Timestamptz{Time: *purchase.ExpiresAt, Valid: true}
+	}
+	return migrations.RecordPurchaseParams{
+		UserID:                pgtype.Int4{Int32: userID, Valid: true},
+		Platform:              purchase.Platform,
+		TransactionID:         purchase.TransactionID,
+		OriginalTransactionID: pgtype.Text{String: purchase.OriginalTransactionID, Valid: purchase.OriginalTransactionID != ""},
+		PurchaseToken:         pgtype.Text{String: purchase.PurchaseToken, Valid: purchase.PurchaseToken != ""},
+		ProductID:             purchase.ProductID,
+		Environment:           purchase.Environment,
+		PurchasedAt:           pgtype.Timestamptz{Time: purchase.PurchasedAt, Valid: true},
+		ExpiresAt:             expiresAt,
+	}
+}
 
-	// --- Step 5: Respond Success ---
-	log.Printf("[INFO VerifyHandler] Successfully processed IAP: User=%d, Product=%s, TxID=%s", userID, req.ProductID, req.TransactionID)
-	utils.RespondWithJSON(w, http.StatusOK, VerifyPurchaseResponse{Success: true, Message: "Purchase verified and feature granted"})
+// storeSubscriptionKey identifies the store subscription a purchase belongs
+// to across renewals.
+func storeSubscriptionKey(purchase migrations.Purchase) pgtype.Text {
+	if purchase.OriginalTransactionID.Valid {
+		return purchase.OriginalTransactionID
+	}
+	return purchase.PurchaseToken
 }
 
-// grantConsumable updates the user's consumable balance
-func grantConsumable(ctx context.Context, queries *migrations.Queries, userID int32, consumableType migrations.PremiumFeatureType, detail string) error {
-	log.Printf("[DEBUG grantConsumable] Granting: User=%d, Type=%s, Detail=%s", userID, consumableType, detail)
-	quantity, err := strconv.Atoi(detail)
-	if err != nil || quantity <= 0 {
-		log.Printf("[ERROR grantConsumable] Invalid quantity: Detail='%s', User=%d, Error=%v", detail, userID, err)
-		return fmt.Errorf("invalid quantity detail '%s' for consumable product", detail)
+// findStoreSubscription finds userID's featureType subscription paid for by
+// earlier purchases of the store subscription purchase belongs to.
+func findStoreSubscription(ctx context.Context, queries *migrations.Queries, purchase migrations.Purchase, userID int32, featureType migrations.PremiumFeatureType) (migrations.UserSubscription, bool, error) {
+	subscriptions, err := queries.GetSubscriptionsForStoreSubscription(ctx, migrations.GetSubscriptionsForStoreSubscriptionParams{
+		Platform:              purchase.Platform,
+		OriginalTransactionID: storeSubscriptionKey(purchase),
+	})
+	if err != nil {
+		return migrations.UserSubscription{}, false, err
 	}
+	for _, s := range subscriptions {
+		if s.UserID == userID && s.FeatureType == featureType {
+			return s, true, nil
+		}
+	}
+	return migrations.UserSubscription{}, false, nil
+}
 
+// grantConsumable updates the user's consumable balance
+func grantConsumable(ctx context.Context, queries *migrations.Queries, userID int32, purchaseID int64, consumableType migrations.PremiumFeatureType, quantity int32) error {
+	log.Printf("[DEBUG grantConsumable] Granting: User=%d, Type=%s, Quantity=%d", userID, consumableType, quantity)
 	_, dbErr := queries.UpsertUserConsumable(ctx, migrations.UpsertUserConsumableParams{
 		UserID:         userID,
 		ConsumableType: consumableType,
-		Quantity:       int32(quantity),
+		Quantity:       quantity,
 	})
 
 	if dbErr != nil {
 		log.Printf("[ERROR grantConsumable] DB Error: User=%d, Type=%s, Error=%v", userID, consumableType, dbErr)
 		return fmt.Errorf("database error upserting consumable %s for user %d: %w", consumableType, userID, dbErr)
 	}
+	if err := queries.RecordEntitlementEvent(ctx, migrations.RecordEntitlementEventParams{
+		UserID:      pgtype.Int4{Int32: userID, Valid: true},
+		PurchaseID:  pgtype.Int8{Int64: purchaseID, Valid: true},
+		FeatureType: consumableType,
+		Event:       migrations.EntitlementEventGranted,
+		Quantity:    pgtype.Int4{Int32: quantity, Valid: true},
+		Source:      "app",
+	}); err != nil {
+		return fmt.Errorf("database error recording grant of %s for user %d: %w", consumableType, userID, err)
+	}
 	log.Printf("[INFO grantConsumable] Granted %d of %s to User %d", quantity, consumableType, userID)
 	return nil
 }
 
-// grantSubscription adds a new subscription record for the user
-func grantSubscription(ctx context.Context, queries *migrations.Queries, userID int32, featureType migrations.PremiumFeatureType, detail string) error {
-	log.Printf("[DEBUG grantSubscription] Granting: User=%d, Type=%s, Detail=%s", userID, featureType, detail)
-	var duration time.Duration
-	normalizedDetail := strings.ToLower(strings.TrimSpace(detail))
-
-	switch normalizedDetail {
-	case "1day":
-		duration = 24 * time.Hour
-	case "1week":
-		duration = 7 * 24 * time.Hour
-	// Add other durations as needed
-	default:
-		log.Printf("[ERROR grantSubscription] Invalid duration: Detail='%s', User=%d", detail, userID)
-		return fmt.Errorf("invalid duration detail '%s' for subscription product", detail)
+// grantSubscription adds a new subscription record for the user, ending at
+// the store's expiry for the purchase if it reported one and otherwise after
+// duration. A renewal of a store subscription the user already has extends
+// that subscription instead.
+func grantSubscription(ctx context.Context, queries *migrations.Queries, userID int32, purchase migrations.Purchase, featureType migrations.PremiumFeatureType, duration catalog.Duration) error {
+	log.Printf("[DEBUG grantSubscription] Granting: User=%d, Type=%s, Duration=%+v", userID, featureType, duration)
+	expiresAt := duration.AddTo(time.Now())
+	if purchase.ExpiresAt.Valid {
+		expiresAt = purchase.ExpiresAt.Time
 	}
+	purchaseID := pgtype.Int8{Int64: purchase.ID, Valid: true}
 
-	expiresAt := time.Now().Add(duration)
-
-	_, dbErr := queries.AddUserSubscription(ctx, migrations.AddUserSubscriptionParams{
-		UserID:      userID,
-		FeatureType: featureType,
-		ExpiresAt:   pgtype.Timestamptz{Time: expiresAt, Valid: true},
-	})
+	event := migrations.EntitlementEventGranted
+	existing, found, err := findStoreSubscription(ctx, queries, purchase, userID, featureType)
+	if err != nil {
+		return fmt.Errorf("database error looking up subscription %s for user %d: %w", featureType, userID, err)
+	}
+	var subscription migrations.UserSubscription
+	var dbErr error
+	if found {
+		event = migrations.EntitlementEventRenewed
+		if existing.ExpiresAt.Time.After(expiresAt) {
+			expiresAt = existing.ExpiresAt.Time
+		}
+		subscription, dbErr = queries.UpdateSubscriptionFromStore(ctx, migrations.UpdateSubscriptionFromStoreParams{
+			ID:         existing.ID,
+			ExpiresAt:  pgtype.Timestamptz{Time: expiresAt, Valid: true},
+			PurchaseID: purchaseID,
+		})
+	} else {
+		subscription, dbErr = queries.AddUserSubscription(ctx, migrations.AddUserSubscriptionParams{
+			UserID:      userID,
+			FeatureType: featureType,
+			ExpiresAt:   pgtype.Timestamptz{Time: expiresAt, Valid: true},
+			PurchaseID:  purchaseID,
+		})
+	}
 
 	if dbErr != nil {
 		log.Printf("[ERROR grantSubscription] DB Error: User=%d, Type=%s, Error=%v", userID, featureType, dbErr)
 		return fmt.Errorf("database error adding subscription %s for user %d: %w", featureType, userID, dbErr)
 	}
+	if err := queries.RecordEntitlementEvent(ctx, migrations.RecordEntitlementEventParams{
+		UserID:             pgtype.Int4{Int32: userID, Valid: true},
+		PurchaseID:         purchaseID,
+		UserSubscriptionID: pgtype.Int4{Int32: subscription.ID, Valid: true},
+		FeatureType:        featureType,
+		Event:              event,
+		ExpiresAt:          subscription.ExpiresAt,
+		Source:             "app",
+	}); err != nil {
+		return fmt.Errorf("database error recording grant of %s for user %d: %w", featureType, userID, err)
+	}
 
 	log.Printf("[INFO grantSubscription] Granted subscription %s to User %d, expiring at %s", featureType, userID, expiresAt.Format(time.RFC3339))
 	return nil
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/iap"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxStoreNotificationBytes = 1 << 20
+
+// AppStoreNotificationHandler receives App Store Server Notifications V2
+// and applies renewals, expiries and refunds to the user's entitlements.
+func AppStoreNotificationHandler(notifications *iap.AppStoreNotifications) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+			return
+		}
+		if notifications == nil {
+			utils.RespondWithError(w, http.StatusServiceUnavailable, "App Store notifications are not configured")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStoreNotificationBytes))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		n, err := notifications.Parse(body)
+		handleStoreNotification(w, r, n, err)
+	}
+}
+
+// PlayNotificationHandler receives Google Play real-time developer
+// notifications from a Pub/Sub push subscription and applies them like
+// AppStoreNotificationHandler.
+func PlayNotificationHandler(notifications *iap.PlayNotifications) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+			return
+		}
+		if notifications == nil {
+			utils.RespondWithError(w, http.StatusServiceUnavailable, "Play notifications are not configured")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStoreNotificationBytes))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		n, err := notifications.Parse(r.Context(), r.Header.Get("Authorization"), body)
+		handleStoreNotification(w, r, n, err)
+	}
+}
+
+// handleStoreNotification applies a parsed notification and tells the store
+// whether to redeliver it: anything but a 2xx is retried.
+func handleStoreNotification(w http.ResponseWriter, r *http.Request, n iap.Notification, parseErr error) {
+	if parseErr != nil {
+		log.Printf("ERROR: StoreNotification: Rejected notification: %v", parseErr)
+		if errors.Is(parseErr, iap.ErrInvalidNotification) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid notification")
+		} else {
+			utils.RespondWithError(w, http.StatusServiceUnavailable, "Could not reach the store, please retry")
+		}
+		return
+	}
+
+	queries, errDb := db.GetDB()
+	pool, errPool := db.GetPool()
+	if errDb != nil || errPool != nil || queries == nil || pool == nil {
+		log.Println("ERROR: StoreNotification: Database connection not available.")
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database connection error")
+		return
+	}
+	if err := applyStoreNotification(r.Context(), pool, queries, n); err != nil {
+		log.Printf("ERROR: StoreNotification: Failed to apply %s notification %s (%s): %v", n.Platform, n.ID, n.Type, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to apply notification")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, VerifyPurchaseResponse{Success: true, Message: "Notification processed"})
+}
+
+// applyStoreNotification updates entitlements for n once, however often the
+// store delivers it.
+func applyStoreNotification(ctx context.Context, pool *pgxpool.Pool, queries *migrations.Queries, n iap.Notification) error {
+	if n.Kind != iap.NotificationSubscription && n.Kind != iap.NotificationRefund {
+		log.Printf("INFO: StoreNotification: Ignoring %s notification %s (%s)", n.Platform, n.ID, n.Type)
+		return nil
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	_, err = qtx.RecordStoreNotification(ctx, migrations.RecordStoreNotificationParams{
+		Platform:         n.Platform,
+		NotificationID:   n.ID,
+		NotificationType: n.Type,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("INFO: StoreNotification: %s notification %s already applied", n.Platform, n.ID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("record notification: %w", err)
+	}
+
+	if n.Kind == iap.NotificationSubscription {
+		err = syncStoreSubscription(ctx, qtx, n)
+	} else {
+		err = refundStorePurchase(ctx, qtx, n)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// syncStoreSubscription moves the subscriptions paid for by n's store
+// subscription to the expiry the store reports, recording the renewal
+// transaction if it is new. Notifications older than the last one applied
+// are skipped.
+func syncStoreSubscription(ctx context.Context, queries *migrations.Queries, n iap.Notification) error {
+	_, err := queries.AdvanceStoreSubscriptionState(ctx, migrations.AdvanceStoreSubscriptionStateParams{
+		Platform:        n.Platform,
+		SubscriptionKey: n.SubscriptionKey,
+		LastSignedAt:    pgtype.Timestamptz{Time: n.SignedAt, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("INFO: StoreNotification: Skipping stale %s notification %s (%s) for %s", n.Platform, n.ID, n.Type, n.SubscriptionKey)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("advance subscription state: %w", err)
+	}
+
+	subscriptions, err := queries.GetSubscriptionsForStoreSubscription(ctx, migrations.GetSubscriptionsForStoreSubscriptionParams{
+		Platform:              n.Platform,
+		OriginalTransactionID: pgtype.Text{String: n.SubscriptionKey, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("get subscriptions: %w", err)
+	}
+	if len(subscriptions) == 0 {
+		// Not granted yet; the store's expiry applies once the app reports
+		// the purchase.
+		log.Printf("INFO: StoreNotification: No subscription for %s %s yet (%s)", n.Platform, n.SubscriptionKey, n.Type)
+		return nil
+	}
+
+	var purchaseID pgtype.Int8
+	if n.Purchase.TransactionID != "" {
+		recorded, err := queries.RecordPurchase(ctx, recordPurchaseParams(subscriptions[0].UserID, n.Purchase))
+		switch {
+		case err == nil:
+			purchaseID = pgtype.Int8{Int64: recorded.ID, Valid: true}
+		case !errors.Is(err, pgx.ErrNoRows):
+			return fmt.Errorf("record purchase: %w", err)
+		}
+	}
+
+	// Only the latest subscription for each feature is moved.
+	seen := map[migrations.PremiumFeatureType]bool{}
+	for _, subscription := range subscriptions {
+		if seen[subscription.FeatureType] {
+			continue
+		}
+		seen[subscription.FeatureType] = true
+		if n.EntitledUntil.Equal(subscription.ExpiresAt.Time) && !purchaseID.Valid {
+			continue
+		}
+
+		event := migrations.EntitlementEventRenewed
+		if n.EntitledUntil.Before(subscription.ExpiresAt.Time) {
+			event = migrations.EntitlementEventExpired
+		}
+		updated, err := queries.UpdateSubscriptionFromStore(ctx, migrations.UpdateSubscriptionFromStoreParams{
+			ID:         subscription.ID,
+			ExpiresAt:  pgtype.Timestamptz{Time: n.EntitledUntil, Valid: true},
+			PurchaseID: purchaseID,
+		})
+		if err != nil {
+			return fmt.Errorf("update subscription: %w", err)
+		}
+		log.Printf("INFO: StoreNotification: Subscription %d of user %d now expires at %s (%s)", updated.ID, updated.UserID, n.EntitledUntil, n.Type)
+		if err := queries.RecordEntitlementEvent(ctx, migrations.RecordEntitlementEventParams{
+			UserID:             pgtype.Int4{Int32: updated.UserID, Valid: true},
+			PurchaseID:         updated.PurchaseID,
+			UserSubscriptionID: pgtype.Int4{Int32: updated.ID, Valid: true},
+			FeatureType:        updated.FeatureType,
+			Event:              event,
+			ExpiresAt:          updated.ExpiresAt,
+			Source:             notificationSource(n.Platform),
+			NotificationType:   pgtype.Text{String: n.Type, Valid: true},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundStorePurchase undoes what a refunded or revoked purchase granted:
+// consumables the user hasn't spent are taken back and subscriptions end.
+func refundStorePurchase(ctx context.Context, queries *migrations.Queries, n iap.Notification) error {
+	ended := map[int32]bool{}
+	endSubscription := func(subscriptionID int32, purchaseID pgtype.Int8) error {
+		if ended[subscriptionID] {
+			return nil
+		}
+		ended[subscriptionID] = true
+		subscription, err := queries.EndUserSubscription(ctx, subscriptionID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("end subscription: %w", err)
+		}
+		log.Printf("INFO: StoreNotification: Ended subscription %d of user %d (%s)", subscription.ID, subscription.UserID, n.Type)
+		return queries.RecordEntitlementEvent(ctx, migrations.RecordEntitlementEventParams{
+			UserID:             pgtype.Int4{Int32: subscription.UserID, Valid: true},
+			PurchaseID:         purchaseID,
+			UserSubscriptionID: pgtype.Int4{Int32: subscription.ID, Valid: true},
+			FeatureType:        subscription.FeatureType,
+			Event:              migrations.EntitlementEventRefunded,
+			ExpiresAt:          subscription.ExpiresAt,
+			Source:             notificationSource(n.Platform),
+			NotificationType:   pgtype.Text{String: n.Type, Valid: true},
+		})
+	}
+
+	revoked, err := queries.RevokePurchase(ctx, migrations.RevokePurchaseParams{
+		Platform:      n.Platform,
+		TransactionID: n.Purchase.TransactionID,
+	})
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		log.Printf("INFO: StoreNotification: %s purchase %s unknown or already refunded", n.Platform, n.Purchase.TransactionID)
+	case err != nil:
+		return fmt.Errorf("revoke purchase: %w", err)
+	default:
+		purchaseID := pgtype.Int8{Int64: revoked.ID, Valid: true}
+		grants, err := queries.GetPurchaseGrants(ctx, purchaseID)
+		if err != nil {
+			return fmt.Errorf("get purchase grants: %w", err)
+		}
+		for _, grant := range grants {
+			if grant.UserSubscriptionID.Valid {
+				if err := endSubscription(grant.UserSubscriptionID.Int32, purchaseID); err != nil {
+					return err
+				}
+				continue
+			}
+			if !grant.Quantity.Valid || !grant.UserID.Valid {
+				continue
+			}
+			clawedBack, err := queries.ClawBackUserConsumable(ctx, migrations.ClawBackUserConsumableParams{
+				UserID:         grant.UserID.Int32,
+				ConsumableType: grant.FeatureType,
+				Quantity:       grant.Quantity.Int32,
+			})
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("claw back %s: %w", grant.FeatureType, err)
+			}
+			log.Printf("INFO: StoreNotification: Took back %d of %d %s from user %d (%s)", clawedBack, grant.Quantity.Int32, grant.FeatureType, grant.UserID.Int32, n.Type)
+			if err := queries.RecordEntitlementEvent(ctx, migrations.RecordEntitlementEventParams{
+				UserID:           grant.UserID,
+				PurchaseID:       purchaseID,
+				FeatureType:      grant.FeatureType,
+				Event:            migrations.EntitlementEventRefunded,
+				Quantity:         pgtype.Int4{Int32: -clawedBack, Valid: true},
+				Source:           notificationSource(n.Platform),
+				NotificationType: pgtype.Text{String: n.Type, Valid: true},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// A refunded renewal may not have been recorded; it still ends the
+	// subscriptions it renewed.
+	if n.SubscriptionKey == "" {
+		return nil
+	}
+	subscriptions, err := queries.GetSubscriptionsForStoreSubscription(ctx, migrations.GetSubscriptionsForStoreSubscriptionParams{
+		Platform:              n.Platform,
+		OriginalTransactionID: pgtype.Text{String: n.SubscriptionKey, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("get subscriptions: %w", err)
+	}
+	for _, subscription := range subscriptions {
+		if err := endSubscription(subscription.ID, subscription.PurchaseID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func notificationSource(platform migrations.PurchasePlatform) string {
+	if platform == migrations.PurchasePlatformIos {
+		return "appstore"
+	}
+	return "play"
+}
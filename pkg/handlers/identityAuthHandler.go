@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/identity"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type IdentityTokenRequest struct {
+	Provider string `json:"provider"`
+	IDToken  string `json:"id_token"`
+}
+
+type IdentitySignInResponse struct {
+	Success      bool   `json:"success"`
+	Message      string `json:"message"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	IsNewUser    bool   `json:"is_new_user,omitempty"`
+}
+
+type LinkedIdentity struct {
+	Provider   string     `json:"provider"`
+	Email      *string    `json:"email,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type LinkedIdentitiesResponse struct {
+	Success    bool             `json:"success"`
+	Message    string           `json:"message,omitempty"`
+	Identities []LinkedIdentity `json:"identities"`
+}
+
+func decodeIdentityTokenRequest(r *http.Request) (IdentityTokenRequest, bool) {
+	var req IdentityTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, false
+	}
+	defer r.Body.Close()
+	return req, req.Provider != "" && req.IDToken != ""
+}
+
+// IdentitySignInHandler signs a user in with an ID token from any configured
+// provider. The identity is matched by (provider, subject) first; on first
+// use it is linked to the account with the same verified email, or a new
+// account is created.
+func IdentitySignInHandler(providers identity.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, _ := db.GetDB()
+
+		if r.Method != http.MethodPost {
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+			return
+		}
+
+		req, ok := decodeIdentityTokenRequest(r)
+		if !ok {
+			utils.RespondWithError(w, http.StatusBadRequest, "provider and id_token are required")
+			return
+		}
+
+		ident, err := providers.Verify(ctx, req.Provider, req.IDToken)
+		if err != nil {
+			log.Printf("WARN: IdentitySignInHandler: %s token rejected: %v", req.Provider, err)
+			if errors.Is(err, identity.ErrUnknownProvider) {
+				utils.RespondWithError(w, http.StatusBadRequest, "Unsupported identity provider")
+				return
+			}
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired identity token")
+			return
+		}
+
+		userID, isNew, err := resolveIdentityUser(ctx, ident)
+		if err != nil {
+			if errors.Is(err, errIdentityEmailUnverified) {
+				utils.RespondWithError(w, http.StatusForbidden, "A verified email is required to create an account")
+				return
+			}
+			log.Printf("ERROR: IdentitySignInHandler: Failed to resolve %s identity %s: %v", ident.Provider, ident.Subject, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to sign in")
+			return
+		}
+
+		if err := cancelPendingAccountDeletion(ctx, queries, userID); err != nil {
+			log.Printf("ERROR: IdentitySignInHandler: Failed to cancel pending deletion for user %d: %v", userID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to sign in")
+			return
+		}
+
+		tokens, err := token.IssueTokenPair(ctx, userID)
+		if err != nil {
+			log.Printf("ERROR: IdentitySignInHandler: Failed to issue tokens for user %d: %v", userID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to generate session token")
+			return
+		}
+
+		log.Printf("INFO: IdentitySignInHandler: User %d signed in with %s (new=%t)", userID, ident.Provider, isNew)
+		utils.RespondWithJSON(w, http.StatusOK, IdentitySignInResponse{
+			Success:      true,
+			Message:      "Authentication successful",
+			Token:        tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
+			ExpiresIn:    tokens.ExpiresIn,
+			IsNewUser:    isNew,
+		})
+	}
+}
+
+var errIdentityEmailUnverified = errors.New("identity email missing or unverified")
+
+func resolveIdentityUser(ctx context.Context, ident *identity.Identity) (int32, bool, error) {
+	queries, err := db.GetDB()
+	if err != nil {
+		return 0, false, err
+	}
+	email := pgtype.Text{String: ident.Email, Valid: ident.Email != ""}
+
+	userID, err := queries.GetUserIDByIdentity(ctx, migrations.GetUserIDByIdentityParams{
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+	})
+	if err == nil {
+		if err := queries.UpsertUserIdentity(ctx, migrations.UpsertUserIdentityParams{
+			UserID: userID, Provider: ident.Provider, Subject: ident.Subject, Email: email,
+		}); err != nil {
+			log.Printf("WARN: resolveIdentityUser: Failed to touch identity for user %d: %v", userID, err)
+		}
+		return userID, false, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, err
+	}
+
+	// Linking by email is only safe when the provider vouches for it.
+	if ident.Email == "" || !ident.EmailVerified {
+		return 0, false, errIdentityEmailUnverified
+	}
+
+	pool, err := db.GetPool()
+	if err != nil {
+		return 0, false, err
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	isNew := false
+	user, err := qtx.GetUserByEmail(ctx, ident.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		user, err = qtx.CreateUserWithEmail(ctx, ident.Email)
+		if err != nil {
+			return 0, false, err
+		}
+		isNew = true
+		if _, err := qtx.UpsertUserConsumable(ctx, migrations.UpsertUserConsumableParams{
+			UserID:         user.ID,
+			ConsumableType: migrations.PremiumFeatureTypeRose,
+			Quantity:       1,
+		}); err != nil {
+			return 0, false, err
+		}
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	if err := qtx.UpsertUserIdentity(ctx, migrations.UpsertUserIdentityParams{
+		UserID: user.ID, Provider: ident.Provider, Subject: ident.Subject, Email: email,
+	}); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, err
+	}
+	return user.ID, isNew, nil
+}
+
+// LinkIdentityHandler attaches another provider's identity to the signed-in
+// account so the user can sign in with either.
+func LinkIdentityHandler(providers identity.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, _ := db.GetDB()
+
+		if r.Method != http.MethodPost {
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+			return
+		}
+
+		claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		userID := int32(claims.UserID)
+
+		req, ok := decodeIdentityTokenRequest(r)
+		if !ok {
+			utils.RespondWithError(w, http.StatusBadRequest, "provider and id_token are required")
+			return
+		}
+
+		ident, err := providers.Verify(ctx, req.Provider, req.IDToken)
+		if err != nil {
+			log.Printf("WARN: LinkIdentityHandler: %s token rejected for user %d: %v", req.Provider, userID, err)
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired identity token")
+			return
+		}
+
+		existing, err := queries.GetUserIDByIdentity(ctx, migrations.GetUserIDByIdentityParams{
+			Provider: ident.Provider,
+			Subject:  ident.Subject,
+		})
+		if err == nil && existing != userID {
+			utils.RespondWithError(w, http.StatusConflict, "This identity is already linked to another account")
+			return
+		}
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("ERROR: LinkIdentityHandler: Lookup failed for user %d: %v", userID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to link identity")
+			return
+		}
+
+		err = queries.UpsertUserIdentity(ctx, migrations.UpsertUserIdentityParams{
+			UserID:   userID,
+			Provider: ident.Provider,
+			Subject:  ident.Subject,
+			Email:    pgtype.Text{String: ident.Email, Valid: ident.Email != ""},
+		})
+		if err != nil {
+			log.Printf("ERROR: LinkIdentityHandler: Failed to link %s for user %d: %v", ident.Provider, userID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to link identity")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, IdentitySignInResponse{Success: true, Message: "Identity linked"})
+	}
+}
+
+func GetLinkedIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+
+	if r.Method != http.MethodGet {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET")
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	rows, err := queries.GetUserIdentities(ctx, int32(claims.UserID))
+	if err != nil {
+		log.Printf("ERROR: GetLinkedIdentitiesHandler: Failed to fetch identities for user %d: %v", claims.UserID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch linked identities")
+		return
+	}
+
+	identities := make([]LinkedIdentity, 0, len(rows))
+	for _, row := range rows {
+		li := LinkedIdentity{
+			Provider:   row.Provider,
+			CreatedAt:  row.CreatedAt.Time,
+			LastUsedAt: pgTimestampToTimePtr(row.LastUsedAt),
+		}
+		if row.Email.Valid {
+			li.Email = &row.Email.String
+		}
+		identities = append(identities, li)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, LinkedIdentitiesResponse{Success: true, Identities: identities})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ImpersonateRequest struct {
+	UserID int32  `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+type ImpersonateResponse struct {
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// ImpersonateUserHandler lets an admin obtain a short-lived token for
+// another user, e.g. to reproduce a support issue. Every token is written
+// to impersonation_audit_log before it is handed out.
+func ImpersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+
+	if r.Method != http.MethodPost {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	adminUserID := int32(claims.UserID)
+
+	if claims.IsImpersonated() {
+		utils.RespondWithError(w, http.StatusForbidden, "Cannot impersonate while impersonating")
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body format")
+		return
+	}
+	defer r.Body.Close()
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.UserID <= 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Valid user_id is required")
+		return
+	}
+	if req.Reason == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "A reason is required for the audit log")
+		return
+	}
+	if req.UserID == adminUserID {
+		utils.RespondWithError(w, http.StatusBadRequest, "Cannot impersonate yourself")
+		return
+	}
+
+	target, err := queries.GetUserByID(ctx, req.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		} else {
+			log.Printf("ERROR: ImpersonateUserHandler: Error fetching user %d: %v", req.UserID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Database error retrieving user")
+		}
+		return
+	}
+	if target.Role == migrations.UserRoleAdmin {
+		utils.RespondWithError(w, http.StatusForbidden, "Cannot impersonate another admin")
+		return
+	}
+
+	tokenString, issued, err := token.GenerateImpersonationToken(target.ID, adminUserID)
+	if err != nil {
+		log.Printf("ERROR: ImpersonateUserHandler: Failed to generate token for user %d: %v", target.ID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	expiresAt := issued.ExpiresAt.Time
+
+	_, err = queries.CreateImpersonationAuditLog(ctx, migrations.CreateImpersonationAuditLogParams{
+		AdminUserID:  adminUserID,
+		TargetUserID: target.ID,
+		Reason:       req.Reason,
+		TokenID:      issued.ID,
+		ExpiresAt:    pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		log.Printf("ERROR: ImpersonateUserHandler: Failed to write audit log (admin %d, target %d): %v", adminUserID, target.ID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to record impersonation")
+		return
+	}
+
+	log.Printf("AUDIT: Admin %d started impersonating user %d (jti %s): %s", adminUserID, target.ID, issued.ID, req.Reason)
+	utils.RespondWithJSON(w, http.StatusOK, ImpersonateResponse{
+		Success:   true,
+		Message:   "Impersonation token issued",
+		Token:     tokenString,
+		ExpiresAt: expiresAt,
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/arnnvv/peeple-api/pkg/ws"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type LogoutResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// LogoutHandler revokes the session of the token used for the request and
+// closes its WebSocket connection. Push tokens registered from the session
+// stop receiving notifications.
+func LogoutHandler(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodPost {
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+			return
+		}
+
+		claims, ok := r.Context().Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		userID := int32(claims.UserID)
+
+		if err := token.RevokeSession(r.Context(), claims); err != nil {
+			log.Printf("ERROR: LogoutHandler: Failed to revoke session for user %d: %v", userID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+		hub.DisconnectUser(userID, claims.SessionKey())
+		if queries, err := db.GetDB(); err == nil {
+			sessionKey := claims.SessionKey()
+			if err := queries.DeleteSessionDevicePushTokens(r.Context(), migrations.DeleteSessionDevicePushTokensParams{
+				UserID:    userID,
+				SessionID: pgtype.Text{String: sessionKey, Valid: sessionKey != ""},
+			}); err != nil {
+				log.Printf("WARN: LogoutHandler: Failed to remove push tokens for user %d: %v", userID, err)
+			}
+		}
+
+		log.Printf("INFO: LogoutHandler: User %d logged out of session", userID)
+		utils.RespondWithJSON(w, http.StatusOK, LogoutResponse{Success: true, Message: "Logged out"})
+	}
+}
+
+// LogoutAllHandler revokes every session of the user and closes all of
+// their WebSocket connections.
+func LogoutAllHandler(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodPost {
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+			return
+		}
+
+		claims, ok := r.Context().Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		userID := int32(claims.UserID)
+
+		if claims.IsImpersonated() {
+			utils.RespondWithError(w, http.StatusForbidden, "Not allowed while impersonating a user")
+			return
+		}
+
+		if err := token.RevokeAllSessions(r.Context(), userID); err != nil {
+			log.Printf("ERROR: LogoutAllHandler: Failed to revoke sessions for user %d: %v", userID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+		hub.DisconnectUser(userID, "")
+		if queries, err := db.GetDB(); err == nil {
+			if err := queries.DeleteUserDevicePushTokens(r.Context(), userID); err != nil {
+				log.Printf("WARN: LogoutAllHandler: Failed to remove push tokens for user %d: %v", userID, err)
+			}
+		}
+
+		log.Printf("INFO: LogoutAllHandler: User %d logged out of all sessions", userID)
+		utils.RespondWithJSON(w, http.StatusOK, LogoutResponse{Success: true, Message: "Logged out of all sessions"})
+	}
+}
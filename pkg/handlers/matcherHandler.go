@@ -4,12 +4,16 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/arnnvv/peeple-api/migrations"
 	"github.com/arnnvv/peeple-api/pkg/db"
 	"github.com/arnnvv/peeple-api/pkg/token"
 	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/arnnvv/peeple-api/pkg/ws"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type MatchInfo struct {
@@ -19,6 +23,10 @@ type MatchInfo struct {
 	IsOnline           bool       `json:"is_online"`
 	LastOnline         *time.Time `json:"last_online,omitempty"`
 	UnreadMessageCount int64      `json:"unread_message_count"`
+	IsMuted            bool       `json:"is_muted"`
+	MutedUntil         *time.Time `json:"muted_until,omitempty"` // unset while muted means until turned off
+	Pinned             bool       `json:"pinned"`
+	Archived           bool       `json:"archived"`
 
 	LastEventTimestamp *time.Time `json:"last_event_timestamp,omitempty"`
 	LastEventUserID    *int32     `json:"last_event_user_id,omitempty"`
@@ -28,88 +36,157 @@ type MatchInfo struct {
 }
 
 type GetMatchesResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Matches []MatchInfo `json:"matches"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message,omitempty"`
+	Matches    []MatchInfo `json:"matches"`
+	HasMore    bool        `json:"has_more"`
+	NextCursor string      `json:"next_cursor,omitempty"` // pass back as ?after= for the next page
 }
 
-func GetMatchesHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	ctx := r.Context()
-	queries, errDb := db.GetDB()
-	if errDb != nil || queries == nil {
-		log.Println("ERROR: GetMatchesHandler: Database connection not available.")
-		utils.RespondWithJSON(w, http.StatusInternalServerError, GetMatchesResponse{Success: false, Message: "Database connection error", Matches: []MatchInfo{}})
-		return
-	}
+const (
+	defaultMatchesPageLimit = 50
+	maxMatchesPageLimit     = 100
+)
 
-	if r.Method != http.MethodGet {
-		utils.RespondWithJSON(w, http.StatusMethodNotAllowed, GetMatchesResponse{Success: false, Message: "Method Not Allowed: Use GET", Matches: []MatchInfo{}})
-		return
-	}
+func GetMatchesHandler(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, errDb := db.GetDB()
+		if errDb != nil || queries == nil {
+			log.Println("ERROR: GetMatchesHandler: Database connection not available.")
+			utils.RespondWithJSON(w, http.StatusInternalServerError, GetMatchesResponse{Success: false, Message: "Database connection error", Matches: []MatchInfo{}})
+			return
+		}
 
-	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
-	if !ok || claims == nil || claims.UserID <= 0 {
-		utils.RespondWithJSON(w, http.StatusUnauthorized, GetMatchesResponse{Success: false, Message: "Authentication required", Matches: []MatchInfo{}})
-		return
-	}
-	requestingUserID := int32(claims.UserID)
+		if r.Method != http.MethodGet {
+			utils.RespondWithJSON(w, http.StatusMethodNotAllowed, GetMatchesResponse{Success: false, Message: "Method Not Allowed: Use GET", Matches: []MatchInfo{}})
+			return
+		}
 
-	log.Printf("INFO: GetMatchesHandler: Fetching matches with details for user %d", requestingUserID)
+		claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithJSON(w, http.StatusUnauthorized, GetMatchesResponse{Success: false, Message: "Authentication required", Matches: []MatchInfo{}})
+			return
+		}
+		requestingUserID := int32(claims.UserID)
 
-	dbMatches, err := queries.GetMatchesWithLastEvent(ctx, requestingUserID)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		log.Printf("ERROR: GetMatchesHandler: Failed to fetch matches for user %d: %v", requestingUserID, err)
-		utils.RespondWithJSON(w, http.StatusInternalServerError, GetMatchesResponse{Success: false, Message: "Error retrieving matches", Matches: []MatchInfo{}})
-		return
-	}
+		log.Printf("INFO: GetMatchesHandler: Fetching matches with details for user %d", requestingUserID)
 
-	responseMatches := make([]MatchInfo, 0, len(dbMatches))
-
-	for _, dbMatch := range dbMatches {
-		match := MatchInfo{
-			MatchedUserID:      dbMatch.MatchedUserID,
-			Name:               buildFullName(dbMatch.MatchedUserName, dbMatch.MatchedUserLastName),
-			FirstProfilePicURL: getFirstMediaURL(dbMatch.MatchedUserMediaUrls),
-			IsOnline:           dbMatch.MatchedUserIsOnline,
-			LastOnline:         pgTimestampToTimePtr(dbMatch.MatchedUserLastOnline),
-			UnreadMessageCount: dbMatch.UnreadMessageCount,
-			LastEventTimestamp: nil,
-			LastEventUserID:    nil,
-			LastEventType:      nil,
-			LastEventContent:   nil,
-			LastEventMediaURL:  nil,
+		limit, limitErr := parsePageLimit(r.URL.Query().Get("limit"), defaultMatchesPageLimit, maxMatchesPageLimit)
+		if limitErr != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, GetMatchesResponse{Success: false, Message: limitErr.Error(), Matches: []MatchInfo{}})
+			return
+		}
+		// ?archived=true lists archived conversations instead of the inbox.
+		archived := false
+		if raw := r.URL.Query().Get("archived"); raw != "" {
+			var parseErr error
+			if archived, parseErr = strconv.ParseBool(raw); parseErr != nil {
+				utils.RespondWithJSON(w, http.StatusBadRequest, GetMatchesResponse{Success: false, Message: "archived must be true or false", Matches: []MatchInfo{}})
+				return
+			}
+		}
+		// Pinned matches come first, then the rest by latest activity (matches
+		// without any use the epoch), then by user ID; the cursor holds all three
+		// for the last match shown.
+		params := migrations.GetMatchesWithLastEventParams{
+			LikerUserID:  requestingUserID,
+			Archived:     archived,
+			AfterRank:    0,
+			AfterEventAt: timestampPosInf,
+			AfterUserID:  0,
+			PageLimit:    limit + 1,
+		}
+		if raw := r.URL.Query().Get("after"); raw != "" {
+			c, cursorErr := decodeCursor(raw)
+			if cursorErr != nil || c.ID > maxCursorID32 {
+				utils.RespondWithJSON(w, http.StatusBadRequest, GetMatchesResponse{Success: false, Message: "Invalid cursor", Matches: []MatchInfo{}})
+				return
+			}
+			params.AfterRank = c.Rank
+			params.AfterEventAt = cursorTimestamp(c.At)
+			params.AfterUserID = int32(c.ID)
 		}
 
-		if dbMatch.LastEventUserID != 0 {
-			uid := dbMatch.LastEventUserID
-			match.LastEventUserID = &uid
+		dbMatches, err := queries.GetMatchesWithLastEvent(ctx, params)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("ERROR: GetMatchesHandler: Failed to fetch matches for user %d: %v", requestingUserID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, GetMatchesResponse{Success: false, Message: "Error retrieving matches", Matches: []MatchInfo{}})
+			return
+		}
 
-			if dbMatch.LastEventTimestamp.Valid {
-				ts := dbMatch.LastEventTimestamp.Time
-				match.LastEventTimestamp = &ts
-			}
-			if dbMatch.LastEventType != "" {
-				et := dbMatch.LastEventType
-				match.LastEventType = &et
+		hasMore := len(dbMatches) > int(limit)
+		var nextCursor string
+		if hasMore {
+			dbMatches = dbMatches[:limit]
+			last := dbMatches[len(dbMatches)-1]
+			nextCursor = encodeCursor(pageCursor{At: last.SortEventAt.Time, ID: int64(last.MatchedUserID), Rank: last.SortRank})
+		}
+
+		responseMatches := make([]MatchInfo, 0, len(dbMatches))
+		matchedIDs := make([]int32, len(dbMatches))
+		for i, dbMatch := range dbMatches {
+			matchedIDs[i] = dbMatch.MatchedUserID
+		}
+		presence := userPresence(ctx, hub, matchedIDs)
+
+		for _, dbMatch := range dbMatches {
+			match := MatchInfo{
+				MatchedUserID:      dbMatch.MatchedUserID,
+				Name:               buildFullName(dbMatch.MatchedUserName, dbMatch.MatchedUserLastName),
+				FirstProfilePicURL: getFirstMediaURL(dbMatch.MatchedUserMediaUrls),
+				UnreadMessageCount: dbMatch.UnreadMessageCount,
+				Pinned:             dbMatch.Pinned,
+				Archived:           dbMatch.Archived,
+				LastEventTimestamp: nil,
+				LastEventUserID:    nil,
+				LastEventType:      nil,
+				LastEventContent:   nil,
+				LastEventMediaURL:  nil,
 			}
-			if dbMatch.LastEventContent != "" {
-				ec := dbMatch.LastEventContent
-				match.LastEventContent = &ec
+			match.IsOnline, match.LastOnline = ws.ResolvePresence(presence, dbMatch.MatchedUserID, dbMatch.MatchedUserIsOnline, dbMatch.MatchedUserLastOnline)
+
+			if dbMatch.LastEventUserID != 0 {
+				uid := dbMatch.LastEventUserID
+				match.LastEventUserID = &uid
+
+				if dbMatch.LastEventTimestamp.Valid {
+					ts := dbMatch.LastEventTimestamp.Time
+					match.LastEventTimestamp = &ts
+				}
+				if dbMatch.LastEventType != "" {
+					et := dbMatch.LastEventType
+					match.LastEventType = &et
+				}
+				if dbMatch.LastEventContent != "" {
+					ec := dbMatch.LastEventContent
+					match.LastEventContent = &ec
+				}
+				if dbMatch.LastEventType == "media" && dbMatch.LastEventExtra != "" {
+					ee := dbMatch.LastEventExtra
+					match.LastEventMediaURL = &ee
+				}
 			}
-			if dbMatch.LastEventType == "media" && dbMatch.LastEventExtra != "" {
-				ee := dbMatch.LastEventExtra
-				match.LastEventMediaURL = &ee
+
+			if ws.IsMuted(dbMatch.MutedUntil) {
+				match.IsMuted = true
+				if dbMatch.MutedUntil.InfinityModifier == pgtype.Finite {
+					t := dbMatch.MutedUntil.Time
+					match.MutedUntil = &t
+				}
 			}
-		}
 
-		responseMatches = append(responseMatches, match)
-	}
+			responseMatches = append(responseMatches, match)
+		}
 
-	log.Printf("INFO: GetMatchesHandler: Found %d matches for user %d.", len(responseMatches), requestingUserID)
+		log.Printf("INFO: GetMatchesHandler: Found %d matches for user %d.", len(responseMatches), requestingUserID)
 
-	utils.RespondWithJSON(w, http.StatusOK, GetMatchesResponse{
-		Success: true,
-		Matches: responseMatches,
-	})
+		utils.RespondWithJSON(w, http.StatusOK, GetMatchesResponse{
+			Success:    true,
+			Matches:    responseMatches,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+		})
+	}
 }
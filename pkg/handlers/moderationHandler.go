@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/arnnvv/peeple-api/pkg/ws"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultAdminPageLimit = 50
+	maxAdminPageLimit     = 200
+	chatExcerptLimit      = 20
+)
+
+type ReportQueueEntry struct {
+	ReportedUserID     int32            `json:"reported_user_id"`
+	Name               string           `json:"name"`
+	FirstProfilePicURL string           `json:"first_profile_pic_url,omitempty"`
+	OpenReportCount    int64            `json:"open_report_count"`
+	ReasonCounts       map[string]int64 `json:"reason_counts"`
+	FirstReportedAt    time.Time        `json:"first_reported_at"`
+	LastReportedAt     time.Time        `json:"last_reported_at"`
+}
+
+type ReportQueueResponse struct {
+	Success bool               `json:"success"`
+	Message string             `json:"message,omitempty"`
+	Queue   []ReportQueueEntry `json:"queue"`
+}
+
+type ReportedChatExcerpt struct {
+	ReporterUserID int32                    `json:"reporter_user_id"`
+	Messages       []migrations.ChatMessage `json:"messages"`
+}
+
+type ReportDetailResponse struct {
+	Success        bool                          `json:"success"`
+	Message        string                        `json:"message,omitempty"`
+	Profile        *UserProfileData              `json:"profile,omitempty"`
+	OpenReports    []migrations.Report           `json:"open_reports"`
+	ChatExcerpts   []ReportedChatExcerpt         `json:"chat_excerpts"`
+	ActiveSanction *migrations.UserSanction      `json:"active_sanction,omitempty"`
+	History        []migrations.ModerationAction `json:"history"`
+}
+
+type ModerationActionRequest struct {
+	UserID   int32  `json:"user_id"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration,omitempty"` // suspend only, e.g. "72h"
+}
+
+type ModerationActionResponse struct {
+	Success         bool       `json:"success"`
+	Message         string     `json:"message"`
+	ActionID        int64      `json:"action_id,omitempty"`
+	ReportsResolved int64      `json:"reports_resolved"`
+	SuspendedUntil  *time.Time `json:"suspended_until,omitempty"`
+}
+
+// parseAdminPage reads the limit/offset query parameters of the admin list
+// endpoints, writing a 400 and returning false if they are invalid.
+func parseAdminPage(w http.ResponseWriter, r *http.Request) (int32, int32, bool) {
+	limit := int32(defaultAdminPageLimit)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return 0, 0, false
+		}
+		limit = int32(min(n, maxAdminPageLimit))
+	}
+	offset := int32(0)
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid offset")
+			return 0, 0, false
+		}
+		offset = int32(n)
+	}
+	return limit, offset, true
+}
+
+// GetReportQueueHandler lists users with unresolved reports, most reported
+// first, with a count per report reason.
+func GetReportQueueHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+
+	if r.Method != http.MethodGet {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET")
+		return
+	}
+
+	limit, offset, ok := parseAdminPage(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := queries.GetReportQueue(ctx, migrations.GetReportQueueParams{Limit: limit, Offset: offset})
+	if err != nil {
+		log.Printf("ERROR: GetReportQueueHandler: Failed to fetch report queue: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch report queue")
+		return
+	}
+
+	queue := make([]ReportQueueEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := ReportQueueEntry{
+			ReportedUserID:     row.ReportedUserID,
+			Name:               buildFullName(row.Name, row.LastName),
+			FirstProfilePicURL: getFirstMediaURL(row.MediaUrls),
+			OpenReportCount:    row.OpenReportCount,
+			FirstReportedAt:    row.FirstReportedAt.Time,
+			LastReportedAt:     row.LastReportedAt.Time,
+		}
+		if err := json.Unmarshal(row.ReasonCounts, &entry.ReasonCounts); err != nil {
+			log.Printf("WARN: GetReportQueueHandler: Bad reason counts for user %d: %v", row.ReportedUserID, err)
+		}
+		queue = append(queue, entry)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, ReportQueueResponse{Success: true, Queue: queue})
+}
+
+// GetReportDetailHandler serves /api/admin/reports/{user_id}: the reported
+// profile, its open reports, the latest messages exchanged with each
+// reporter and the moderation history.
+func GetReportDetailHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+
+	if r.Method != http.MethodGet {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET")
+		return
+	}
+
+	idStr := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/api/admin/reports/")
+	id, err := strconv.ParseInt(idStr, 10, 32)
+	if err != nil || id <= 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID in URL")
+		return
+	}
+	reportedUserID := int32(id)
+
+	profile, err := fetchFullUserProfileData(ctx, queries, reportedUserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		} else {
+			log.Printf("ERROR: GetReportDetailHandler: Failed to fetch profile %d: %v", reportedUserID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch reported profile")
+		}
+		return
+	}
+
+	reports, err := queries.GetOpenReportsForUser(ctx, reportedUserID)
+	if err != nil {
+		log.Printf("ERROR: GetReportDetailHandler: Failed to fetch reports for user %d: %v", reportedUserID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch reports")
+		return
+	}
+
+	excerpts := make([]ReportedChatExcerpt, 0)
+	seen := make(map[int32]bool)
+	for _, report := range reports {
+		if seen[report.ReporterUserID] {
+			continue
+		}
+		seen[report.ReporterUserID] = true
+
+		msgs, err := queries.GetChatExcerpt(ctx, migrations.GetChatExcerptParams{
+			SenderUserID:    report.ReporterUserID,
+			RecipientUserID: reportedUserID,
+			Limit:           chatExcerptLimit,
+		})
+		if err != nil {
+			log.Printf("ERROR: GetReportDetailHandler: Failed to fetch chat %d <-> %d: %v", report.ReporterUserID, reportedUserID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch chat excerpt")
+			return
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+		slices.Reverse(msgs)
+		excerpts = append(excerpts, ReportedChatExcerpt{ReporterUserID: report.ReporterUserID, Messages: msgs})
+	}
+
+	history, err := queries.GetModerationActionsForUser(ctx, reportedUserID)
+	if err != nil {
+		log.Printf("ERROR: GetReportDetailHandler: Failed to fetch moderation history for user %d: %v", reportedUserID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch moderation history")
+		return
+	}
+
+	resp := ReportDetailResponse{
+		Success:      true,
+		Profile:      profile,
+		OpenReports:  reports,
+		ChatExcerpts: excerpts,
+		History:      history,
+	}
+	sanction, err := queries.GetActiveUserSanction(ctx, reportedUserID)
+	if err == nil {
+		resp.ActiveSanction = &sanction
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("WARN: GetReportDetailHandler: Failed to fetch sanction for user %d: %v", reportedUserID, err)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// ModerationActionHandler applies an admin decision to a reported user:
+// dismiss, warn, suspend (with duration), ban, or lift an active sanction.
+// Every decision is written to moderation_actions and resolves the user's
+// open reports, so the risk rules don't hide them again for reports an admin
+// has already reviewed.
+func ModerationActionHandler(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ctx := r.Context()
+		queries, _ := db.GetDB()
+
+		if r.Method != http.MethodPost {
+			utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+			return
+		}
+
+		claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+		if !ok || claims == nil || claims.UserID <= 0 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		adminUserID := int32(claims.UserID)
+
+		var req ModerationActionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body format")
+			return
+		}
+		defer r.Body.Close()
+
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.UserID <= 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "Valid user_id is required")
+			return
+		}
+		if req.Reason == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "A reason is required for the audit log")
+			return
+		}
+		if req.UserID == adminUserID {
+			utils.RespondWithError(w, http.StatusBadRequest, "Cannot moderate yourself")
+			return
+		}
+
+		action := migrations.ModerationActionType(req.Action)
+		var suspendedUntil pgtype.Timestamptz
+		switch action {
+		case migrations.ModerationActionTypeDismiss, migrations.ModerationActionTypeWarn,
+			migrations.ModerationActionTypeBan, migrations.ModerationActionTypeLift:
+		case migrations.ModerationActionTypeSuspend:
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				utils.RespondWithError(w, http.StatusBadRequest, "A positive duration (e.g. \"72h\") is required to suspend")
+				return
+			}
+			suspendedUntil = pgtype.Timestamptz{Time: time.Now().Add(d), Valid: true}
+		default:
+			utils.RespondWithError(w, http.StatusBadRequest, "action must be one of dismiss, warn, suspend, ban, lift")
+			return
+		}
+
+		target, err := queries.GetUserByID(ctx, req.UserID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				utils.RespondWithError(w, http.StatusNotFound, "User not found")
+			} else {
+				log.Printf("ERROR: ModerationActionHandler: Error fetching user %d: %v", req.UserID, err)
+				utils.RespondWithError(w, http.StatusInternalServerError, "Database error retrieving user")
+			}
+			return
+		}
+		if target.Role == migrations.UserRoleAdmin {
+			utils.RespondWithError(w, http.StatusForbidden, "Cannot moderate another admin")
+			return
+		}
+
+		pool, err := db.GetPool()
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Database connection not available")
+			return
+		}
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			log.Printf("ERROR: ModerationActionHandler: Failed to begin transaction: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to apply moderation action")
+			return
+		}
+		defer tx.Rollback(ctx)
+		qtx := queries.WithTx(tx)
+
+		recorded, err := qtx.CreateModerationAction(ctx, migrations.CreateModerationActionParams{
+			AdminUserID:    adminUserID,
+			TargetUserID:   target.ID,
+			Action:         action,
+			Reason:         req.Reason,
+			SuspendedUntil: suspendedUntil,
+		})
+		if err != nil {
+			log.Printf("ERROR: ModerationActionHandler: Failed to record %s on user %d: %v", action, target.ID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to apply moderation action")
+			return
+		}
+
+		switch action {
+		case migrations.ModerationActionTypeSuspend, migrations.ModerationActionTypeBan:
+			err = qtx.UpsertUserSanction(ctx, migrations.UpsertUserSanctionParams{
+				UserID:    target.ID,
+				ActionID:  recorded.ID,
+				IsBan:     action == migrations.ModerationActionTypeBan,
+				Reason:    req.Reason,
+				ExpiresAt: suspendedUntil,
+			})
+		case migrations.ModerationActionTypeLift:
+			var n int64
+			n, err = qtx.DeleteUserSanction(ctx, target.ID)
+			if err == nil && n == 0 {
+				utils.RespondWithError(w, http.StatusConflict, "User has no active sanction")
+				return
+			}
+		}
+		if err != nil {
+			log.Printf("ERROR: ModerationActionHandler: Failed to update sanction for user %d: %v", target.ID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to apply moderation action")
+			return
+		}
+
+		// Any decision counts as the review that lifts an automatic hide.
+		if err := qtx.ClearRiskHold(ctx, target.ID); err != nil {
+			log.Printf("ERROR: ModerationActionHandler: Failed to clear risk hold for user %d: %v", target.ID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to apply moderation action")
+			return
+		}
+
+		resolved, err := qtx.ResolveOpenReportsForUser(ctx, migrations.ResolveOpenReportsForUserParams{
+			ActionID:       recorded.ID,
+			ReportedUserID: target.ID,
+		})
+		if err != nil {
+			log.Printf("ERROR: ModerationActionHandler: Failed to resolve reports for user %d: %v", target.ID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to apply moderation action")
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			log.Printf("ERROR: ModerationActionHandler: Failed to commit %s on user %d: %v", action, target.ID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to apply moderation action")
+			return
+		}
+
+		switch action {
+		case migrations.ModerationActionTypeSuspend, migrations.ModerationActionTypeBan:
+			hub.DisconnectUser(target.ID, "")
+		case migrations.ModerationActionTypeWarn:
+			hub.SendEvent(target.ID, adminUserID, ws.WsMessage{Type: "moderation_warning", Content: ws.Ptr(req.Reason)})
+		}
+
+		log.Printf("AUDIT: Admin %d applied %s to user %d (action %d, %d reports resolved): %s", adminUserID, action, target.ID, recorded.ID, resolved, req.Reason)
+		resp := ModerationActionResponse{
+			Success:         true,
+			Message:         "Moderation action applied",
+			ActionID:        recorded.ID,
+			ReportsResolved: resolved,
+		}
+		if suspendedUntil.Valid {
+			resp.SuspendedUntil = &suspendedUntil.Time
+		}
+		utils.RespondWithJSON(w, http.StatusOK, resp)
+	}
+}
+
+type AutoHiddenUser struct {
+	UserID             int32     `json:"user_id"`
+	Name               string    `json:"name"`
+	FirstProfilePicURL string    `json:"first_profile_pic_url,omitempty"`
+	Score              float64   `json:"score"`
+	Reasons            []string  `json:"reasons"`
+	EvaluatedAt        time.Time `json:"evaluated_at"`
+}
+
+type AutoHiddenUsersResponse struct {
+	Success bool             `json:"success"`
+	Message string           `json:"message,omitempty"`
+	Users   []AutoHiddenUser `json:"users"`
+}
+
+// GetAutoHiddenUsersHandler lists users the risk rules hid from the feeds
+// and who are waiting for an admin decision.
+func GetAutoHiddenUsersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+
+	if r.Method != http.MethodGet {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET")
+		return
+	}
+
+	limit, offset, ok := parseAdminPage(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := queries.GetAutoHiddenUsers(ctx, migrations.GetAutoHiddenUsersParams{Limit: limit, Offset: offset})
+	if err != nil {
+		log.Printf("ERROR: GetAutoHiddenUsersHandler: Failed to fetch hidden users: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch hidden users")
+		return
+	}
+
+	users := make([]AutoHiddenUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, AutoHiddenUser{
+			UserID:             row.UserID,
+			Name:               buildFullName(row.Name, row.LastName),
+			FirstProfilePicURL: getFirstMediaURL(row.MediaUrls),
+			Score:              row.Score,
+			Reasons:            row.Reasons,
+			EvaluatedAt:        row.EvaluatedAt.Time,
+		})
+	}
+	utils.RespondWithJSON(w, http.StatusOK, AutoHiddenUsersResponse{Success: true, Users: users})
+}
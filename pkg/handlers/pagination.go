@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor is the keyset position of the last row on a page. Clients only
+// ever see it base64-encoded, so the fields can change without breaking them.
+type pageCursor struct {
+	At   time.Time `json:"t"`
+	ID   int64     `json:"i"`
+	Rank int32     `json:"r,omitempty"` // sort bucket, used by the likes list
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.At.IsZero() {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
+
+var errInvalidPageLimit = errors.New("limit must be a positive integer")
+
+// clampPageLimit returns def for a zero limit and caps it at max.
+func clampPageLimit(n int64, def, max int32) (int32, error) {
+	switch {
+	case n == 0:
+		return def, nil
+	case n < 0:
+		return 0, errInvalidPageLimit
+	case n > int64(max):
+		return max, nil
+	}
+	return int32(n), nil
+}
+
+// parsePageLimit is clampPageLimit for a "limit" query parameter.
+func parsePageLimit(raw string, def, max int32) (int32, error) {
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n == 0 {
+		return 0, errInvalidPageLimit
+	}
+	return clampPageLimit(n, def, max)
+}
+
+// Keyset bounds used when the client sends no cursor, so the queries never
+// need an "IS NULL OR" branch that would stop them using an index range.
+var timestampPosInf = pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+
+const (
+	maxCursorID64 = math.MaxInt64
+	maxCursorID32 = math.MaxInt32
+)
+
+func cursorTimestamp(t time.Time) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: t, Valid: true}
+}
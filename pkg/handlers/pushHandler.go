@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/push"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const maxPushTokenLength = 4096
+
+type PushTokenRequest struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform,omitempty"` // "ios" or "android"; only needed to register
+}
+
+type PushTokenResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// PushTokensHandler registers (POST) and removes (DELETE) the caller's
+// device push tokens. A token registered from a session is removed again
+// when that session logs out.
+func PushTokensHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, errDb := db.GetDB()
+	if errDb != nil || queries == nil {
+		utils.RespondWithJSON(w, http.StatusInternalServerError, PushTokenResponse{Success: false, Message: "Database connection error"})
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithJSON(w, http.StatusUnauthorized, PushTokenResponse{Success: false, Message: "Authentication required"})
+		return
+	}
+	userID := int32(claims.UserID)
+
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		utils.RespondWithJSON(w, http.StatusMethodNotAllowed, PushTokenResponse{Success: false, Message: "Method Not Allowed: Use POST or DELETE"})
+		return
+	}
+
+	var req PushTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithJSON(w, http.StatusBadRequest, PushTokenResponse{Success: false, Message: "Invalid request body format"})
+		return
+	}
+	defer r.Body.Close()
+	if req.Token == "" || len(req.Token) > maxPushTokenLength {
+		utils.RespondWithJSON(w, http.StatusBadRequest, PushTokenResponse{Success: false, Message: "Valid token is required"})
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if _, err := queries.DeleteDevicePushToken(ctx, migrations.DeleteDevicePushTokenParams{UserID: userID, Token: req.Token}); err != nil {
+			log.Printf("ERROR: PushTokensHandler: Failed delete token for user %d: %v", userID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, PushTokenResponse{Success: false, Message: "Failed to remove device"})
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, PushTokenResponse{Success: true, Message: "Device removed"})
+		return
+	}
+
+	// The admin's device must not receive the impersonated user's pushes.
+	if claims.IsImpersonated() {
+		utils.RespondWithJSON(w, http.StatusForbidden, PushTokenResponse{Success: false, Message: "Not allowed while impersonating a user"})
+		return
+	}
+	platform := migrations.PushPlatform(req.Platform)
+	if platform != migrations.PushPlatformIos && platform != migrations.PushPlatformAndroid {
+		utils.RespondWithJSON(w, http.StatusBadRequest, PushTokenResponse{Success: false, Message: "platform must be ios or android"})
+		return
+	}
+	sessionKey := claims.SessionKey()
+	if _, err := queries.UpsertDevicePushToken(ctx, migrations.UpsertDevicePushTokenParams{
+		UserID:    userID,
+		Platform:  platform,
+		Token:     req.Token,
+		SessionID: pgtype.Text{String: sessionKey, Valid: sessionKey != ""},
+	}); err != nil {
+		log.Printf("ERROR: PushTokensHandler: Failed register token for user %d: %v", userID, err)
+		utils.RespondWithJSON(w, http.StatusInternalServerError, PushTokenResponse{Success: false, Message: "Failed to register device"})
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, PushTokenResponse{Success: true, Message: "Device registered"})
+}
+
+// NotificationPreferencesRequest changes push preferences. Fields left out
+// are unchanged; an empty quiet_hours_start and quiet_hours_end turn quiet
+// hours off.
+type NotificationPreferencesRequest struct {
+	NewMessage      *bool   `json:"new_message,omitempty"`
+	NewLike         *bool   `json:"new_like,omitempty"`
+	NewMatch        *bool   `json:"new_match,omitempty"`
+	QuietHoursStart *string `json:"quiet_hours_start,omitempty"` // "HH:MM" in timezone
+	QuietHoursEnd   *string `json:"quiet_hours_end,omitempty"`
+	Timezone        *string `json:"timezone,omitempty"` // IANA name, e.g. "Asia/Kolkata"
+}
+
+type NotificationPreferencesView struct {
+	NewMessage      bool   `json:"new_message"`
+	NewLike         bool   `json:"new_like"`
+	NewMatch        bool   `json:"new_match"`
+	QuietHoursStart string `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   string `json:"quiet_hours_end,omitempty"`
+	Timezone        string `json:"timezone"`
+}
+
+type NotificationPreferencesResponse struct {
+	Success     bool                         `json:"success"`
+	Message     string                       `json:"message,omitempty"`
+	Preferences *NotificationPreferencesView `json:"preferences,omitempty"`
+}
+
+func notificationPreferencesView(p migrations.NotificationPreference) *NotificationPreferencesView {
+	view := &NotificationPreferencesView{
+		NewMessage: p.NewMessage,
+		NewLike:    p.NewLike,
+		NewMatch:   p.NewMatch,
+		Timezone:   p.Timezone,
+	}
+	if p.QuietHoursStart.Valid && p.QuietHoursEnd.Valid {
+		view.QuietHoursStart = formatClock(p.QuietHoursStart.Int16)
+		view.QuietHoursEnd = formatClock(p.QuietHoursEnd.Int16)
+	}
+	return view
+}
+
+func formatClock(minutes int16) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// parseClock parses "HH:MM" into minutes after midnight; "" means unset.
+func parseClock(s string) (pgtype.Int2, error) {
+	if s == "" {
+		return pgtype.Int2{}, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return pgtype.Int2{}, errors.New("quiet hours must be HH:MM")
+	}
+	return pgtype.Int2{Int16: int16(t.Hour()*60 + t.Minute()), Valid: true}, nil
+}
+
+// NotificationPreferencesHandler reads (GET) and changes (PUT) which push
+// notifications the caller gets and their quiet hours.
+func NotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, errDb := db.GetDB()
+	if errDb != nil || queries == nil {
+		utils.RespondWithJSON(w, http.StatusInternalServerError, NotificationPreferencesResponse{Success: false, Message: "Database connection error"})
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithJSON(w, http.StatusUnauthorized, NotificationPreferencesResponse{Success: false, Message: "Authentication required"})
+		return
+	}
+	userID := int32(claims.UserID)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		utils.RespondWithJSON(w, http.StatusMethodNotAllowed, NotificationPreferencesResponse{Success: false, Message: "Method Not Allowed: Use GET or PUT"})
+		return
+	}
+
+	prefs, err := queries.GetNotificationPreferences(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		prefs = push.DefaultPreferences(userID)
+	} else if err != nil {
+		log.Printf("ERROR: NotificationPreferencesHandler: Failed fetch preferences for user %d: %v", userID, err)
+		utils.RespondWithJSON(w, http.StatusInternalServerError, NotificationPreferencesResponse{Success: false, Message: "Error retrieving notification preferences"})
+		return
+	}
+	if r.Method == http.MethodGet {
+		utils.RespondWithJSON(w, http.StatusOK, NotificationPreferencesResponse{Success: true, Preferences: notificationPreferencesView(prefs)})
+		return
+	}
+
+	var req NotificationPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithJSON(w, http.StatusBadRequest, NotificationPreferencesResponse{Success: false, Message: "Invalid request body format"})
+		return
+	}
+	defer r.Body.Close()
+
+	if req.NewMessage != nil {
+		prefs.NewMessage = *req.NewMessage
+	}
+	if req.NewLike != nil {
+		prefs.NewLike = *req.NewLike
+	}
+	if req.NewMatch != nil {
+		prefs.NewMatch = *req.NewMatch
+	}
+	if (req.QuietHoursStart == nil) != (req.QuietHoursEnd == nil) {
+		utils.RespondWithJSON(w, http.StatusBadRequest, NotificationPreferencesResponse{Success: false, Message: "quiet_hours_start and quiet_hours_end must be sent together"})
+		return
+	}
+	if req.QuietHoursStart != nil {
+		start, errStart := parseClock(*req.QuietHoursStart)
+		end, errEnd := parseClock(*req.QuietHoursEnd)
+		if errStart != nil || errEnd != nil || start.Valid != end.Valid {
+			utils.RespondWithJSON(w, http.StatusBadRequest, NotificationPreferencesResponse{Success: false, Message: "Quiet hours must both be HH:MM, or both empty to turn them off"})
+			return
+		}
+		prefs.QuietHoursStart, prefs.QuietHoursEnd = start, end
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			utils.RespondWithJSON(w, http.StatusBadRequest, NotificationPreferencesResponse{Success: false, Message: "Unknown timezone"})
+			return
+		}
+		prefs.Timezone = *req.Timezone
+	}
+
+	saved, err := queries.UpsertNotificationPreferences(ctx, migrations.UpsertNotificationPreferencesParams{
+		UserID:          userID,
+		NewMessage:      prefs.NewMessage,
+		NewLike:         prefs.NewLike,
+		NewMatch:        prefs.NewMatch,
+		QuietHoursStart: prefs.QuietHoursStart,
+		QuietHoursEnd:   prefs.QuietHoursEnd,
+		Timezone:        prefs.Timezone,
+	})
+	if err != nil {
+		log.Printf("ERROR: NotificationPreferencesHandler: Failed save preferences for user %d: %v", userID, err)
+		utils.RespondWithJSON(w, http.StatusInternalServerError, NotificationPreferencesResponse{Success: false, Message: "Failed to save notification preferences"})
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, NotificationPreferencesResponse{Success: true, Message: "Notification preferences updated", Preferences: notificationPreferencesView(saved)})
+}
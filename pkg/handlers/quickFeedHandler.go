@@ -54,7 +54,13 @@ func GetQuickFeedHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !requestingUser.Latitude.Valid || !requestingUser.Longitude.Valid {
+	lat, lon, hasLocation, err := feedLocation(ctx, queries, requestingUser)
+	if err != nil {
+		log.Printf("GetQuickFeedHandler: Error fetching travel location for user %d: %v", requestingUserID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve user data")
+		return
+	}
+	if !hasLocation {
 		log.Printf("GetQuickFeedHandler: Requesting user %d missing required location data.", requestingUserID)
 		utils.RespondWithError(w, http.StatusBadRequest, "Your location is not set. Please update your profile.")
 		return
@@ -77,9 +83,7 @@ func GetQuickFeedHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lat := requestingUser.Latitude.Float64
-	lon := requestingUser.Longitude.Float64
-	log.Printf("Fetching quick feed for user %d (gender: %s) using DB location (lat: %f, lon: %f), showing %s",
+	log.Printf("Fetching quick feed for user %d (gender: %s) using location (lat: %f, lon: %f), showing %s",
 		requestingUserID, requestingUser.Gender.GenderEnum, lat, lon, oppositeGender.GenderEnum)
 
 	params := migrations.GetQuickFeedParams{
@@ -106,6 +110,14 @@ func GetQuickFeedHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Travellers are shown at their travel location, not their own.
+	for i := range profiles {
+		if profiles[i].VisitingCity.Valid {
+			profiles[i].Latitude = profiles[i].VisitingLatitude
+			profiles[i].Longitude = profiles[i].VisitingLongitude
+		}
+	}
+
 	log.Printf("Found %d profiles for quick feed for user %d", len(profiles), requestingUserID)
 	utils.RespondWithJSON(w, http.StatusOK, QuickFeedResponse{
 		Success:  true,
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshTokenResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	*token.TokenPair
+}
+
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use POST")
+		return
+	}
+
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body format")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.RefreshToken == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	pair, err := token.RotateRefreshToken(r.Context(), req.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, token.ErrRefreshTokenInvalid), errors.Is(err, token.ErrRefreshTokenExpired):
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		case errors.Is(err, token.ErrRefreshTokenReused):
+			utils.RespondWithError(w, http.StatusUnauthorized, "Refresh token already used; please sign in again")
+		default:
+			log.Printf("ERROR: RefreshTokenHandler: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to refresh session")
+		}
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, RefreshTokenResponse{
+		Success:   true,
+		Message:   "Token refreshed",
+		TokenPair: &pair,
+	})
+}
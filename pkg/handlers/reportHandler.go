@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/arnnvv/peeple-api/migrations"
 	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/risk"
 	"github.com/arnnvv/peeple-api/pkg/token"
 	"github.com/arnnvv/peeple-api/pkg/utils"
 	"github.com/jackc/pgx/v5"
@@ -111,6 +113,21 @@ func ReportHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("ReportHandler: Report created successfully: ID=%d", createdReport.ID)
 
+	go func(reportedUserID int32) {
+		if _, err := risk.EvaluateUser(context.Background(), queries, reportedUserID); err != nil {
+			log.Printf("ReportHandler: Risk evaluation failed for user %d: %v", reportedUserID, err)
+		}
+	}(req.ReportedUserID)
+
+	// Reporting someone also hides them from the reporter.
+	err = queries.BlockUser(ctx, migrations.BlockUserParams{
+		BlockerUserID: reporterUserID,
+		BlockedUserID: req.ReportedUserID,
+	})
+	if err != nil {
+		log.Printf("ReportHandler: Error blocking reported user %d for reporter %d: %v", req.ReportedUserID, reporterUserID, err)
+	}
+
 	utils.RespondWithJSON(w, http.StatusOK, ReportResponse{
 		Success: true,
 		Message: "User reported successfully",
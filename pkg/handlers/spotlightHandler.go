@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/spotlight"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+)
+
+type ActivateSpotlightResponse struct {
+	Success          bool       `json:"success"`
+	Message          string     `json:"message"`
+	ActivatedAt      *time.Time `json:"activated_at,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreditsRemaining *int32     `json:"credits_remaining,omitempty"`
+}
+
+// ActivateSpotlightHandler uses one of the caller's spotlight credits to put
+// them at the top of other users' home feeds for a while.
+func ActivateSpotlightHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, errDb := db.GetDB()
+	pool, errPool := db.GetPool()
+	if errDb != nil || errPool != nil || queries == nil || pool == nil {
+		utils.RespondWithJSON(w, http.StatusInternalServerError, ActivateSpotlightResponse{Success: false, Message: "Database connection error"})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		utils.RespondWithJSON(w, http.StatusMethodNotAllowed, ActivateSpotlightResponse{Success: false, Message: "Method Not Allowed: Use POST"})
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithJSON(w, http.StatusUnauthorized, ActivateSpotlightResponse{Success: false, Message: "Authentication required"})
+		return
+	}
+	userID := int32(claims.UserID)
+
+	activation, err := spotlight.Activate(ctx, pool, queries, userID)
+	switch {
+	case errors.Is(err, spotlight.ErrAlreadyActive):
+		utils.RespondWithJSON(w, http.StatusConflict, ActivateSpotlightResponse{Success: false, Message: "Your spotlight is already active"})
+		return
+	case errors.Is(err, spotlight.ErrNoCredits):
+		utils.RespondWithJSON(w, http.StatusForbidden, ActivateSpotlightResponse{Success: false, Message: "You have no spotlights left"})
+		return
+	case err != nil:
+		log.Printf("ERROR: ActivateSpotlightHandler: Failed activate spotlight for user %d: %v", userID, err)
+		utils.RespondWithJSON(w, http.StatusInternalServerError, ActivateSpotlightResponse{Success: false, Message: "Failed to activate spotlight"})
+		return
+	}
+
+	activatedAt := activation.ActivatedAt.UTC()
+	expiresAt := activation.ExpiresAt.UTC()
+	utils.RespondWithJSON(w, http.StatusOK, ActivateSpotlightResponse{
+		Success:          true,
+		Message:          "Spotlight activated",
+		ActivatedAt:      &activatedAt,
+		ExpiresAt:        &expiresAt,
+		CreditsRemaining: &activation.CreditsRemaining,
+	})
+}
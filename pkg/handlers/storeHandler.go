@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/catalog"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+)
+
+type StoreProductGrant struct {
+	FeatureType migrations.PremiumFeatureType `json:"feature_type"`
+	Quantity    int32                         `json:"quantity,omitempty"` // consumables
+	Duration    string                        `json:"duration,omitempty"` // subscriptions, ISO-8601
+}
+
+type StoreProduct struct {
+	ProductID   string              `json:"product_id"`
+	DisplayName string              `json:"display_name"`
+	Description string              `json:"description"`
+	Type        string              `json:"type"` // "consumable" or "subscription"
+	Active      bool                `json:"active"`
+	SortOrder   int32               `json:"sort_order"`
+	Grants      []StoreProductGrant `json:"grants"`
+}
+
+type StoreProductsResponse struct {
+	Success  bool           `json:"success"`
+	Products []StoreProduct `json:"products"`
+}
+
+type StoreProductResponse struct {
+	Success bool          `json:"success"`
+	Message string        `json:"message,omitempty"`
+	Product *StoreProduct `json:"product,omitempty"`
+}
+
+// StoreProductRequest creates (POST, with product_id) or replaces (PUT) a
+// catalog product.
+type StoreProductRequest struct {
+	ProductID   string              `json:"product_id"`
+	DisplayName string              `json:"display_name"`
+	Description string              `json:"description"`
+	Type        string              `json:"type"`   // as set up in the stores: "consumable" or "subscription"
+	Active      *bool               `json:"active"` // defaults to true
+	SortOrder   int32               `json:"sort_order"`
+	Grants      []StoreProductGrant `json:"grants"`
+}
+
+func (req StoreProductRequest) product(productID string) (catalog.Product, error) {
+	if req.Type != "consumable" && req.Type != "subscription" {
+		return catalog.Product{}, fmt.Errorf("%w: type must be consumable or subscription", catalog.ErrInvalidProduct)
+	}
+	p := catalog.Product{
+		ProductID:    productID,
+		DisplayName:  strings.TrimSpace(req.DisplayName),
+		Description:  strings.TrimSpace(req.Description),
+		Subscription: req.Type == "subscription",
+		Active:       req.Active == nil || *req.Active,
+		SortOrder:    req.SortOrder,
+		Grants:       make([]catalog.Grant, 0, len(req.Grants)),
+	}
+	for _, g := range req.Grants {
+		p.Grants = append(p.Grants, catalog.Grant{FeatureType: g.FeatureType, Quantity: g.Quantity, Duration: g.Duration})
+	}
+	return p, nil
+}
+
+func toStoreProduct(p catalog.Product) StoreProduct {
+	view := StoreProduct{
+		ProductID:   p.ProductID,
+		DisplayName: p.DisplayName,
+		Description: p.Description,
+		Type:        "consumable",
+		Active:      p.Active,
+		SortOrder:   p.SortOrder,
+		Grants:      make([]StoreProductGrant, 0, len(p.Grants)),
+	}
+	if p.Subscription {
+		view.Type = "subscription"
+	}
+	for _, g := range p.Grants {
+		view.Grants = append(view.Grants, StoreProductGrant{FeatureType: g.FeatureType, Quantity: g.Quantity, Duration: g.Duration})
+	}
+	return view
+}
+
+func toStoreProducts(products []catalog.Product) []StoreProduct {
+	views := make([]StoreProduct, 0, len(products))
+	for _, p := range products {
+		views = append(views, toStoreProduct(p))
+	}
+	return views
+}
+
+// GetStoreProductsHandler lists the products on sale, in display order, for
+// the app to render its store from. Prices come from the stores.
+func GetStoreProductsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+	if queries == nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database connection error")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET")
+		return
+	}
+
+	products, err := catalog.List(ctx, queries, true)
+	if err != nil {
+		log.Printf("ERROR: GetStoreProductsHandler: Failed to list products: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch products")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, StoreProductsResponse{Success: true, Products: toStoreProducts(products)})
+}
+
+// AdminStoreProductsHandler lists the whole catalog (GET) or adds a
+// product to it (POST).
+func AdminStoreProductsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+	pool, _ := db.GetPool()
+	if queries == nil || pool == nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database connection error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		products, err := catalog.List(ctx, queries, false)
+		if err != nil {
+			log.Printf("ERROR: AdminStoreProductsHandler: Failed to list products: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch products")
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, StoreProductsResponse{Success: true, Products: toStoreProducts(products)})
+
+	case http.MethodPost:
+		var req StoreProductRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		product, err := req.product(strings.TrimSpace(req.ProductID))
+		if err == nil {
+			product, err = catalog.Create(ctx, pool, queries, product)
+		}
+		if err != nil {
+			respondWithCatalogError(w, "AdminStoreProductsHandler", req.ProductID, err)
+			return
+		}
+		log.Printf("INFO: AdminStoreProductsHandler: Created product %s", product.ProductID)
+		view := toStoreProduct(product)
+		utils.RespondWithJSON(w, http.StatusCreated, StoreProductResponse{Success: true, Message: "Product created", Product: &view})
+
+	default:
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET or POST")
+	}
+}
+
+// AdminStoreProductHandler reads (GET), replaces (PUT) or removes (DELETE)
+// the product in /api/admin/store/products/{product_id}.
+func AdminStoreProductHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, _ := db.GetDB()
+	pool, _ := db.GetPool()
+	if queries == nil || pool == nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Database connection error")
+		return
+	}
+
+	productID := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/api/admin/store/products/")
+	if productID == "" || strings.Contains(productID, "/") {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID in URL")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		product, err := catalog.Get(ctx, queries, productID)
+		if err != nil {
+			respondWithCatalogError(w, "AdminStoreProductHandler", productID, err)
+			return
+		}
+		view := toStoreProduct(product)
+		utils.RespondWithJSON(w, http.StatusOK, StoreProductResponse{Success: true, Product: &view})
+
+	case http.MethodPut:
+		var req StoreProductRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if req.ProductID != "" && req.ProductID != productID {
+			utils.RespondWithError(w, http.StatusBadRequest, "product_id does not match the URL")
+			return
+		}
+		product, err := req.product(productID)
+		if err == nil {
+			product, err = catalog.Update(ctx, pool, queries, product)
+		}
+		if err != nil {
+			respondWithCatalogError(w, "AdminStoreProductHandler", productID, err)
+			return
+		}
+		log.Printf("INFO: AdminStoreProductHandler: Updated product %s", productID)
+		view := toStoreProduct(product)
+		utils.RespondWithJSON(w, http.StatusOK, StoreProductResponse{Success: true, Message: "Product updated", Product: &view})
+
+	case http.MethodDelete:
+		if err := catalog.Delete(ctx, queries, productID); err != nil {
+			respondWithCatalogError(w, "AdminStoreProductHandler", productID, err)
+			return
+		}
+		log.Printf("INFO: AdminStoreProductHandler: Deleted product %s", productID)
+		utils.RespondWithJSON(w, http.StatusOK, StoreProductResponse{Success: true, Message: "Product deleted"})
+
+	default:
+		utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed: Use GET, PUT or DELETE")
+	}
+}
+
+func respondWithCatalogError(w http.ResponseWriter, handler, productID string, err error) {
+	switch {
+	case errors.Is(err, catalog.ErrInvalidProduct):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, catalog.ErrNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+	case errors.Is(err, catalog.ErrExists):
+		utils.RespondWithError(w, http.StatusConflict, "Product already exists")
+	default:
+		log.Printf("ERROR: %s: Failed on product %s: %v", handler, productID, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to access the product catalog")
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/arnnvv/peeple-api/pkg/token"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	maxTravelCityLength = 100
+	// A travel location lasts until the subscription ends unless the user
+	// picks an earlier expiry, and never longer than this.
+	maxTravelDuration = 30 * 24 * time.Hour
+)
+
+type TravelLocationRequest struct {
+	Latitude  *float64   `json:"latitude"`
+	Longitude *float64   `json:"longitude"`
+	City      string     `json:"city"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type TravelLocationView struct {
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	City      string    `json:"city"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Active is false once the location or the travel mode subscription
+	// has expired; feeds then use the user's own location again.
+	Active bool `json:"active"`
+}
+
+type TravelLocationResponse struct {
+	Success        bool                `json:"success"`
+	Message        string              `json:"message,omitempty"`
+	TravelLocation *TravelLocationView `json:"travel_location"`
+}
+
+// TravelLocationHandler shows (GET), sets (PUT) and clears (DELETE) the
+// location a travel mode subscriber browses from.
+func TravelLocationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	queries, errDb := db.GetDB()
+	if errDb != nil || queries == nil {
+		utils.RespondWithJSON(w, http.StatusInternalServerError, TravelLocationResponse{Success: false, Message: "Database connection error"})
+		return
+	}
+
+	claims, ok := ctx.Value(token.ClaimsContextKey).(*token.Claims)
+	if !ok || claims == nil || claims.UserID <= 0 {
+		utils.RespondWithJSON(w, http.StatusUnauthorized, TravelLocationResponse{Success: false, Message: "Authentication required"})
+		return
+	}
+	userID := int32(claims.UserID)
+
+	switch r.Method {
+	case http.MethodGet:
+		location, err := queries.GetTravelLocation(ctx, userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.RespondWithJSON(w, http.StatusOK, TravelLocationResponse{Success: true})
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: TravelLocationHandler: Failed get travel location for user %d: %v", userID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, TravelLocationResponse{Success: false, Message: "Failed to retrieve travel location"})
+			return
+		}
+		subscription, err := activeTravelSubscription(ctx, queries, userID)
+		if err != nil {
+			log.Printf("ERROR: TravelLocationHandler: Failed check subscription for user %d: %v", userID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, TravelLocationResponse{Success: false, Message: "Failed to retrieve travel location"})
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, TravelLocationResponse{Success: true, TravelLocation: toTravelLocationView(location, subscription != nil)})
+
+	case http.MethodPut:
+		var req TravelLocationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, TravelLocationResponse{Success: false, Message: "Invalid request body format"})
+			return
+		}
+		defer r.Body.Close()
+		req.City = strings.TrimSpace(req.City)
+		if req.Latitude == nil || *req.Latitude < -90 || *req.Latitude > 90 ||
+			req.Longitude == nil || *req.Longitude < -180 || *req.Longitude > 180 {
+			utils.RespondWithJSON(w, http.StatusBadRequest, TravelLocationResponse{Success: false, Message: "Valid latitude and longitude are required"})
+			return
+		}
+		if req.City == "" || utf8.RuneCountInString(req.City) > maxTravelCityLength {
+			utils.RespondWithJSON(w, http.StatusBadRequest, TravelLocationResponse{Success: false, Message: "City is required and must be at most 100 characters"})
+			return
+		}
+
+		subscription, err := activeTravelSubscription(ctx, queries, userID)
+		if err != nil {
+			log.Printf("ERROR: TravelLocationHandler: Failed check subscription for user %d: %v", userID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, TravelLocationResponse{Success: false, Message: "Failed to verify subscription"})
+			return
+		}
+		if subscription == nil {
+			utils.RespondWithJSON(w, http.StatusForbidden, TravelLocationResponse{Success: false, Message: "Travel mode requires an active subscription"})
+			return
+		}
+
+		now := time.Now()
+		expiresAt := subscription.ExpiresAt.Time
+		if req.ExpiresAt != nil {
+			if !req.ExpiresAt.After(now) {
+				utils.RespondWithJSON(w, http.StatusBadRequest, TravelLocationResponse{Success: false, Message: "expires_at must be in the future"})
+				return
+			}
+			if req.ExpiresAt.Before(expiresAt) {
+				expiresAt = *req.ExpiresAt
+			}
+		}
+		if limit := now.Add(maxTravelDuration); expiresAt.After(limit) {
+			expiresAt = limit
+		}
+
+		location, err := queries.UpsertTravelLocation(ctx, migrations.UpsertTravelLocationParams{
+			UserID:    userID,
+			Latitude:  *req.Latitude,
+			Longitude: *req.Longitude,
+			City:      req.City,
+			ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+		})
+		if err != nil {
+			log.Printf("ERROR: TravelLocationHandler: Failed set travel location for user %d: %v", userID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, TravelLocationResponse{Success: false, Message: "Failed to set travel location"})
+			return
+		}
+		log.Printf("INFO: TravelLocationHandler: User %d now visiting %q until %s", userID, location.City, expiresAt.Format(time.RFC3339))
+		utils.RespondWithJSON(w, http.StatusOK, TravelLocationResponse{Success: true, Message: "Travel location set", TravelLocation: toTravelLocationView(location, true)})
+
+	case http.MethodDelete:
+		if err := queries.DeleteTravelLocation(ctx, userID); err != nil {
+			log.Printf("ERROR: TravelLocationHandler: Failed clear travel location for user %d: %v", userID, err)
+			utils.RespondWithJSON(w, http.StatusInternalServerError, TravelLocationResponse{Success: false, Message: "Failed to clear travel location"})
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, TravelLocationResponse{Success: true, Message: "Travel location cleared"})
+
+	default:
+		utils.RespondWithJSON(w, http.StatusMethodNotAllowed, TravelLocationResponse{Success: false, Message: "Method Not Allowed: Use GET, PUT or DELETE"})
+	}
+}
+
+// activeTravelSubscription returns the user's active travel mode
+// subscription, or nil if they have none.
+func activeTravelSubscription(ctx context.Context, queries *migrations.Queries, userID int32) (*migrations.UserSubscription, error) {
+	subscription, err := queries.GetActiveSubscription(ctx, migrations.GetActiveSubscriptionParams{
+		UserID:      userID,
+		FeatureType: migrations.PremiumFeatureTypeTravelMode,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func toTravelLocationView(location migrations.UserTravelLocation, subscribed bool) *TravelLocationView {
+	return &TravelLocationView{
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+		City:      location.City,
+		ExpiresAt: location.ExpiresAt.Time.UTC(),
+		Active:    subscribed && location.ExpiresAt.Time.After(time.Now()),
+	}
+}
+
+// feedLocation returns where the user browses from: their travel location
+// while it and their subscription are active, otherwise their own.
+func feedLocation(ctx context.Context, queries *migrations.Queries, user migrations.User) (lat, lon float64, ok bool, err error) {
+	travel, err := queries.GetActiveTravelLocation(ctx, user.ID)
+	if err == nil {
+		return travel.Latitude, travel.Longitude, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, false, err
+	}
+	if !user.Latitude.Valid || !user.Longitude.Valid {
+		return 0, 0, false, nil
+	}
+	return user.Latitude.Float64, user.Longitude.Float64, true, nil
+}
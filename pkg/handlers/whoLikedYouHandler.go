@@ -19,6 +19,11 @@ import (
 
 const maxFullProfiles = 10 // Assuming this constant is appropriate
 
+const (
+	defaultLikersPageLimit = 50
+	maxLikersPageLimit     = 100
+)
+
 // --- MODIFIED Structs to include LikeID ---
 
 // FullProfileLikerResponseItem represents a liker whose full profile is included.
@@ -50,6 +55,8 @@ type WhoLikedYouResponse struct {
 	Message      string                          `json:"message,omitempty"`
 	FullProfiles []FullProfileLikerResponseItem  `json:"full_profiles"` // Use modified struct
 	OtherLikers  []BasicProfileLikerResponseItem `json:"other_likers"`  // Use modified struct
+	HasMore      bool                            `json:"has_more"`
+	NextCursor   string                          `json:"next_cursor,omitempty"` // pass back as ?after= for the next page
 }
 
 // LikerProfileResponse structure (used by GetLikerProfileHandler, unchanged here)
@@ -91,7 +98,33 @@ func GetWhoLikedYouHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("INFO: GetWhoLikedYouHandler: Fetching likers for user %d", likedUserID)
 
-	likersBasicInfo, err := queries.GetLikersForUser(ctx, likedUserID)
+	limit, limitErr := parsePageLimit(r.URL.Query().Get("limit"), defaultLikersPageLimit, maxLikersPageLimit)
+	if limitErr != nil {
+		utils.RespondWithJSON(w, http.StatusBadRequest, WhoLikedYouResponse{Success: false, Message: limitErr.Error()})
+		return
+	}
+	// Pages follow the list order: roses first, then unseen before seen,
+	// newest first within each group.
+	params := migrations.GetLikersForUserParams{
+		LikedUserID:    likedUserID,
+		AfterRank:      -1,
+		AfterCreatedAt: timestampPosInf,
+		AfterID:        maxCursorID32,
+		PageLimit:      limit + 1,
+	}
+	afterCursor := r.URL.Query().Get("after")
+	if afterCursor != "" {
+		c, cursorErr := decodeCursor(afterCursor)
+		if cursorErr != nil || c.ID > maxCursorID32 {
+			utils.RespondWithJSON(w, http.StatusBadRequest, WhoLikedYouResponse{Success: false, Message: "Invalid cursor"})
+			return
+		}
+		params.AfterRank = c.Rank
+		params.AfterCreatedAt = cursorTimestamp(c.At)
+		params.AfterID = int32(c.ID)
+	}
+
+	likersBasicInfo, err := queries.GetLikersForUser(ctx, params)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		log.Printf("ERROR: GetWhoLikedYouHandler: Failed to fetch likers for user %d: %v", likedUserID, err)
 		utils.RespondWithJSON(w, http.StatusInternalServerError, WhoLikedYouResponse{Success: false, Message: "Error retrieving likes"})
@@ -109,13 +142,27 @@ func GetWhoLikedYouHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	hasMore := len(likersBasicInfo) > int(limit)
+	var nextCursor string
+	if hasMore {
+		likersBasicInfo = likersBasicInfo[:limit]
+		last := likersBasicInfo[len(likersBasicInfo)-1]
+		nextCursor = encodeCursor(pageCursor{At: last.LikedAt.Time, ID: int64(last.LikeID), Rank: last.SortRank})
+	}
+
 	log.Printf("INFO: GetWhoLikedYouHandler: Found %d likers for user %d", len(likersBasicInfo), likedUserID)
 
+	// Only the top of the list gets full profiles; later pages are basic.
+	fullProfileCount := maxFullProfiles
+	if afterCursor != "" {
+		fullProfileCount = 0
+	}
+
 	// Initialize slices with the modified struct types
 	fullProfiles := make([]FullProfileLikerResponseItem, 0, maxFullProfiles)
 	otherLikersCap := 0
-	if len(likersBasicInfo) > maxFullProfiles {
-		otherLikersCap = len(likersBasicInfo) - maxFullProfiles
+	if len(likersBasicInfo) > fullProfileCount {
+		otherLikersCap = len(likersBasicInfo) - fullProfileCount
 	}
 	otherLikers := make([]BasicProfileLikerResponseItem, 0, otherLikersCap)
 
@@ -131,7 +178,7 @@ func GetWhoLikedYouHandler(w http.ResponseWriter, r *http.Request) {
 		likerName := buildFullName(basicInfo.Name, basicInfo.LastName) // Assumes buildFullName exists
 		likerPic := getFirstMediaURL(basicInfo.MediaUrls)              // Assumes getFirstMediaURL exists
 
-		if i < maxFullProfiles {
+		if i < fullProfileCount {
 			log.Printf("DEBUG: Fetching full profile for liker %d (index %d)", basicInfo.LikerUserID, i)
 			// Assuming fetchFullUserProfileData returns *UserProfileData, error
 			fullProfileData, profileErr := fetchFullUserProfileData(ctx, queries, basicInfo.LikerUserID)
@@ -181,6 +228,8 @@ func GetWhoLikedYouHandler(w http.ResponseWriter, r *http.Request) {
 		Success:      true,
 		FullProfiles: fullProfiles,
 		OtherLikers:  otherLikers,
+		HasMore:      hasMore,
+		NextCursor:   nextCursor,
 	})
 }
 
@@ -241,6 +290,20 @@ func GetLikerProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	blocked, err := queries.IsBlockedBetween(ctx, migrations.IsBlockedBetweenParams{
+		BlockerUserID: currentUserLikerID,
+		BlockedUserID: targetLikerUserID,
+	})
+	if err != nil {
+		log.Printf("ERROR: GetLikerProfileHandler: Failed block check %d <-> %d: %v", currentUserLikerID, targetLikerUserID, err)
+		utils.RespondWithJSON(w, http.StatusInternalServerError, LikerProfileResponse{Success: false, Message: "Error checking like status"})
+		return
+	}
+	if blocked {
+		utils.RespondWithJSON(w, http.StatusNotFound, LikerProfileResponse{Success: false, Message: "This user has not liked you or the like does not exist."})
+		return
+	}
+
 	// Fetch the full profile of the target liker user
 	// Assume fetchFullUserProfileData returns *UserProfileData, error
 	fullProfileData, err := fetchFullUserProfileData(ctx, queries, targetLikerUserID)
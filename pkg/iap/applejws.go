@@ -0,0 +1,116 @@
+package iap
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Apple marks the certificates that sign App Store data with these
+// extensions; a chain to the root alone could be any Apple certificate.
+var (
+	appleReceiptSigningOID       = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	appleWWDRIntermediateCertOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
+
+type jwsHeader struct {
+	Alg string   `json:"alg"`
+	X5c []string `json:"x5c"`
+}
+
+// verifyAppleJWS checks that signed is a JWS signed by Apple's App Store
+// certificate chain, rooted in roots and valid at now, and decodes its
+// payload into v.
+func verifyAppleJWS(signed string, roots *x509.CertPool, now time.Time, v any) error {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed JWS")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("JWS header: %w", err)
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return fmt.Errorf("JWS header: %w", err)
+	}
+	if header.Alg != "ES256" {
+		return fmt.Errorf("JWS algorithm %q not allowed", header.Alg)
+	}
+	if len(header.X5c) < 2 {
+		return errors.New("JWS certificate chain too short")
+	}
+
+	certs := make([]*x509.Certificate, len(header.X5c))
+	for i, enc := range header.X5c {
+		der, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return fmt.Errorf("JWS certificate %d: %w", i, err)
+		}
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return fmt.Errorf("JWS certificate %d: %w", i, err)
+		}
+	}
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("JWS certificate chain: %w", err)
+	}
+	if !hasExtension(leaf, appleReceiptSigningOID) || !hasExtension(certs[1], appleWWDRIntermediateCertOID) {
+		return errors.New("JWS not signed by an App Store certificate")
+	}
+
+	key, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("JWS signing key is not ECDSA")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return errors.New("malformed JWS signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return errors.New("JWS signature invalid")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("JWS payload: %w", err)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("JWS payload: %w", err)
+	}
+	return nil
+}
+
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// millisTime converts the milliseconds since the epoch used in Apple's
+// payloads.
+func millisTime(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
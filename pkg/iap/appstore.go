@@ -0,0 +1,239 @@
+package iap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AppStoreProductionURL = "https://api.storekit.itunes.apple.com"
+	AppStoreSandboxURL    = "https://api.storekit-sandbox.itunes.apple.com"
+	// Apple accepts API tokens valid for up to an hour.
+	appStoreTokenLifetime = 30 * time.Minute
+	appStoreTokenRefresh  = 25 * time.Minute
+)
+
+// AppStoreConfig configures the App Store Server API verifier.
+type AppStoreConfig struct {
+	KeyPEM   []byte // In-App Purchase key (.p8) from App Store Connect
+	KeyID    string
+	IssuerID string
+	BundleID string
+	// RootCAs must hold Apple Root CA - G3, which anchors the signatures
+	// on transactions.
+	RootCAs *x509.CertPool
+	// BaseURLs are tried in order until one knows the transaction, so a
+	// production server still accepts App Review's sandbox purchases.
+	BaseURLs []string
+}
+
+// appStoreVerifier looks transactions up with the App Store Server API and
+// checks Apple's signature on them.
+type appStoreVerifier struct {
+	keyID    string
+	issuerID string
+	bundleID string
+	key      *ecdsa.PrivateKey
+	roots    *x509.CertPool
+	baseURLs []string
+	client   *http.Client
+	now      func() time.Time
+
+	mu       sync.Mutex
+	bearer   string
+	issuedAt time.Time
+}
+
+// NewAppStoreVerifier creates an App Store verifier.
+func NewAppStoreVerifier(cfg AppStoreConfig) (ReceiptVerifier, error) {
+	return newAppStoreVerifier(cfg)
+}
+
+func newAppStoreVerifier(cfg AppStoreConfig) (*appStoreVerifier, error) {
+	if cfg.KeyID == "" || cfg.IssuerID == "" || cfg.BundleID == "" {
+		return nil, errors.New("appstore: APPSTORE_KEY_ID, APPSTORE_ISSUER_ID and APPSTORE_BUNDLE_ID are required")
+	}
+	if cfg.RootCAs == nil {
+		return nil, errors.New("appstore: root certificates are required")
+	}
+	if len(cfg.BaseURLs) == 0 {
+		cfg.BaseURLs = []string{AppStoreProductionURL, AppStoreSandboxURL}
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(cfg.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("appstore: parsing key: %w", err)
+	}
+	baseURLs := make([]string, len(cfg.BaseURLs))
+	for i, u := range cfg.BaseURLs {
+		baseURLs[i] = strings.TrimRight(u, "/")
+	}
+	return &appStoreVerifier{
+		keyID:    cfg.KeyID,
+		issuerID: cfg.IssuerID,
+		bundleID: cfg.BundleID,
+		key:      key,
+		roots:    cfg.RootCAs,
+		baseURLs: baseURLs,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+func (v *appStoreVerifier) Name() string {
+	return "appstore"
+}
+
+// appStoreTransaction is the payload of a JWSTransaction.
+type appStoreTransaction struct {
+	TransactionID         string `json:"transactionId"`
+	OriginalTransactionID string `json:"originalTransactionId"`
+	BundleID              string `json:"bundleId"`
+	ProductID             string `json:"productId"`
+	PurchaseDate          int64  `json:"purchaseDate"`
+	ExpiresDate           int64  `json:"expiresDate,omitempty"`
+	RevocationDate        int64  `json:"revocationDate,omitempty"`
+	Type                  string `json:"type"`
+	Environment           string `json:"environment"`
+}
+
+func (t appStoreTransaction) purchase() Purchase {
+	p := Purchase{
+		Platform:              migrations.PurchasePlatformIos,
+		TransactionID:         t.TransactionID,
+		OriginalTransactionID: t.OriginalTransactionID,
+		ProductID:             t.ProductID,
+		PurchasedAt:           millisTime(t.PurchaseDate),
+		Environment:           t.Environment,
+	}
+	if t.ExpiresDate > 0 {
+		expires := millisTime(t.ExpiresDate)
+		p.ExpiresAt = &expires
+	}
+	return p
+}
+
+func (v *appStoreVerifier) Verify(ctx context.Context, req Request) (Purchase, error) {
+	if req.TransactionID == "" {
+		return Purchase{}, fmt.Errorf("%w: missing transaction ID", ErrInvalidReceipt)
+	}
+	var signed string
+	for _, baseURL := range v.baseURLs {
+		s, err := v.lookup(ctx, baseURL, req.TransactionID)
+		if err != nil {
+			return Purchase{}, err
+		}
+		if s != "" {
+			signed = s
+			break
+		}
+	}
+	if signed == "" {
+		return Purchase{}, fmt.Errorf("%w: transaction %s not found", ErrInvalidReceipt, req.TransactionID)
+	}
+
+	var t appStoreTransaction
+	if err := verifyAppleJWS(signed, v.roots, v.now(), &t); err != nil {
+		return Purchase{}, fmt.Errorf("appstore: %w", err)
+	}
+	switch {
+	case t.BundleID != v.bundleID:
+		return Purchase{}, fmt.Errorf("%w: transaction is for bundle %q", ErrInvalidReceipt, t.BundleID)
+	case t.TransactionID != req.TransactionID:
+		return Purchase{}, fmt.Errorf("%w: transaction ID mismatch", ErrInvalidReceipt)
+	case t.ProductID != req.ProductID:
+		return Purchase{}, fmt.Errorf("%w: transaction is for product %q", ErrInvalidReceipt, t.ProductID)
+	case t.RevocationDate > 0:
+		return Purchase{}, fmt.Errorf("%w: revoked at %s", ErrRevoked, millisTime(t.RevocationDate).Format(time.RFC3339))
+	}
+	return t.purchase(), nil
+}
+
+// lookup fetches a signed transaction from one environment. It returns ""
+// if that environment doesn't know the transaction.
+func (v *appStoreVerifier) lookup(ctx context.Context, baseURL, transactionID string) (string, error) {
+	bearer, err := v.token()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/inApps/v1/transactions/"+url.PathEscape(transactionID), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("appstore: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var body struct {
+			SignedTransactionInfo string `json:"signedTransactionInfo"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil || body.SignedTransactionInfo == "" {
+			return "", errors.New("appstore: malformed transaction response")
+		}
+		return body.SignedTransactionInfo, nil
+	case http.StatusNotFound:
+		io.Copy(io.Discard, resp.Body)
+		return "", nil
+	case http.StatusBadRequest:
+		return "", fmt.Errorf("%w: appstore rejected transaction ID: %s", ErrInvalidReceipt, appStoreError(resp.Body))
+	case http.StatusUnauthorized:
+		v.mu.Lock()
+		v.bearer = ""
+		v.mu.Unlock()
+		return "", errors.New("appstore: API token rejected")
+	}
+	return "", fmt.Errorf("appstore: status %d: %s", resp.StatusCode, appStoreError(resp.Body))
+}
+
+func appStoreError(body io.Reader) string {
+	var e struct {
+		ErrorCode    int    `json:"errorCode"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	_ = json.NewDecoder(io.LimitReader(body, 64<<10)).Decode(&e)
+	return fmt.Sprintf("%d %s", e.ErrorCode, e.ErrorMessage)
+}
+
+// token returns the API bearer token, signing a new one when the cached
+// one is about to expire.
+func (v *appStoreVerifier) token() (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	if v.bearer != "" && now.Sub(v.issuedAt) < appStoreTokenRefresh {
+		return v.bearer, nil
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": v.issuerID,
+		"iat": now.Unix(),
+		"exp": now.Add(appStoreTokenLifetime).Unix(),
+		"aud": "appstoreconnect-v1",
+		"bid": v.bundleID,
+	})
+	t.Header["kid"] = v.keyID
+	signed, err := t.SignedString(v.key)
+	if err != nil {
+		return "", fmt.Errorf("appstore: signing token: %w", err)
+	}
+	v.bearer = signed
+	v.issuedAt = now
+	return signed, nil
+}
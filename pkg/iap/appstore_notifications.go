@@ -0,0 +1,124 @@
+package iap
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+)
+
+// AppStoreNotifications decodes App Store Server Notifications V2, which
+// Apple posts to the URL set in App Store Connect.
+type AppStoreNotifications struct {
+	bundleID string
+	roots    *x509.CertPool
+	now      func() time.Time
+}
+
+func newAppStoreNotifications(bundleID string, roots *x509.CertPool) *AppStoreNotifications {
+	return &AppStoreNotifications{bundleID: bundleID, roots: roots, now: time.Now}
+}
+
+// appStoreNotificationPayload is the payload of a signedPayload.
+type appStoreNotificationPayload struct {
+	NotificationType string                   `json:"notificationType"`
+	Subtype          string                   `json:"subtype,omitempty"`
+	NotificationUUID string                   `json:"notificationUUID"`
+	SignedDate       int64                    `json:"signedDate"`
+	Data             appStoreNotificationData `json:"data"`
+}
+
+type appStoreNotificationData struct {
+	BundleID              string `json:"bundleId"`
+	Environment           string `json:"environment"`
+	SignedTransactionInfo string `json:"signedTransactionInfo,omitempty"`
+	SignedRenewalInfo     string `json:"signedRenewalInfo,omitempty"`
+}
+
+// appStoreRenewalInfo is the payload of a JWSRenewalInfo.
+type appStoreRenewalInfo struct {
+	OriginalTransactionID  string `json:"originalTransactionId"`
+	GracePeriodExpiresDate int64  `json:"gracePeriodExpiresDate,omitempty"`
+}
+
+// Parse verifies and decodes a notification request body. Errors wrap
+// ErrInvalidNotification.
+func (a *AppStoreNotifications) Parse(body []byte) (Notification, error) {
+	var req struct {
+		SignedPayload string `json:"signedPayload"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.SignedPayload == "" {
+		return Notification{}, fmt.Errorf("%w: missing signedPayload", ErrInvalidNotification)
+	}
+	now := a.now()
+	var p appStoreNotificationPayload
+	if err := verifyAppleJWS(req.SignedPayload, a.roots, now, &p); err != nil {
+		return Notification{}, fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+	if p.NotificationUUID == "" {
+		return Notification{}, fmt.Errorf("%w: missing notificationUUID", ErrInvalidNotification)
+	}
+	if p.Data.BundleID != a.bundleID {
+		return Notification{}, fmt.Errorf("%w: notification is for bundle %q", ErrInvalidNotification, p.Data.BundleID)
+	}
+
+	n := Notification{
+		ID:       p.NotificationUUID,
+		Platform: migrations.PurchasePlatformIos,
+		Type:     p.NotificationType,
+		Kind:     NotificationIgnored,
+		SignedAt: now.UTC(),
+	}
+	if p.SignedDate > 0 {
+		n.SignedAt = millisTime(p.SignedDate)
+	}
+	if p.Subtype != "" {
+		n.Type += "/" + p.Subtype
+	}
+	if p.NotificationType == "TEST" {
+		n.Kind = NotificationTest
+		return n, nil
+	}
+	if p.Data.SignedTransactionInfo == "" {
+		return n, nil
+	}
+	var t appStoreTransaction
+	if err := verifyAppleJWS(p.Data.SignedTransactionInfo, a.roots, now, &t); err != nil {
+		return Notification{}, fmt.Errorf("%w: transaction: %v", ErrInvalidNotification, err)
+	}
+	if t.BundleID != a.bundleID {
+		return Notification{}, fmt.Errorf("%w: transaction is for bundle %q", ErrInvalidNotification, t.BundleID)
+	}
+	n.Purchase = t.purchase()
+	n.SubscriptionKey = t.OriginalTransactionID
+
+	switch p.NotificationType {
+	case "REFUND", "REVOKE":
+		n.Kind = NotificationRefund
+	case "SUBSCRIBED", "DID_RENEW", "DID_CHANGE_RENEWAL_STATUS", "DID_CHANGE_RENEWAL_PREF", "DID_FAIL_TO_RENEW",
+		"EXPIRED", "GRACE_PERIOD_EXPIRED", "OFFER_REDEEMED", "RENEWAL_EXTENDED", "REFUND_REVERSED":
+		if t.ExpiresDate == 0 {
+			return n, nil
+		}
+		n.Kind = NotificationSubscription
+		n.EntitledUntil = millisTime(t.ExpiresDate)
+		// Billing retry with a grace period keeps the features past expiry.
+		if p.NotificationType == "DID_FAIL_TO_RENEW" && p.Subtype == "GRACE_PERIOD" && p.Data.SignedRenewalInfo != "" {
+			var r appStoreRenewalInfo
+			if err := verifyAppleJWS(p.Data.SignedRenewalInfo, a.roots, now, &r); err != nil {
+				return Notification{}, fmt.Errorf("%w: renewal info: %v", ErrInvalidNotification, err)
+			}
+			if grace := millisTime(r.GracePeriodExpiresDate); grace.After(n.EntitledUntil) {
+				n.EntitledUntil = grace
+			}
+		}
+		if t.RevocationDate > 0 || p.NotificationType == "EXPIRED" || p.NotificationType == "GRACE_PERIOD_EXPIRED" {
+			if n.EntitledUntil.After(now) {
+				n.EntitledUntil = now.UTC()
+			}
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,55 @@
+package iap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+)
+
+// FakeVerifier accepts every purchase without asking a store. It reports
+// no expiry for subscriptions, so they last as long as the product says.
+// Tests can refuse purchases with Fail; IAP_FAKE=true uses it with Log set.
+type FakeVerifier struct {
+	Platform migrations.PurchasePlatform
+	Log      bool
+	Fail     func(req Request) error
+}
+
+func NewFakeVerifier(platform migrations.PurchasePlatform) *FakeVerifier {
+	return &FakeVerifier{Platform: platform}
+}
+
+func (f *FakeVerifier) Name() string {
+	return "fake"
+}
+
+func (f *FakeVerifier) Verify(ctx context.Context, req Request) (Purchase, error) {
+	if f.Fail != nil {
+		if err := f.Fail(req); err != nil {
+			return Purchase{}, err
+		}
+	}
+	if req.TransactionID == "" {
+		return Purchase{}, fmt.Errorf("%w: missing transaction ID", ErrInvalidReceipt)
+	}
+	now := time.Now().UTC()
+	p := Purchase{
+		Platform:              f.Platform,
+		TransactionID:         req.TransactionID,
+		OriginalTransactionID: req.TransactionID,
+		ProductID:             req.ProductID,
+		PurchasedAt:           now,
+		Environment:           "Sandbox",
+	}
+	if f.Platform == migrations.PurchasePlatformAndroid {
+		p.OriginalTransactionID = ""
+		p.PurchaseToken = req.ReceiptData
+	}
+	if f.Log {
+		log.Printf("INFO: iap (fake): accepted %s purchase %s of %s", f.Platform, req.TransactionID, req.ProductID)
+	}
+	return p, nil
+}
@@ -0,0 +1,293 @@
+package iap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAppleSigner signs JWS payloads the way the App Store does, with a
+// locally generated root, intermediate and leaf certificate.
+type fakeAppleSigner struct {
+	roots *x509.CertPool
+	x5c   []string
+	key   *ecdsa.PrivateKey
+}
+
+func newFakeAppleSigner(t *testing.T, withAppleOIDs bool) *fakeAppleSigner {
+	t.Helper()
+	now := time.Now()
+	newCert := func(serial int64, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tmpl.SerialNumber = big.NewInt(serial)
+		tmpl.NotBefore = now.Add(-time.Hour)
+		tmpl.NotAfter = now.Add(24 * time.Hour)
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert, key
+	}
+	marker := func(oid asn1.ObjectIdentifier) []pkix.Extension {
+		if !withAppleOIDs {
+			return nil
+		}
+		return []pkix.Extension{{Id: oid, Value: []byte{0x05, 0x00}}}
+	}
+
+	root, rootKey := newCert(1, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	intermediate, intermediateKey := newCert(2, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test WWDR"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtraExtensions:       marker(appleWWDRIntermediateCertOID),
+	}, root, rootKey)
+	leaf, leafKey := newCert(3, &x509.Certificate{
+		Subject:         pkix.Name{CommonName: "Test StoreKit Signing"},
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: marker(appleReceiptSigningOID),
+	}, intermediate, intermediateKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &fakeAppleSigner{
+		roots: roots,
+		x5c: []string{
+			base64.StdEncoding.EncodeToString(leaf.Raw),
+			base64.StdEncoding.EncodeToString(intermediate.Raw),
+			base64.StdEncoding.EncodeToString(root.Raw),
+		},
+		key: leafKey,
+	}
+}
+
+func (s *fakeAppleSigner) sign(t *testing.T, payload any) string {
+	t.Helper()
+	header, err := json.Marshal(jwsHeader{Alg: "ES256", X5c: s.x5c})
+	require.NoError(t, err)
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, sv, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	require.NoError(t, err)
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	sv.FillBytes(sig[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// fakeAppStore serves the App Store Server API's transaction lookup.
+type fakeAppStore struct {
+	*httptest.Server
+	mu           sync.Mutex
+	transactions map[string]appStoreTransaction
+}
+
+func newFakeAppStore(t *testing.T, signer *fakeAppleSigner, apiKey *ecdsa.PublicKey) *fakeAppStore {
+	t.Helper()
+	f := &fakeAppStore{transactions: map[string]appStoreTransaction{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims := jwt.MapClaims{}
+		if _, err := jwt.ParseWithClaims(bearer, claims, func(*jwt.Token) (any, error) { return apiKey, nil },
+			jwt.WithAudience("appstoreconnect-v1"), jwt.WithValidMethods([]string{"ES256"})); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id, ok := strings.CutPrefix(r.URL.Path, "/inApps/v1/transactions/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.mu.Lock()
+		tx, found := f.transactions[id]
+		f.mu.Unlock()
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":4040010,"errorMessage":"Transaction id not found."}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"signedTransactionInfo": signer.sign(t, tx)})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAppStore) add(tx appStoreTransaction) {
+	f.mu.Lock()
+	f.transactions[tx.TransactionID] = tx
+	f.mu.Unlock()
+}
+
+func newAppStoreAPIKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// fakePlay serves Google's token endpoint and the Play Developer API's
+// purchase lookups, keyed by purchase token.
+type fakePlay struct {
+	*httptest.Server
+	mu            sync.Mutex
+	products      map[string]playProductPurchase
+	subscriptions map[string]playSubscriptionPurchase
+}
+
+func newFakePlay(t *testing.T, packageName string) *fakePlay {
+	t.Helper()
+	f := &fakePlay{products: map[string]playProductPurchase{}, subscriptions: map[string]playSubscriptionPurchase{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "ya29.play", "expires_in": 3600})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer ya29.play" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		prefix := "/androidpublisher/v3/applications/" + packageName + "/purchases/"
+		rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		parts := strings.Split(rest, "/")
+		var found any
+		switch {
+		case len(parts) == 4 && parts[0] == "products" && parts[2] == "tokens":
+			if p, ok := f.products[parts[3]+"|"+parts[1]]; ok {
+				found = p
+			}
+		case len(parts) == 3 && parts[0] == "subscriptionsv2" && parts[1] == "tokens":
+			if s, ok := f.subscriptions[parts[2]]; ok {
+				found = s
+			}
+		}
+		if found == nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND","message":"The purchase token was not found."}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(found)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakePlay) addProduct(token, productID string, p playProductPurchase) {
+	f.mu.Lock()
+	f.products[token+"|"+productID] = p
+	f.mu.Unlock()
+}
+
+func (f *fakePlay) addSubscription(token string, s playSubscriptionPurchase) {
+	f.mu.Lock()
+	f.subscriptions[token] = s
+	f.mu.Unlock()
+}
+
+func newPlayServiceAccount(t *testing.T, tokenURI string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	sa, err := json.Marshal(googleServiceAccount{
+		ClientEmail: "iap@peeple-test.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		TokenURI:    tokenURI,
+	})
+	require.NoError(t, err)
+	return sa
+}
+
+// fakeGoogleOIDC serves a signing key set and signs Pub/Sub push tokens.
+type fakeGoogleOIDC struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newFakeGoogleOIDC(t *testing.T) *fakeGoogleOIDC {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f := &fakeGoogleOIDC{key: key}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "google-1",
+			"kty": "RSA",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// pushToken signs a token like the one Pub/Sub sends for audience as email.
+func (f *fakeGoogleOIDC) pushToken(t *testing.T, audience, email string) string {
+	t.Helper()
+	now := time.Now()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            audience,
+		"email":          email,
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	})
+	tok.Header["kid"] = "google-1"
+	signed, err := tok.SignedString(f.key)
+	require.NoError(t, err)
+	return "Bearer " + signed
+}
+
+// playPushBody wraps a developer notification in a Pub/Sub push request.
+func playPushBody(t *testing.T, messageID string, notification any) []byte {
+	t.Helper()
+	data, err := json.Marshal(notification)
+	require.NoError(t, err)
+	body, err := json.Marshal(map[string]any{
+		"message": map[string]string{
+			"data":      base64.StdEncoding.EncodeToString(data),
+			"messageId": messageID,
+		},
+		"subscription": "projects/peeple-test/subscriptions/play-rtdn",
+	})
+	require.NoError(t, err)
+	return body
+}
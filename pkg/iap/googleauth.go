@@ -0,0 +1,121 @@
+package iap
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	googleDefaultTokenURI = "https://oauth2.googleapis.com/token"
+	// Access tokens are refreshed this long before they expire.
+	googleTokenRefreshMargin = 5 * time.Minute
+)
+
+type googleServiceAccount struct {
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// googleTokenSource exchanges signed service account assertions for OAuth
+// access tokens and caches them.
+type googleTokenSource struct {
+	account googleServiceAccount
+	key     *rsa.PrivateKey
+	scope   string
+	client  *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func newGoogleTokenSource(serviceAccountJSON []byte, scope string, client *http.Client) (*googleTokenSource, error) {
+	var sa googleServiceAccount
+	if err := json.Unmarshal(serviceAccountJSON, &sa); err != nil {
+		return nil, fmt.Errorf("parsing service account: %w", err)
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("service account needs client_email and private_key")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = googleDefaultTokenURI
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+	return &googleTokenSource{account: sa, key: key, scope: scope, client: client}, nil
+}
+
+// token returns a cached access token, exchanging a fresh assertion for one
+// when it is about to expire.
+func (s *googleTokenSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && time.Until(s.expiresAt) > googleTokenRefreshMargin {
+		return s.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.account.ClientEmail,
+		"scope": s.scope,
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if s.account.PrivateKeyID != "" {
+		assertion.Header["kid"] = s.account.PrivateKeyID
+	}
+	signed, err := assertion.SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("signing assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signed},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token exchange: status %d", resp.StatusCode)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil || tok.AccessToken == "" {
+		return "", errors.New("token exchange: malformed response")
+	}
+	s.accessToken = tok.AccessToken
+	s.expiresAt = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return s.accessToken, nil
+}
+
+// invalidate drops the cached token after the API rejected it.
+func (s *googleTokenSource) invalidate() {
+	s.mu.Lock()
+	s.accessToken = ""
+	s.mu.Unlock()
+}
@@ -0,0 +1,156 @@
+// Package iap verifies in-app purchases with the App Store and Google Play
+// before the features they pay for are granted.
+package iap
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+)
+
+var (
+	// ErrInvalidReceipt means the store doesn't know the purchase, it isn't
+	// paid for, or it doesn't match what the app reported. Retrying won't
+	// help.
+	ErrInvalidReceipt = errors.New("iap: invalid receipt")
+	// ErrRevoked means the purchase was refunded or revoked.
+	ErrRevoked = errors.New("iap: purchase revoked")
+)
+
+// Request is a purchase as reported by the app.
+type Request struct {
+	ProductID string
+	// TransactionID is the App Store transaction ID or the Play order ID.
+	TransactionID string
+	// ReceiptData is the Play purchase token. The App Store verifier looks
+	// the transaction up by ID and ignores it.
+	ReceiptData  string
+	Subscription bool
+}
+
+// Purchase is a purchase as the store reports it.
+type Purchase struct {
+	Platform      migrations.PurchasePlatform
+	TransactionID string
+	// OriginalTransactionID ties App Store renewals to the first purchase
+	// of a subscription. Play identifies a subscription by PurchaseToken.
+	OriginalTransactionID string
+	PurchaseToken         string
+	ProductID             string
+	PurchasedAt           time.Time
+	ExpiresAt             *time.Time // subscriptions only
+	Environment           string     // "Production" or "Sandbox"
+}
+
+// ReceiptVerifier checks a purchase with one store. Errors other than
+// ErrInvalidReceipt and ErrRevoked (possibly wrapped) mean the store could
+// not be asked and the app should retry.
+type ReceiptVerifier interface {
+	Name() string
+	Verify(ctx context.Context, req Request) (Purchase, error)
+}
+
+// Verifiers maps each platform to its store's verifier. Purchases from a
+// platform without one are refused.
+type Verifiers map[migrations.PurchasePlatform]ReceiptVerifier
+
+// NewVerifiersFromEnv configures the verifiers whose credentials are set:
+//
+//   - APPSTORE_KEY_FILE, APPSTORE_KEY_ID, APPSTORE_ISSUER_ID,
+//     APPSTORE_BUNDLE_ID, APPSTORE_ROOT_CA_FILE: App Store Server API key
+//     (.p8) and the Apple Root CA - G3 certificate, for iOS.
+//     APPSTORE_SANDBOX=true looks transactions up in the sandbox only.
+//   - PLAY_SERVICE_ACCOUNT_FILE, PLAY_PACKAGE_NAME: a service account with
+//     access to the Play Developer API, for Android.
+//   - IAP_FAKE=true: accept every purchase, for both. Refused unless
+//     APP_ENV=development.
+func NewVerifiersFromEnv() (Verifiers, error) {
+	verifiers := Verifiers{}
+	if fake, _ := strconv.ParseBool(os.Getenv("IAP_FAKE")); fake {
+		if os.Getenv("APP_ENV") != "development" {
+			return nil, errors.New("IAP_FAKE requires APP_ENV=development")
+		}
+		for _, platform := range []migrations.PurchasePlatform{migrations.PurchasePlatformIos, migrations.PurchasePlatformAndroid} {
+			f := NewFakeVerifier(platform)
+			f.Log = true
+			verifiers[platform] = f
+		}
+		return verifiers, nil
+	}
+
+	if path := os.Getenv("APPSTORE_KEY_FILE"); path != "" {
+		keyPEM, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading APPSTORE_KEY_FILE: %w", err)
+		}
+		roots, err := loadRootCAs(os.Getenv("APPSTORE_ROOT_CA_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		baseURLs := []string{AppStoreProductionURL, AppStoreSandboxURL}
+		if sandbox, _ := strconv.ParseBool(os.Getenv("APPSTORE_SANDBOX")); sandbox {
+			baseURLs = []string{AppStoreSandboxURL}
+		}
+		v, err := NewAppStoreVerifier(AppStoreConfig{
+			KeyPEM:   keyPEM,
+			KeyID:    os.Getenv("APPSTORE_KEY_ID"),
+			IssuerID: os.Getenv("APPSTORE_ISSUER_ID"),
+			BundleID: os.Getenv("APPSTORE_BUNDLE_ID"),
+			RootCAs:  roots,
+			BaseURLs: baseURLs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		verifiers[migrations.PurchasePlatformIos] = v
+	}
+
+	if path := os.Getenv("PLAY_SERVICE_ACCOUNT_FILE"); path != "" {
+		keyJSON, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading PLAY_SERVICE_ACCOUNT_FILE: %w", err)
+		}
+		v, err := NewPlayVerifier(keyJSON, os.Getenv("PLAY_PACKAGE_NAME"))
+		if err != nil {
+			return nil, err
+		}
+		verifiers[migrations.PurchasePlatformAndroid] = v
+	}
+
+	for platform, v := range verifiers {
+		log.Printf("Receipt verifier for %s: %s", platform, v.Name())
+	}
+	return verifiers, nil
+}
+
+// loadRootCAs reads a certificate file in PEM or DER form.
+func loadRootCAs(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, errors.New("APPSTORE_ROOT_CA_FILE is required to verify App Store signatures")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading APPSTORE_ROOT_CA_FILE: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if block, _ := pem.Decode(data); block != nil {
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("APPSTORE_ROOT_CA_FILE: no certificates found")
+		}
+		return pool, nil
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("APPSTORE_ROOT_CA_FILE: %w", err)
+	}
+	pool.AddCert(cert)
+	return pool, nil
+}
@@ -0,0 +1,86 @@
+package iap
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+)
+
+// ErrInvalidNotification means a store notification is malformed, isn't
+// signed by the store or is for another app. Redelivering it won't help.
+var ErrInvalidNotification = errors.New("iap: invalid notification")
+
+// NotificationKind says what a store notification means for entitlements.
+type NotificationKind string
+
+const (
+	// NotificationSubscription reports a subscription's new state: renewed,
+	// expired, in a grace period and so on. Its entitlement now ends at
+	// Notification.EntitledUntil.
+	NotificationSubscription NotificationKind = "subscription"
+	// NotificationRefund reports that Purchase was refunded or revoked.
+	NotificationRefund NotificationKind = "refund"
+	// NotificationTest is sent from the store's console to check the
+	// endpoint.
+	NotificationTest NotificationKind = "test"
+	// NotificationIgnored doesn't change entitlements.
+	NotificationIgnored NotificationKind = "ignored"
+)
+
+// Notification is a verified server-to-server notification from a store.
+type Notification struct {
+	// ID is unique per notification and repeated on redelivery.
+	ID       string
+	Platform migrations.PurchasePlatform
+	// Type is the store's name for the notification, like DID_RENEW or
+	// SUBSCRIPTION_RENEWED.
+	Type string
+	Kind NotificationKind
+	// Purchase is the transaction the notification is about; for
+	// subscriptions, the latest one.
+	Purchase Purchase
+	// SubscriptionKey identifies a subscription across renewals: the App
+	// Store original transaction ID or the Play purchase token.
+	SubscriptionKey string
+	// EntitledUntil is when a subscription's features end given its new
+	// state. It is not after the notification arrived if they already have.
+	EntitledUntil time.Time
+	// SignedAt is when the store produced the state n carries: the App
+	// Store's signedDate, or when a Play subscription was looked up. Stores
+	// don't deliver in order, so older states must not replace newer ones.
+	SignedAt time.Time
+}
+
+// Notifications holds the decoders for the stores that send notifications.
+// A nil decoder means that store's endpoint is disabled.
+type Notifications struct {
+	AppStore *AppStoreNotifications
+	Play     *PlayNotifications
+}
+
+// NewNotificationsFromEnv configures notifications for the stores verifiers
+// talks to. App Store notifications are checked with the verifier's bundle
+// ID and root certificates. Play notifications arrive by Pub/Sub push and
+// need PLAY_RTDN_AUDIENCE, the audience set on the push subscription, and
+// PLAY_RTDN_SERVICE_ACCOUNT, the service account it authenticates as.
+func NewNotificationsFromEnv(verifiers Verifiers) Notifications {
+	var n Notifications
+	if v, ok := verifiers[migrations.PurchasePlatformIos].(*appStoreVerifier); ok {
+		n.AppStore = newAppStoreNotifications(v.bundleID, v.roots)
+		log.Println("App Store server notifications enabled.")
+	}
+	if v, ok := verifiers[migrations.PurchasePlatformAndroid].(*playVerifier); ok {
+		audience := os.Getenv("PLAY_RTDN_AUDIENCE")
+		email := os.Getenv("PLAY_RTDN_SERVICE_ACCOUNT")
+		if audience == "" || email == "" {
+			log.Println("Play real-time developer notifications disabled: PLAY_RTDN_AUDIENCE and PLAY_RTDN_SERVICE_ACCOUNT are required.")
+			return n
+		}
+		n.Play = newPlayNotifications(v, newPubSubAuth(audience, email, GoogleCertsURL, v.client))
+		log.Println("Play real-time developer notifications enabled.")
+	}
+	return n
+}
@@ -0,0 +1,225 @@
+package iap
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signedNotification(t *testing.T, signer *fakeAppleSigner, p appStoreNotificationPayload) []byte {
+	t.Helper()
+	body, err := json.Marshal(map[string]string{"signedPayload": signer.sign(t, p)})
+	require.NoError(t, err)
+	return body
+}
+
+func TestAppStoreNotifications(t *testing.T) {
+	signer := newFakeAppleSigner(t, true)
+	notifications := newAppStoreNotifications(testBundleID, signer.roots)
+
+	purchased := time.Now().Add(-time.Hour).Truncate(time.Millisecond).UTC()
+	expires := purchased.Add(7 * 24 * time.Hour)
+	renewal := appStoreTransaction{TransactionID: "2001", OriginalTransactionID: "2000", BundleID: testBundleID,
+		ProductID: "com.peeple.unlimited_likes_1week", PurchaseDate: purchased.UnixMilli(), ExpiresDate: expires.UnixMilli(),
+		Type: "Auto-Renewable Subscription", Environment: "Production"}
+	signed := time.Now().Add(-time.Minute).Truncate(time.Millisecond).UTC()
+	notification := func(notificationType, subtype string, tx appStoreTransaction) appStoreNotificationPayload {
+		return appStoreNotificationPayload{
+			NotificationType: notificationType,
+			Subtype:          subtype,
+			NotificationUUID: "uuid-" + notificationType,
+			SignedDate:       signed.UnixMilli(),
+			Data: appStoreNotificationData{
+				BundleID:              tx.BundleID,
+				Environment:           "Production",
+				SignedTransactionInfo: signer.sign(t, tx),
+			},
+		}
+	}
+
+	n, err := notifications.Parse(signedNotification(t, signer, notification("DID_RENEW", "", renewal)))
+	require.NoError(t, err)
+	assert.Equal(t, "uuid-DID_RENEW", n.ID)
+	assert.Equal(t, migrations.PurchasePlatformIos, n.Platform)
+	assert.Equal(t, NotificationSubscription, n.Kind)
+	assert.Equal(t, "2001", n.Purchase.TransactionID)
+	assert.Equal(t, "2000", n.SubscriptionKey)
+	assert.True(t, expires.Equal(n.EntitledUntil))
+	assert.True(t, signed.Equal(n.SignedAt), "ordered by the App Store's signedDate")
+
+	expired := renewal
+	expired.ExpiresDate = time.Now().Add(-time.Minute).UnixMilli()
+	n, err = notifications.Parse(signedNotification(t, signer, notification("EXPIRED", "VOLUNTARY", expired)))
+	require.NoError(t, err)
+	assert.Equal(t, "EXPIRED/VOLUNTARY", n.Type)
+	assert.Equal(t, NotificationSubscription, n.Kind)
+	assert.False(t, n.EntitledUntil.After(time.Now()))
+
+	grace := notification("DID_FAIL_TO_RENEW", "GRACE_PERIOD", expired)
+	graceEnds := time.Now().Add(3 * 24 * time.Hour).Truncate(time.Millisecond)
+	grace.Data.SignedRenewalInfo = signer.sign(t, appStoreRenewalInfo{OriginalTransactionID: "2000", GracePeriodExpiresDate: graceEnds.UnixMilli()})
+	n, err = notifications.Parse(signedNotification(t, signer, grace))
+	require.NoError(t, err)
+	assert.True(t, graceEnds.Equal(n.EntitledUntil), "grace period extends the entitlement")
+
+	consumable := appStoreTransaction{TransactionID: "1000", OriginalTransactionID: "1000", BundleID: testBundleID,
+		ProductID: "com.peeple.rose_pack_5", PurchaseDate: purchased.UnixMilli(), RevocationDate: time.Now().UnixMilli()}
+	n, err = notifications.Parse(signedNotification(t, signer, notification("REFUND", "", consumable)))
+	require.NoError(t, err)
+	assert.Equal(t, NotificationRefund, n.Kind)
+	assert.Equal(t, "1000", n.Purchase.TransactionID)
+
+	n, err = notifications.Parse(signedNotification(t, signer, notification("CONSUMPTION_REQUEST", "", consumable)))
+	require.NoError(t, err)
+	assert.Equal(t, NotificationIgnored, n.Kind)
+
+	n, err = notifications.Parse(signedNotification(t, signer, appStoreNotificationPayload{
+		NotificationType: "TEST", NotificationUUID: "uuid-test", Data: appStoreNotificationData{BundleID: testBundleID},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, NotificationTest, n.Kind)
+}
+
+func TestAppStoreNotificationsRejectsForgeries(t *testing.T) {
+	signer := newFakeAppleSigner(t, true)
+	notifications := newAppStoreNotifications(testBundleID, signer.roots)
+	tx := appStoreTransaction{TransactionID: "1000", BundleID: testBundleID, ProductID: "com.peeple.rose_pack_5"}
+	payload := appStoreNotificationPayload{
+		NotificationType: "REFUND",
+		NotificationUUID: "uuid-1",
+		Data:             appStoreNotificationData{BundleID: testBundleID, SignedTransactionInfo: signer.sign(t, tx)},
+	}
+
+	impostor := newFakeAppleSigner(t, true)
+	_, err := notifications.Parse(signedNotification(t, impostor, payload))
+	assert.ErrorIs(t, err, ErrInvalidNotification, "payload signed by another root")
+
+	forged := payload
+	forged.Data.SignedTransactionInfo = impostor.sign(t, tx)
+	_, err = notifications.Parse(signedNotification(t, signer, forged))
+	assert.ErrorIs(t, err, ErrInvalidNotification, "transaction signed by another root")
+
+	otherApp := payload
+	otherApp.Data.BundleID = "com.other.app"
+	_, err = notifications.Parse(signedNotification(t, signer, otherApp))
+	assert.ErrorIs(t, err, ErrInvalidNotification, "another app's notification")
+
+	_, err = notifications.Parse([]byte(`{"signedPayload":""}`))
+	assert.ErrorIs(t, err, ErrInvalidNotification)
+}
+
+const (
+	testPushAudience = "https://api.peeple.test/api/iap/notifications/play"
+	testPushEmail    = "rtdn@peeple-test.iam.gserviceaccount.com"
+)
+
+func newTestPlayNotifications(t *testing.T) (*PlayNotifications, *fakePlay, *fakeGoogleOIDC) {
+	t.Helper()
+	play := newFakePlay(t, testBundleID)
+	oidc := newFakeGoogleOIDC(t)
+	v, err := newPlayVerifier(newPlayServiceAccount(t, play.URL+"/token"), testBundleID, play.URL)
+	require.NoError(t, err)
+	return newPlayNotifications(v, newPubSubAuth(testPushAudience, testPushEmail, oidc.URL, v.client)), play, oidc
+}
+
+func TestPlayNotifications(t *testing.T) {
+	notifications, play, oidc := newTestPlayNotifications(t)
+	auth := oidc.pushToken(t, testPushAudience, testPushEmail)
+	ctx := context.Background()
+
+	expiry := time.Now().Add(7 * 24 * time.Hour).UTC().Truncate(time.Second)
+	play.addSubscription("sub-1", playSubscriptionPurchase{
+		StartTime:         time.Now().Add(-7 * 24 * time.Hour).UTC().Truncate(time.Second),
+		SubscriptionState: "SUBSCRIPTION_STATE_ACTIVE",
+		LatestOrderID:     "GPA.5555..1",
+		LineItems:         []playLineItem{{ProductID: "com.peeple.unlimited_likes_1week", ExpiryTime: expiry}},
+	})
+	play.addSubscription("sub-on-hold", playSubscriptionPurchase{
+		SubscriptionState: "SUBSCRIPTION_STATE_ON_HOLD",
+		LatestOrderID:     "GPA.6666",
+		LineItems:         []playLineItem{{ProductID: "com.peeple.unlimited_likes_1week", ExpiryTime: expiry}},
+	})
+	subscriptionNotification := func(notificationType int, token string) map[string]any {
+		return map[string]any{
+			"version":     "1.0",
+			"packageName": testBundleID,
+			"subscriptionNotification": map[string]any{
+				"version":          "1.0",
+				"notificationType": notificationType,
+				"purchaseToken":    token,
+				"subscriptionId":   "com.peeple.unlimited_likes_1week",
+			},
+		}
+	}
+
+	n, err := notifications.Parse(ctx, auth, playPushBody(t, "msg-1", subscriptionNotification(2, "sub-1")))
+	require.NoError(t, err)
+	assert.Equal(t, "msg-1", n.ID)
+	assert.Equal(t, migrations.PurchasePlatformAndroid, n.Platform)
+	assert.Equal(t, "SUBSCRIPTION_RENEWED", n.Type)
+	assert.Equal(t, NotificationSubscription, n.Kind)
+	assert.Equal(t, "GPA.5555..1", n.Purchase.TransactionID)
+	assert.Equal(t, "sub-1", n.SubscriptionKey)
+	assert.True(t, expiry.Equal(n.EntitledUntil))
+	assert.False(t, n.SignedAt.IsZero(), "ordered by when the state was looked up")
+
+	n, err = notifications.Parse(ctx, auth, playPushBody(t, "msg-2", subscriptionNotification(5, "sub-on-hold")))
+	require.NoError(t, err)
+	assert.Equal(t, NotificationSubscription, n.Kind)
+	assert.False(t, n.EntitledUntil.After(time.Now()), "on hold subscriptions lose their features")
+
+	n, err = notifications.Parse(ctx, auth, playPushBody(t, "msg-3", subscriptionNotification(12, "sub-1")))
+	require.NoError(t, err)
+	assert.Equal(t, NotificationRefund, n.Kind)
+	assert.Equal(t, "GPA.5555..1", n.Purchase.TransactionID)
+
+	n, err = notifications.Parse(ctx, auth, playPushBody(t, "msg-4", map[string]any{
+		"packageName": testBundleID,
+		"voidedPurchaseNotification": map[string]any{
+			"purchaseToken": "tok-1",
+			"orderId":       "GPA.1111",
+			"productType":   2,
+		},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, NotificationRefund, n.Kind)
+	assert.Equal(t, "GPA.1111", n.Purchase.TransactionID)
+	assert.Empty(t, n.SubscriptionKey)
+
+	n, err = notifications.Parse(ctx, auth, playPushBody(t, "msg-5", map[string]any{
+		"packageName": testBundleID, "testNotification": map[string]any{"version": "1.0"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, NotificationTest, n.Kind)
+
+	_, err = notifications.Parse(ctx, auth, playPushBody(t, "msg-6", subscriptionNotification(2, "unknown-token")))
+	assert.ErrorIs(t, err, ErrInvalidNotification)
+}
+
+func TestPlayNotificationsRejectsUnauthenticatedPushes(t *testing.T) {
+	notifications, _, oidc := newTestPlayNotifications(t)
+	ctx := context.Background()
+	body := playPushBody(t, "msg-1", map[string]any{"packageName": testBundleID, "testNotification": map[string]any{}})
+
+	cases := map[string]string{
+		"no token":          "",
+		"other audience":    oidc.pushToken(t, "https://elsewhere.test", testPushEmail),
+		"other account":     oidc.pushToken(t, testPushAudience, "someone@peeple-test.iam.gserviceaccount.com"),
+		"other signing key": newFakeGoogleOIDC(t).pushToken(t, testPushAudience, testPushEmail),
+	}
+	for name, auth := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := notifications.Parse(ctx, auth, body)
+			assert.ErrorIs(t, err, ErrInvalidNotification)
+		})
+	}
+
+	otherApp := playPushBody(t, "msg-2", map[string]any{"packageName": "com.other.app", "testNotification": map[string]any{}})
+	_, err := notifications.Parse(ctx, oidc.pushToken(t, testPushAudience, testPushEmail), otherApp)
+	assert.ErrorIs(t, err, ErrInvalidNotification)
+}
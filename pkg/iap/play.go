@@ -0,0 +1,240 @@
+package iap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+)
+
+const (
+	PlayEndpoint = "https://androidpublisher.googleapis.com"
+	playScope    = "https://www.googleapis.com/auth/androidpublisher"
+)
+
+// playVerifier looks purchases up with the Google Play Developer API. The
+// app acknowledges or consumes them through Play Billing once the server
+// has granted the purchase.
+type playVerifier struct {
+	packageName string
+	endpoint    string
+	auth        *googleTokenSource
+	client      *http.Client
+}
+
+// NewPlayVerifier creates a Play verifier from a service account JSON key
+// with access to packageName in the Play Console.
+func NewPlayVerifier(serviceAccountJSON []byte, packageName string) (ReceiptVerifier, error) {
+	return newPlayVerifier(serviceAccountJSON, packageName, PlayEndpoint)
+}
+
+func newPlayVerifier(serviceAccountJSON []byte, packageName, endpoint string) (*playVerifier, error) {
+	if packageName == "" {
+		return nil, errors.New("play: PLAY_PACKAGE_NAME is required")
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	auth, err := newGoogleTokenSource(serviceAccountJSON, playScope, client)
+	if err != nil {
+		return nil, fmt.Errorf("play: %w", err)
+	}
+	return &playVerifier{
+		packageName: packageName,
+		endpoint:    strings.TrimRight(endpoint, "/"),
+		auth:        auth,
+		client:      client,
+	}, nil
+}
+
+func (v *playVerifier) Name() string {
+	return "play"
+}
+
+// playProductPurchase is a ProductPurchase resource.
+type playProductPurchase struct {
+	PurchaseTimeMillis string `json:"purchaseTimeMillis"`
+	PurchaseState      int    `json:"purchaseState"` // 0 purchased, 1 cancelled, 2 pending
+	OrderID            string `json:"orderId"`
+	PurchaseType       *int   `json:"purchaseType"` // set for test, promo and rewarded purchases
+}
+
+// playSubscriptionPurchase is a SubscriptionPurchaseV2 resource.
+type playSubscriptionPurchase struct {
+	StartTime         time.Time      `json:"startTime"`
+	SubscriptionState string         `json:"subscriptionState"`
+	LatestOrderID     string         `json:"latestOrderId"`
+	LineItems         []playLineItem `json:"lineItems"`
+	TestPurchase      *struct{}      `json:"testPurchase,omitempty"`
+}
+
+type playLineItem struct {
+	ProductID  string    `json:"productId"`
+	ExpiryTime time.Time `json:"expiryTime"`
+}
+
+func (v *playVerifier) Verify(ctx context.Context, req Request) (Purchase, error) {
+	if req.ReceiptData == "" {
+		return Purchase{}, fmt.Errorf("%w: missing purchase token", ErrInvalidReceipt)
+	}
+	if req.Subscription {
+		return v.verifySubscription(ctx, req)
+	}
+	return v.verifyProduct(ctx, req)
+}
+
+func (v *playVerifier) verifyProduct(ctx context.Context, req Request) (Purchase, error) {
+	var p playProductPurchase
+	path := fmt.Sprintf("/androidpublisher/v3/applications/%s/purchases/products/%s/tokens/%s",
+		url.PathEscape(v.packageName), url.PathEscape(req.ProductID), url.PathEscape(req.ReceiptData))
+	if err := v.get(ctx, path, &p); err != nil {
+		return Purchase{}, err
+	}
+	if p.PurchaseState != 0 {
+		return Purchase{}, fmt.Errorf("%w: purchase state %d", ErrInvalidReceipt, p.PurchaseState)
+	}
+	if req.TransactionID != "" && p.OrderID != "" && p.OrderID != req.TransactionID {
+		return Purchase{}, fmt.Errorf("%w: order ID mismatch", ErrInvalidReceipt)
+	}
+	millis, _ := strconv.ParseInt(p.PurchaseTimeMillis, 10, 64)
+	purchase := Purchase{
+		Platform:      migrations.PurchasePlatformAndroid,
+		TransactionID: playTransactionID(p.OrderID, req.ReceiptData),
+		PurchaseToken: req.ReceiptData,
+		ProductID:     req.ProductID,
+		PurchasedAt:   time.UnixMilli(millis).UTC(),
+		Environment:   "Production",
+	}
+	if p.PurchaseType != nil && *p.PurchaseType == 0 {
+		purchase.Environment = "Sandbox"
+	}
+	return purchase, nil
+}
+
+func (v *playVerifier) verifySubscription(ctx context.Context, req Request) (Purchase, error) {
+	s, err := v.subscription(ctx, req.ReceiptData)
+	if err != nil {
+		return Purchase{}, err
+	}
+	if !s.entitled() {
+		return Purchase{}, fmt.Errorf("%w: subscription state %s", ErrInvalidReceipt, s.SubscriptionState)
+	}
+	// Renewals get order IDs "<first order>..N"; the app may report either.
+	if req.TransactionID != "" && s.LatestOrderID != "" &&
+		s.LatestOrderID != req.TransactionID && !strings.HasPrefix(s.LatestOrderID, req.TransactionID+"..") {
+		return Purchase{}, fmt.Errorf("%w: order ID mismatch", ErrInvalidReceipt)
+	}
+	purchase, ok := s.purchase(req.ProductID, req.ReceiptData)
+	if !ok {
+		return Purchase{}, fmt.Errorf("%w: subscription is not for product %q", ErrInvalidReceipt, req.ProductID)
+	}
+	if !purchase.ExpiresAt.After(time.Now()) {
+		return Purchase{}, fmt.Errorf("%w: subscription expired at %s", ErrInvalidReceipt, purchase.ExpiresAt.Format(time.RFC3339))
+	}
+	return purchase, nil
+}
+
+func (v *playVerifier) subscription(ctx context.Context, purchaseToken string) (playSubscriptionPurchase, error) {
+	var s playSubscriptionPurchase
+	path := fmt.Sprintf("/androidpublisher/v3/applications/%s/purchases/subscriptionsv2/tokens/%s",
+		url.PathEscape(v.packageName), url.PathEscape(purchaseToken))
+	err := v.get(ctx, path, &s)
+	return s, err
+}
+
+// entitled reports whether the subscription still grants its features.
+// Cancelled subscriptions stay entitled until they expire.
+func (s playSubscriptionPurchase) entitled() bool {
+	switch s.SubscriptionState {
+	case "SUBSCRIPTION_STATE_ACTIVE", "SUBSCRIPTION_STATE_IN_GRACE_PERIOD", "SUBSCRIPTION_STATE_CANCELED":
+		return true
+	}
+	return false
+}
+
+// purchase describes the subscription's latest order of productID. It
+// reports false if the subscription has no line item for productID.
+func (s playSubscriptionPurchase) purchase(productID, purchaseToken string) (Purchase, bool) {
+	var expiresAt *time.Time
+	for _, item := range s.LineItems {
+		if item.ProductID == productID {
+			t := item.ExpiryTime.UTC()
+			expiresAt = &t
+		}
+	}
+	if expiresAt == nil {
+		return Purchase{}, false
+	}
+	purchase := Purchase{
+		Platform:      migrations.PurchasePlatformAndroid,
+		TransactionID: playTransactionID(s.LatestOrderID, purchaseToken),
+		PurchaseToken: purchaseToken,
+		ProductID:     productID,
+		PurchasedAt:   s.StartTime.UTC(),
+		ExpiresAt:     expiresAt,
+		Environment:   "Production",
+	}
+	if s.TestPurchase != nil {
+		purchase.Environment = "Sandbox"
+	}
+	return purchase, true
+}
+
+// playTransactionID is the order ID, or the purchase token for license
+// tester purchases, which have none.
+func playTransactionID(orderID, purchaseToken string) string {
+	if orderID != "" {
+		return orderID
+	}
+	return purchaseToken
+}
+
+func (v *playVerifier) get(ctx context.Context, path string, out any) error {
+	accessToken, err := v.auth.token(ctx)
+	if err != nil {
+		return fmt.Errorf("play: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("play: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out); err != nil {
+			return fmt.Errorf("play: malformed response: %w", err)
+		}
+		return nil
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusGone:
+		// Unknown, malformed or expired purchase tokens.
+		return fmt.Errorf("%w: play status %d: %s", ErrInvalidReceipt, resp.StatusCode, playError(resp.Body))
+	case http.StatusUnauthorized:
+		v.auth.invalidate()
+		return errors.New("play: access token rejected")
+	}
+	return fmt.Errorf("play: status %d: %s", resp.StatusCode, playError(resp.Body))
+}
+
+func playError(body io.Reader) string {
+	var e struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.NewDecoder(io.LimitReader(body, 64<<10)).Decode(&e)
+	return strings.TrimSpace(e.Error.Status + " " + e.Error.Message)
+}
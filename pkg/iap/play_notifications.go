@@ -0,0 +1,161 @@
+package iap
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+)
+
+// PlayNotifications decodes Google Play real-time developer notifications,
+// delivered by an authenticated Pub/Sub push subscription. Subscription
+// notifications only carry a purchase token, so their state is looked up
+// with the Play Developer API.
+type PlayNotifications struct {
+	verifier *playVerifier
+	auth     *pubSubAuth
+	now      func() time.Time
+}
+
+func newPlayNotifications(verifier *playVerifier, auth *pubSubAuth) *PlayNotifications {
+	return &PlayNotifications{verifier: verifier, auth: auth, now: time.Now}
+}
+
+// playSubscriptionNotificationTypes names SubscriptionNotification types.
+var playSubscriptionNotificationTypes = map[int]string{
+	1:  "SUBSCRIPTION_RECOVERED",
+	2:  "SUBSCRIPTION_RENEWED",
+	3:  "SUBSCRIPTION_CANCELED",
+	4:  "SUBSCRIPTION_PURCHASED",
+	5:  "SUBSCRIPTION_ON_HOLD",
+	6:  "SUBSCRIPTION_IN_GRACE_PERIOD",
+	7:  "SUBSCRIPTION_RESTARTED",
+	8:  "SUBSCRIPTION_PRICE_CHANGE_CONFIRMED",
+	9:  "SUBSCRIPTION_DEFERRED",
+	10: "SUBSCRIPTION_PAUSED",
+	11: "SUBSCRIPTION_PAUSE_SCHEDULE_CHANGED",
+	12: "SUBSCRIPTION_REVOKED",
+	13: "SUBSCRIPTION_EXPIRED",
+}
+
+const playSubscriptionRevoked = 12
+
+// playPushRequest is the body of a Pub/Sub push request.
+type playPushRequest struct {
+	Message struct {
+		Data      string `json:"data"`
+		MessageID string `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// playDeveloperNotification is the message data of a notification.
+type playDeveloperNotification struct {
+	PackageName              string `json:"packageName"`
+	SubscriptionNotification *struct {
+		NotificationType int    `json:"notificationType"`
+		PurchaseToken    string `json:"purchaseToken"`
+		SubscriptionID   string `json:"subscriptionId"`
+	} `json:"subscriptionNotification,omitempty"`
+	OneTimeProductNotification *struct {
+		NotificationType int    `json:"notificationType"`
+		PurchaseToken    string `json:"purchaseToken"`
+		SKU              string `json:"sku"`
+	} `json:"oneTimeProductNotification,omitempty"`
+	VoidedPurchaseNotification *struct {
+		PurchaseToken string `json:"purchaseToken"`
+		OrderID       string `json:"orderId"`
+		ProductType   int    `json:"productType"` // 1 subscription, 2 one-time
+	} `json:"voidedPurchaseNotification,omitempty"`
+	TestNotification *struct{} `json:"testNotification,omitempty"`
+}
+
+// Parse authenticates and decodes a push request. Errors wrap
+// ErrInvalidNotification unless Google could not be reached.
+func (p *PlayNotifications) Parse(ctx context.Context, authorization string, body []byte) (Notification, error) {
+	if err := p.auth.verify(ctx, authorization); err != nil {
+		return Notification{}, err
+	}
+	var push playPushRequest
+	if err := json.Unmarshal(body, &push); err != nil || push.Message.MessageID == "" {
+		return Notification{}, fmt.Errorf("%w: malformed push request", ErrInvalidNotification)
+	}
+	data, err := base64.StdEncoding.DecodeString(push.Message.Data)
+	if err != nil {
+		return Notification{}, fmt.Errorf("%w: message data: %v", ErrInvalidNotification, err)
+	}
+	var dn playDeveloperNotification
+	if err := json.Unmarshal(data, &dn); err != nil {
+		return Notification{}, fmt.Errorf("%w: message data: %v", ErrInvalidNotification, err)
+	}
+	if dn.PackageName != p.verifier.packageName {
+		return Notification{}, fmt.Errorf("%w: notification is for package %q", ErrInvalidNotification, dn.PackageName)
+	}
+
+	n := Notification{
+		ID:       push.Message.MessageID,
+		Platform: migrations.PurchasePlatformAndroid,
+		Kind:     NotificationIgnored,
+	}
+	switch {
+	case dn.TestNotification != nil:
+		n.Type = "TEST"
+		n.Kind = NotificationTest
+
+	case dn.SubscriptionNotification != nil:
+		sn := dn.SubscriptionNotification
+		n.Type = playSubscriptionNotificationTypes[sn.NotificationType]
+		if n.Type == "" {
+			n.Type = fmt.Sprintf("SUBSCRIPTION_%d", sn.NotificationType)
+		}
+		s, err := p.verifier.subscription(ctx, sn.PurchaseToken)
+		if errors.Is(err, ErrInvalidReceipt) {
+			return Notification{}, fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+		}
+		if err != nil {
+			return Notification{}, err
+		}
+		purchase, ok := s.purchase(sn.SubscriptionID, sn.PurchaseToken)
+		if !ok && len(s.LineItems) > 0 {
+			// Plan changes move the token to another product.
+			purchase, ok = s.purchase(s.LineItems[0].ProductID, sn.PurchaseToken)
+		}
+		if !ok {
+			return Notification{}, fmt.Errorf("%w: subscription has no line items", ErrInvalidNotification)
+		}
+		n.Purchase = purchase
+		n.SubscriptionKey = sn.PurchaseToken
+		n.SignedAt = p.now().UTC()
+		if sn.NotificationType == playSubscriptionRevoked {
+			n.Kind = NotificationRefund
+			break
+		}
+		n.Kind = NotificationSubscription
+		n.EntitledUntil = *purchase.ExpiresAt
+		if now := p.now().UTC(); !s.entitled() && n.EntitledUntil.After(now) {
+			n.EntitledUntil = now
+		}
+
+	case dn.VoidedPurchaseNotification != nil:
+		vn := dn.VoidedPurchaseNotification
+		n.Type = "VOIDED_PURCHASE"
+		n.Kind = NotificationRefund
+		n.Purchase = Purchase{
+			Platform:      migrations.PurchasePlatformAndroid,
+			TransactionID: playTransactionID(vn.OrderID, vn.PurchaseToken),
+			PurchaseToken: vn.PurchaseToken,
+		}
+		if vn.ProductType == 1 {
+			n.SubscriptionKey = vn.PurchaseToken
+		}
+
+	case dn.OneTimeProductNotification != nil:
+		// Purchases are granted when the app reports them.
+		n.Type = fmt.Sprintf("ONE_TIME_PRODUCT_%d", dn.OneTimeProductNotification.NotificationType)
+	}
+	return n, nil
+}
@@ -0,0 +1,138 @@
+package iap
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// GoogleCertsURL serves the keys Google signs OIDC tokens with.
+	GoogleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+	// Unknown key IDs refetch the keys at most this often.
+	googleCertsMinRefresh = time.Minute
+)
+
+var errGoogleCerts = errors.New("fetching Google certificates")
+
+// pubSubAuth checks the OIDC token Pub/Sub puts on authenticated push
+// requests.
+type pubSubAuth struct {
+	audience string
+	email    string
+	certsURL string
+	client   *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newPubSubAuth(audience, email, certsURL string, client *http.Client) *pubSubAuth {
+	return &pubSubAuth{audience: audience, email: email, certsURL: certsURL, client: client}
+}
+
+type pubSubClaims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// verify checks the Authorization header of a push request. Errors wrap
+// ErrInvalidNotification unless Google's keys could not be fetched.
+func (a *pubSubAuth) verify(ctx context.Context, authorization string) error {
+	raw, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return fmt.Errorf("%w: missing bearer token", ErrInvalidNotification)
+	}
+	var claims pubSubClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.key(ctx, kid)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(a.audience), jwt.WithExpirationRequired())
+	if errors.Is(err, errGoogleCerts) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+	if claims.Issuer != "accounts.google.com" && claims.Issuer != "https://accounts.google.com" {
+		return fmt.Errorf("%w: token issued by %q", ErrInvalidNotification, claims.Issuer)
+	}
+	if claims.Email != a.email || !claims.EmailVerified {
+		return fmt.Errorf("%w: token is for %q", ErrInvalidNotification, claims.Email)
+	}
+	return nil
+}
+
+// key returns Google's signing key kid, fetching the keys again when it is
+// unknown, since Google rotates them.
+func (a *pubSubAuth) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(a.fetchedAt) < googleCertsMinRefresh {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	keys, err := a.fetchKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errGoogleCerts, err)
+	}
+	a.keys, a.fetchedAt = keys, time.Now()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+func (a *pubSubAuth) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.certsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("malformed key set: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			return nil, fmt.Errorf("malformed key %q", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
@@ -0,0 +1,174 @@
+package iap
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBundleID = "com.peeple.app"
+
+func TestAppStoreVerify(t *testing.T) {
+	signer := newFakeAppleSigner(t, true)
+	apiKey, keyPEM := newAppStoreAPIKey(t)
+	production := newFakeAppStore(t, signer, &apiKey.PublicKey)
+	sandbox := newFakeAppStore(t, signer, &apiKey.PublicKey)
+	v, err := newAppStoreVerifier(AppStoreConfig{
+		KeyPEM:   keyPEM,
+		KeyID:    "KEY123",
+		IssuerID: "issuer-1",
+		BundleID: testBundleID,
+		RootCAs:  signer.roots,
+		BaseURLs: []string{production.URL, sandbox.URL},
+	})
+	require.NoError(t, err)
+
+	purchased := time.Now().Add(-time.Minute).Truncate(time.Millisecond).UTC()
+	expires := purchased.Add(7 * 24 * time.Hour)
+	production.add(appStoreTransaction{TransactionID: "1000", OriginalTransactionID: "1000", BundleID: testBundleID,
+		ProductID: "com.peeple.rose_pack_5", PurchaseDate: purchased.UnixMilli(), Type: "Consumable", Environment: "Production"})
+	sandbox.add(appStoreTransaction{TransactionID: "2000", OriginalTransactionID: "1999", BundleID: testBundleID,
+		ProductID: "com.peeple.unlimited_likes_1week", PurchaseDate: purchased.UnixMilli(), ExpiresDate: expires.UnixMilli(),
+		Type: "Auto-Renewable Subscription", Environment: "Sandbox"})
+	production.add(appStoreTransaction{TransactionID: "3000", BundleID: testBundleID, ProductID: "com.peeple.rose_pack_5",
+		PurchaseDate: purchased.UnixMilli(), RevocationDate: time.Now().UnixMilli()})
+	production.add(appStoreTransaction{TransactionID: "4000", BundleID: "com.other.app", ProductID: "com.peeple.rose_pack_5",
+		PurchaseDate: purchased.UnixMilli()})
+
+	ctx := context.Background()
+	p, err := v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "1000"})
+	require.NoError(t, err)
+	assert.Equal(t, migrations.PurchasePlatformIos, p.Platform)
+	assert.Equal(t, "1000", p.TransactionID)
+	assert.Equal(t, "Production", p.Environment)
+	assert.True(t, purchased.Equal(p.PurchasedAt))
+	assert.Nil(t, p.ExpiresAt)
+
+	p, err = v.Verify(ctx, Request{ProductID: "com.peeple.unlimited_likes_1week", TransactionID: "2000", Subscription: true})
+	require.NoError(t, err, "transactions unknown in production are looked up in sandbox")
+	assert.Equal(t, "1999", p.OriginalTransactionID)
+	assert.Equal(t, "Sandbox", p.Environment)
+	require.NotNil(t, p.ExpiresAt)
+	assert.True(t, expires.Equal(*p.ExpiresAt))
+
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.spotlight_pack_1", TransactionID: "1000"})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "product mismatch")
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "9999"})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "unknown transaction")
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "3000"})
+	assert.ErrorIs(t, err, ErrRevoked)
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "4000"})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "other app's transaction")
+}
+
+func TestAppStoreVerifyRejectsUntrustedSignatures(t *testing.T) {
+	trusted := newFakeAppleSigner(t, true)
+	impostor := newFakeAppleSigner(t, true)
+	apiKey, keyPEM := newAppStoreAPIKey(t)
+	store := newFakeAppStore(t, impostor, &apiKey.PublicKey)
+	v, err := newAppStoreVerifier(AppStoreConfig{
+		KeyPEM: keyPEM, KeyID: "KEY123", IssuerID: "issuer-1", BundleID: testBundleID,
+		RootCAs: trusted.roots, BaseURLs: []string{store.URL},
+	})
+	require.NoError(t, err)
+	store.add(appStoreTransaction{TransactionID: "1000", BundleID: testBundleID, ProductID: "com.peeple.rose_pack_5"})
+
+	_, err = v.Verify(context.Background(), Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "1000"})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidReceipt, "a bad signature is not the app's fault")
+}
+
+func TestVerifyAppleJWS(t *testing.T) {
+	signer := newFakeAppleSigner(t, true)
+	tx := appStoreTransaction{TransactionID: "1000", ProductID: "com.peeple.rose_pack_5"}
+
+	var got appStoreTransaction
+	require.NoError(t, verifyAppleJWS(signer.sign(t, tx), signer.roots, time.Now(), &got))
+	assert.Equal(t, tx, got)
+
+	parts := strings.Split(signer.sign(t, tx), ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"transactionId":"1000","productId":"com.peeple.rose_pack_500"}`))
+	assert.ErrorContains(t, verifyAppleJWS(strings.Join(parts, "."), signer.roots, time.Now(), &got), "signature invalid")
+
+	assert.ErrorContains(t, verifyAppleJWS(signer.sign(t, tx), signer.roots, time.Now().Add(48*time.Hour), &got), "certificate chain",
+		"expired certificates")
+
+	plain := newFakeAppleSigner(t, false)
+	assert.ErrorContains(t, verifyAppleJWS(plain.sign(t, tx), plain.roots, time.Now(), &got), "not signed by an App Store certificate")
+}
+
+func TestPlayVerifyProduct(t *testing.T) {
+	play := newFakePlay(t, testBundleID)
+	v, err := newPlayVerifier(newPlayServiceAccount(t, play.URL+"/token"), testBundleID, play.URL)
+	require.NoError(t, err)
+
+	testPurchase := 0
+	play.addProduct("tok-1", "com.peeple.rose_pack_5", playProductPurchase{PurchaseTimeMillis: "1700000000000", OrderID: "GPA.1111"})
+	play.addProduct("tok-pending", "com.peeple.rose_pack_5", playProductPurchase{PurchaseTimeMillis: "1700000000000", PurchaseState: 2, OrderID: "GPA.2222"})
+	play.addProduct("tok-tester", "com.peeple.rose_pack_5", playProductPurchase{PurchaseTimeMillis: "1700000000000", PurchaseType: &testPurchase})
+
+	ctx := context.Background()
+	p, err := v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "GPA.1111", ReceiptData: "tok-1"})
+	require.NoError(t, err)
+	assert.Equal(t, migrations.PurchasePlatformAndroid, p.Platform)
+	assert.Equal(t, "GPA.1111", p.TransactionID)
+	assert.Equal(t, "tok-1", p.PurchaseToken)
+	assert.Equal(t, "Production", p.Environment)
+	assert.True(t, time.UnixMilli(1700000000000).Equal(p.PurchasedAt))
+
+	p, err = v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "tester", ReceiptData: "tok-tester"})
+	require.NoError(t, err)
+	assert.Equal(t, "tok-tester", p.TransactionID, "tester purchases have no order ID")
+	assert.Equal(t, "Sandbox", p.Environment)
+
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "GPA.2222", ReceiptData: "tok-pending"})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "pending purchase")
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "GPA.9999", ReceiptData: "tok-1"})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "order ID mismatch")
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.spotlight_pack_1", TransactionID: "GPA.1111", ReceiptData: "tok-1"})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "token is for another product")
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.rose_pack_5", TransactionID: "GPA.1111"})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "missing token")
+}
+
+func TestPlayVerifySubscription(t *testing.T) {
+	play := newFakePlay(t, testBundleID)
+	v, err := newPlayVerifier(newPlayServiceAccount(t, play.URL+"/token"), testBundleID, play.URL)
+	require.NoError(t, err)
+
+	start := time.Now().Add(-15 * 24 * time.Hour).UTC().Truncate(time.Second)
+	expiry := time.Now().Add(6 * 24 * time.Hour).UTC().Truncate(time.Second)
+	play.addSubscription("sub-1", playSubscriptionPurchase{
+		StartTime:         start,
+		SubscriptionState: "SUBSCRIPTION_STATE_ACTIVE",
+		LatestOrderID:     "GPA.5555..2",
+		LineItems:         []playLineItem{{ProductID: "com.peeple.unlimited_likes_1week", ExpiryTime: expiry}},
+	})
+	play.addSubscription("sub-expired", playSubscriptionPurchase{
+		StartTime:         start,
+		SubscriptionState: "SUBSCRIPTION_STATE_EXPIRED",
+		LatestOrderID:     "GPA.6666",
+		LineItems:         []playLineItem{{ProductID: "com.peeple.unlimited_likes_1week", ExpiryTime: start.Add(7 * 24 * time.Hour)}},
+	})
+
+	ctx := context.Background()
+	p, err := v.Verify(ctx, Request{ProductID: "com.peeple.unlimited_likes_1week", TransactionID: "GPA.5555", ReceiptData: "sub-1", Subscription: true})
+	require.NoError(t, err, "the first order ID matches its renewals")
+	assert.Equal(t, "GPA.5555..2", p.TransactionID)
+	assert.True(t, start.Equal(p.PurchasedAt))
+	require.NotNil(t, p.ExpiresAt)
+	assert.True(t, expiry.Equal(*p.ExpiresAt))
+
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.travel_mode_1week", TransactionID: "GPA.5555", ReceiptData: "sub-1", Subscription: true})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "subscription is for another product")
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.unlimited_likes_1week", TransactionID: "GPA.6666", ReceiptData: "sub-expired", Subscription: true})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "expired subscription")
+	_, err = v.Verify(ctx, Request{ProductID: "com.peeple.unlimited_likes_1week", TransactionID: "GPA.55", ReceiptData: "sub-1", Subscription: true})
+	assert.ErrorIs(t, err, ErrInvalidReceipt, "order ID mismatch")
+}
@@ -0,0 +1,72 @@
+// Package identity verifies ID tokens from third-party sign-in providers
+// offline, against each provider's published signing keys.
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	ProviderGoogle = "google"
+	ProviderApple  = "apple"
+)
+
+var (
+	ErrInvalidToken    = errors.New("invalid identity token")
+	ErrUnknownProvider = errors.New("unknown identity provider")
+)
+
+// Identity is the verified result of an ID token.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// IdentityProvider verifies ID tokens issued by one sign-in provider.
+type IdentityProvider interface {
+	Name() string
+	Verify(ctx context.Context, rawIDToken string) (*Identity, error)
+}
+
+// Registry maps provider names to their verifiers.
+type Registry map[string]IdentityProvider
+
+func (r Registry) Verify(ctx context.Context, provider, rawIDToken string) (*Identity, error) {
+	p, ok := r[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, provider)
+	}
+	return p.Verify(ctx, rawIDToken)
+}
+
+// NewRegistryFromEnv configures the providers whose client IDs are set:
+// GOOGLE_CLIENT_ID_ANDROID, GOOGLE_CLIENT_ID_IOS, GOOGLE_CLIENT_ID_WEB and
+// APPLE_CLIENT_IDS (comma-separated bundle and services IDs).
+func NewRegistryFromEnv() Registry {
+	reg := Registry{}
+	var googleAudiences []string
+	for _, key := range []string{"GOOGLE_CLIENT_ID_ANDROID", "GOOGLE_CLIENT_ID_IOS", "GOOGLE_CLIENT_ID_WEB"} {
+		if v := os.Getenv(key); v != "" {
+			googleAudiences = append(googleAudiences, v)
+		}
+	}
+	if len(googleAudiences) > 0 {
+		reg[ProviderGoogle] = NewGoogleProvider(googleAudiences, GoogleJWKSURL)
+	}
+	var appleAudiences []string
+	for _, v := range strings.Split(os.Getenv("APPLE_CLIENT_IDS"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			appleAudiences = append(appleAudiences, v)
+		}
+	}
+	if len(appleAudiences) > 0 {
+		reg[ProviderApple] = NewAppleProvider(appleAudiences, AppleJWKSURL)
+	}
+	return reg
+}
@@ -0,0 +1,178 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeJWKS stands in for a provider's key endpoint.
+type fakeJWKS struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches atomic.Int32
+	server  *httptest.Server
+}
+
+func newFakeJWKS(t *testing.T) *fakeJWKS {
+	f := &fakeJWKS{keys: make(map[string]*rsa.PrivateKey)}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.fetches.Add(1)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		type jwk struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		}
+		set := struct {
+			Keys []jwk `json:"keys"`
+		}{}
+		for kid, k := range f.keys {
+			set.Keys = append(set.Keys, jwk{
+				Kty: "RSA",
+				Kid: kid,
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(f.server.Close)
+	f.addKey(t, "key-1")
+	return f
+}
+
+func (f *fakeJWKS) addKey(t *testing.T, kid string) {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f.mu.Lock()
+	f.keys[kid] = k
+	f.mu.Unlock()
+}
+
+func (f *fakeJWKS) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	f.mu.Lock()
+	k := f.keys[kid]
+	f.mu.Unlock()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = kid
+	s, err := tok.SignedString(k)
+	require.NoError(t, err)
+	return s
+}
+
+func baseClaims(iss, aud string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            iss,
+		"aud":            aud,
+		"sub":            "subject-123",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestGoogleProviderVerify(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	p := NewGoogleProvider([]string{"android-client", "ios-client", "web-client"}, jwks.server.URL)
+	ctx := context.Background()
+
+	for _, aud := range []string{"android-client", "ios-client", "web-client"} {
+		id, err := p.Verify(ctx, jwks.sign(t, "key-1", baseClaims("https://accounts.google.com", aud)))
+		require.NoError(t, err, aud)
+		assert.Equal(t, ProviderGoogle, id.Provider)
+		assert.Equal(t, "subject-123", id.Subject)
+		assert.Equal(t, "user@example.com", id.Email)
+		assert.True(t, id.EmailVerified)
+	}
+
+	t.Run("wrong audience", func(t *testing.T) {
+		_, err := p.Verify(ctx, jwks.sign(t, "key-1", baseClaims("https://accounts.google.com", "someone-else")))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		_, err := p.Verify(ctx, jwks.sign(t, "key-1", baseClaims("https://appleid.apple.com", "web-client")))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		claims := baseClaims("accounts.google.com", "web-client")
+		claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		_, err := p.Verify(ctx, jwks.sign(t, "key-1", claims))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		raw := jwks.sign(t, "key-1", baseClaims("accounts.google.com", "web-client"))
+		_, err := p.Verify(ctx, raw[:len(raw)-4]+"AAAA")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestJWKSCacheRefetchesOnKeyRotation(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	p := NewGoogleProvider([]string{"web-client"}, jwks.server.URL)
+	ctx := context.Background()
+
+	_, err := p.Verify(ctx, jwks.sign(t, "key-1", baseClaims("accounts.google.com", "web-client")))
+	require.NoError(t, err)
+	_, err = p.Verify(ctx, jwks.sign(t, "key-1", baseClaims("accounts.google.com", "web-client")))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), jwks.fetches.Load(), "cached keys should be reused")
+
+	// A new kid forces a refetch once the minimum interval has passed.
+	jwks.addKey(t, "key-2")
+	p.(*oidcProvider).jwks.lastFetched = time.Now().Add(-2 * minRefreshInterval)
+	_, err = p.Verify(ctx, jwks.sign(t, "key-2", baseClaims("accounts.google.com", "web-client")))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), jwks.fetches.Load())
+
+	// Unknown kids right after a fetch are rejected without another request.
+	jwks.addKey(t, "key-3")
+	_, err = p.Verify(ctx, jwks.sign(t, "key-3", baseClaims("accounts.google.com", "web-client")))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, int32(2), jwks.fetches.Load())
+}
+
+func TestAppleProviderVerify(t *testing.T) {
+	jwks := newFakeJWKS(t)
+	p := NewAppleProvider([]string{"com.peeple.app"}, jwks.server.URL)
+
+	claims := baseClaims("https://appleid.apple.com", "com.peeple.app")
+	claims["email_verified"] = "true"
+	id, err := p.Verify(context.Background(), jwks.sign(t, "key-1", claims))
+	require.NoError(t, err)
+	assert.Equal(t, ProviderApple, id.Provider)
+	assert.True(t, id.EmailVerified)
+
+	claims["email_verified"] = "false"
+	id, err = p.Verify(context.Background(), jwks.sign(t, "key-1", claims))
+	require.NoError(t, err)
+	assert.False(t, id.EmailVerified)
+}
+
+func TestRegistryUnknownProvider(t *testing.T) {
+	_, err := Registry{}.Verify(context.Background(), "facebook", "x.y.z")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
@@ -0,0 +1,138 @@
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSTTL = time.Hour
+	// minRefreshInterval bounds refetches triggered by unknown kids so a
+	// flood of forged tokens cannot hammer the provider.
+	minRefreshInterval = time.Minute
+)
+
+// jwksCache holds a provider's RSA signing keys, refetching them when the
+// cache expires or a token names a kid we have not seen.
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	expiresAt   time.Time
+	lastFetched time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+func (c *jwksCache) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if k, ok := c.keys[kid]; ok && now.Before(c.expiresAt) {
+		return k, nil
+	}
+	if now.Before(c.expiresAt) && now.Sub(c.lastFetched) < minRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown kid %q", ErrInvalidToken, kid)
+	}
+	if err := c.refresh(ctx); err != nil {
+		// Serve a stale key rather than failing every sign-in while the
+		// provider's endpoint is unreachable.
+		if k, ok := c.keys[kid]; ok {
+			log.Printf("Identity WARN: JWKS refresh from %s failed, using cached key: %v", c.url, err)
+			return k, nil
+		}
+		return nil, err
+	}
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: unknown kid %q", ErrInvalidToken, kid)
+}
+
+func (c *jwksCache) refresh(ctx context.Context) error {
+	c.lastFetched = time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || k.Kid == "" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS contained no usable RSA keys")
+	}
+
+	c.keys = keys
+	c.expiresAt = time.Now().Add(cacheTTL(resp.Header.Get("Cache-Control")))
+	return nil
+}
+
+// cacheTTL honours the provider's Cache-Control max-age, which Google and
+// Apple set to match their key rotation.
+func cacheTTL(header string) time.Duration {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if v, ok := strings.CutPrefix(part, "max-age="); ok {
+			if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+				return time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return defaultJWKSTTL
+}
@@ -0,0 +1,166 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	APNSProductionHost = "https://api.push.apple.com"
+	APNSSandboxHost    = "https://api.sandbox.push.apple.com"
+	// Apple rejects provider tokens older than an hour and throttles
+	// refreshing more often than every 20 minutes.
+	apnsTokenLifetime = 40 * time.Minute
+	apnsMaxCollapseID = 64
+)
+
+// apnsProvider sends through the APNs HTTP/2 API with token-based
+// authentication.
+type apnsProvider struct {
+	keyID  string
+	teamID string
+	topic  string
+	host   string
+	key    *ecdsa.PrivateKey
+	client *http.Client
+
+	mu       sync.Mutex
+	bearer   string
+	issuedAt time.Time
+}
+
+// NewAPNSProvider creates an APNs provider from a .p8 signing key. topic is
+// the app's bundle ID; host is APNSProductionHost or APNSSandboxHost.
+func NewAPNSProvider(keyPEM []byte, keyID, teamID, topic, host string) (Provider, error) {
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, errors.New("apns: APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC are required")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("apns: parsing key: %w", err)
+	}
+	return &apnsProvider{
+		keyID:  keyID,
+		teamID: teamID,
+		topic:  topic,
+		host:   strings.TrimRight(host, "/"),
+		key:    key,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *apnsProvider) Name() string {
+	return "apns"
+}
+
+type apnsAlert struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type apnsAps struct {
+	Alert    apnsAlert `json:"alert"`
+	Sound    string    `json:"sound"`
+	Badge    *int      `json:"badge,omitempty"`
+	ThreadID string    `json:"thread-id,omitempty"`
+}
+
+func (p *apnsProvider) Send(ctx context.Context, msg Message) error {
+	payload := make(map[string]any, len(msg.Data)+1)
+	for k, v := range msg.Data {
+		payload[k] = v
+	}
+	payload["aps"] = apnsAps{
+		Alert:    apnsAlert{Title: msg.Title, Body: msg.Body},
+		Sound:    "default",
+		Badge:    msg.Badge,
+		ThreadID: msg.CollapseKey,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+
+	bearer, err := p.providerToken()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.host+"/3/device/"+msg.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", p.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	if id := msg.CollapseKey; id != "" {
+		if len(id) > apnsMaxCollapseID {
+			id = id[:apnsMaxCollapseID]
+		}
+		req.Header.Set("apns-collapse-id", id)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("apns: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apnsErr)
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		apnsErr.Reason == "BadDeviceToken",
+		apnsErr.Reason == "DeviceTokenNotForTopic",
+		apnsErr.Reason == "Unregistered":
+		return fmt.Errorf("%w: apns %s", ErrInvalidToken, apnsErr.Reason)
+	case apnsErr.Reason == "ExpiredProviderToken" || apnsErr.Reason == "InvalidProviderToken":
+		p.mu.Lock()
+		p.bearer = ""
+		p.mu.Unlock()
+		return fmt.Errorf("apns: provider token rejected: %s", apnsErr.Reason)
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("%w: apns %s", ErrRejected, apnsErr.Reason)
+	}
+	return fmt.Errorf("apns: status %d %s", resp.StatusCode, apnsErr.Reason)
+}
+
+// providerToken returns the signed provider JWT, re-signing it once it is
+// apnsTokenLifetime old.
+func (p *apnsProvider) providerToken() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bearer != "" && time.Since(p.issuedAt) < apnsTokenLifetime {
+		return p.bearer, nil
+	}
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": p.teamID,
+		"iat": now.Unix(),
+	})
+	t.Header["kid"] = p.keyID
+	signed, err := t.SignedString(p.key)
+	if err != nil {
+		return "", fmt.Errorf("apns: signing provider token: %w", err)
+	}
+	p.bearer, p.issuedAt = signed, now
+	return signed, nil
+}
@@ -0,0 +1,418 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+	_ "time/tzdata" // quiet hours use IANA zones; don't depend on the host's zoneinfo
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultDispatchInterval = 5 * time.Second
+	dispatchBatchSize       = 200
+	dispatchLeaseSeconds    = 60
+	sendTimeout             = 10 * time.Second
+	maxPushAttempts         = 5
+	baseRetryDelay          = 30 * time.Second
+	maxRetryDelay           = time.Hour
+	// A user with more notifications than this due in one batch gets a
+	// single summary push instead.
+	maxPushesPerUserBatch = 3
+	outboxRetention       = 7 * 24 * time.Hour
+	outboxPruneInterval   = time.Hour
+	summaryCollapseKey    = "summary"
+)
+
+var errNoProvider = errors.New("push: no provider for device platform")
+
+// Notification is what a feature asks to push. Notifications for one user
+// with the same CollapseKey that are still queued merge into one push.
+type Notification struct {
+	Type        migrations.NotificationType
+	CollapseKey string
+	Title       string
+	Body        string
+	Data        map[string]string
+}
+
+// Dispatcher queues notifications in push_outbox and delivers them.
+type Dispatcher struct {
+	queries   *migrations.Queries
+	providers Providers
+}
+
+func NewDispatcher(queries *migrations.Queries, providers Providers) *Dispatcher {
+	return &Dispatcher{queries: queries, providers: providers}
+}
+
+// DefaultPreferences are used for users who never changed theirs.
+func DefaultPreferences(userID int32) migrations.NotificationPreference {
+	return migrations.NotificationPreference{
+		UserID:     userID,
+		NewMessage: true,
+		NewLike:    true,
+		NewMatch:   true,
+		Timezone:   "UTC",
+	}
+}
+
+func typeEnabled(p migrations.NotificationPreference, t migrations.NotificationType) bool {
+	switch t {
+	case migrations.NotificationTypeNewMessage:
+		return p.NewMessage
+	case migrations.NotificationTypeNewLike:
+		return p.NewLike
+	case migrations.NotificationTypeNewMatch:
+		return p.NewMatch
+	}
+	return false
+}
+
+// Enqueue queues n for userID unless their preferences turn its type off.
+// During the user's quiet hours it is held until they end.
+func (d *Dispatcher) Enqueue(ctx context.Context, userID int32, n Notification) error {
+	prefs, err := d.queries.GetNotificationPreferences(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		prefs = DefaultPreferences(userID)
+	} else if err != nil {
+		return fmt.Errorf("loading notification preferences: %w", err)
+	}
+	if !typeEnabled(prefs, n.Type) {
+		return nil
+	}
+
+	sendAt := time.Now()
+	if end, quiet := quietHoursEnd(prefs, sendAt); quiet {
+		sendAt = end
+	}
+	data, err := json.Marshal(n.Data)
+	if err != nil {
+		return fmt.Errorf("encoding notification data: %w", err)
+	}
+	if err := d.queries.EnqueuePushNotification(ctx, migrations.EnqueuePushNotificationParams{
+		UserID:           userID,
+		NotificationType: n.Type,
+		CollapseKey:      n.CollapseKey,
+		Title:            n.Title,
+		Body:             n.Body,
+		Data:             data,
+		NextAttemptAt:    pgtype.Timestamptz{Time: sendAt, Valid: true},
+	}); err != nil {
+		return fmt.Errorf("queueing notification: %w", err)
+	}
+	return nil
+}
+
+// quietHoursEnd reports whether now falls in the user's quiet hours and, if
+// so, when they end. Windows may wrap past midnight (22:00-07:00).
+func quietHoursEnd(p migrations.NotificationPreference, now time.Time) (time.Time, bool) {
+	if !p.QuietHoursStart.Valid || !p.QuietHoursEnd.Valid {
+		return time.Time{}, false
+	}
+	start, end := int(p.QuietHoursStart.Int16), int(p.QuietHoursEnd.Int16)
+	if start == end {
+		return time.Time{}, false
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	var quiet bool
+	if start < end {
+		quiet = minute >= start && minute < end
+	} else {
+		quiet = minute >= start || minute < end
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	endAt := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !endAt.After(local) {
+		endAt = time.Date(local.Year(), local.Month(), local.Day()+1, end/60, end%60, 0, 0, loc)
+	}
+	return endAt, true
+}
+
+// retryDelay is the backoff before the next attempt after attempts failed
+// ones: 30s, 1m, 2m... capped at an hour.
+func retryDelay(attempts int32) time.Duration {
+	d := baseRetryDelay
+	for i := int32(1); i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryDelay)
+}
+
+func dispatchInterval() time.Duration {
+	return utils.DurationFromEnv("PUSH_DISPATCH_INTERVAL", defaultDispatchInterval)
+}
+
+// Run delivers due notifications every PUSH_DISPATCH_INTERVAL and prunes
+// old outbox rows hourly until ctx is cancelled. Several instances can run
+// it at once; each claims its own rows.
+func (d *Dispatcher) Run(ctx context.Context) {
+	interval := dispatchInterval()
+	log.Printf("Push dispatcher started (interval %s)", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPrune := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Push dispatcher stopped.")
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			n, err := d.dispatchOnce(ctx)
+			if err != nil {
+				log.Printf("ERROR: push: dispatch failed: %v", err)
+				break
+			}
+			if n < dispatchBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPrune) >= outboxPruneInterval {
+			lastPrune = time.Now()
+			cutoff := pgtype.Timestamptz{Time: time.Now().Add(-outboxRetention), Valid: true}
+			if n, err := d.queries.PrunePushOutbox(ctx, cutoff); err != nil {
+				log.Printf("ERROR: push: prune failed: %v", err)
+			} else if n > 0 {
+				log.Printf("INFO: push: pruned %d outbox rows", n)
+			}
+		}
+	}
+}
+
+// dispatchOnce claims one batch of due notifications and delivers them,
+// returning how many were claimed.
+func (d *Dispatcher) dispatchOnce(ctx context.Context) (int, error) {
+	rows, err := d.queries.ClaimDuePushNotifications(ctx, migrations.ClaimDuePushNotificationsParams{
+		LeaseSeconds: dispatchLeaseSeconds,
+		BatchSize:    dispatchBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var order []int32
+	byUser := make(map[int32][]migrations.PushOutbox)
+	for _, row := range rows {
+		if _, seen := byUser[row.UserID]; !seen {
+			order = append(order, row.UserID)
+		}
+		byUser[row.UserID] = append(byUser[row.UserID], row)
+	}
+	for _, userID := range order {
+		d.deliverToUser(ctx, userID, byUser[userID])
+	}
+	return len(rows), nil
+}
+
+func (d *Dispatcher) deliverToUser(ctx context.Context, userID int32, rows []migrations.PushOutbox) {
+	live := rows[:0]
+	for _, row := range rows {
+		if row.Attempts > maxPushAttempts {
+			d.markFailed(ctx, row.ID, "lease expired after the last attempt")
+			continue
+		}
+		live = append(live, row)
+	}
+	if len(live) == 0 {
+		return
+	}
+
+	tokens, err := d.queries.GetUserDevicePushTokens(ctx, userID)
+	if err != nil {
+		log.Printf("ERROR: push: failed to load devices of user %d: %v", userID, err)
+		for _, row := range live {
+			d.retry(ctx, row, err)
+		}
+		return
+	}
+	if len(tokens) == 0 {
+		for _, row := range live {
+			d.markFailed(ctx, row.ID, "no registered devices")
+		}
+		return
+	}
+
+	for _, r := range render(live) {
+		delivered, invalid, sendErr := d.sendToDevices(ctx, tokens, r.msg)
+		if len(invalid) > 0 {
+			tokens = d.dropInvalidTokens(ctx, tokens, invalid)
+		}
+		switch {
+		case delivered:
+			if err := d.queries.MarkPushNotificationsSent(ctx, r.ids); err != nil {
+				log.Printf("ERROR: push: failed to mark %v sent: %v", r.ids, err)
+			}
+		case sendErr == nil:
+			for _, id := range r.ids {
+				d.markFailed(ctx, id, "no valid devices")
+			}
+		case errors.Is(sendErr, ErrRejected) || errors.Is(sendErr, errNoProvider):
+			for _, id := range r.ids {
+				d.markFailed(ctx, id, sendErr.Error())
+			}
+		default:
+			for _, row := range live {
+				if slices.Contains(r.ids, row.ID) {
+					d.retry(ctx, row, sendErr)
+				}
+			}
+		}
+	}
+}
+
+type renderedPush struct {
+	msg Message
+	ids []int64
+}
+
+// render turns a user's due notifications into pushes: one per collapse
+// key, or a single summary when there are more than maxPushesPerUserBatch.
+func render(rows []migrations.PushOutbox) []renderedPush {
+	if len(rows) > maxPushesPerUserBatch {
+		total := int32(0)
+		ids := make([]int64, 0, len(rows))
+		for _, row := range rows {
+			total += row.CollapsedCount
+			ids = append(ids, row.ID)
+		}
+		return []renderedPush{{
+			msg: Message{
+				Title:       "Peeple",
+				Body:        fmt.Sprintf("You have %d new notifications", total),
+				Data:        map[string]string{"type": summaryCollapseKey},
+				CollapseKey: summaryCollapseKey,
+			},
+			ids: ids,
+		}}
+	}
+
+	out := make([]renderedPush, 0, len(rows))
+	for _, row := range rows {
+		var data map[string]string
+		if err := json.Unmarshal(row.Data, &data); err != nil {
+			data = nil
+		}
+		body := row.Body
+		if row.CollapsedCount > 1 {
+			body = collapsedBody(row.NotificationType, row.CollapsedCount)
+		}
+		out = append(out, renderedPush{
+			msg: Message{
+				Title:       row.Title,
+				Body:        body,
+				Data:        data,
+				CollapseKey: row.CollapseKey,
+			},
+			ids: []int64{row.ID},
+		})
+	}
+	return out
+}
+
+func collapsedBody(t migrations.NotificationType, n int32) string {
+	switch t {
+	case migrations.NotificationTypeNewMessage:
+		return fmt.Sprintf("%d new messages", n)
+	case migrations.NotificationTypeNewLike:
+		return fmt.Sprintf("You have %d new likes", n)
+	case migrations.NotificationTypeNewMatch:
+		return fmt.Sprintf("You have %d new matches", n)
+	}
+	return fmt.Sprintf("%d new notifications", n)
+}
+
+// sendToDevices sends msg to each device. It reports whether any device
+// accepted it, which tokens the providers rejected as invalid, and the last
+// other error.
+func (d *Dispatcher) sendToDevices(ctx context.Context, tokens []migrations.DevicePushToken, msg Message) (bool, []string, error) {
+	delivered := false
+	var invalid []string
+	var lastErr error
+	for _, t := range tokens {
+		p, ok := d.providers[t.Platform]
+		if !ok {
+			lastErr = fmt.Errorf("%w: %s", errNoProvider, t.Platform)
+			continue
+		}
+		m := msg
+		m.Token = t.Token
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := p.Send(sendCtx, m)
+		cancel()
+		switch {
+		case err == nil:
+			delivered = true
+		case errors.Is(err, ErrInvalidToken):
+			invalid = append(invalid, t.Token)
+		default:
+			log.Printf("WARN: push: %s send to user %d failed: %v", p.Name(), t.UserID, err)
+			lastErr = err
+		}
+	}
+	return delivered, invalid, lastErr
+}
+
+func (d *Dispatcher) dropInvalidTokens(ctx context.Context, tokens []migrations.DevicePushToken, invalid []string) []migrations.DevicePushToken {
+	kept := tokens[:0]
+	for _, t := range tokens {
+		if !slices.Contains(invalid, t.Token) {
+			kept = append(kept, t)
+			continue
+		}
+		if err := d.queries.DeleteInvalidDevicePushToken(ctx, t.Token); err != nil {
+			log.Printf("ERROR: push: failed to delete invalid token of user %d: %v", t.UserID, err)
+		} else {
+			log.Printf("INFO: push: deleted invalid %s token of user %d", t.Platform, t.UserID)
+		}
+	}
+	return kept
+}
+
+func (d *Dispatcher) retry(ctx context.Context, row migrations.PushOutbox, cause error) {
+	if row.Attempts >= maxPushAttempts {
+		d.markFailed(ctx, row.ID, cause.Error())
+		return
+	}
+	n, err := d.queries.RetryPushNotification(ctx, migrations.RetryPushNotificationParams{
+		ID:            row.ID,
+		NextAttemptAt: pgtype.Timestamptz{Time: time.Now().Add(retryDelay(row.Attempts)), Valid: true},
+		LastError:     pgtype.Text{String: cause.Error(), Valid: true},
+	})
+	if err != nil {
+		log.Printf("ERROR: push: failed to reschedule notification %d: %v", row.ID, err)
+		return
+	}
+	if n == 0 {
+		d.markFailed(ctx, row.ID, "superseded by a newer notification")
+	}
+}
+
+func (d *Dispatcher) markFailed(ctx context.Context, id int64, reason string) {
+	if err := d.queries.MarkPushNotificationFailed(ctx, migrations.MarkPushNotificationFailedParams{
+		ID:        id,
+		LastError: pgtype.Text{String: reason, Valid: true},
+	}); err != nil {
+		log.Printf("ERROR: push: failed to mark notification %d failed: %v", id, err)
+	}
+}
@@ -0,0 +1,174 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func quietPrefs(start, end int16, tz string) migrations.NotificationPreference {
+	p := DefaultPreferences(1)
+	p.QuietHoursStart = pgtype.Int2{Int16: start, Valid: true}
+	p.QuietHoursEnd = pgtype.Int2{Int16: end, Valid: true}
+	p.Timezone = tz
+	return p
+}
+
+func TestQuietHoursEnd(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		prefs migrations.NotificationPreference
+		now   time.Time
+		quiet bool
+		end   time.Time
+	}{
+		{
+			name:  "no quiet hours",
+			prefs: DefaultPreferences(1),
+			now:   time.Date(2025, 3, 1, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "inside daytime window",
+			prefs: quietPrefs(9*60, 17*60, "UTC"),
+			now:   time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC),
+			quiet: true,
+			end:   time.Date(2025, 3, 1, 17, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "end of window is not quiet",
+			prefs: quietPrefs(9*60, 17*60, "UTC"),
+			now:   time.Date(2025, 3, 1, 17, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "overnight window before midnight",
+			prefs: quietPrefs(22*60, 7*60, "UTC"),
+			now:   time.Date(2025, 3, 1, 23, 15, 0, 0, time.UTC),
+			quiet: true,
+			end:   time.Date(2025, 3, 2, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "overnight window after midnight",
+			prefs: quietPrefs(22*60, 7*60, "UTC"),
+			now:   time.Date(2025, 3, 2, 3, 0, 0, 0, time.UTC),
+			quiet: true,
+			end:   time.Date(2025, 3, 2, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "outside overnight window",
+			prefs: quietPrefs(22*60, 7*60, "UTC"),
+			now:   time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "window in user's timezone",
+			prefs: quietPrefs(22*60, 7*60, "Asia/Kolkata"),
+			// 17:00 UTC is 22:30 in Kolkata.
+			now:   time.Date(2025, 3, 1, 17, 0, 0, 0, time.UTC),
+			quiet: true,
+			end:   time.Date(2025, 3, 2, 7, 0, 0, 0, kolkata),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, quiet := quietHoursEnd(tt.prefs, tt.now)
+			assert.Equal(t, tt.quiet, quiet)
+			if tt.quiet {
+				assert.True(t, tt.end.Equal(end), "want %s, got %s", tt.end, end)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryDelay(1))
+	assert.Equal(t, time.Minute, retryDelay(2))
+	assert.Equal(t, 4*time.Minute, retryDelay(4))
+	assert.Equal(t, time.Hour, retryDelay(20))
+}
+
+func outboxRow(id int64, typ migrations.NotificationType, key string, count int32) migrations.PushOutbox {
+	return migrations.PushOutbox{
+		ID:               id,
+		UserID:           1,
+		NotificationType: typ,
+		CollapseKey:      key,
+		Title:            "Asha",
+		Body:             "hey",
+		Data:             []byte(`{"type":"chat_message"}`),
+		CollapsedCount:   count,
+	}
+}
+
+func TestRenderCollapsesRepeatedNotifications(t *testing.T) {
+	out := render([]migrations.PushOutbox{
+		outboxRow(1, migrations.NotificationTypeNewMessage, "message:2", 1),
+		outboxRow(2, migrations.NotificationTypeNewMessage, "message:3", 4),
+	})
+	require.Len(t, out, 2)
+	assert.Equal(t, "hey", out[0].msg.Body)
+	assert.Equal(t, "message:2", out[0].msg.CollapseKey)
+	assert.Equal(t, map[string]string{"type": "chat_message"}, out[0].msg.Data)
+	assert.Equal(t, "4 new messages", out[1].msg.Body)
+	assert.Equal(t, []int64{2}, out[1].ids)
+}
+
+func TestRenderSummarisesLargeBatches(t *testing.T) {
+	rows := []migrations.PushOutbox{
+		outboxRow(1, migrations.NotificationTypeNewMessage, "message:2", 2),
+		outboxRow(2, migrations.NotificationTypeNewLike, "likes", 1),
+		outboxRow(3, migrations.NotificationTypeNewMatch, "match:4", 1),
+		outboxRow(4, migrations.NotificationTypeNewMessage, "message:5", 1),
+	}
+	out := render(rows)
+	require.Len(t, out, 1)
+	assert.Equal(t, "You have 5 new notifications", out[0].msg.Body)
+	assert.Equal(t, summaryCollapseKey, out[0].msg.CollapseKey)
+	assert.Equal(t, []int64{1, 2, 3, 4}, out[0].ids)
+}
+
+func TestSendToDevices(t *testing.T) {
+	android := NewFakeProvider()
+	android.Fail = func(msg Message) error {
+		if msg.Token == "stale" {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+	d := NewDispatcher(nil, Providers{migrations.PushPlatformAndroid: android})
+
+	tokens := []migrations.DevicePushToken{
+		{UserID: 1, Platform: migrations.PushPlatformAndroid, Token: "stale"},
+		{UserID: 1, Platform: migrations.PushPlatformAndroid, Token: "good"},
+		{UserID: 1, Platform: migrations.PushPlatformIos, Token: "no-provider"},
+	}
+	delivered, invalid, err := d.sendToDevices(context.Background(), tokens, Message{Title: "t", Body: "b"})
+	assert.True(t, delivered)
+	assert.Equal(t, []string{"stale"}, invalid)
+	assert.ErrorIs(t, err, errNoProvider)
+
+	sent := android.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "good", sent[0].Token)
+}
+
+func TestSendToDevicesTransientFailure(t *testing.T) {
+	fake := NewFakeProvider()
+	unavailable := errors.New("unavailable")
+	fake.Fail = func(Message) error { return unavailable }
+	d := NewDispatcher(nil, Providers{migrations.PushPlatformIos: fake})
+
+	delivered, invalid, err := d.sendToDevices(context.Background(), []migrations.DevicePushToken{
+		{UserID: 1, Platform: migrations.PushPlatformIos, Token: "a"},
+	}, Message{})
+	assert.False(t, delivered)
+	assert.Empty(t, invalid)
+	assert.ErrorIs(t, err, unavailable)
+}
@@ -0,0 +1,47 @@
+package push
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// FakeProvider records pushes instead of sending them. Tests read Sent and
+// can make sends fail with Fail; PUSH_FAKE=true uses it with Log set.
+type FakeProvider struct {
+	Log  bool
+	Fail func(msg Message) error
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) Send(ctx context.Context, msg Message) error {
+	if f.Fail != nil {
+		if err := f.Fail(msg); err != nil {
+			return err
+		}
+	}
+	f.mu.Lock()
+	f.sent = append(f.sent, msg)
+	f.mu.Unlock()
+	if f.Log {
+		log.Printf("INFO: push (fake): to %s: %q %q (collapse %q)", msg.Token, msg.Title, msg.Body, msg.CollapseKey)
+	}
+	return nil
+}
+
+// Sent returns the pushes accepted so far, in order.
+func (f *FakeProvider) Sent() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.sent...)
+}
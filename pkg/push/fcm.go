@@ -0,0 +1,230 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	FCMEndpoint        = "https://fcm.googleapis.com"
+	fcmScope           = "https://www.googleapis.com/auth/firebase.messaging"
+	fcmDefaultTokenURI = "https://oauth2.googleapis.com/token"
+	// Access tokens are refreshed this long before they expire.
+	fcmTokenRefreshMargin = 5 * time.Minute
+)
+
+type fcmServiceAccount struct {
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// fcmProvider sends through the FCM HTTP v1 API, authenticating with an
+// OAuth access token obtained from a signed service account assertion.
+type fcmProvider struct {
+	account  fcmServiceAccount
+	key      *rsa.PrivateKey
+	endpoint string
+	client   *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCMProvider creates an FCM provider from a service account JSON key.
+func NewFCMProvider(serviceAccountJSON []byte) (Provider, error) {
+	return newFCMProvider(serviceAccountJSON, FCMEndpoint)
+}
+
+func newFCMProvider(serviceAccountJSON []byte, endpoint string) (*fcmProvider, error) {
+	var sa fcmServiceAccount
+	if err := json.Unmarshal(serviceAccountJSON, &sa); err != nil {
+		return nil, fmt.Errorf("fcm: parsing service account: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("fcm: service account needs project_id, client_email and private_key")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = fcmDefaultTokenURI
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("fcm: parsing private key: %w", err)
+	}
+	return &fcmProvider{
+		account:  sa,
+		key:      key,
+		endpoint: strings.TrimRight(endpoint, "/"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *fcmProvider) Name() string {
+	return "fcm"
+}
+
+type fcmRequest struct {
+	Message fcmMessage `json:"message"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      fcmAndroidConfig  `json:"android"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type fcmAndroidConfig struct {
+	CollapseKey  string                 `json:"collapse_key,omitempty"`
+	Priority     string                 `json:"priority"`
+	Notification fcmAndroidNotification `json:"notification"`
+}
+
+type fcmAndroidNotification struct {
+	Tag string `json:"tag,omitempty"` // replaces a shown notification with the same tag
+}
+
+type fcmErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+func (p *fcmProvider) Send(ctx context.Context, msg Message) error {
+	accessToken, err := p.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(fcmRequest{Message: fcmMessage{
+		Token:        msg.Token,
+		Notification: fcmNotification{Title: msg.Title, Body: msg.Body},
+		Data:         msg.Data,
+		Android: fcmAndroidConfig{
+			CollapseKey:  msg.CollapseKey,
+			Priority:     "high",
+			Notification: fcmAndroidNotification{Tag: msg.CollapseKey},
+		},
+	}})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+
+	sendURL := fmt.Sprintf("%s/v1/projects/%s/messages:send", p.endpoint, url.PathEscape(p.account.ProjectID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fcm: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	var fe fcmErrorResponse
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&fe)
+	errorCode := fe.Error.Status
+	for _, d := range fe.Error.Details {
+		if d.ErrorCode != "" {
+			errorCode = d.ErrorCode
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || errorCode == "UNREGISTERED" || errorCode == "SENDER_ID_MISMATCH":
+		return fmt.Errorf("%w: fcm %s", ErrInvalidToken, errorCode)
+	case resp.StatusCode == http.StatusUnauthorized:
+		p.mu.Lock()
+		p.accessToken = ""
+		p.mu.Unlock()
+		return fmt.Errorf("fcm: access token rejected: %s", fe.Error.Message)
+	case resp.StatusCode == http.StatusBadRequest:
+		return fmt.Errorf("%w: fcm %s: %s", ErrRejected, errorCode, fe.Error.Message)
+	}
+	return fmt.Errorf("fcm: status %d %s", resp.StatusCode, errorCode)
+}
+
+// token returns a cached access token, exchanging a fresh service account
+// assertion for one when it is about to expire.
+func (p *fcmProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.accessToken != "" && time.Until(p.expiresAt) > fcmTokenRefreshMargin {
+		return p.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   p.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   p.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if p.account.PrivateKeyID != "" {
+		assertion.Header["kid"] = p.account.PrivateKeyID
+	}
+	signed, err := assertion.SignedString(p.key)
+	if err != nil {
+		return "", fmt.Errorf("fcm: signing assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signed},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fcm: token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fcm: token exchange: status %d", resp.StatusCode)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil || tok.AccessToken == "" {
+		return "", errors.New("fcm: token exchange: malformed response")
+	}
+	p.accessToken = tok.AccessToken
+	p.expiresAt = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return p.accessToken, nil
+}
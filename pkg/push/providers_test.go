@@ -0,0 +1,109 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFCMProviderSend(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var tokenExchanges int
+	var got fcmRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenExchanges++
+			require.NoError(t, r.ParseForm())
+			assert.NotEmpty(t, r.PostForm.Get("assertion"))
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "ya29.test", "expires_in": 3600})
+		case "/v1/projects/peeple-test/messages:send":
+			assert.Equal(t, "Bearer ya29.test", r.Header.Get("Authorization"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			if got.Message.Token == "stale" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+				return
+			}
+			w.Write([]byte(`{"name":"projects/peeple-test/messages/1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	sa, err := json.Marshal(fcmServiceAccount{
+		ProjectID:   "peeple-test",
+		ClientEmail: "push@peeple-test.iam.gserviceaccount.com",
+		PrivateKey:  string(keyPEM),
+		TokenURI:    srv.URL + "/token",
+	})
+	require.NoError(t, err)
+	p, err := newFCMProvider(sa, srv.URL)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = p.Send(ctx, Message{Token: "device", Title: "Asha", Body: "hey", CollapseKey: "message:2", Data: map[string]string{"type": "chat_message"}})
+	require.NoError(t, err)
+	assert.Equal(t, "device", got.Message.Token)
+	assert.Equal(t, "message:2", got.Message.Android.CollapseKey)
+	assert.Equal(t, "chat_message", got.Message.Data["type"])
+
+	err = p.Send(ctx, Message{Token: "stale"})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, 1, tokenExchanges, "access token should be cached")
+}
+
+func TestAPNSProviderSend(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "com.peeple.app", r.Header.Get("apns-topic"))
+		assert.Contains(t, r.Header.Get("Authorization"), "bearer ")
+		switch r.URL.Path {
+		case "/3/device/stale":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered"}`))
+		case "/3/device/bad-payload":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"PayloadEmpty"}`))
+		default:
+			assert.Equal(t, "likes", r.Header.Get("apns-collapse-id"))
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Contains(t, body, "aps")
+			assert.Equal(t, "new_like", body["type"])
+		}
+	}))
+	defer srv.Close()
+
+	p, err := NewAPNSProvider(keyPEM, "KEY123", "TEAM123", "com.peeple.app", srv.URL)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	msg := Message{Token: "device", Title: "New like", Body: "Asha liked you", CollapseKey: "likes", Data: map[string]string{"type": "new_like"}}
+	require.NoError(t, p.Send(ctx, msg))
+
+	msg.Token = "stale"
+	assert.ErrorIs(t, p.Send(ctx, msg), ErrInvalidToken)
+	msg.Token = "bad-payload"
+	assert.ErrorIs(t, p.Send(ctx, msg), ErrRejected)
+}
@@ -0,0 +1,96 @@
+// Package push delivers notifications to the devices of users who are not
+// connected over WebSocket. Notifications are queued in the push_outbox
+// table and sent by a Dispatcher through one Provider per platform.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/arnnvv/peeple-api/migrations"
+)
+
+var (
+	// ErrInvalidToken means the provider will never accept the device
+	// token again; the token is deleted.
+	ErrInvalidToken = errors.New("push: invalid device token")
+	// ErrRejected means the provider refused this message for a reason a
+	// retry won't fix.
+	ErrRejected = errors.New("push: message rejected")
+)
+
+// Message is one push to one device.
+type Message struct {
+	Token       string
+	Title       string
+	Body        string
+	Data        map[string]string
+	CollapseKey string // replaces an earlier push with the same key on the device
+	Badge       *int   // iOS app badge; unset leaves it unchanged
+}
+
+// Provider sends pushes for one platform. Errors other than ErrInvalidToken
+// and ErrRejected (possibly wrapped) are treated as temporary.
+type Provider interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// Providers maps each platform to the provider serving it. A platform
+// without one gets no pushes.
+type Providers map[migrations.PushPlatform]Provider
+
+// NewProvidersFromEnv configures the providers whose credentials are set:
+//
+//   - FCM_SERVICE_ACCOUNT_FILE: Firebase service account JSON, for Android.
+//   - APNS_KEY_FILE, APNS_KEY_ID, APNS_TEAM_ID, APNS_TOPIC: APNs token auth
+//     (.p8 key), for iOS. APNS_SANDBOX=true uses the development gateway.
+//   - PUSH_FAKE=true: log pushes instead of sending them, for both.
+func NewProvidersFromEnv() (Providers, error) {
+	providers := Providers{}
+	if fake, _ := strconv.ParseBool(os.Getenv("PUSH_FAKE")); fake {
+		f := NewFakeProvider()
+		f.Log = true
+		providers[migrations.PushPlatformAndroid] = f
+		providers[migrations.PushPlatformIos] = f
+		return providers, nil
+	}
+
+	if path := os.Getenv("FCM_SERVICE_ACCOUNT_FILE"); path != "" {
+		keyJSON, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading FCM_SERVICE_ACCOUNT_FILE: %w", err)
+		}
+		p, err := NewFCMProvider(keyJSON)
+		if err != nil {
+			return nil, err
+		}
+		providers[migrations.PushPlatformAndroid] = p
+	}
+
+	if path := os.Getenv("APNS_KEY_FILE"); path != "" {
+		keyPEM, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading APNS_KEY_FILE: %w", err)
+		}
+		sandbox, _ := strconv.ParseBool(os.Getenv("APNS_SANDBOX"))
+		host := APNSProductionHost
+		if sandbox {
+			host = APNSSandboxHost
+		}
+		p, err := NewAPNSProvider(keyPEM, os.Getenv("APNS_KEY_ID"), os.Getenv("APNS_TEAM_ID"), os.Getenv("APNS_TOPIC"), host)
+		if err != nil {
+			return nil, err
+		}
+		providers[migrations.PushPlatformIos] = p
+	}
+
+	for platform, p := range providers {
+		log.Printf("Push provider for %s: %s", platform, p.Name())
+	}
+	return providers, nil
+}
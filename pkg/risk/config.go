@@ -0,0 +1,51 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/peeple-api/pkg/utils"
+)
+
+const defaultEvalInterval = 15 * time.Minute
+
+var (
+	cfg     Config
+	cfgOnce sync.Once
+)
+
+func getConfig() Config {
+	cfgOnce.Do(func() {
+		var err error
+		cfg, err = parseConfig(os.Getenv("RISK_RULES"))
+		if err != nil {
+			log.Printf("WARNING: risk: invalid RISK_RULES, using defaults: %v", err)
+			cfg = DefaultConfig()
+		}
+		log.Printf("Risk rules: hide threshold %.0f, velocity %d reports/%dh", cfg.HideThreshold, cfg.VelocityThreshold, cfg.VelocityWindowHours)
+	})
+	return cfg
+}
+
+// parseConfig overlays a JSON object of Config fields onto DefaultConfig.
+func parseConfig(raw string) (Config, error) {
+	c := DefaultConfig()
+	if raw == "" {
+		return c, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &c); err != nil {
+		return DefaultConfig(), err
+	}
+	if c.VelocityWindowHours <= 0 || c.DislikeWindowHours <= 0 {
+		return DefaultConfig(), fmt.Errorf("window hours must be positive")
+	}
+	return c, nil
+}
+
+func evalInterval() time.Duration {
+	return utils.DurationFromEnv("RISK_EVAL_INTERVAL", defaultEvalInterval)
+}
@@ -0,0 +1,122 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// EvaluateUser gathers the user's signals, runs the rules and stores the
+// result. A user who crosses the hide threshold stays hidden until an admin
+// reviews them, even if the score later drops.
+func EvaluateUser(ctx context.Context, queries *migrations.Queries, userID int32) (Assessment, error) {
+	c := getConfig()
+	s, err := gatherSignals(ctx, queries, userID, c)
+	if err != nil {
+		return Assessment{}, err
+	}
+	a := Assess(s, c)
+
+	reasons := a.Reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+	if err := queries.UpsertUserRiskScore(ctx, migrations.UpsertUserRiskScoreParams{
+		UserID:     userID,
+		Score:      a.Score,
+		Reasons:    reasons,
+		AutoHidden: a.Hide,
+	}); err != nil {
+		return a, fmt.Errorf("storing risk score: %w", err)
+	}
+	if a.Hide {
+		log.Printf("WARN: risk: user %d auto-hidden (score %.0f, reasons %v)", userID, a.Score, a.Reasons)
+	}
+	return a, nil
+}
+
+func gatherSignals(ctx context.Context, queries *migrations.Queries, userID int32, c Config) (Signals, error) {
+	now := time.Now()
+	user, err := queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return Signals{}, fmt.Errorf("fetching user: %w", err)
+	}
+
+	reports, err := queries.GetOpenReportSignals(ctx, migrations.GetOpenReportSignalsParams{
+		VelocitySince:  pgtype.Timestamptz{Time: now.Add(-time.Duration(c.VelocityWindowHours) * time.Hour), Valid: true},
+		ReportedUserID: userID,
+	})
+	if err != nil {
+		return Signals{}, fmt.Errorf("fetching report signals: %w", err)
+	}
+
+	dislikeSince := pgtype.Timestamptz{Time: now.Add(-time.Duration(c.DislikeWindowHours) * time.Hour), Valid: true}
+	dislikes, err := queries.CountDislikesReceived(ctx, migrations.CountDislikesReceivedParams{
+		DislikedUserID: userID,
+		StartDate:      dislikeSince,
+	})
+	if err != nil {
+		return Signals{}, fmt.Errorf("counting dislikes: %w", err)
+	}
+	impressions, err := queries.CountProfileImpressions(ctx, migrations.CountProfileImpressionsParams{
+		ShownUserID: userID,
+		StartDate:   dislikeSince,
+	})
+	if err != nil {
+		return Signals{}, fmt.Errorf("counting impressions: %w", err)
+	}
+
+	return Signals{
+		ReportsInWindow:     reports.ReportsInWindow,
+		DistinctReporters:   reports.DistinctReporters,
+		MinorReports:        reports.MinorReports,
+		FakeProfileReports:  reports.FakeProfileReports,
+		DislikesReceived:    dislikes,
+		ImpressionsReceived: impressions,
+		Verified:            user.VerificationStatus == migrations.VerificationStatusTrue,
+	}, nil
+}
+
+// RunScheduler re-evaluates every user with open reports or a non-zero score
+// every RISK_EVAL_INTERVAL until ctx is cancelled, so velocity windows and
+// dislike ratios are kept current between reports.
+func RunScheduler(ctx context.Context, queries *migrations.Queries) {
+	interval := evalInterval()
+	log.Printf("Risk scoring job started (interval %s)", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Risk scoring job stopped.")
+			return
+		case <-ticker.C:
+		}
+
+		userIDs, err := queries.ListRiskCandidates(ctx)
+		if err != nil {
+			log.Printf("ERROR: risk: failed to list candidates: %v", err)
+			continue
+		}
+		hidden := 0
+		for _, userID := range userIDs {
+			if ctx.Err() != nil {
+				return
+			}
+			a, err := EvaluateUser(ctx, queries, userID)
+			if err != nil {
+				log.Printf("ERROR: risk: failed to evaluate user %d: %v", userID, err)
+				continue
+			}
+			if a.Hide {
+				hidden++
+			}
+		}
+		log.Printf("INFO: risk: evaluated %d users, %d above hide threshold", len(userIDs), hidden)
+	}
+}
@@ -0,0 +1,143 @@
+package risk
+
+import "math"
+
+// Signals are the per-user inputs to the rules. Report counts only include
+// reports no admin has resolved yet.
+type Signals struct {
+	ReportsInWindow     int64 // open reports filed within Config.VelocityWindowHours
+	DistinctReporters   int64
+	MinorReports        int64
+	FakeProfileReports  int64
+	DislikesReceived    int64 // within Config.DislikeWindowHours
+	ImpressionsReceived int64 // times shown to others in the same window
+	Verified            bool
+}
+
+// Config holds the rule weights and thresholds. Every field can be
+// overridden through the RISK_RULES environment variable (JSON).
+type Config struct {
+	// Report velocity: VelocityWeight once VelocityThreshold open reports
+	// arrive within the window, plus VelocityWeight/2 per extra report.
+	VelocityWindowHours int     `json:"velocity_window_hours"`
+	VelocityThreshold   int64   `json:"velocity_threshold"`
+	VelocityWeight      float64 `json:"velocity_weight"`
+
+	// Added for each distinct reporter beyond the first.
+	DistinctReporterWeight float64 `json:"distinct_reporter_weight"`
+
+	// Added per open report with the given reason.
+	MinorReportWeight       float64 `json:"minor_report_weight"`
+	FakeProfileReportWeight float64 `json:"fake_profile_report_weight"`
+
+	// Dislikes received / impressions received, ignored below
+	// DislikeMinImpressions.
+	DislikeWindowHours    int     `json:"dislike_window_hours"`
+	DislikeMinImpressions int64   `json:"dislike_min_impressions"`
+	DislikeRatioThreshold float64 `json:"dislike_ratio_threshold"`
+	DislikeRatioWeight    float64 `json:"dislike_ratio_weight"`
+
+	// Added for unverified users, but only when they have open reports.
+	UnverifiedWeight float64 `json:"unverified_weight"`
+
+	// Users scoring at or above HideThreshold are hidden from the feeds.
+	HideThreshold float64 `json:"hide_threshold"`
+	// Scores are capped at MaxScore.
+	MaxScore float64 `json:"max_score"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		VelocityWindowHours:     24,
+		VelocityThreshold:       3,
+		VelocityWeight:          30,
+		DistinctReporterWeight:  10,
+		MinorReportWeight:       40,
+		FakeProfileReportWeight: 20,
+		DislikeWindowHours:      7 * 24,
+		DislikeMinImpressions:   50,
+		DislikeRatioThreshold:   0.9,
+		DislikeRatioWeight:      15,
+		UnverifiedWeight:        10,
+		HideThreshold:           60,
+		MaxScore:                100,
+	}
+}
+
+// Rule scores one aspect of Signals. A zero score means the rule did not
+// fire.
+type Rule struct {
+	Name  string
+	Score func(s Signals, cfg Config) float64
+}
+
+// Rules is the rule set Assess evaluates, in order.
+var Rules = []Rule{
+	{Name: "report_velocity", Score: reportVelocity},
+	{Name: "distinct_reporters", Score: distinctReporters},
+	{Name: "minor_reports", Score: func(s Signals, cfg Config) float64 {
+		return float64(s.MinorReports) * cfg.MinorReportWeight
+	}},
+	{Name: "fake_profile_reports", Score: func(s Signals, cfg Config) float64 {
+		return float64(s.FakeProfileReports) * cfg.FakeProfileReportWeight
+	}},
+	{Name: "dislike_ratio", Score: dislikeRatio},
+	{Name: "unverified", Score: unverified},
+}
+
+// Assessment is the result of running Rules over a user's Signals.
+type Assessment struct {
+	Score   float64
+	Reasons []string // names of the rules that fired
+	Hide    bool
+}
+
+// Assess runs every rule and sums their scores.
+func Assess(s Signals, cfg Config) Assessment {
+	var a Assessment
+	for _, rule := range Rules {
+		if score := rule.Score(s, cfg); score > 0 {
+			a.Score += score
+			a.Reasons = append(a.Reasons, rule.Name)
+		}
+	}
+	if cfg.MaxScore > 0 {
+		a.Score = math.Min(a.Score, cfg.MaxScore)
+	}
+	a.Hide = cfg.HideThreshold > 0 && a.Score >= cfg.HideThreshold
+	return a
+}
+
+func reportVelocity(s Signals, cfg Config) float64 {
+	if cfg.VelocityThreshold <= 0 || s.ReportsInWindow < cfg.VelocityThreshold {
+		return 0
+	}
+	extra := s.ReportsInWindow - cfg.VelocityThreshold
+	return cfg.VelocityWeight + float64(extra)*cfg.VelocityWeight/2
+}
+
+func distinctReporters(s Signals, cfg Config) float64 {
+	if s.DistinctReporters <= 1 {
+		return 0
+	}
+	return float64(s.DistinctReporters-1) * cfg.DistinctReporterWeight
+}
+
+func dislikeRatio(s Signals, cfg Config) float64 {
+	if s.ImpressionsReceived == 0 || s.ImpressionsReceived < cfg.DislikeMinImpressions {
+		return 0
+	}
+	ratio := float64(s.DislikesReceived) / float64(s.ImpressionsReceived)
+	if ratio < cfg.DislikeRatioThreshold {
+		return 0
+	}
+	return cfg.DislikeRatioWeight
+}
+
+func unverified(s Signals, cfg Config) float64 {
+	hasReports := s.DistinctReporters > 0 || s.ReportsInWindow > 0 || s.MinorReports > 0 || s.FakeProfileReports > 0
+	if s.Verified || !hasReports {
+		return 0
+	}
+	return cfg.UnverifiedWeight
+}
@@ -0,0 +1,126 @@
+package risk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssessNoSignals(t *testing.T) {
+	a := Assess(Signals{}, DefaultConfig())
+	assert.Zero(t, a.Score)
+	assert.Empty(t, a.Reasons)
+	assert.False(t, a.Hide)
+}
+
+func TestAssessUnverifiedAloneDoesNotScore(t *testing.T) {
+	a := Assess(Signals{Verified: false}, DefaultConfig())
+	assert.Zero(t, a.Score)
+}
+
+func TestAssessRules(t *testing.T) {
+	cfg := DefaultConfig()
+
+	tests := []struct {
+		name    string
+		signals Signals
+		score   float64
+		reasons []string
+		hide    bool
+	}{
+		{
+			name:    "single spam report from verified user",
+			signals: Signals{ReportsInWindow: 1, DistinctReporters: 1, Verified: true},
+			score:   0,
+		},
+		{
+			name:    "single report on unverified user",
+			signals: Signals{ReportsInWindow: 1, DistinctReporters: 1},
+			score:   10,
+			reasons: []string{"unverified"},
+		},
+		{
+			name:    "velocity threshold reached by three reporters",
+			signals: Signals{ReportsInWindow: 3, DistinctReporters: 3, Verified: true},
+			score:   30 + 20,
+			reasons: []string{"report_velocity", "distinct_reporters"},
+		},
+		{
+			name:    "velocity above threshold adds half weight per report",
+			signals: Signals{ReportsInWindow: 5, DistinctReporters: 1, Verified: true},
+			score:   30 + 2*15,
+			reasons: []string{"report_velocity"},
+			hide:    true,
+		},
+		{
+			name:    "minor report on unverified user",
+			signals: Signals{ReportsInWindow: 1, DistinctReporters: 1, MinorReports: 1},
+			score:   40 + 10,
+			reasons: []string{"minor_reports", "unverified"},
+		},
+		{
+			name:    "minor and fake profile reports hide",
+			signals: Signals{ReportsInWindow: 2, DistinctReporters: 2, MinorReports: 1, FakeProfileReports: 1, Verified: true},
+			score:   10 + 40 + 20,
+			reasons: []string{"distinct_reporters", "minor_reports", "fake_profile_reports"},
+			hide:    true,
+		},
+		{
+			name:    "dislike ratio over threshold",
+			signals: Signals{DislikesReceived: 95, ImpressionsReceived: 100, Verified: true},
+			score:   15,
+			reasons: []string{"dislike_ratio"},
+		},
+		{
+			name:    "dislike ratio ignored below minimum impressions",
+			signals: Signals{DislikesReceived: 10, ImpressionsReceived: 10, Verified: true},
+			score:   0,
+		},
+		{
+			name:    "score capped at max",
+			signals: Signals{ReportsInWindow: 10, DistinctReporters: 10, MinorReports: 5},
+			score:   100,
+			reasons: []string{"report_velocity", "distinct_reporters", "minor_reports", "unverified"},
+			hide:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Assess(tt.signals, cfg)
+			assert.InDelta(t, tt.score, a.Score, 0.001)
+			assert.Equal(t, tt.reasons, a.Reasons)
+			assert.Equal(t, tt.hide, a.Hide)
+		})
+	}
+}
+
+func TestAssessCustomThreshold(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HideThreshold = 10
+	a := Assess(Signals{ReportsInWindow: 1, DistinctReporters: 1}, cfg)
+	assert.True(t, a.Hide)
+
+	cfg.HideThreshold = 0
+	a = Assess(Signals{ReportsInWindow: 10, DistinctReporters: 10, MinorReports: 5}, cfg)
+	assert.False(t, a.Hide, "a zero threshold disables auto-hiding")
+}
+
+func TestParseConfig(t *testing.T) {
+	c, err := parseConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultConfig(), c)
+
+	c, err = parseConfig(`{"hide_threshold": 80, "minor_report_weight": 90}`)
+	require.NoError(t, err)
+	assert.Equal(t, 80.0, c.HideThreshold)
+	assert.Equal(t, 90.0, c.MinorReportWeight)
+	assert.Equal(t, DefaultConfig().VelocityThreshold, c.VelocityThreshold)
+
+	_, err = parseConfig(`{"velocity_window_hours": 0}`)
+	assert.Error(t, err)
+
+	_, err = parseConfig(`not json`)
+	assert.Error(t, err)
+}
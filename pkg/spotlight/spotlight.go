@@ -0,0 +1,165 @@
+// Package spotlight activates spotlights and announces when they end.
+//
+// A spotlight puts the user at the top of other users' home feeds until
+// users.spotlight_active_until. Each activation uses one spotlight credit
+// from user_consumables and is recorded in spotlight_activations for
+// analytics.
+package spotlight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/arnnvv/peeple-api/pkg/ws"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultDuration       = 30 * time.Minute
+	defaultExpiryInterval = 30 * time.Second
+	expiryBatchSize       = 100
+)
+
+var (
+	ErrAlreadyActive = errors.New("a spotlight is already active")
+	ErrNoCredits     = errors.New("no spotlight credits left")
+)
+
+// Duration is how long a spotlight lasts, from SPOTLIGHT_DURATION.
+func Duration() time.Duration {
+	return utils.DurationFromEnv("SPOTLIGHT_DURATION", defaultDuration)
+}
+
+// Activation is a started spotlight.
+type Activation struct {
+	ActivatedAt      time.Time
+	ExpiresAt        time.Time
+	CreditsRemaining int32
+}
+
+// Activate uses one of the user's spotlight credits and starts a spotlight
+// lasting Duration. It fails with ErrAlreadyActive while the previous one
+// runs and with ErrNoCredits if the user has none; in both cases nothing
+// changes.
+func Activate(ctx context.Context, pool *pgxpool.Pool, queries *migrations.Queries, userID int32) (Activation, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return Activation{}, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	// Locks the users row, so concurrent activations queue behind this one
+	// and then see it as active.
+	until, err := qtx.StartUserSpotlight(ctx, migrations.StartUserSpotlightParams{
+		DurationSeconds: Duration().Seconds(),
+		ID:              userID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Activation{}, ErrAlreadyActive
+	}
+	if err != nil {
+		return Activation{}, fmt.Errorf("start spotlight: %w", err)
+	}
+
+	credits, err := qtx.DecrementUserConsumable(ctx, migrations.DecrementUserConsumableParams{
+		UserID:         userID,
+		ConsumableType: migrations.PremiumFeatureTypeSpotlight,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Activation{}, ErrNoCredits
+	}
+	if err != nil {
+		return Activation{}, fmt.Errorf("use spotlight credit: %w", err)
+	}
+
+	activation, err := qtx.CreateSpotlightActivation(ctx, migrations.CreateSpotlightActivationParams{
+		UserID:    userID,
+		ExpiresAt: until,
+	})
+	if err != nil {
+		return Activation{}, fmt.Errorf("record activation: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Activation{}, fmt.Errorf("commit: %w", err)
+	}
+
+	log.Printf("INFO: spotlight: user %d activated a spotlight until %s (%d credits left)",
+		userID, until.Time.UTC().Format(time.RFC3339), credits.Quantity)
+	return Activation{
+		ActivatedAt:      activation.ActivatedAt.Time,
+		ExpiresAt:        activation.ExpiresAt.Time,
+		CreditsRemaining: credits.Quantity,
+	}, nil
+}
+
+// RunExpiryNotifier sends a spotlight_expired event to each user whose
+// spotlight ended, polling every SPOTLIGHT_EXPIRY_INTERVAL until ctx is
+// cancelled. Instances claim expired spotlights, so each is announced once.
+func RunExpiryNotifier(ctx context.Context, pool *pgxpool.Pool, queries *migrations.Queries, hub *ws.Hub) {
+	interval := utils.DurationFromEnv("SPOTLIGHT_EXPIRY_INTERVAL", defaultExpiryInterval)
+	log.Printf("Spotlight expiry job started (interval %s)", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Spotlight expiry job stopped.")
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			n, err := notifyExpired(ctx, pool, queries, hub)
+			if err != nil {
+				log.Printf("ERROR: spotlight: expiry run failed: %v", err)
+				break
+			}
+			if n < expiryBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// notifyExpired queues events for one batch of expired spotlights and
+// returns how many it claimed.
+func notifyExpired(ctx context.Context, pool *pgxpool.Pool, queries *migrations.Queries, hub *ws.Hub) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	expired, err := qtx.ClaimExpiredSpotlights(ctx, expiryBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("claim expired spotlights: %w", err)
+	}
+	for _, a := range expired {
+		msg := ws.WsMessage{
+			Type: "spotlight_expired",
+			Spotlight: &ws.WsSpotlightInfo{
+				ActivatedAt: a.ActivatedAt.Time.UTC(),
+				ExpiresAt:   a.ExpiresAt.Time.UTC(),
+			},
+		}
+		if err := hub.QueueEvent(ctx, qtx, a.UserID, a.UserID, msg); err != nil {
+			return 0, fmt.Errorf("spotlight %d: %w", a.ID, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	if len(expired) > 0 {
+		hub.FlushEvents()
+	}
+	return len(expired), nil
+}
@@ -6,9 +6,35 @@ import (
 
 type Claims struct {
 	UserID uint `json:"user_id"`
+	// SessionID is the refresh token family the access token was minted
+	// from; it is shared by every token of one sign-in.
+	SessionID string `json:"sid,omitempty"`
+	// ImpersonatedBy is the admin's user ID on tokens minted through
+	// admin impersonation; zero otherwise.
+	ImpersonatedBy uint `json:"impersonated_by,omitempty"`
 	jwt.RegisteredClaims
 }
 
 func (c *Claims) Valid() error {
 	return nil
 }
+
+// isLegacy reports whether the claims come from a token issued before
+// access tokens carried exp/iat/jti.
+func (c *Claims) isLegacy() bool {
+	return c.ExpiresAt == nil && c.IssuedAt == nil && c.ID == ""
+}
+
+// SessionKey identifies the session for revocation: the sid when present,
+// otherwise the token's own jti. Legacy tokens have neither.
+func (c *Claims) SessionKey() string {
+	if c.SessionID != "" {
+		return c.SessionID
+	}
+	return c.ID
+}
+
+// IsImpersonated reports whether an admin is acting as this user.
+func (c *Claims) IsImpersonated() bool {
+	return c.ImpersonatedBy != 0
+}
@@ -0,0 +1,95 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+)
+
+const (
+	defaultAccessTokenTTL    = 15 * time.Minute
+	defaultRefreshTokenTTL   = 30 * 24 * time.Hour
+	defaultImpersonateTTL    = 10 * time.Minute
+	defaultLegacyGracePeriod = 30 * 24 * time.Hour
+)
+
+type tokenConfig struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// ImpersonateTTL bounds admin impersonation tokens, which are never
+	// refreshable.
+	ImpersonateTTL time.Duration
+	// Tokens issued before expiring access tokens existed carry no exp/iat.
+	// They are accepted until LegacyGraceUntil when it is set, otherwise for
+	// LegacyGracePeriod after the first start (see StartLegacyGrace).
+	LegacyGraceUntil  time.Time
+	LegacyGracePeriod time.Duration
+}
+
+var (
+	cfg     tokenConfig
+	cfgOnce sync.Once
+
+	legacyGraceMu sync.RWMutex
+	// Until StartLegacyGrace reads the recorded first start, the grace
+	// period runs from this process's start.
+	legacyGraceStart = time.Now()
+)
+
+func getConfig() tokenConfig {
+	cfgOnce.Do(func() {
+		cfg = tokenConfig{
+			AccessTTL:         utils.DurationFromEnv("ACCESS_TOKEN_TTL", defaultAccessTokenTTL),
+			RefreshTTL:        utils.DurationFromEnv("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL),
+			ImpersonateTTL:    utils.DurationFromEnv("IMPERSONATION_TOKEN_TTL", defaultImpersonateTTL),
+			LegacyGracePeriod: utils.DurationFromEnv("LEGACY_TOKEN_GRACE_PERIOD", defaultLegacyGracePeriod),
+		}
+		if v := os.Getenv("LEGACY_TOKEN_GRACE_UNTIL"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				log.Printf("WARNING: token: invalid LEGACY_TOKEN_GRACE_UNTIL %q (want RFC3339), using LEGACY_TOKEN_GRACE_PERIOD: %v", v, err)
+			} else {
+				cfg.LegacyGraceUntil = t
+			}
+		}
+		log.Printf("Token config: access TTL %s, refresh TTL %s, legacy grace period %s", cfg.AccessTTL, cfg.RefreshTTL, cfg.LegacyGracePeriod)
+	})
+	return cfg
+}
+
+// StartLegacyGrace loads when the first server issuing expiring tokens
+// started, recording now if none has, so that restarts don't extend the
+// grace period for legacy tokens.
+func StartLegacyGrace(ctx context.Context, q *migrations.Queries) error {
+	startedAt, err := q.StartLegacyTokenGrace(ctx)
+	if err != nil {
+		return fmt.Errorf("recording legacy token grace start: %w", err)
+	}
+	legacyGraceMu.Lock()
+	legacyGraceStart = startedAt.Time
+	legacyGraceMu.Unlock()
+	log.Printf("Token config: legacy tokens accepted until %v", legacyGraceUntil())
+	return nil
+}
+
+// legacyGraceUntil returns when tokens without exp/iat stop being accepted.
+func legacyGraceUntil() time.Time {
+	conf := getConfig()
+	if !conf.LegacyGraceUntil.IsZero() {
+		return conf.LegacyGraceUntil
+	}
+	legacyGraceMu.RLock()
+	defer legacyGraceMu.RUnlock()
+	return legacyGraceStart.Add(conf.LegacyGracePeriod)
+}
+
+// AccessTokenTTL returns how long newly issued access tokens stay valid.
+func AccessTokenTTL() time.Duration {
+	return getConfig().AccessTTL
+}
@@ -6,9 +6,8 @@ import (
 	"errors"
 	"log"
 	"net/http"
-	"os"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/arnnvv/peeple-api/migrations"
 	"github.com/arnnvv/peeple-api/pkg/db"
@@ -28,41 +27,58 @@ type TokenResponse struct {
 // 	Message string `json:"message"`
 // }
 
-var (
-	jwtSecret     []byte
-	jwtSecretOnce sync.Once
-)
+// GenerateToken issues a short-lived access token for userID. Clients keep
+// their session alive by exchanging a refresh token at /api/auth/refresh.
+func GenerateToken(userID int32) (string, error) {
+	return generateAccessToken(userID, "")
+}
 
-func getSecret() []byte {
-	jwtSecretOnce.Do(func() {
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			log.Fatal("FATAL: JWT_SECRET environment variable not set!")
-		}
-		jwtSecret = []byte(secret)
-	})
-	return jwtSecret
+func generateAccessToken(userID int32, sessionID string) (string, error) {
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := &Claims{
+		UserID:    uint(userID),
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(getConfig().AccessTTL)),
+		},
+	}
+	return getKeyring().sign(claims)
 }
 
-func GenerateToken(userID int32) (string, error) {
+// GenerateImpersonationToken issues a short-lived, non-refreshable token
+// that lets adminUserID act as targetUserID. The returned claims carry the
+// jti and expiry for the audit log.
+func GenerateImpersonationToken(targetUserID, adminUserID int32) (string, *Claims, error) {
+	jti, err := randomString(16)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
 	claims := &Claims{
-		UserID: uint(userID),
-		// Add RegisteredClaims if needed (e.g., expiry)
-		// RegisteredClaims: jwt.RegisteredClaims{
-		//  ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 30)), // e.g., 30 days
-		// },
+		UserID:         uint(targetUserID),
+		ImpersonatedBy: uint(adminUserID),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(getConfig().ImpersonateTTL)),
+		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secret := getSecret()
-	if len(secret) == 0 {
-		return "", errors.New("JWT secret is not configured")
+	signed, err := getKeyring().sign(claims)
+	if err != nil {
+		return "", nil, err
 	}
-	return token.SignedString(secret)
+	return signed, claims, nil
 }
 
-// GenerateTokenHandler is primarily for testing/debugging.
-// It generates a token for an existing user based on their email.
-// WARNING: In production, this endpoint should be removed or heavily secured.
+// GenerateTokenHandler is the development login: it generates a token for
+// an existing user based on their email. It is only mounted when
+// APP_ENV=development; use admin impersonation everywhere else.
 func GenerateTokenHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
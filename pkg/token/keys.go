@@ -1,7 +1,406 @@
 package token
 
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
 type contextKey string
 
 const (
 	ClaimsContextKey contextKey = "claims"
 )
+
+// legacyKeyID names the JWT_SECRET key. Tokens without a kid header were
+// all signed with it.
+const legacyKeyID = "default"
+
+// signingKey is one entry of the keyring. Verify-only keys (e.g. the public
+// half of a key another service signs with) have a nil private key.
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private any
+	public  any
+}
+
+type keyring struct {
+	keys   map[string]*signingKey
+	active *signingKey
+}
+
+var (
+	ring     *keyring
+	ringOnce sync.Once
+)
+
+// getKeyring loads signing keys once, from JWT_KEYS_DIR, JWT_JWKS
+// (base64-encoded JWKS JSON) and JWT_SECRET, in that order of preference.
+// JWT_ACTIVE_KID picks the key new tokens are signed with.
+func getKeyring() *keyring {
+	ringOnce.Do(func() {
+		kr, err := loadKeyring()
+		if err != nil {
+			log.Fatalf("FATAL: token: failed to load JWT keys: %v", err)
+		}
+		ring = kr
+		log.Printf("Token keyring: %d key(s) loaded, signing with kid %q (%s)", len(kr.keys), kr.active.ID, kr.active.Method.Alg())
+	})
+	return ring
+}
+
+func loadKeyring() (*keyring, error) {
+	kr := &keyring{keys: make(map[string]*signingKey)}
+	var loaded []*signingKey
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		keys, err := loadKeysFromDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, keys...)
+	}
+	if encoded := os.Getenv("JWT_JWKS"); encoded != "" {
+		keys, err := loadKeysFromJWKS(encoded)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, keys...)
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		loaded = append(loaded, &signingKey{
+			ID:      legacyKeyID,
+			Method:  jwt.SigningMethodHS256,
+			private: []byte(secret),
+			public:  []byte(secret),
+		})
+	}
+
+	for _, k := range loaded {
+		if _, dup := kr.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate kid %q", k.ID)
+		}
+		kr.keys[k.ID] = k
+	}
+
+	if kid := os.Getenv("JWT_ACTIVE_KID"); kid != "" {
+		kr.active = kr.keys[kid]
+		if kr.active == nil {
+			return nil, fmt.Errorf("JWT_ACTIVE_KID %q not found in keyring", kid)
+		}
+	} else {
+		for _, k := range loaded {
+			if k.private != nil {
+				kr.active = k
+				break
+			}
+		}
+	}
+	if kr.active == nil || kr.active.private == nil {
+		return nil, errors.New("no signing key configured (set JWT_KEYS_DIR, JWT_JWKS or JWT_SECRET)")
+	}
+	return kr, nil
+}
+
+// loadKeysFromDir reads <kid>.pem (PKCS#8/PKCS#1 private or PKIX public
+// keys) and <kid>.secret (HS256 shared secrets).
+func loadKeysFromDir(dir string) ([]*signingKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT_KEYS_DIR: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var keys []*signingKey
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(e.Name())
+		kid := strings.TrimSuffix(e.Name(), ext)
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading key %s: %w", e.Name(), err)
+		}
+		switch ext {
+		case ".pem":
+			k, err := parsePEMKey(kid, data)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", e.Name(), err)
+			}
+			keys = append(keys, k)
+		case ".secret":
+			secret := []byte(strings.TrimSpace(string(data)))
+			if len(secret) == 0 {
+				return nil, fmt.Errorf("key %s: empty secret", e.Name())
+			}
+			keys = append(keys, &signingKey{ID: kid, Method: jwt.SigningMethodHS256, private: secret, public: secret})
+		}
+	}
+	return keys, nil
+}
+
+func parsePEMKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return keyFromPrivate(kid, key)
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return keyFromPrivate(kid, key)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return keyFromPublic(kid, key)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func keyFromPrivate(kid string, key any) (*signingKey, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{ID: kid, Method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{ID: kid, Method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+func keyFromPublic(kid string, key any) (*signingKey, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{ID: kid, Method: jwt.SigningMethodRS256, public: k}, nil
+	case ed25519.PublicKey:
+		return &signingKey{ID: kid, Method: jwt.SigningMethodEdDSA, public: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// jsonWebKey covers the RFC 7517/8037 members we read and publish.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	D   string `json:"d,omitempty"`
+	P   string `json:"p,omitempty"`
+	Q   string `json:"q,omitempty"`
+	K   string `json:"k,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+func loadKeysFromJWKS(encoded string) ([]*signingKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		if raw, err = base64.RawURLEncoding.DecodeString(strings.TrimSpace(encoded)); err != nil {
+			return nil, fmt.Errorf("JWT_JWKS is not base64: %w", err)
+		}
+	}
+	var set jsonWebKeySet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("JWT_JWKS is not a JWKS document: %w", err)
+	}
+	keys := make([]*signingKey, 0, len(set.Keys))
+	for _, jk := range set.Keys {
+		k, err := parseJWK(jk)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %w", jk.Kid, err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func b64uInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func parseJWK(jk jsonWebKey) (*signingKey, error) {
+	if jk.Kid == "" {
+		return nil, errors.New("missing kid")
+	}
+	switch jk.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(jk.K)
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("invalid k")
+		}
+		method := jwt.SigningMethod(jwt.SigningMethodHS256)
+		if jk.Alg != "" {
+			if method = jwt.GetSigningMethod(jk.Alg); method == nil || !strings.HasPrefix(jk.Alg, "HS") {
+				return nil, fmt.Errorf("unsupported alg %q for oct key", jk.Alg)
+			}
+		}
+		return &signingKey{ID: jk.Kid, Method: method, private: secret, public: secret}, nil
+	case "RSA":
+		n, err := b64uInt(jk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := b64uInt(jk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid e")
+		}
+		pub := rsa.PublicKey{N: n, E: int(e.Int64())}
+		if jk.D == "" {
+			return keyFromPublic(jk.Kid, &pub)
+		}
+		d, err := b64uInt(jk.D)
+		if err != nil {
+			return nil, fmt.Errorf("invalid d: %w", err)
+		}
+		p, err := b64uInt(jk.P)
+		if err != nil {
+			return nil, fmt.Errorf("invalid p: %w", err)
+		}
+		q, err := b64uInt(jk.Q)
+		if err != nil {
+			return nil, fmt.Errorf("invalid q: %w", err)
+		}
+		priv := &rsa.PrivateKey{PublicKey: pub, D: d, Primes: []*big.Int{p, q}}
+		if err := priv.Validate(); err != nil {
+			return nil, err
+		}
+		priv.Precompute()
+		return keyFromPrivate(jk.Kid, priv)
+	case "OKP":
+		if jk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jk.Crv)
+		}
+		if jk.D != "" {
+			seed, err := base64.RawURLEncoding.DecodeString(jk.D)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, errors.New("invalid d")
+			}
+			return keyFromPrivate(jk.Kid, ed25519.NewKeyFromSeed(seed))
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid x")
+		}
+		return keyFromPublic(jk.Kid, ed25519.PublicKey(x))
+	default:
+		return nil, fmt.Errorf("unsupported kty %q", jk.Kty)
+	}
+}
+
+// sign signs claims with the active key and stamps its kid in the header.
+func (kr *keyring) sign(claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(kr.active.Method, claims)
+	t.Header["kid"] = kr.active.ID
+	return t.SignedString(kr.active.private)
+}
+
+// keyFunc resolves the verification key from the token's kid. Tokens
+// without a kid predate the keyring and can only be checked against
+// JWT_SECRET. The key's algorithm must match the header so an HMAC token
+// can never be verified with a public key as the secret.
+func (kr *keyring) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKeyID
+	}
+	k, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("alg %s does not match key %q", t.Method.Alg(), kid)
+	}
+	return k.public, nil
+}
+
+func (kr *keyring) validMethods() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, k := range kr.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// publicJWKS lists the asymmetric keys. Shared secrets are never published.
+func (kr *keyring) publicJWKS() jsonWebKeySet {
+	set := jsonWebKeySet{Keys: []jsonWebKey{}}
+	for _, k := range kr.keys {
+		jk := jsonWebKey{Kid: k.ID, Alg: k.Method.Alg(), Use: "sig"}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jk.Kty = "RSA"
+			jk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jk.Kty = "OKP"
+			jk.Crv = "Ed25519"
+			jk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// JWKSHandler serves the public verification keys at /.well-known/jwks.json
+// so other services can check our tokens without holding a secret.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Success: false,
+			Message: "Only GET method allowed",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(getKeyring().publicJWKS())
+}
@@ -0,0 +1,239 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return k
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return k
+}
+
+// writeKey stores key in dir as <kid>.pem, the way JWT_KEYS_DIR expects.
+func writeKey(t *testing.T, dir, kid string, key any) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
+
+// testKeyring loads a keyring from dir only, signing with activeKID.
+func testKeyring(t *testing.T, dir, activeKID string) *keyring {
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("JWT_JWKS", "")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_ACTIVE_KID", activeKID)
+	kr, err := loadKeyring()
+	require.NoError(t, err)
+	return kr
+}
+
+func testClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID: 42,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			ID:        "jti-1",
+		},
+	}
+}
+
+// verify parses signed the way AuthMiddleware does.
+func verify(kr *keyring, signed string) (*Claims, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods(kr.validMethods()), jwt.WithIssuedAt())
+	claims := &Claims{}
+	_, err := parser.ParseWithClaims(signed, claims, kr.keyFunc)
+	return claims, err
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		key  func(*testing.T) any
+		alg  string
+	}{
+		{"RS256", func(t *testing.T) any { return newRSAKey(t) }, "RS256"},
+		{"EdDSA", func(t *testing.T) any { return newEd25519Key(t) }, "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeKey(t, dir, "k1", tt.key(t))
+			kr := testKeyring(t, dir, "")
+
+			signed, err := kr.sign(testClaims())
+			require.NoError(t, err)
+
+			tok, _, err := jwt.NewParser().ParseUnverified(signed, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, tok.Method.Alg())
+			assert.Equal(t, "k1", tok.Header["kid"])
+
+			claims, err := verify(kr, signed)
+			require.NoError(t, err)
+			assert.Equal(t, uint(42), claims.UserID)
+		})
+	}
+}
+
+func TestKeyringSignsWithActiveKid(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01", newRSAKey(t))
+	writeKey(t, dir, "2025-01", newEd25519Key(t))
+
+	tests := []struct {
+		active  string
+		wantKid string
+		wantAlg string
+	}{
+		{"", "2024-01", "RS256"}, // first key in the directory
+		{"2024-01", "2024-01", "RS256"},
+		{"2025-01", "2025-01", "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run("active="+tt.active, func(t *testing.T) {
+			kr := testKeyring(t, dir, tt.active)
+			signed, err := kr.sign(testClaims())
+			require.NoError(t, err)
+
+			tok, _, err := jwt.NewParser().ParseUnverified(signed, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKid, tok.Header["kid"])
+			assert.Equal(t, tt.wantAlg, tok.Method.Alg())
+		})
+	}
+}
+
+func TestKeyringUnknownActiveKid(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "k1", newRSAKey(t))
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("JWT_JWKS", "")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_ACTIVE_KID", "missing")
+
+	_, err := loadKeyring()
+	assert.Error(t, err)
+}
+
+func TestKeyringVerifiesRetiredKid(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "old", newRSAKey(t))
+	writeKey(t, dir, "new", newEd25519Key(t))
+
+	signed, err := testKeyring(t, dir, "old").sign(testClaims())
+	require.NoError(t, err)
+
+	// After rotation new tokens use "new", but "old" stays in the ring.
+	rotated := testKeyring(t, dir, "new")
+	claims, err := verify(rotated, signed)
+	require.NoError(t, err)
+	assert.Equal(t, uint(42), claims.UserID)
+}
+
+func TestKeyringRejects(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := newRSAKey(t)
+	writeKey(t, dir, "rsa", rsaKey)
+	writeKey(t, dir, "ed", newEd25519Key(t))
+	kr := testKeyring(t, dir, "rsa")
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		tok := jwt.NewWithClaims(method, testClaims())
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		require.NoError(t, err)
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		signed string
+	}{
+		{"unknown kid", sign(jwt.SigningMethodRS256, "ghost", newRSAKey(t))},
+		{"no kid without a legacy secret", sign(jwt.SigningMethodRS256, "", rsaKey)},
+		{"wrong key for kid", sign(jwt.SigningMethodRS256, "rsa", newRSAKey(t))},
+		// The classic confusion attack: HMAC with the public key as secret.
+		{"HS256 with RSA kid", sign(jwt.SigningMethodHS256, "rsa", pubPEM)},
+		{"EdDSA with RSA kid", sign(jwt.SigningMethodEdDSA, "rsa", newEd25519Key(t))},
+		{"RS256 with EdDSA kid", sign(jwt.SigningMethodRS256, "ed", rsaKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verify(kr, tt.signed)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPublicJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := newRSAKey(t)
+	edKey := newEd25519Key(t)
+	writeKey(t, dir, "rsa", rsaKey)
+	writeKey(t, dir, "ed", edKey)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared.secret"), []byte("s3cret"), 0o600))
+	kr := testKeyring(t, dir, "rsa")
+
+	set := kr.publicJWKS()
+	require.Len(t, set.Keys, 2, "shared secrets must not be published")
+
+	ed, rs := set.Keys[0], set.Keys[1] // sorted by kid
+	assert.Equal(t, jsonWebKey{
+		Kty: "OKP", Kid: "ed", Alg: "EdDSA", Use: "sig", Crv: "Ed25519",
+		X: base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey)),
+	}, ed)
+	assert.Equal(t, jsonWebKey{
+		Kty: "RSA", Kid: "rsa", Alg: "RS256", Use: "sig",
+		N: base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}, rs)
+	for _, k := range set.Keys {
+		assert.Empty(t, k.D)
+		assert.Empty(t, k.K)
+	}
+
+	// Another service loading the published set verifies our tokens.
+	signed, err := kr.sign(testClaims())
+	require.NoError(t, err)
+	raw, err := json.Marshal(set)
+	require.NoError(t, err)
+	t.Setenv("JWT_KEYS_DIR", "")
+	t.Setenv("JWT_JWKS", base64.StdEncoding.EncodeToString(raw))
+	t.Setenv("JWT_SECRET", "verify-only rings still need a signing key")
+	t.Setenv("JWT_ACTIVE_KID", "")
+	published, err := loadKeyring()
+	require.NoError(t, err)
+	_, err = verify(published, signed)
+	assert.NoError(t, err)
+}
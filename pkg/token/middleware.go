@@ -3,8 +3,10 @@ package token
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -23,14 +25,19 @@ var (
 		Success: false,
 		Message: "Invalid token",
 	}
+	errRevokedToken = ErrorResponse{
+		Success: false,
+		Message: "Session has been logged out",
+	}
 )
 
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	kr := getKeyring()
 	parser := jwt.NewParser(
-		jwt.WithoutClaimsValidation(),
-		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithValidMethods(kr.validMethods()),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
 	)
-	secret := getSecret()
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -44,9 +51,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		claims := &Claims{}
-		token, err := parser.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
-			return secret, nil
-		})
+		token, err := parser.ParseWithClaims(tokenString, claims, kr.keyFunc)
 
 		if err != nil || !token.Valid {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -54,12 +59,52 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		if claims.isLegacy() && !time.Now().Before(legacyGraceUntil()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(errInvalidToken)
+			return
+		}
+
 		if claims.UserID == 0 {
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(errInvalidToken)
 			return
 		}
 
+		revoked, err := isRevoked(r.Context(), claims)
+		if err != nil {
+			log.Printf("AuthMiddleware: Failed to check revocation for user %d: %v", claims.UserID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(errInternalServer)
+			return
+		}
+		if revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(errRevokedToken)
+			return
+		}
+
+		// Admins impersonating a sanctioned user still get through so they
+		// can investigate the account.
+		if !claims.IsImpersonated() {
+			sanction, err := activeSanction(r.Context(), int32(claims.UserID))
+			if err != nil {
+				log.Printf("AuthMiddleware: Failed to check sanctions for user %d: %v", claims.UserID, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(errInternalServer)
+				return
+			}
+			if sanction != nil {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(sanctionResponse(sanction))
+				return
+			}
+		}
+
+		if claims.IsImpersonated() {
+			log.Printf("AUDIT: Admin %d acting as user %d (jti %s): %s %s", claims.ImpersonatedBy, claims.UserID, claims.ID, r.Method, r.URL.Path)
+		}
+
 		ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
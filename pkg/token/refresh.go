@@ -0,0 +1,166 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// TokenPair is what clients receive on sign-in and on every refresh.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Only the SHA-256 of a refresh token is stored, so a database leak does not
+// hand out usable sessions.
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshStore is the part of migrations.Queries that issuing and rotating
+// refresh tokens needs.
+type refreshStore interface {
+	CreateRefreshToken(ctx context.Context, arg migrations.CreateRefreshTokenParams) (migrations.RefreshToken, error)
+	GetRefreshTokenByHashForUpdate(ctx context.Context, tokenHash string) (migrations.RefreshToken, error)
+	MarkRefreshTokenRotated(ctx context.Context, arg migrations.MarkRefreshTokenRotatedParams) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+}
+
+func newTokenPair(ctx context.Context, q refreshStore, userID int32, familyID string) (TokenPair, migrations.RefreshToken, error) {
+	access, err := generateAccessToken(userID, familyID)
+	if err != nil {
+		return TokenPair{}, migrations.RefreshToken{}, err
+	}
+	raw, err := randomString(32)
+	if err != nil {
+		return TokenPair{}, migrations.RefreshToken{}, err
+	}
+	conf := getConfig()
+	rt, err := q.CreateRefreshToken(ctx, migrations.CreateRefreshTokenParams{
+		UserID:    userID,
+		TokenHash: hashRefreshToken(raw),
+		FamilyID:  familyID,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(conf.RefreshTTL), Valid: true},
+	})
+	if err != nil {
+		return TokenPair{}, migrations.RefreshToken{}, fmt.Errorf("storing refresh token: %w", err)
+	}
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: raw,
+		ExpiresIn:    int64(conf.AccessTTL / time.Second),
+	}, rt, nil
+}
+
+// IssueTokenPair starts a new refresh token family for userID, e.g. after a
+// successful sign-in.
+func IssueTokenPair(ctx context.Context, userID int32) (TokenPair, error) {
+	q, err := db.GetDB()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	familyID, err := randomString(16)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	pair, _, err := newTokenPair(ctx, q, userID, familyID)
+	return pair, err
+}
+
+// RotateRefreshToken exchanges a refresh token for a new pair. Each refresh
+// token is single use: presenting one that was already rotated means it
+// leaked, so the whole family is revoked and the user must sign in again.
+func RotateRefreshToken(ctx context.Context, raw string) (TokenPair, error) {
+	if raw == "" {
+		return TokenPair{}, ErrRefreshTokenInvalid
+	}
+	queries, err := db.GetDB()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	pool, err := db.GetPool()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	pair, err := rotateRefreshToken(ctx, queries.WithTx(tx), raw)
+	if err != nil && !errors.Is(err, ErrRefreshTokenReused) {
+		return TokenPair{}, err
+	}
+	// A detected reuse still commits, so the family stays revoked.
+	if cerr := tx.Commit(ctx); cerr != nil {
+		return TokenPair{}, fmt.Errorf("commit rotation: %w", cerr)
+	}
+	return pair, err
+}
+
+// rotateRefreshToken does the work of RotateRefreshToken inside its
+// transaction. On ErrRefreshTokenReused the family has been revoked and the
+// caller must still commit.
+func rotateRefreshToken(ctx context.Context, qtx refreshStore, raw string) (TokenPair, error) {
+	current, err := qtx.GetRefreshTokenByHashForUpdate(ctx, hashRefreshToken(raw))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return TokenPair{}, ErrRefreshTokenInvalid
+		}
+		return TokenPair{}, fmt.Errorf("loading refresh token: %w", err)
+	}
+
+	if current.RevokedAt.Valid {
+		if err := qtx.RevokeRefreshTokenFamily(ctx, current.FamilyID); err != nil {
+			return TokenPair{}, fmt.Errorf("revoking token family: %w", err)
+		}
+		log.Printf("WARN: RotateRefreshToken: reuse of refresh token %d detected for user %d, revoking family", current.ID, current.UserID)
+		return TokenPair{}, ErrRefreshTokenReused
+	}
+
+	if !current.ExpiresAt.Time.After(time.Now()) {
+		return TokenPair{}, ErrRefreshTokenExpired
+	}
+
+	pair, next, err := newTokenPair(ctx, qtx, current.UserID, current.FamilyID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := qtx.MarkRefreshTokenRotated(ctx, migrations.MarkRefreshTokenRotatedParams{
+		ID:           current.ID,
+		ReplacedByID: pgtype.Int8{Int64: next.ID, Valid: true},
+	}); err != nil {
+		return TokenPair{}, fmt.Errorf("marking refresh token rotated: %w", err)
+	}
+	return pair, nil
+}
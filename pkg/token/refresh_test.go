@@ -0,0 +1,143 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memRefreshStore keeps refresh_tokens rows in memory, applying the same
+// updates as the queries in db/queries.sql.
+type memRefreshStore struct {
+	rows []migrations.RefreshToken
+}
+
+func (m *memRefreshStore) CreateRefreshToken(_ context.Context, arg migrations.CreateRefreshTokenParams) (migrations.RefreshToken, error) {
+	rt := migrations.RefreshToken{
+		ID:        int64(len(m.rows) + 1),
+		UserID:    arg.UserID,
+		TokenHash: arg.TokenHash,
+		FamilyID:  arg.FamilyID,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	m.rows = append(m.rows, rt)
+	return rt, nil
+}
+
+func (m *memRefreshStore) GetRefreshTokenByHashForUpdate(_ context.Context, tokenHash string) (migrations.RefreshToken, error) {
+	for _, rt := range m.rows {
+		if rt.TokenHash == tokenHash {
+			return rt, nil
+		}
+	}
+	return migrations.RefreshToken{}, pgx.ErrNoRows
+}
+
+func (m *memRefreshStore) MarkRefreshTokenRotated(_ context.Context, arg migrations.MarkRefreshTokenRotatedParams) error {
+	for i := range m.rows {
+		if m.rows[i].ID == arg.ID {
+			m.rows[i].RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+			m.rows[i].ReplacedByID = arg.ReplacedByID
+		}
+	}
+	return nil
+}
+
+func (m *memRefreshStore) RevokeRefreshTokenFamily(_ context.Context, familyID string) error {
+	for i := range m.rows {
+		if m.rows[i].FamilyID == familyID && !m.rows[i].RevokedAt.Valid {
+			m.rows[i].RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *memRefreshStore) liveInFamily(familyID string) int {
+	n := 0
+	for _, rt := range m.rows {
+		if rt.FamilyID == familyID && !rt.RevokedAt.Valid {
+			n++
+		}
+	}
+	return n
+}
+
+// useTestKeyring makes getKeyring return a throwaway Ed25519 keyring.
+func useTestKeyring(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "test", newEd25519Key(t))
+	kr := testKeyring(t, dir, "test")
+	ringOnce.Do(func() { ring = kr })
+}
+
+func issue(t *testing.T, store *memRefreshStore, userID int32) TokenPair {
+	pair, _, err := newTokenPair(context.Background(), store, userID, "family-1")
+	require.NoError(t, err)
+	return pair
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	useTestKeyring(t)
+	ctx := context.Background()
+	store := &memRefreshStore{}
+	first := issue(t, store, 7)
+
+	second, err := rotateRefreshToken(ctx, store, first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.NotEmpty(t, second.AccessToken)
+
+	claims, err := verify(getKeyring(), second.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+	assert.Equal(t, "family-1", claims.SessionID)
+
+	require.Len(t, store.rows, 2)
+	assert.True(t, store.rows[0].RevokedAt.Valid, "rotated token must be spent")
+	assert.Equal(t, pgtype.Int8{Int64: store.rows[1].ID, Valid: true}, store.rows[0].ReplacedByID)
+	assert.Equal(t, 1, store.liveInFamily("family-1"))
+
+	third, err := rotateRefreshToken(ctx, store, second.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, second.RefreshToken, third.RefreshToken)
+}
+
+func TestRotateRefreshTokenReuseRevokesFamily(t *testing.T) {
+	useTestKeyring(t)
+	ctx := context.Background()
+	store := &memRefreshStore{}
+	first := issue(t, store, 7)
+
+	second, err := rotateRefreshToken(ctx, store, first.RefreshToken)
+	require.NoError(t, err)
+
+	_, err = rotateRefreshToken(ctx, store, first.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.Equal(t, 0, store.liveInFamily("family-1"))
+
+	// The legitimate holder of the newest token is signed out too.
+	_, err = rotateRefreshToken(ctx, store, second.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+}
+
+func TestRotateRefreshTokenRejects(t *testing.T) {
+	useTestKeyring(t)
+	ctx := context.Background()
+	store := &memRefreshStore{}
+
+	_, err := rotateRefreshToken(ctx, store, "never-issued")
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	expired := issue(t, store, 7)
+	store.rows[0].ExpiresAt = pgtype.Timestamptz{Time: time.Now().Add(-time.Minute), Valid: true}
+	_, err = rotateRefreshToken(ctx, store, expired.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenExpired)
+	assert.Len(t, store.rows, 1, "no token may be issued for an expired one")
+}
@@ -0,0 +1,84 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// isRevoked reports whether the session behind claims was logged out, either
+// individually or by a "log out everywhere" issued after the token.
+func isRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	q, err := db.GetDB()
+	if err != nil {
+		return false, err
+	}
+	issuedAt := time.Unix(0, 0)
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return q.IsTokenRevoked(ctx, migrations.IsTokenRevokedParams{
+		SessionID: claims.SessionKey(),
+		UserID:    int32(claims.UserID),
+		IssuedAt:  pgtype.Timestamptz{Time: issuedAt, Valid: true},
+	})
+}
+
+// RevokeSession logs out the session the claims belong to, including its
+// refresh tokens. Legacy tokens cannot be told apart, so for them every
+// session of the user is revoked.
+func RevokeSession(ctx context.Context, claims *Claims) error {
+	key := claims.SessionKey()
+	if key == "" {
+		return RevokeAllSessions(ctx, int32(claims.UserID))
+	}
+	q, err := db.GetDB()
+	if err != nil {
+		return err
+	}
+	err = q.RevokeSession(ctx, migrations.RevokeSessionParams{
+		SessionID: key,
+		UserID:    int32(claims.UserID),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(getConfig().RefreshTTL), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("revoking session: %w", err)
+	}
+	if claims.SessionID != "" {
+		if err := q.RevokeRefreshTokenFamily(ctx, claims.SessionID); err != nil {
+			return fmt.Errorf("revoking refresh tokens: %w", err)
+		}
+	}
+	return nil
+}
+
+// RevokeAllSessions invalidates every access and refresh token issued to
+// userID so far.
+func RevokeAllSessions(ctx context.Context, userID int32) error {
+	queries, err := db.GetDB()
+	if err != nil {
+		return err
+	}
+	pool, err := db.GetPool()
+	if err != nil {
+		return err
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	if err := qtx.SetUserSessionCutoff(ctx, userID); err != nil {
+		return fmt.Errorf("setting session cutoff: %w", err)
+	}
+	if err := qtx.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return fmt.Errorf("revoking refresh tokens: %w", err)
+	}
+	return tx.Commit(ctx)
+}
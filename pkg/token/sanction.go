@@ -0,0 +1,38 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/db"
+	"github.com/jackc/pgx/v5"
+)
+
+// activeSanction returns the user's current suspension or ban, or nil.
+func activeSanction(ctx context.Context, userID int32) (*migrations.UserSanction, error) {
+	q, err := db.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	sanction, err := q.GetActiveUserSanction(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sanction, nil
+}
+
+func sanctionResponse(s *migrations.UserSanction) ErrorResponse {
+	if s.IsBan || !s.ExpiresAt.Valid {
+		return ErrorResponse{Success: false, Message: "Account has been banned"}
+	}
+	return ErrorResponse{
+		Success: false,
+		Message: fmt.Sprintf("Account suspended until %s", s.ExpiresAt.Time.UTC().Format(time.RFC3339)),
+	}
+}
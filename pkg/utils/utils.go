@@ -3,7 +3,10 @@ package utils
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"golang.org/x/sync/errgroup" // Import errgroup
 )
@@ -23,9 +26,24 @@ func RespondWithError(w http.ResponseWriter, code int, message string) {
 	RespondWithJSON(w, code, ErrorResponse{Success: false, Message: message})
 }
 
+// DurationFromEnv reads a positive Go duration such as "15m" from key,
+// falling back to def when it is unset or invalid.
+func DurationFromEnv(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("WARNING: invalid %s %q, using default %s", key, v, def)
+		return def
+	}
+	return d
+}
+
 // WaitGroupWithError simplifies running multiple goroutines and collecting the first error.
 type WaitGroupWithError struct {
-	errgroup.Group
+	*errgroup.Group
 	ctx context.Context
 }
 
@@ -33,7 +51,7 @@ type WaitGroupWithError struct {
 func NewWaitGroupWithError(ctx context.Context) *WaitGroupWithError {
 	// Create an error group that cancels the context if any goroutine returns an error
 	g, derivedCtx := errgroup.WithContext(ctx)
-	return &WaitGroupWithError{Group: *g, ctx: derivedCtx}
+	return &WaitGroupWithError{Group: g, ctx: derivedCtx}
 }
 
 // Add starts a new goroutine within the group.
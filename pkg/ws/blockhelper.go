@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BlockRequest struct {
+	BlockedUserID int32 `json:"blocked_user_id"`
+}
+
+var ErrBlocked = errors.New("this user is not available")
+
+// ProcessBlock blocks req.BlockedUserID for blockerUserID. Likes are left in
+// place and hidden by the queries, so unblocking restores the previous state;
+// the blocked user's client is told the match or like disappeared.
+func ProcessBlock(ctx context.Context, queries *migrations.Queries, pool *pgxpool.Pool, hub *Hub, blockerUserID int32, req BlockRequest) error {
+	if req.BlockedUserID <= 0 {
+		return errors.New("valid blocked_user_id is required")
+	}
+	if req.BlockedUserID == blockerUserID {
+		return errors.New("cannot block yourself")
+	}
+
+	log.Printf("ProcessBlock attempt: User %d -> User %d", blockerUserID, req.BlockedUserID)
+
+	if _, err := queries.GetUserByID(ctx, req.BlockedUserID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("user not found")
+		}
+		log.Printf("ProcessBlock ERROR: GetUserByID %d: %v", req.BlockedUserID, err)
+		return errors.New("failed to process block")
+	}
+
+	matched, likedTarget := false, false
+	mutual, err := queries.CheckMutualLikeExists(ctx, migrations.CheckMutualLikeExistsParams{
+		LikerUserID: blockerUserID,
+		LikedUserID: req.BlockedUserID,
+	})
+	if err != nil {
+		log.Printf("ProcessBlock WARN: Failed mutual like check %d <-> %d: %v", blockerUserID, req.BlockedUserID, err)
+	} else {
+		matched = mutual.Valid && mutual.Bool
+	}
+	if !matched {
+		liked, err := queries.CheckLikeExists(ctx, migrations.CheckLikeExistsParams{
+			LikerUserID: blockerUserID,
+			LikedUserID: req.BlockedUserID,
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("ProcessBlock WARN: Failed check like %d -> %d: %v", blockerUserID, req.BlockedUserID, err)
+		}
+		likedTarget = liked
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		log.Printf("ProcessBlock ERROR: Failed begin transaction user %d: %v", blockerUserID, err)
+		return errors.New("failed to process block")
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	if err := qtx.BlockUser(ctx, migrations.BlockUserParams{
+		BlockerUserID: blockerUserID,
+		BlockedUserID: req.BlockedUserID,
+	}); err != nil {
+		log.Printf("ProcessBlock ERROR: BlockUser %d -> %d: %v", blockerUserID, req.BlockedUserID, err)
+		return errors.New("failed to process block")
+	}
+
+	if hub != nil && (matched || likedTarget) {
+		event := likeRemovedEvent(blockerUserID)
+		if matched {
+			event = matchRemovedEvent(blockerUserID)
+		}
+		if err := hub.QueueEvent(ctx, qtx, req.BlockedUserID, blockerUserID, event); err != nil {
+			log.Printf("ProcessBlock ERROR: Failed queue %s for %d: %v", event.Type, req.BlockedUserID, err)
+			return errors.New("failed to process block")
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("ProcessBlock ERROR: Failed commit block %d -> %d: %v", blockerUserID, req.BlockedUserID, err)
+		return errors.New("failed to process block")
+	}
+
+	log.Printf("ProcessBlock INFO: Block processed: User %d -> User %d", blockerUserID, req.BlockedUserID)
+
+	if hub != nil {
+		hub.FlushEvents()
+	}
+
+	return nil
+}
+
+// checkNotBlocked returns ErrBlocked if either user has blocked the other.
+func checkNotBlocked(ctx context.Context, queries *migrations.Queries, userA, userB int32) error {
+	blocked, err := queries.IsBlockedBetween(ctx, migrations.IsBlockedBetweenParams{
+		BlockerUserID: userA,
+		BlockedUserID: userB,
+	})
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
@@ -46,6 +46,9 @@ type Client struct {
 	conn              *websocket.Conn
 	Send              chan []byte
 	UserID            int32
+	SessionID         string
+	DeviceID          string // a second connection from the same device replaces the first
+	connID            string
 	typingToUserID    int32
 	typingMu          sync.Mutex
 	recordingToUserID int32
@@ -157,28 +160,8 @@ func (c *Client) readPump() {
 				SenderUserID:    c.UserID,
 				RecipientUserID: recipientID,
 			}
-			isMedia := false
-			if msg.Text != nil && *msg.Text != "" {
-				if len(*msg.Text) > 500 {
-					c.sendWsError("Message text too long")
-					continue
-				}
-				createParams.MessageText = pgtype.Text{
-					String: *msg.Text,
-					Valid:  true,
-				}
-			} else if msg.MediaURL != nil && *msg.MediaURL != "" && msg.MediaType != nil && *msg.MediaType != "" {
-				createParams.MediaUrl = pgtype.Text{
-					String: *msg.MediaURL,
-					Valid:  true,
-				}
-				createParams.MediaType = pgtype.Text{
-					String: *msg.MediaType,
-					Valid:  true,
-				}
-				isMedia = true
-			} else {
-				c.sendWsError("Invalid message content (text or media required)")
+			if err := buildChatMessageContent(msg, &createParams); err != nil {
+				c.sendWsError(err.Error())
 				continue
 			}
 			if msg.ReplyToMessageID != nil && *msg.ReplyToMessageID > 0 {
@@ -199,6 +182,10 @@ func (c *Client) readPump() {
 					c.sendWsError("Cannot reply to a message from a different conversation.")
 					continue
 				}
+				if originalMsg.DeletedAt.Valid {
+					c.sendWsError("Cannot reply to a deleted message.")
+					continue
+				}
 				createParams.ReplyToMessageID = pgtype.Int8{
 					Int64: replyToID,
 					Valid: true,
@@ -218,18 +205,29 @@ func (c *Client) readPump() {
 				c.sendWsError("You can only message matched users")
 				continue
 			}
-			savedMsg, dbErr := queries.CreateChatMessage(ctx, createParams)
+			// The message and its event commit together; the relay
+			// delivers the event once the transaction is in.
+			tx, txErr := pool.Begin(ctx)
+			if txErr != nil {
+				log.Printf("Client ReadPump ERROR: Failed begin transaction for message from %d: %v", c.UserID, txErr)
+				c.sendWsError("Failed to save message")
+				continue
+			}
+			qtx := queries.WithTx(tx)
+			savedMsg, dbErr := qtx.CreateChatMessage(ctx, createParams)
 			if dbErr != nil {
+				_ = tx.Rollback(ctx)
 				log.Printf("Client ReadPump ERROR: Failed to save chat message from %d to %d: %v", c.UserID, recipientID, dbErr)
 				c.sendWsError("Failed to save message")
 				continue
 			}
-			log.Printf("Client ReadPump INFO: Message saved: ID=%d, %d -> %d (Media: %t)", savedMsg.ID, c.UserID, recipientID, isMedia)
 			wsMsgToSend := WsMessage{
 				Type:            "chat_message",
 				ID:              &savedMsg.ID,
 				SenderUserID:    &savedMsg.SenderUserID,
 				RecipientUserID: &savedMsg.RecipientUserID,
+				Kind:            Ptr(string(savedMsg.Kind)),
+				Payload:         savedMsg.Payload,
 				Text:            nil,
 				MediaURL:        nil,
 				MediaType:       nil,
@@ -247,33 +245,29 @@ func (c *Client) readPump() {
 			if savedMsg.ReplyToMessageID.Valid {
 				wsMsgToSend.ReplyToMessageID = &savedMsg.ReplyToMessageID.Int64
 			}
-			msgBytes, marshalErr := json.Marshal(wsMsgToSend)
-			if marshalErr != nil {
-				log.Printf("Client ReadPump ERROR: Failed to marshal outgoing message ID %d: %v", savedMsg.ID, marshalErr)
+			if err := c.hub.QueueEvent(ctx, qtx, recipientID, c.UserID, wsMsgToSend); err != nil {
+				_ = tx.Rollback(ctx)
+				log.Printf("Client ReadPump ERROR: Failed to queue chat message event from %d to %d: %v", c.UserID, recipientID, err)
+				c.sendWsError("Failed to save message")
 				continue
 			}
-			if !c.hub.SendToUser(recipientID, msgBytes) {
-				ackMsg := WsMessage{
-					Type:    "message_ack",
-					Content: Ptr("Message sent, recipient offline."),
-					ID:      &savedMsg.ID,
-				}
-				ackBytes, _ := json.Marshal(ackMsg)
-				select {
-				case c.Send <- ackBytes:
-				default:
-				}
-			} else {
-				ackMsg := WsMessage{
-					Type:    "message_ack",
-					Content: Ptr("Message delivered."),
-					ID:      &savedMsg.ID,
-				}
-				ackBytes, _ := json.Marshal(ackMsg)
-				select {
-				case c.Send <- ackBytes:
-				default:
-				}
+			if err := tx.Commit(ctx); err != nil {
+				log.Printf("Client ReadPump ERROR: Failed to commit chat message from %d to %d: %v", c.UserID, recipientID, err)
+				c.sendWsError("Failed to save message")
+				continue
+			}
+			c.hub.FlushEvents()
+			log.Printf("Client ReadPump INFO: Message saved: ID=%d, %d -> %d (Kind: %s)", savedMsg.ID, c.UserID, recipientID, savedMsg.Kind)
+
+			ackMsg := WsMessage{
+				Type:    "message_ack",
+				Content: Ptr("Message sent."),
+				ID:      &savedMsg.ID,
+			}
+			ackBytes, _ := json.Marshal(ackMsg)
+			select {
+			case c.Send <- ackBytes:
+			default:
 			}
 
 		case "react_to_message":
@@ -303,6 +297,10 @@ func (c *Client) readPump() {
 				c.sendWsError("You can only react to messages in your conversations.")
 				continue
 			}
+			if msgParticipants.DeletedAt.Valid {
+				c.sendWsError("Cannot react to a deleted message.")
+				continue
+			}
 			existingReaction, err := queries.GetSingleReactionByUser(ctx,
 				migrations.GetSingleReactionByUserParams{
 					MessageID: targetMessageID,
@@ -379,6 +377,125 @@ func (c *Client) readPump() {
 			default:
 			}
 
+		case "edit_message", "delete_message":
+			if msg.MessageID == nil || *msg.MessageID <= 0 {
+				c.sendWsError("Valid message_id is required")
+				continue
+			}
+			key := fmt.Sprintf("ws_action:message_change:%d", c.UserID)
+			res, err := c.hub.rateLimiter.Allow(ctx, key, interactLimit)
+			if err != nil {
+				log.Printf("ERROR: readPump: Rate limiter check failed for %s user %d: %v", msg.Type, c.UserID, err)
+				c.sendWsError("Internal error checking rate limit.")
+				continue
+			}
+			if res.Allowed == 0 {
+				log.Printf("WARN: Rate limit exceeded for %s user %d", msg.Type, c.UserID)
+				c.sendWsError("Action rate limit exceeded. Please wait.")
+				continue
+			}
+			var changed migrations.ChatMessage
+			ackType := "edit_ack"
+			if msg.Type == "edit_message" {
+				newText := ""
+				if msg.Text != nil {
+					newText = *msg.Text
+				}
+				changed, err = ProcessEditMessage(ctx, queries, pool, c.hub, c.UserID, *msg.MessageID, newText)
+			} else {
+				ackType = "delete_ack"
+				changed, err = ProcessDeleteMessage(ctx, queries, pool, c.hub, c.UserID, *msg.MessageID)
+			}
+			if err != nil {
+				log.Printf("Client ReadPump ERROR: Processing %s failed for user %d: %v", msg.Type, c.UserID, err)
+				c.sendWsError(err.Error())
+				continue
+			}
+			ackMsg := messageChangeEvent(ackType, changed)
+			ackBytes, _ := json.Marshal(ackMsg)
+			select {
+			case c.Send <- ackBytes:
+			default:
+			}
+
+		case "respond_date_proposal":
+			if msg.MessageID == nil || msg.Status == nil {
+				c.sendWsError("message_id and status are required")
+				continue
+			}
+			key := fmt.Sprintf("ws_action:message_change:%d", c.UserID)
+			res, err := c.hub.rateLimiter.Allow(ctx, key, interactLimit)
+			if err != nil {
+				log.Printf("ERROR: readPump: Rate limiter check failed for %s user %d: %v", msg.Type, c.UserID, err)
+				c.sendWsError("Internal error checking rate limit.")
+				continue
+			}
+			if res.Allowed == 0 {
+				log.Printf("WARN: Rate limit exceeded for %s user %d", msg.Type, c.UserID)
+				c.sendWsError("Action rate limit exceeded. Please wait.")
+				continue
+			}
+			answered, err := ProcessDateProposalResponse(ctx, queries, c.hub, c.UserID, *msg.MessageID, *msg.Status)
+			if err != nil {
+				log.Printf("Client ReadPump ERROR: Processing %s failed for user %d: %v", msg.Type, c.UserID, err)
+				c.sendWsError(err.Error())
+				continue
+			}
+			ackBytes, _ := json.Marshal(messageChangeEvent("date_proposal_ack", answered))
+			select {
+			case c.Send <- ackBytes:
+			default:
+			}
+
+		case "update_conversation_settings":
+			if msg.ConversationSettingsPayload == nil {
+				c.sendWsError("Missing conversation_settings_payload")
+				continue
+			}
+			key := fmt.Sprintf("ws_action:conversation_settings:%d", c.UserID)
+			res, err := c.hub.rateLimiter.Allow(ctx, key, interactLimit)
+			if err != nil {
+				log.Printf("ERROR: readPump: Rate limiter check failed for %s user %d: %v", msg.Type, c.UserID, err)
+				c.sendWsError("Internal error checking rate limit.")
+				continue
+			}
+			if res.Allowed == 0 {
+				log.Printf("WARN: Rate limit exceeded for %s user %d", msg.Type, c.UserID)
+				c.sendWsError("Action rate limit exceeded. Please wait.")
+				continue
+			}
+			settings, err := ProcessConversationSettings(ctx, queries, c.hub, c.UserID, *msg.ConversationSettingsPayload)
+			if err != nil {
+				log.Printf("Client ReadPump ERROR: Processing %s failed for user %d: %v", msg.Type, c.UserID, err)
+				c.sendWsError(err.Error())
+				continue
+			}
+			view := ConversationSettingsView(settings)
+			ackBytes, _ := json.Marshal(WsMessage{Type: "conversation_settings_ack", ConversationSettings: &view})
+			select {
+			case c.Send <- ackBytes:
+			default:
+			}
+
+		case "sync":
+			if msg.LastSeq == nil {
+				c.sendWsError("last_seq is required for sync")
+				continue
+			}
+			key := fmt.Sprintf("ws_action:sync:%d", c.UserID)
+			res, err := c.hub.rateLimiter.Allow(ctx, key, interactLimit)
+			if err != nil {
+				log.Printf("ERROR: readPump: Rate limiter check failed for sync user %d: %v", c.UserID, err)
+				c.sendWsError("Internal error checking rate limit.")
+				continue
+			}
+			if res.Allowed == 0 {
+				log.Printf("WARN: Rate limit exceeded for sync user %d", c.UserID)
+				c.sendWsError("Sync rate limit exceeded. Please wait.")
+				continue
+			}
+			c.replayEvents(ctx, queries, *msg.LastSeq)
+
 		case "mark_read":
 			recipientUserID := c.UserID
 			if msg.OtherUserID == nil || *msg.OtherUserID <= 0 {
@@ -439,14 +556,51 @@ func (c *Client) readPump() {
 					ReaderUserID: &recipientUserID,
 					MessageID:    &lastMessageID,
 				}
-				readUpdateBytes, errMarshal := json.Marshal(readUpdateMsg)
-				if errMarshal != nil {
-					log.Printf("Client ReadPump ERROR: Failed marshal messages_read_update: %v", errMarshal)
-				} else {
-					if !c.hub.SendToUser(senderUserID, readUpdateBytes) {
-					} else {
-					}
+				c.hub.SendEvent(senderUserID, recipientUserID, readUpdateMsg)
+			}
+
+		case "mark_delivered":
+			recipientUserID := c.UserID
+			if msg.OtherUserID == nil || *msg.OtherUserID <= 0 || *msg.OtherUserID == recipientUserID {
+				c.sendWsError("Valid other_user_id is required for mark_delivered")
+				continue
+			}
+			if msg.MessageID == nil || *msg.MessageID <= 0 {
+				c.sendWsError("Valid message_id (last received) is required for mark_delivered")
+				continue
+			}
+			senderUserID := *msg.OtherUserID
+			lastMessageID := *msg.MessageID
+			rowsAffected, err := queries.MarkMessagesDeliveredUntil(ctx, migrations.MarkMessagesDeliveredUntilParams{
+				RecipientUserID: recipientUserID,
+				SenderUserID:    senderUserID,
+				ID:              lastMessageID,
+			})
+			if err != nil {
+				log.Printf("Client ReadPump ERROR: Failed to mark messages delivered for user %d from user %d: %v", recipientUserID, senderUserID, err)
+				c.sendWsError("Failed to update message status")
+				continue
+			}
+			ackMsg := WsMessage{
+				Type:        "mark_delivered_ack",
+				OtherUserID: &senderUserID,
+				MessageID:   &lastMessageID,
+				Count:       PtrInt64(rowsAffected),
+			}
+			ackBytes, _ := json.Marshal(ackMsg)
+			select {
+			case c.Send <- ackBytes:
+			default:
+			}
+			if rowsAffected > 0 {
+				deliveredMsg := WsMessage{
+					Type:            "message_delivered",
+					RecipientUserID: &recipientUserID,
+					MessageID:       &lastMessageID,
+					DeliveredAt:     Ptr(time.Now().UTC().Format(time.RFC3339Nano)),
+					Count:           PtrInt64(rowsAffected),
 				}
+				c.hub.SendEvent(senderUserID, recipientUserID, deliveredMsg)
 			}
 
 		case "typing_event":
@@ -625,7 +779,7 @@ func (c *Client) readPump() {
 				c.sendWsError("Action rate limit exceeded. Please wait.")
 				continue
 			}
-			err = ProcessDislike(ctx, queries, c.hub, c.UserID, *msg.DislikePayload)
+			err = ProcessDislike(ctx, queries, pool, c.hub, c.UserID, *msg.DislikePayload)
 			if err != nil {
 				log.Printf("Client ReadPump ERROR: Processing Dislike failed for user %d: %v", c.UserID, err)
 				c.sendWsError(err.Error())
@@ -674,6 +828,39 @@ func (c *Client) readPump() {
 				}
 			}
 
+		case "block_user":
+			if msg.BlockPayload == nil {
+				c.sendWsError("Missing block_payload")
+				continue
+			}
+			key := fmt.Sprintf("ws_action:block:%d", c.UserID)
+			res, err := c.hub.rateLimiter.Allow(ctx, key, interactLimit)
+			if err != nil {
+				log.Printf("ERROR: readPump: Rate limiter check failed for block_user user %d: %v", c.UserID, err)
+				c.sendWsError("Internal error checking rate limit.")
+				continue
+			}
+			if res.Allowed == 0 {
+				log.Printf("WARN: Rate limit exceeded for block_user user %d", c.UserID)
+				c.sendWsError("Action rate limit exceeded. Please wait.")
+				continue
+			}
+			err = ProcessBlock(ctx, queries, pool, c.hub, c.UserID, *msg.BlockPayload)
+			if err != nil {
+				log.Printf("Client ReadPump ERROR: Processing Block failed for user %d: %v", c.UserID, err)
+				c.sendWsError(err.Error())
+			} else {
+				ackMsg := WsMessage{
+					Type:    "block_ack",
+					Content: Ptr("Block processed successfully."),
+				}
+				ackBytes, _ := json.Marshal(ackMsg)
+				select {
+				case c.Send <- ackBytes:
+				default:
+				}
+			}
+
 		default:
 			log.Printf("Client ReadPump: Received unhandled message type '%s' from user %d", msg.Type, c.UserID)
 			c.sendWsError("Unknown message type")
@@ -721,14 +908,17 @@ func (c *Client) writePump() {
 	}
 }
 
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, userID int32) {
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, userID int32, sessionID string, deviceID string) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("ServeWs: Failed to upgrade connection for user %d: %v", userID, err)
 		return
 	}
 	log.Printf("ServeWs: Connection upgraded successfully for user %d", userID)
-	client := &Client{hub: hub, conn: conn, Send: make(chan []byte, 256), UserID: userID}
+	if deviceID == "" {
+		deviceID = sessionID
+	}
+	client := &Client{hub: hub, conn: conn, Send: make(chan []byte, 256), UserID: userID, SessionID: sessionID, DeviceID: deviceID, connID: newConnID()}
 	client.hub.register <- client
 	go client.writePump()
 	go client.readPump()
@@ -745,6 +935,16 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, userID int32) {
 	}
 }
 
+// closeRevoked tells the client its session was logged out and drops the
+// connection; readPump then unregisters it as for any other disconnect.
+func (c *Client) closeRevoked() {
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked")
+	_ = c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+	if err := c.conn.Close(); err != nil {
+		log.Printf("Client: Error closing revoked connection for user %d: %v", c.UserID, err)
+	}
+}
+
 func (c *Client) sendWsError(errorMessage string) {
 	errMsg := WsMessage{
 		Type:    "error",
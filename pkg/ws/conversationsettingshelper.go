@@ -0,0 +1,188 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	maxPinnedConversations = 3
+	maxMuteDuration        = 365 * 24 * time.Hour
+)
+
+// ConversationSettingsRequest changes how the caller sees one conversation.
+// Fields left out are unchanged.
+type ConversationSettingsRequest struct {
+	OtherUserID  int32   `json:"other_user_id"`
+	Mute         *string `json:"mute,omitempty"` // "off", "forever" or a Go duration such as "8h"
+	Pinned       *bool   `json:"pinned,omitempty"`
+	Archived     *bool   `json:"archived,omitempty"`
+	ClearHistory bool    `json:"clear_history,omitempty"` // hide every message sent so far, for the caller only
+}
+
+type WsConversationSettings struct {
+	OtherUserID   int32      `json:"other_user_id"`
+	IsMuted       bool       `json:"is_muted"`
+	MutedUntil    *time.Time `json:"muted_until,omitempty"` // unset while muted means until turned off
+	Pinned        bool       `json:"pinned"`
+	Archived      bool       `json:"archived"`
+	ClearedBefore *time.Time `json:"cleared_before,omitempty"`
+}
+
+// ConversationSettingsView converts a settings row for clients.
+func ConversationSettingsView(s migrations.ConversationSetting) WsConversationSettings {
+	view := WsConversationSettings{
+		OtherUserID: s.PeerUserID,
+		Pinned:      s.Pinned,
+		Archived:    s.Archived,
+	}
+	if IsMuted(s.MutedUntil) {
+		view.IsMuted = true
+		if s.MutedUntil.InfinityModifier == pgtype.Finite {
+			t := s.MutedUntil.Time
+			view.MutedUntil = &t
+		}
+	}
+	if s.ClearedBefore.Valid {
+		t := s.ClearedBefore.Time
+		view.ClearedBefore = &t
+	}
+	return view
+}
+
+// IsMuted reports whether a muted_until value is still in effect.
+func IsMuted(mutedUntil pgtype.Timestamptz) bool {
+	if !mutedUntil.Valid {
+		return false
+	}
+	switch mutedUntil.InfinityModifier {
+	case pgtype.Infinity:
+		return true
+	case pgtype.NegativeInfinity:
+		return false
+	}
+	return mutedUntil.Time.After(time.Now())
+}
+
+func parseMute(v string) (pgtype.Timestamptz, error) {
+	switch v {
+	case "off":
+		return pgtype.Timestamptz{}, nil
+	case "forever":
+		return pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 || d > maxMuteDuration {
+		return pgtype.Timestamptz{}, errors.New(`mute must be "off", "forever" or a duration of up to a year`)
+	}
+	return pgtype.Timestamptz{Time: time.Now().Add(d), Valid: true}, nil
+}
+
+// ProcessConversationSettings applies req to the caller's settings for a
+// conversation with a current match and syncs the result to all of the
+// caller's devices. Unpinning alone is also allowed after the match ended.
+func ProcessConversationSettings(ctx context.Context, queries *migrations.Queries, hub *Hub, userID int32, req ConversationSettingsRequest) (migrations.ConversationSetting, error) {
+	if req.OtherUserID <= 0 || req.OtherUserID == userID {
+		return migrations.ConversationSetting{}, errors.New("valid other_user_id is required")
+	}
+	if req.Mute == nil && req.Pinned == nil && req.Archived == nil && !req.ClearHistory {
+		return migrations.ConversationSetting{}, errors.New("no settings to change")
+	}
+	if req.Pinned != nil && req.Archived != nil && *req.Pinned && *req.Archived {
+		return migrations.ConversationSetting{}, errors.New("a conversation cannot be both pinned and archived")
+	}
+
+	unpinOnly := req.Pinned != nil && !*req.Pinned && req.Mute == nil && req.Archived == nil && !req.ClearHistory
+	if !unpinOnly {
+		mutualLike, err := queries.CheckMutualLikeExists(ctx, migrations.CheckMutualLikeExistsParams{
+			LikerUserID: userID,
+			LikedUserID: req.OtherUserID,
+		})
+		if err != nil {
+			log.Printf("ERROR: ProcessConversationSettings: Failed check mutual like %d -> %d: %v", userID, req.OtherUserID, err)
+			return migrations.ConversationSetting{}, errors.New("failed to check match status")
+		}
+		if !mutualLike.Valid || !mutualLike.Bool {
+			return migrations.ConversationSetting{}, errors.New("you can only change settings for matched users")
+		}
+	}
+
+	settings, err := queries.GetConversationSettings(ctx, migrations.GetConversationSettingsParams{
+		UserID:     userID,
+		PeerUserID: req.OtherUserID,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("ERROR: ProcessConversationSettings: Failed fetch settings %d -> %d: %v", userID, req.OtherUserID, err)
+		return migrations.ConversationSetting{}, errors.New("failed to load conversation settings")
+	}
+	settings.UserID, settings.PeerUserID = userID, req.OtherUserID
+
+	if req.Mute != nil || req.Pinned != nil || req.Archived != nil {
+		if req.Mute != nil {
+			if settings.MutedUntil, err = parseMute(*req.Mute); err != nil {
+				return migrations.ConversationSetting{}, err
+			}
+		}
+		if req.Archived != nil {
+			settings.Archived = *req.Archived
+			if settings.Archived {
+				settings.Pinned = false
+			}
+		}
+		if req.Pinned != nil {
+			if *req.Pinned && !settings.Pinned {
+				pinned, err := queries.CountPinnedConversations(ctx, migrations.CountPinnedConversationsParams{
+					UserID:     userID,
+					PeerUserID: req.OtherUserID,
+				})
+				if err != nil {
+					log.Printf("ERROR: ProcessConversationSettings: Failed count pinned for user %d: %v", userID, err)
+					return migrations.ConversationSetting{}, errors.New("failed to update conversation settings")
+				}
+				if pinned >= maxPinnedConversations {
+					return migrations.ConversationSetting{}, errors.New("you can pin at most 3 conversations")
+				}
+			}
+			settings.Pinned = *req.Pinned
+			if settings.Pinned {
+				settings.Archived = false
+			}
+		}
+
+		settings, err = queries.UpsertConversationSettings(ctx, migrations.UpsertConversationSettingsParams{
+			UserID:     userID,
+			PeerUserID: req.OtherUserID,
+			MutedUntil: settings.MutedUntil,
+			Pinned:     settings.Pinned,
+			Archived:   settings.Archived,
+		})
+		if err != nil {
+			log.Printf("ERROR: ProcessConversationSettings: Failed save settings %d -> %d: %v", userID, req.OtherUserID, err)
+			return migrations.ConversationSetting{}, errors.New("failed to update conversation settings")
+		}
+	}
+
+	if req.ClearHistory {
+		settings, err = queries.ClearConversationHistory(ctx, migrations.ClearConversationHistoryParams{
+			UserID:     userID,
+			PeerUserID: req.OtherUserID,
+		})
+		if err != nil {
+			log.Printf("ERROR: ProcessConversationSettings: Failed clear history %d -> %d: %v", userID, req.OtherUserID, err)
+			return migrations.ConversationSetting{}, errors.New("failed to clear conversation history")
+		}
+	}
+
+	log.Printf("INFO: Conversation settings updated: user %d, peer %d", userID, req.OtherUserID)
+	if hub != nil {
+		view := ConversationSettingsView(settings)
+		hub.SendEvent(userID, userID, WsMessage{Type: "conversation_settings_updated", ConversationSettings: &view})
+	}
+	return settings, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/arnnvv/peeple-api/migrations"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DislikeRequest struct {
@@ -18,7 +19,7 @@ type DislikeResponse struct {
 	Message string `json:"message"`
 }
 
-func ProcessDislike(ctx context.Context, queries *migrations.Queries, hub *Hub, dislikerUserID int32, req DislikeRequest) error {
+func ProcessDislike(ctx context.Context, queries *migrations.Queries, pool *pgxpool.Pool, hub *Hub, dislikerUserID int32, req DislikeRequest) error {
 	if req.DislikedUserID <= 0 {
 		return errors.New("valid disliked_user_id is required")
 	}
@@ -40,7 +41,15 @@ func ProcessDislike(ctx context.Context, queries *migrations.Queries, hub *Hub,
 		hadLikedBack = likeExists
 	}
 
-	err := queries.AddDislike(ctx, migrations.AddDislikeParams{
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		log.Printf("ProcessDislike ERROR: Failed begin transaction user %d: %v", dislikerUserID, err)
+		return errors.New("failed to process dislike")
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	err = qtx.AddDislike(ctx, migrations.AddDislikeParams{
 		DislikerUserID: dislikerUserID,
 		DislikedUserID: req.DislikedUserID,
 	})
@@ -49,14 +58,23 @@ func ProcessDislike(ctx context.Context, queries *migrations.Queries, hub *Hub,
 		return errors.New("failed to process dislike")
 	}
 
-	log.Printf("ProcessDislike INFO: Dislike processed: User %d -> User %d", dislikerUserID, req.DislikedUserID)
-
 	if hadLikedBack && hub != nil {
 		log.Printf("ProcessDislike INFO: Dislike from %d removed like from %d. Notifying user %d.", dislikerUserID, req.DislikedUserID, req.DislikedUserID)
-		removalInfo := WsLikeRemovalInfo{
-			LikerUserID: dislikerUserID,
+		if err := hub.QueueEvent(ctx, qtx, req.DislikedUserID, dislikerUserID, likeRemovedEvent(dislikerUserID)); err != nil {
+			log.Printf("ProcessDislike ERROR: Failed queue like_removed for %d: %v", req.DislikedUserID, err)
+			return errors.New("failed to process dislike")
 		}
-		go hub.BroadcastLikeRemoved(req.DislikedUserID, removalInfo)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("ProcessDislike ERROR: Failed commit dislike %d -> %d: %v", dislikerUserID, req.DislikedUserID, err)
+		return errors.New("failed to process dislike")
+	}
+
+	log.Printf("ProcessDislike INFO: Dislike processed: User %d -> User %d", dislikerUserID, req.DislikedUserID)
+
+	if hub != nil {
+		hub.FlushEvents()
 	}
 
 	return nil
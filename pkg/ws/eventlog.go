@@ -0,0 +1,173 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultEventLogRetention = 7 * 24 * time.Hour
+	eventLogPruneInterval    = time.Hour
+	syncBatchSize            = 200
+)
+
+// EventLogRetention is how long events stay replayable. Clients that were
+// offline for longer get a sync_reset and must refetch. Override with
+// EVENT_LOG_RETENTION (a Go duration).
+func EventLogRetention() time.Duration {
+	return utils.DurationFromEnv("EVENT_LOG_RETENTION", defaultEventLogRetention)
+}
+
+// SendEvent queues msg for userID on its own, for events that don't
+// accompany a transactional write (see QueueEvent). The event is logged
+// whether or not the user is connected, so a later "sync" replays it, and
+// users with no connection also get a push notification for it. If it
+// can't be queued it is published directly, without a seq.
+func (h *Hub) SendEvent(userID int32, senderUserID int32, msg WsMessage) bool {
+	ctx := context.Background()
+	msg.EventID = Ptr(newEventID())
+	err := h.QueueEvent(ctx, h.dbQueries, userID, senderUserID, msg)
+	if err == nil {
+		h.FlushEvents()
+		return true
+	}
+	log.Printf("Hub WARN: Failed to queue %s event for user %d, publishing directly: %v", msg.Type, userID, err)
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Hub ERROR: Failed marshal %s event for user %d: %v", msg.Type, userID, err)
+		return false
+	}
+	h.notifyIfOffline(ctx, userID, msg)
+
+	redisMsg := RedisWsMessage{
+		Type:            RedisMsgTypeDirect,
+		TargetUserID:    &userID,
+		OriginalPayload: payload,
+		SenderUserID:    senderUserID,
+	}
+	if err := h.publishToRedis(ctx, redisMsg); err != nil {
+		log.Printf("Hub WARN: Failed to publish %s event for user %d via Redis: %v", msg.Type, userID, err)
+		return false
+	}
+	return true
+}
+
+// replayEvents sends the client every logged event after lastSeq, in order,
+// followed by sync_complete carrying the last seq sent. Events logged while
+// the replay runs may arrive both live and replayed; clients drop any seq
+// they have already applied. If events after lastSeq have been pruned, the
+// client gets sync_reset instead and must refetch its state.
+func (c *Client) replayEvents(ctx context.Context, queries *migrations.Queries, lastSeq int64) {
+	bounds, err := queries.GetUserEventBounds(ctx, c.UserID)
+	if err != nil {
+		log.Printf("Client Sync ERROR: Failed to get event bounds for user %d: %v", c.UserID, err)
+		c.sendWsError("Failed to sync events")
+		return
+	}
+
+	pruned := lastSeq < bounds.LatestSeq && (bounds.OldestSeq == 0 || lastSeq+1 < bounds.OldestSeq)
+	if lastSeq < 0 || lastSeq > bounds.LatestSeq || pruned {
+		log.Printf("Client Sync INFO: User %d sent last_seq %d outside log [%d, %d], resetting", c.UserID, lastSeq, bounds.OldestSeq, bounds.LatestSeq)
+		c.sendSyncMessage(WsMessage{Type: "sync_reset", Seq: &bounds.LatestSeq})
+		return
+	}
+
+	seq := lastSeq
+	replayed := 0
+	for seq < bounds.LatestSeq {
+		events, err := queries.GetUserEventsAfter(ctx, migrations.GetUserEventsAfterParams{
+			UserID: c.UserID,
+			Seq:    seq,
+			Limit:  syncBatchSize,
+		})
+		if err != nil {
+			log.Printf("Client Sync ERROR: Failed to fetch events after %d for user %d: %v", seq, c.UserID, err)
+			c.sendWsError("Failed to sync events")
+			return
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, event := range events {
+			var msg WsMessage
+			if err := json.Unmarshal(event.Payload, &msg); err != nil {
+				log.Printf("Client Sync ERROR: Corrupt event %d for user %d: %v", event.Seq, c.UserID, err)
+			} else {
+				msg.Seq = &event.Seq
+				if !c.sendSyncMessage(msg) {
+					return
+				}
+				replayed++
+			}
+			seq = event.Seq
+		}
+	}
+
+	log.Printf("Client Sync INFO: Replayed %d events to user %d (seq %d -> %d)", replayed, c.UserID, lastSeq, seq)
+	c.sendSyncMessage(WsMessage{Type: "sync_complete", Seq: &seq, Count: PtrInt64(int64(replayed))})
+}
+
+// sendSyncMessage queues msg for the client, waiting for room in the send
+// buffer rather than dropping it. It returns false if the client stops
+// reading.
+func (c *Client) sendSyncMessage(msg WsMessage) bool {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Client Sync ERROR: Failed marshal %s for user %d: %v", msg.Type, c.UserID, err)
+		return true
+	}
+	select {
+	case c.Send <- msgBytes:
+		return true
+	case <-time.After(writeWait):
+		log.Printf("Client Sync WARN: Send buffer full for user %d, aborting replay", c.UserID)
+		return false
+	}
+}
+
+// RunEventLogPruner deletes events older than EventLogRetention, and
+// published outbox events, every hour until ctx is cancelled.
+func RunEventLogPruner(ctx context.Context, queries *migrations.Queries) {
+	retention := EventLogRetention()
+	log.Printf("Event log pruner started (retention %s)", retention)
+	ticker := time.NewTicker(eventLogPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Event log pruner stopped.")
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := pgtype.Timestamptz{Time: time.Now().Add(-retention), Valid: true}
+		n, err := queries.PruneUserEvents(ctx, cutoff)
+		if err != nil {
+			log.Printf("ERROR: event log: prune failed: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("INFO: event log: pruned %d events older than %s", n, retention)
+		}
+
+		n, err = queries.PruneEventOutbox(ctx, migrations.PruneEventOutboxParams{
+			PublishedBefore: pgtype.Timestamptz{Time: time.Now().Add(-publishedEventRetention), Valid: true},
+			CreatedBefore:   cutoff,
+		})
+		if err != nil {
+			log.Printf("ERROR: event outbox: prune failed: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("INFO: event outbox: pruned %d events", n)
+		}
+	}
+}
@@ -9,13 +9,16 @@ import (
 	"time"
 
 	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/push"
 	"github.com/go-redis/redis_rate/v10"
 	"github.com/jackc/pgx/v5"
 	"github.com/redis/go-redis/v9"
 )
 
 type Hub struct {
-	clients     map[int32]*Client
+	// clients holds every connection on this instance, keyed by user. A user
+	// may have one connection per device.
+	clients     map[int32]map[*Client]struct{}
 	register    chan *Client
 	unregister  chan *Client
 	clientsMu   sync.RWMutex
@@ -24,6 +27,9 @@ type Hub struct {
 	hubContext  context.Context
 	hubCancel   context.CancelFunc
 	rateLimiter *redis_rate.Limiter
+	pusher      *push.Dispatcher // nil when no push provider is configured
+	relayWake   chan struct{}
+	instanceID  string // distinguishes this instance's connections in presence
 }
 
 func NewHub(db *migrations.Queries, rds *redis.Client, limiter *redis_rate.Limiter) *Hub {
@@ -40,65 +46,83 @@ func NewHub(db *migrations.Queries, rds *redis.Client, limiter *redis_rate.Limit
 	return &Hub{
 		register:    make(chan *Client),
 		unregister:  make(chan *Client),
-		clients:     make(map[int32]*Client),
+		clients:     make(map[int32]map[*Client]struct{}),
 		dbQueries:   db,
 		redisClient: rds,
 		hubContext:  ctx,
 		hubCancel:   cancel,
 		rateLimiter: limiter,
+		relayWake:   make(chan struct{}, 1),
+		instanceID:  randomID(6),
 	}
 }
 
 func (h *Hub) Run() {
 	log.Println("Hub: Starting run loop and Redis subscription...")
 	go h.subscribeToMessages()
+	go h.runEventRelay(h.hubContext)
+	go h.runPresence(h.hubContext)
 
 	for {
 		select {
 		case client := <-h.register:
 			h.clientsMu.Lock()
-			log.Printf("Hub: Registering client for user %d", client.UserID)
-			if oldClient, exists := h.clients[client.UserID]; exists {
-				log.Printf("Hub: Closing stale connection for user %d", client.UserID)
-				close(oldClient.Send)
+			log.Printf("Hub: Registering client for user %d (device %s)", client.UserID, client.DeviceID)
+			var replaced *Client
+			for existing := range h.clients[client.UserID] {
+				if existing.DeviceID == client.DeviceID {
+					replaced = existing
+					break
+				}
+			}
+			if replaced != nil {
+				log.Printf("Hub: Closing stale connection for user %d device %s", client.UserID, client.DeviceID)
+				delete(h.clients[client.UserID], replaced)
+				close(replaced.Send)
+			}
+			if h.clients[client.UserID] == nil {
+				h.clients[client.UserID] = make(map[*Client]struct{})
 			}
-			h.clients[client.UserID] = client
+			h.clients[client.UserID][client] = struct{}{}
 			h.clientsMu.Unlock()
 
-			go func(uid int32) {
+			go func(c *Client, replaced *Client) {
 				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer cancel()
-				err := h.dbQueries.SetUserOnline(ctx, uid)
-				if err != nil {
-					log.Printf("Hub: Failed to set user %d online in DB: %v", uid, err)
+				first := h.addSession(ctx, c)
+				if replaced != nil {
+					h.removeSession(ctx, replaced)
 				}
-				h.broadcastStatusChange(uid, true)
-			}(client.UserID)
+				if first {
+					h.broadcastStatusChange(c.UserID, true)
+				}
+				h.sendStatusesOfMatchesToClient(c)
+			}(client, replaced)
 
 		case client := <-h.unregister:
 			clientID := client.UserID
-			go func(uid int32) {
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
-				err := h.dbQueries.SetUserOffline(ctx, uid)
-				if err != nil {
-					log.Printf("Hub: Failed to set user %d offline and update last_online in DB: %v", uid, err)
-				}
-				h.broadcastStatusChange(uid, false)
-			}(clientID)
-
 			h.clientsMu.Lock()
-			if currentClient, ok := h.clients[clientID]; ok && currentClient == client {
-				log.Printf("Hub: Unregistering client for user %d", clientID)
-				delete(h.clients, clientID)
-				select {
-				case <-client.Send:
-				default:
-					close(client.Send)
+			_, registered := h.clients[clientID][client]
+			if registered {
+				log.Printf("Hub: Unregistering client for user %d (device %s)", clientID, client.DeviceID)
+				delete(h.clients[clientID], client)
+				if len(h.clients[clientID]) == 0 {
+					delete(h.clients, clientID)
 				}
+				close(client.Send)
 			}
 			h.clientsMu.Unlock()
 
+			if registered {
+				go func(c *Client) {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					if h.removeSession(ctx, c) {
+						h.broadcastStatusChange(c.UserID, false)
+					}
+				}(client)
+			}
+
 		case <-h.hubContext.Done():
 			log.Println("Hub: Context cancelled, shutting down Run loop.")
 			return
@@ -154,11 +178,11 @@ func (h *Hub) handleRedisMessage(payload string) {
 	case RedisMsgTypeDirect:
 		if redisMsg.TargetUserID != nil {
 			targetID := *redisMsg.TargetUserID
-			if client, ok := h.clients[targetID]; ok {
+			for client := range h.clients[targetID] {
 				select {
 				case client.Send <- redisMsg.OriginalPayload:
 				default:
-					log.Printf("Hub Subscriber WARN: Send channel full or closed for user %d.", targetID)
+					log.Printf("Hub Subscriber WARN: Send channel full or closed for user %d device %s.", targetID, client.DeviceID)
 				}
 			}
 		} else {
@@ -171,7 +195,7 @@ func (h *Hub) handleRedisMessage(payload string) {
 				if targetID == redisMsg.SenderUserID {
 					continue
 				}
-				if client, ok := h.clients[targetID]; ok {
+				for client := range h.clients[targetID] {
 					select {
 					case client.Send <- redisMsg.OriginalPayload:
 					default:
@@ -182,6 +206,18 @@ func (h *Hub) handleRedisMessage(payload string) {
 		} else {
 			log.Printf("Hub Subscriber WARN: Received broadcast_matches message from Redis without TargetUserIDs.")
 		}
+	case RedisMsgTypeDisconnect:
+		if redisMsg.TargetUserID == nil {
+			log.Printf("Hub Subscriber WARN: Received disconnect message from Redis without TargetUserID.")
+			break
+		}
+		targetID := *redisMsg.TargetUserID
+		for client := range h.clients[targetID] {
+			if redisMsg.SessionID == "" || client.SessionID == redisMsg.SessionID {
+				log.Printf("Hub Subscriber INFO: Closing revoked connection for user %d device %s", targetID, client.DeviceID)
+				go client.closeRevoked()
+			}
+		}
 	default:
 		log.Printf("Hub Subscriber WARN: Received unknown message type from Redis: '%s'", redisMsg.Type)
 	}
@@ -216,6 +252,19 @@ func (h *Hub) SendToUser(userID int32, message []byte) bool {
 	return true
 }
 
+// DisconnectUser closes the user's live connections for sessionID on
+// whichever instances hold them. An empty sessionID matches every session.
+func (h *Hub) DisconnectUser(userID int32, sessionID string) {
+	redisMsg := RedisWsMessage{
+		Type:         RedisMsgTypeDisconnect,
+		TargetUserID: &userID,
+		SessionID:    sessionID,
+	}
+	if err := h.publishToRedis(context.Background(), redisMsg); err != nil {
+		log.Printf("Hub WARN: Failed to publish disconnect for user %d via Redis: %v", userID, err)
+	}
+}
+
 func (h *Hub) getMatchIDs(ctx context.Context, userID int32) ([]int32, error) {
 	matchIDs, err := h.dbQueries.GetMatchIDs(ctx, userID)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
@@ -266,29 +315,28 @@ func (h *Hub) broadcastStatusChange(userID int32, isOnline bool) {
 	if err != nil {
 		log.Printf("Hub WARN: Failed to publish status change for user %d via Redis: %v", userID, err)
 	}
-
-	if isOnline {
-		h.sendStatusesOfMatchesToUser(userID, matchIDs)
-	}
 }
 
-func (h *Hub) sendStatusesOfMatchesToUser(targetUser int32, matchIDs []int32) {
-	if len(matchIDs) == 0 {
+// sendStatusesOfMatchesToClient tells a newly connected client which of the
+// user's matches are online on any instance.
+func (h *Hub) sendStatusesOfMatchesToClient(c *Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	matchIDs, err := h.getMatchIDs(ctx, c.UserID)
+	if err != nil || len(matchIDs) == 0 {
 		return
 	}
-
-	h.clientsMu.RLock()
-	connectedMatches := make(map[int32]bool)
-	for _, matchID := range matchIDs {
-		if _, isConnected := h.clients[matchID]; isConnected {
-			connectedMatches[matchID] = true
-		}
+	connectedMatches, err := h.connectedUsers(ctx, matchIDs)
+	if err != nil {
+		log.Printf("Hub WARN: Failed to look up match presence for user %d: %v", c.UserID, err)
+		return
 	}
-	targetClient, isTargetConnected := h.clients[targetUser]
-	h.clientsMu.RUnlock()
 
-	if !isTargetConnected {
-		log.Printf("Hub WARN: Cannot send initial statuses to user %d, they disconnected.", targetUser)
+	h.clientsMu.RLock()
+	defer h.clientsMu.RUnlock()
+	if _, stillConnected := h.clients[c.UserID][c]; !stillConnected {
+		log.Printf("Hub WARN: Cannot send initial statuses to user %d, they disconnected.", c.UserID)
 		return
 	}
 
@@ -305,9 +353,9 @@ func (h *Hub) sendStatusesOfMatchesToUser(targetUser int32, matchIDs []int32) {
 			continue
 		}
 		select {
-		case targetClient.Send <- messageBytes:
+		case c.Send <- messageBytes:
 		default:
-			log.Printf("Hub WARN: Send channel full/closed for target user %d while sending initial statuses.", targetUser)
+			log.Printf("Hub WARN: Send channel full/closed for target user %d while sending initial statuses.", c.UserID)
 			return
 		}
 	}
@@ -323,105 +371,18 @@ func (h *Hub) BroadcastReaction(messageID int64, reactorUserID int32, emoji stri
 	if !isRemoved {
 		reactionMsg.Emoji = &emoji
 	}
-	messageBytes, err := json.Marshal(reactionMsg)
-	if err != nil {
-		log.Printf("Hub ERROR: Failed marshal reaction update msg %d: %v", messageID, err)
-		return
-	}
-
-	redisMsg := RedisWsMessage{
-		Type:            RedisMsgTypeBroadcastMatches,
-		TargetUserIDs:   participants,
-		OriginalPayload: messageBytes,
-		SenderUserID:    reactorUserID,
-	}
-	err = h.publishToRedis(context.Background(), redisMsg)
-	if err != nil {
-		log.Printf("Hub WARN: Failed to publish reaction update for msg %d via Redis: %v", messageID, err)
-	}
-}
-
-func (h *Hub) BroadcastNewLike(recipientUserID int32, likerInfo WsBasicLikerInfo) {
-	wsMsg := WsMessage{Type: "new_like_received", LikerInfo: &likerInfo}
-	messageBytes, err := json.Marshal(wsMsg)
-	if err != nil {
-		log.Printf("Hub ERROR: Failed marshal new_like msg for %d: %v", recipientUserID, err)
-		return
-	}
-	redisMsg := RedisWsMessage{
-		Type:            RedisMsgTypeDirect,
-		TargetUserID:    &recipientUserID,
-		OriginalPayload: messageBytes,
-		SenderUserID:    likerInfo.LikerUserID,
-	}
-	err = h.publishToRedis(context.Background(), redisMsg)
-	if err != nil {
-		log.Printf("Hub WARN: Failed to publish new_like_received message for user %d via Redis: %v", recipientUserID, err)
-	} else {
-		log.Printf("Hub INFO: Published new_like_received notification via Redis for user %d.", recipientUserID)
-	}
-}
-
-func (h *Hub) BroadcastNewMatch(targetUserID int32, matchInfo WsMatchInfo) {
-	wsMsg := WsMessage{Type: "new_match", MatchInfo: &matchInfo}
-	messageBytes, err := json.Marshal(wsMsg)
-	if err != nil {
-		log.Printf("Hub ERROR: Failed marshal new_match msg for %d: %v", targetUserID, err)
-		return
-	}
-	redisMsg := RedisWsMessage{
-		Type:            RedisMsgTypeDirect,
-		TargetUserID:    &targetUserID,
-		OriginalPayload: messageBytes,
-		SenderUserID:    matchInfo.MatchedUserID,
-	}
-	err = h.publishToRedis(context.Background(), redisMsg)
-	if err != nil {
-		log.Printf("Hub WARN: Failed to publish new_match message for user %d via Redis: %v", targetUserID, err)
-	} else {
-		log.Printf("Hub INFO: Published new_match notification via Redis for user %d.", targetUserID)
+	for _, participantID := range participants {
+		if participantID == reactorUserID {
+			continue
+		}
+		h.SendEvent(participantID, reactorUserID, reactionMsg)
 	}
 }
 
-func (h *Hub) BroadcastLikeRemoved(recipientUserID int32, removalInfo WsLikeRemovalInfo) {
-	wsMsg := WsMessage{Type: "like_removed", RemovalInfo: &removalInfo}
-	messageBytes, err := json.Marshal(wsMsg)
-	if err != nil {
-		log.Printf("Hub ERROR: Failed marshal like_removed msg for %d: %v", recipientUserID, err)
-		return
-	}
-	redisMsg := RedisWsMessage{
-		Type:            RedisMsgTypeDirect,
-		TargetUserID:    &recipientUserID,
-		OriginalPayload: messageBytes,
-		SenderUserID:    removalInfo.LikerUserID,
-	}
-	err = h.publishToRedis(context.Background(), redisMsg)
-	if err != nil {
-		log.Printf("Hub WARN: Failed to publish like_removed message for user %d via Redis: %v", recipientUserID, err)
-	} else {
-		log.Printf("Hub INFO: Published like_removed notification via Redis for user %d.", recipientUserID)
-	}
+func likeRemovedEvent(likerUserID int32) WsMessage {
+	return WsMessage{Type: "like_removed", RemovalInfo: &WsLikeRemovalInfo{LikerUserID: likerUserID}}
 }
 
-func (h *Hub) BroadcastMatchRemoved(recipientUserID int32, unmatcherUserID int32) {
-	payload := &WsLikeRemovalInfo{LikerUserID: unmatcherUserID}
-	wsMsg := WsMessage{Type: "match_removed", RemovalInfo: payload}
-	messageBytes, err := json.Marshal(wsMsg)
-	if err != nil {
-		log.Printf("Hub ERROR: Failed marshal match_removed msg for %d: %v", recipientUserID, err)
-		return
-	}
-	redisMsg := RedisWsMessage{
-		Type:            RedisMsgTypeDirect,
-		TargetUserID:    &recipientUserID,
-		OriginalPayload: messageBytes,
-		SenderUserID:    unmatcherUserID,
-	}
-	err = h.publishToRedis(context.Background(), redisMsg)
-	if err != nil {
-		log.Printf("Hub WARN: Failed to publish match_removed message for user %d via Redis: %v", recipientUserID, err)
-	} else {
-		log.Printf("Hub INFO: Published match_removed notification via Redis for user %d.", recipientUserID)
-	}
+func matchRemovedEvent(unmatcherUserID int32) WsMessage {
+	return WsMessage{Type: "match_removed", RemovalInfo: &WsLikeRemovalInfo{LikerUserID: unmatcherUserID}}
 }
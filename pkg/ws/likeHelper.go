@@ -72,6 +72,14 @@ func ProcessLike(ctx context.Context, queries *migrations.Queries, pool *pgxpool
 		return errors.New("error checking liked user")
 	}
 
+	if err := checkNotBlocked(ctx, queries, likerUserID, req.LikedUserID); err != nil {
+		if errors.Is(err, ErrBlocked) {
+			return ErrBlocked
+		}
+		log.Printf("ERROR: ProcessLike: Failed block check %d <-> %d: %v", likerUserID, req.LikedUserID, err)
+		return errors.New("error checking liked user")
+	}
+
 	reverseLikeExists := false
 	reverseLikeParams := migrations.CheckLikeExistsParams{
 		LikerUserID: req.LikedUserID,
@@ -138,96 +146,121 @@ func ProcessLike(ctx context.Context, queries *migrations.Queries, pool *pgxpool
 		InteractionType:   interactionType,
 	}
 
+	// The like and the events announcing it commit together, so a crash
+	// can't lose the notification of a like that was saved.
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		log.Printf("ERROR: ProcessLike: Failed begin transaction user %d: %v", likerUserID, err)
+		return errors.New("database transaction error")
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
 	var likeErr error
 	var savedLike migrations.Like
 	if interactionType == migrations.LikeInteractionTypeRose {
-		savedLike, likeErr = handleRoseLikeAndGet(ctx, queries, pool, addLikeParams)
+		savedLike, likeErr = handleRoseLikeAndGet(ctx, qtx, addLikeParams)
 	} else {
-		savedLike, likeErr = handleStandardLikeAndGet(ctx, queries, addLikeParams)
+		savedLike, likeErr = handleStandardLikeAndGet(ctx, qtx, addLikeParams)
 	}
 	if likeErr != nil {
 		log.Printf("ERROR: ProcessLike: Failed %s like: User=%d -> User=%d, Error=%v", interactionType, likerUserID, req.LikedUserID, likeErr)
 		return likeErr
 	}
 
-	isNowMutualLike, checkErr := queries.CheckMutualLikeExists(ctx, migrations.CheckMutualLikeExistsParams{
+	isNowMutualLike, err := qtx.CheckMutualLikeExists(ctx, migrations.CheckMutualLikeExistsParams{
 		LikerUserID: likerUserID,
 		LikedUserID: req.LikedUserID,
 	})
-	if checkErr != nil {
-		log.Printf("WARN: ProcessLike: Failed check mutual like after like (%d -> %d): %v", likerUserID, req.LikedUserID, checkErr)
-	} else {
-		go func(
-			bgCtx context.Context,
-			q *migrations.Queries,
-			h *Hub,
-			isMatch bool,
-			likerID int32,
-			likedID int32,
-			likeData migrations.Like,
-		) {
-			if isMatch {
-				log.Printf("ProcessLike INFO: Match occurred between %d and %d!", likerID, likedID)
-				basicInfoA, errA := q.GetBasicMatchInfo(bgCtx, likerID)
-				if errA != nil {
-					log.Printf("ProcessLike ERROR: Failed get match info %d: %v", likerID, errA)
-					return
-				}
-				basicInfoB, errB := q.GetBasicMatchInfo(bgCtx, likedID)
-				if errB != nil {
-					log.Printf("ProcessLike ERROR: Failed get match info %d: %v", likedID, errB)
-					return
-				}
-
-				matchInfoForA := WsMatchInfo{
-					MatchedUserID:         likedID,
-					Name:                  buildFullName(basicInfoB.Name, basicInfoB.LastName),
-					FirstProfilePicURL:    getFirstMediaURL(basicInfoB.MediaUrls),
-					IsOnline:              basicInfoB.IsOnline,
-					LastOnline:            pgTimestampToTimePtr(basicInfoB.LastOnline),
-					InitiatingLikerUserID: likedID,
-				}
-				h.BroadcastNewMatch(likerID, matchInfoForA)
-
-				matchInfoForB := WsMatchInfo{
-					MatchedUserID:         likerID,
-					Name:                  buildFullName(basicInfoA.Name, basicInfoA.LastName),
-					FirstProfilePicURL:    getFirstMediaURL(basicInfoA.MediaUrls),
-					IsOnline:              basicInfoA.IsOnline,
-					LastOnline:            pgTimestampToTimePtr(basicInfoA.LastOnline),
-					InitiatingLikerUserID: likerID,
-				}
-				h.BroadcastNewMatch(likedID, matchInfoForB)
-
-			} else {
-				log.Printf("ProcessLike INFO: New like (no match) from %d to %d.", likerID, likedID)
-				basicInfoLiker, errLiker := q.GetBasicUserInfo(bgCtx, likerID)
-				if errLiker != nil {
-					log.Printf("ProcessLike ERROR: Failed get basic info %d: %v", likerID, errLiker)
-					return
-				}
-
-				var commentPtr *string
-				if likeData.Comment.Valid {
-					commentPtr = &likeData.Comment.String
-				}
-				likerInfoPayload := WsBasicLikerInfo{
-					LikerUserID:        likerID,
-					Name:               buildFullName(basicInfoLiker.Name, basicInfoLiker.LastName),
-					FirstProfilePicURL: getFirstMediaURL(basicInfoLiker.MediaUrls),
-					IsRose:             likeData.InteractionType == migrations.LikeInteractionTypeRose,
-					LikeComment:        commentPtr,
-					LikedAt:            likeData.CreatedAt,
-				}
-				h.BroadcastNewLike(likedID, likerInfoPayload)
-			}
-		}(context.Background(), queries, hub, isNowMutualLike.Bool, likerUserID, req.LikedUserID, savedLike)
+	if err != nil {
+		log.Printf("ERROR: ProcessLike: Failed check mutual like after like (%d -> %d): %v", likerUserID, req.LikedUserID, err)
+		return errors.New("failed to record like")
+	}
+	if hub != nil {
+		if err := queueLikeEvents(ctx, qtx, hub, isNowMutualLike.Bool, likerUserID, req.LikedUserID, savedLike); err != nil {
+			log.Printf("ERROR: ProcessLike: Failed queue like events (%d -> %d): %v", likerUserID, req.LikedUserID, err)
+			return errors.New("failed to record like")
+		}
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("ERROR: ProcessLike: Failed commit like %d -> %d: %v", likerUserID, req.LikedUserID, err)
+		return errors.New("database commit error")
+	}
+	if hub != nil {
+		hub.FlushEvents()
+	}
 	return nil
 }
 
-func handleRoseLikeAndGet(ctx context.Context, queries *migrations.Queries, pool *pgxpool.Pool, params migrations.AddContentLikeParams) (migrations.Like, error) {
+// queueLikeEvents queues new_match for both users if the like made a match,
+// or new_like_received for the liked user otherwise.
+func queueLikeEvents(ctx context.Context, qtx *migrations.Queries, hub *Hub, isMatch bool, likerID int32, likedID int32, likeData migrations.Like) error {
+	if isMatch {
+		log.Printf("ProcessLike INFO: Match occurred between %d and %d!", likerID, likedID)
+		basicInfoA, err := qtx.GetBasicMatchInfo(ctx, likerID)
+		if err != nil {
+			return fmt.Errorf("get match info %d: %w", likerID, err)
+		}
+		basicInfoB, err := qtx.GetBasicMatchInfo(ctx, likedID)
+		if err != nil {
+			return fmt.Errorf("get match info %d: %w", likedID, err)
+		}
+
+		presence, err := hub.Presence(ctx, []int32{likerID, likedID})
+		if err != nil {
+			log.Printf("ProcessLike WARN: Failed presence lookup for match %d <-> %d: %v", likerID, likedID, err)
+		}
+		isOnlineA, lastOnlineA := ResolvePresence(presence, likerID, basicInfoA.IsOnline, basicInfoA.LastOnline)
+		isOnlineB, lastOnlineB := ResolvePresence(presence, likedID, basicInfoB.IsOnline, basicInfoB.LastOnline)
+
+		matchInfoForA := WsMatchInfo{
+			MatchedUserID:         likedID,
+			Name:                  buildFullName(basicInfoB.Name, basicInfoB.LastName),
+			FirstProfilePicURL:    getFirstMediaURL(basicInfoB.MediaUrls),
+			IsOnline:              isOnlineB,
+			LastOnline:            lastOnlineB,
+			InitiatingLikerUserID: likedID,
+		}
+		if err := hub.QueueEvent(ctx, qtx, likerID, likedID, WsMessage{Type: "new_match", MatchInfo: &matchInfoForA}); err != nil {
+			return err
+		}
+
+		matchInfoForB := WsMatchInfo{
+			MatchedUserID:         likerID,
+			Name:                  buildFullName(basicInfoA.Name, basicInfoA.LastName),
+			FirstProfilePicURL:    getFirstMediaURL(basicInfoA.MediaUrls),
+			IsOnline:              isOnlineA,
+			LastOnline:            lastOnlineA,
+			InitiatingLikerUserID: likerID,
+		}
+		return hub.QueueEvent(ctx, qtx, likedID, likerID, WsMessage{Type: "new_match", MatchInfo: &matchInfoForB})
+	}
+
+	log.Printf("ProcessLike INFO: New like (no match) from %d to %d.", likerID, likedID)
+	basicInfoLiker, err := qtx.GetBasicUserInfo(ctx, likerID)
+	if err != nil {
+		return fmt.Errorf("get basic info %d: %w", likerID, err)
+	}
+
+	var commentPtr *string
+	if likeData.Comment.Valid {
+		commentPtr = &likeData.Comment.String
+	}
+	likerInfoPayload := WsBasicLikerInfo{
+		LikerUserID:        likerID,
+		Name:               buildFullName(basicInfoLiker.Name, basicInfoLiker.LastName),
+		FirstProfilePicURL: getFirstMediaURL(basicInfoLiker.MediaUrls),
+		IsRose:             likeData.InteractionType == migrations.LikeInteractionTypeRose,
+		LikeComment:        commentPtr,
+		LikedAt:            likeData.CreatedAt,
+	}
+	return hub.QueueEvent(ctx, qtx, likedID, likerID, WsMessage{Type: "new_like_received", LikerInfo: &likerInfoPayload})
+}
+
+// handleRoseLikeAndGet spends a rose on the like. queries must be bound to a
+// transaction so the rose is refunded if the like isn't saved.
+func handleRoseLikeAndGet(ctx context.Context, queries *migrations.Queries, params migrations.AddContentLikeParams) (migrations.Like, error) {
 	consumable, err := queries.GetUserConsumable(ctx, migrations.GetUserConsumableParams{UserID: params.LikerUserID, ConsumableType: migrations.PremiumFeatureTypeRose})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -239,15 +272,7 @@ func handleRoseLikeAndGet(ctx context.Context, queries *migrations.Queries, pool
 		return migrations.Like{}, ErrInsufficientConsumables
 	}
 
-	tx, err := pool.Begin(ctx)
-	if err != nil {
-		return migrations.Like{}, fmt.Errorf("begin transaction error: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
-	qtx := queries.WithTx(tx)
-
-	_, err = qtx.DecrementUserConsumable(ctx, migrations.DecrementUserConsumableParams{
+	_, err = queries.DecrementUserConsumable(ctx, migrations.DecrementUserConsumableParams{
 		UserID:         params.LikerUserID,
 		ConsumableType: migrations.PremiumFeatureTypeRose},
 	)
@@ -258,7 +283,7 @@ func handleRoseLikeAndGet(ctx context.Context, queries *migrations.Queries, pool
 		return migrations.Like{}, fmt.Errorf("failed to use rose: %w", err)
 	}
 
-	savedLike, err := qtx.AddContentLike(ctx, params)
+	savedLike, err := queries.AddContentLike(ctx, params)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("handleRoseLikeAndGet WARN: Like already exists (conflict detected) for %d -> %d (%s:%s)", params.LikerUserID, params.LikedUserID, params.ContentType, params.ContentIdentifier)
@@ -268,10 +293,6 @@ func handleRoseLikeAndGet(ctx context.Context, queries *migrations.Queries, pool
 		return migrations.Like{}, fmt.Errorf("failed to record like: %w", err)
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		return migrations.Like{}, fmt.Errorf("commit transaction error: %w", err)
-	}
-
 	log.Printf("INFO: Rose like processed successfully: User=%d -> User=%d, Content=%s:%s", params.LikerUserID, params.LikedUserID, params.ContentType, params.ContentIdentifier)
 	return savedLike, nil
 }
@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/arnnvv/peeple-api/migrations"
@@ -29,18 +30,38 @@ type WsLikeRemovalInfo struct {
 	LikerUserID int32 `json:"liker_user_id"`
 }
 
+type WsSpotlightInfo struct {
+	ActivatedAt time.Time `json:"activated_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
 type WsMessage struct {
 	Type string `json:"type"`
 	ID   *int64 `json:"id,omitempty"`
 
+	// Seq is the event's position in the recipient's event log; LastSeq is
+	// what a client sends with "sync" to replay events after it.
+	Seq     *int64 `json:"seq,omitempty"`
+	LastSeq *int64 `json:"last_seq,omitempty"`
+	// EventID identifies a logged event. The relay delivers at least once,
+	// so clients drop an event_id they have already seen.
+	EventID *string `json:"event_id,omitempty"`
+
 	SenderUserID     *int32  `json:"sender_user_id,omitempty"`
 	RecipientUserID  *int32  `json:"recipient_user_id,omitempty"`
+	Kind             *string `json:"kind,omitempty"`
 	Text             *string `json:"text,omitempty"`
 	MediaURL         *string `json:"media_url,omitempty"`
 	MediaType        *string `json:"media_type,omitempty"`
 	SentAt           *string `json:"sent_at,omitempty"`
 	ReplyToMessageID *int64  `json:"reply_to_message_id,omitempty"`
 	MessageID        *int64  `json:"message_id,omitempty"`
+	DeliveredAt      *string `json:"delivered_at,omitempty"`
+	EditedAt         *string `json:"edited_at,omitempty"`
+	DeletedAt        *string `json:"deleted_at,omitempty"`
+
+	// Payload holds a chat message's kind-specific metadata; see messagekinds.go.
+	Payload json.RawMessage `json:"payload,omitempty"`
 
 	Emoji         *string `json:"emoji,omitempty"`
 	ReactorUserID *int32  `json:"reactor_user_id,omitempty"`
@@ -63,15 +84,21 @@ type WsMessage struct {
 	LikePayload    *ContentLikeRequest `json:"like_payload,omitempty"`
 	DislikePayload *DislikeRequest     `json:"dislike_payload,omitempty"`
 	UnmatchPayload *UnmatchRequest     `json:"unmatch_payload,omitempty"`
+	BlockPayload   *BlockRequest       `json:"block_payload,omitempty"`
+
+	ConversationSettingsPayload *ConversationSettingsRequest `json:"conversation_settings_payload,omitempty"`
+	ConversationSettings        *WsConversationSettings      `json:"conversation_settings,omitempty"`
 
 	LikerInfo   *WsBasicLikerInfo  `json:"liker_info,omitempty"`
 	MatchInfo   *WsMatchInfo       `json:"match_info,omitempty"`
 	RemovalInfo *WsLikeRemovalInfo `json:"removal_info,omitempty"`
+	Spotlight   *WsSpotlightInfo   `json:"spotlight,omitempty"`
 }
 
 const (
 	RedisMsgTypeDirect           = "direct"
 	RedisMsgTypeBroadcastMatches = "broadcast_matches"
+	RedisMsgTypeDisconnect       = "disconnect"
 	// broadcast_all
 )
 
@@ -81,6 +108,7 @@ type RedisWsMessage struct {
 	TargetUserIDs   []int32 `json:"target_user_ids"`
 	SenderUserID    int32   `json:"sender_user_id"`
 	OriginalPayload []byte  `json:"original_payload"`
+	SessionID       string  `json:"session_id,omitempty"`
 }
 
 const RedisChannelName = "peeple-websocket-messages"
@@ -95,6 +123,8 @@ func ChatMessageToWsMessage(dbMsg migrations.GetConversationMessagesRow) WsMessa
 		ID:              &dbMsg.ID,
 		SenderUserID:    &dbMsg.SenderUserID,
 		RecipientUserID: &dbMsg.RecipientUserID,
+		Kind:            Ptr(string(dbMsg.Kind)),
+		Payload:         dbMsg.Payload,
 		Text:            nil,
 		MediaURL:        nil,
 		MediaType:       nil,
@@ -112,6 +142,15 @@ func ChatMessageToWsMessage(dbMsg migrations.GetConversationMessagesRow) WsMessa
 	if dbMsg.ReplyToMessageID.Valid {
 		wsMsg.ReplyToMessageID = &dbMsg.ReplyToMessageID.Int64
 	}
+	if dbMsg.DeliveredAt.Valid {
+		wsMsg.DeliveredAt = Ptr(dbMsg.DeliveredAt.Time.UTC().Format(time.RFC3339Nano))
+	}
+	if dbMsg.EditedAt.Valid {
+		wsMsg.EditedAt = Ptr(dbMsg.EditedAt.Time.UTC().Format(time.RFC3339Nano))
+	}
+	if dbMsg.DeletedAt.Valid {
+		wsMsg.DeletedAt = Ptr(dbMsg.DeletedAt.Time.UTC().Format(time.RFC3339Nano))
+	}
 	return wsMsg
 }
 
@@ -0,0 +1,198 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const defaultMessageEditWindow = 15 * time.Minute
+
+// MessageEditWindow is how long after sending a message its sender may edit
+// or unsend it. Override with MESSAGE_EDIT_WINDOW (a Go duration).
+func MessageEditWindow() time.Duration {
+	return utils.DurationFromEnv("MESSAGE_EDIT_WINDOW", defaultMessageEditWindow)
+}
+
+var (
+	errMessageNotFound      = errors.New("message not found")
+	errMessageNotOwned      = errors.New("you can only change messages you sent")
+	errMessageDeleted       = errors.New("message has been deleted")
+	errMessageWindowExpired = errors.New("message can no longer be changed")
+)
+
+// lockOwnMessage loads the message for update and checks that userID sent it
+// within the edit window and hasn't unsent it.
+func lockOwnMessage(ctx context.Context, qtx *migrations.Queries, userID int32, messageID int64) (migrations.ChatMessage, error) {
+	msg, err := qtx.GetChatMessageForUpdate(ctx, messageID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return msg, errMessageNotFound
+		}
+		log.Printf("ERROR: lockOwnMessage: Failed fetch message %d: %v", messageID, err)
+		return msg, errors.New("database error fetching message")
+	}
+	if msg.SenderUserID != userID {
+		return msg, errMessageNotOwned
+	}
+	if msg.DeletedAt.Valid {
+		return msg, errMessageDeleted
+	}
+	if time.Since(msg.SentAt.Time) > MessageEditWindow() {
+		return msg, errMessageWindowExpired
+	}
+	return msg, nil
+}
+
+// ProcessEditMessage replaces the text of one of the user's text messages,
+// keeping the old text in chat_message_edits, and notifies the other
+// participant.
+func ProcessEditMessage(ctx context.Context, queries *migrations.Queries, pool *pgxpool.Pool, hub *Hub, userID int32, messageID int64, newText string) (migrations.ChatMessage, error) {
+	if messageID <= 0 {
+		return migrations.ChatMessage{}, errors.New("valid message_id is required")
+	}
+	if newText == "" || utf8.RuneCountInString(newText) > maxMessageTextLength {
+		return migrations.ChatMessage{}, fmt.Errorf("message text must be 1-%d characters", maxMessageTextLength)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		log.Printf("ERROR: ProcessEditMessage: Failed begin transaction user %d: %v", userID, err)
+		return migrations.ChatMessage{}, errors.New("database transaction error")
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	msg, err := lockOwnMessage(ctx, qtx, userID, messageID)
+	if err != nil {
+		return migrations.ChatMessage{}, err
+	}
+	if msg.Kind != migrations.ChatMessageKindText {
+		return migrations.ChatMessage{}, errors.New("only text messages can be edited")
+	}
+	if msg.MessageText.String == newText {
+		return msg, nil
+	}
+
+	mutualLike, err := qtx.CheckMutualLikeExists(ctx, migrations.CheckMutualLikeExistsParams{
+		LikerUserID: userID,
+		LikedUserID: msg.RecipientUserID,
+	})
+	if err != nil {
+		log.Printf("ERROR: ProcessEditMessage: Failed check mutual like %d -> %d: %v", userID, msg.RecipientUserID, err)
+		return migrations.ChatMessage{}, errors.New("failed to check match status")
+	}
+	if !mutualLike.Valid || !mutualLike.Bool {
+		return migrations.ChatMessage{}, errors.New("you can only message matched users")
+	}
+
+	if err := qtx.CreateChatMessageEdit(ctx, migrations.CreateChatMessageEditParams{
+		MessageID:    messageID,
+		PreviousText: msg.MessageText.String,
+	}); err != nil {
+		log.Printf("ERROR: ProcessEditMessage: Failed record edit history for message %d: %v", messageID, err)
+		return migrations.ChatMessage{}, errors.New("failed to save edit")
+	}
+	updated, err := qtx.UpdateChatMessageText(ctx, migrations.UpdateChatMessageTextParams{
+		ID:          messageID,
+		MessageText: pgtype.Text{String: newText, Valid: true},
+	})
+	if err != nil {
+		log.Printf("ERROR: ProcessEditMessage: Failed update message %d: %v", messageID, err)
+		return migrations.ChatMessage{}, errors.New("failed to save edit")
+	}
+	if hub != nil {
+		if err := hub.QueueEvent(ctx, qtx, updated.RecipientUserID, userID, messageChangeEvent("message_edited", updated)); err != nil {
+			log.Printf("ERROR: ProcessEditMessage: Failed queue edit event for message %d: %v", messageID, err)
+			return migrations.ChatMessage{}, errors.New("failed to save edit")
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("ERROR: ProcessEditMessage: Failed commit edit of message %d: %v", messageID, err)
+		return migrations.ChatMessage{}, errors.New("database commit error")
+	}
+
+	log.Printf("INFO: Message %d edited by user %d", messageID, userID)
+	if hub != nil {
+		hub.FlushEvents()
+	}
+	return updated, nil
+}
+
+// ProcessDeleteMessage unsends one of the user's messages. The row stays as
+// a tombstone with its content and edit history removed, so replies to it
+// still resolve.
+func ProcessDeleteMessage(ctx context.Context, queries *migrations.Queries, pool *pgxpool.Pool, hub *Hub, userID int32, messageID int64) (migrations.ChatMessage, error) {
+	if messageID <= 0 {
+		return migrations.ChatMessage{}, errors.New("valid message_id is required")
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		log.Printf("ERROR: ProcessDeleteMessage: Failed begin transaction user %d: %v", userID, err)
+		return migrations.ChatMessage{}, errors.New("database transaction error")
+	}
+	defer tx.Rollback(ctx)
+	qtx := queries.WithTx(tx)
+
+	if _, err := lockOwnMessage(ctx, qtx, userID, messageID); err != nil {
+		return migrations.ChatMessage{}, err
+	}
+	if err := qtx.DeleteChatMessageEdits(ctx, messageID); err != nil {
+		log.Printf("ERROR: ProcessDeleteMessage: Failed clear edit history of message %d: %v", messageID, err)
+		return migrations.ChatMessage{}, errors.New("failed to delete message")
+	}
+	tombstone, err := qtx.TombstoneChatMessage(ctx, messageID)
+	if err != nil {
+		log.Printf("ERROR: ProcessDeleteMessage: Failed tombstone message %d: %v", messageID, err)
+		return migrations.ChatMessage{}, errors.New("failed to delete message")
+	}
+	if hub != nil {
+		if err := hub.QueueEvent(ctx, qtx, tombstone.RecipientUserID, userID, messageChangeEvent("message_deleted", tombstone)); err != nil {
+			log.Printf("ERROR: ProcessDeleteMessage: Failed queue delete event for message %d: %v", messageID, err)
+			return migrations.ChatMessage{}, errors.New("failed to delete message")
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("ERROR: ProcessDeleteMessage: Failed commit delete of message %d: %v", messageID, err)
+		return migrations.ChatMessage{}, errors.New("database commit error")
+	}
+
+	log.Printf("INFO: Message %d unsent by user %d", messageID, userID)
+	if hub != nil {
+		hub.FlushEvents()
+	}
+	return tombstone, nil
+}
+
+// messageChangeEvent describes an edited, unsent or answered message for
+// both the notification to the other participant and the actor's ack.
+func messageChangeEvent(eventType string, msg migrations.ChatMessage) WsMessage {
+	wsMsg := WsMessage{
+		Type:            eventType,
+		MessageID:       &msg.ID,
+		SenderUserID:    &msg.SenderUserID,
+		RecipientUserID: &msg.RecipientUserID,
+		Kind:            Ptr(string(msg.Kind)),
+		Payload:         msg.Payload,
+	}
+	if msg.MessageText.Valid {
+		wsMsg.Text = &msg.MessageText.String
+	}
+	if msg.EditedAt.Valid {
+		wsMsg.EditedAt = Ptr(msg.EditedAt.Time.UTC().Format(time.RFC3339Nano))
+	}
+	if msg.DeletedAt.Valid {
+		wsMsg.DeletedAt = Ptr(msg.DeletedAt.Time.UTC().Format(time.RFC3339Nano))
+	}
+	return wsMsg
+}
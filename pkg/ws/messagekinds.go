@@ -0,0 +1,356 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Chat messages carry a kind and, for most kinds, a JSON payload with
+// kind-specific metadata. Payloads are decoded strictly into the structs
+// below and stored re-encoded, so only known fields reach the database.
+
+const (
+	maxMessageTextLength   = 500
+	maxMessagePayloadBytes = 4096
+	maxMediaDimension      = 10000
+	maxMediaDurationMs     = 10 * 60 * 1000
+	maxVoiceWaveformPoints = 256
+	maxPlaceNameLength     = 100
+	maxAddressLength       = 200
+	maxLinkURLLength       = 2048
+	maxLinkTitleLength     = 200
+	maxLinkDescLength      = 500
+	maxDateProposalAhead   = 365 * 24 * time.Hour
+)
+
+const (
+	DateProposalPending  = "pending"
+	DateProposalAccepted = "accepted"
+	DateProposalDeclined = "declined"
+)
+
+// MediaPayload describes an image, video or GIF. Duration is only meaningful
+// for video and animated GIFs.
+type MediaPayload struct {
+	Width      int `json:"width"`
+	Height     int `json:"height"`
+	DurationMs int `json:"duration_ms,omitempty"`
+}
+
+type VoiceNotePayload struct {
+	DurationMs int   `json:"duration_ms"`
+	Waveform   []int `json:"waveform,omitempty"` // amplitude samples, 0-255
+}
+
+type LocationPayload struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// DateProposalPayload is created pending; only the recipient can move it to
+// accepted or declined, once.
+type DateProposalPayload struct {
+	ProposedAt  time.Time  `json:"proposed_at"`
+	PlaceName   string     `json:"place_name"`
+	Address     string     `json:"address,omitempty"`
+	Latitude    *float64   `json:"latitude,omitempty"`
+	Longitude   *float64   `json:"longitude,omitempty"`
+	Status      string     `json:"status"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+type LinkPreviewPayload struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// buildChatMessageContent fills the kind, content columns and payload of
+// params from an incoming chat_message. Clients that predate kinds send no
+// kind; it is inferred from the text or media type.
+func buildChatMessageContent(msg WsMessage, params *migrations.CreateChatMessageParams) error {
+	text := derefString(msg.Text)
+	mediaURL := derefString(msg.MediaURL)
+	mediaType := derefString(msg.MediaType)
+	hasPayload := len(msg.Payload) > 0 && !bytes.Equal(msg.Payload, []byte("null"))
+	if len(msg.Payload) > maxMessagePayloadBytes {
+		return errors.New("message payload too large")
+	}
+
+	kind := migrations.ChatMessageKind(derefString(msg.Kind))
+	if kind == "" {
+		switch {
+		case text != "":
+			kind = migrations.ChatMessageKindText
+		case mediaURL != "" && mediaType != "":
+			kind = inferMediaKind(mediaType)
+			if kind == "" {
+				return errors.New("unsupported media type")
+			}
+		default:
+			return errors.New("Invalid message content (text or media required)")
+		}
+	}
+
+	var payload any
+	switch kind {
+	case migrations.ChatMessageKindText:
+		if text == "" || mediaURL != "" || hasPayload {
+			return errors.New("text messages need text only")
+		}
+		if utf8.RuneCountInString(text) > maxMessageTextLength {
+			return errors.New("Message text too long")
+		}
+
+	case migrations.ChatMessageKindImage, migrations.ChatMessageKindVideo, migrations.ChatMessageKindGif:
+		if err := checkMediaFields(kind, text, mediaURL, mediaType); err != nil {
+			return err
+		}
+		if hasPayload {
+			var p MediaPayload
+			if err := decodeMessagePayload(kind, msg.Payload, &p); err != nil {
+				return err
+			}
+			if p.Width <= 0 || p.Width > maxMediaDimension || p.Height <= 0 || p.Height > maxMediaDimension {
+				return fmt.Errorf("%s width and height must be 1-%d", kind, maxMediaDimension)
+			}
+			if p.DurationMs < 0 || p.DurationMs > maxMediaDurationMs || (kind == migrations.ChatMessageKindImage && p.DurationMs != 0) {
+				return fmt.Errorf("invalid %s duration", kind)
+			}
+			payload = p
+		}
+
+	case migrations.ChatMessageKindVoice:
+		if err := checkMediaFields(kind, text, mediaURL, mediaType); err != nil {
+			return err
+		}
+		if hasPayload {
+			var p VoiceNotePayload
+			if err := decodeMessagePayload(kind, msg.Payload, &p); err != nil {
+				return err
+			}
+			if p.DurationMs <= 0 || p.DurationMs > maxMediaDurationMs {
+				return errors.New("voice note duration must be up to 10 minutes")
+			}
+			if len(p.Waveform) > maxVoiceWaveformPoints {
+				return fmt.Errorf("voice note waveform can have at most %d samples", maxVoiceWaveformPoints)
+			}
+			for _, v := range p.Waveform {
+				if v < 0 || v > 255 {
+					return errors.New("voice note waveform samples must be 0-255")
+				}
+			}
+			payload = p
+		}
+
+	case migrations.ChatMessageKindLocation:
+		if text != "" || mediaURL != "" || !hasPayload {
+			return errors.New("location messages need a payload only")
+		}
+		var p LocationPayload
+		if err := decodeMessagePayload(kind, msg.Payload, &p); err != nil {
+			return err
+		}
+		if err := checkCoordinates(p.Latitude, p.Longitude); err != nil {
+			return err
+		}
+		if utf8.RuneCountInString(p.Name) > maxPlaceNameLength || utf8.RuneCountInString(p.Address) > maxAddressLength {
+			return errors.New("location name or address too long")
+		}
+		payload = p
+
+	case migrations.ChatMessageKindDateProposal:
+		if text != "" || mediaURL != "" || !hasPayload {
+			return errors.New("date proposals need a payload only")
+		}
+		var p DateProposalPayload
+		if err := decodeMessagePayload(kind, msg.Payload, &p); err != nil {
+			return err
+		}
+		if p.ProposedAt.IsZero() || p.ProposedAt.Before(time.Now()) || time.Until(p.ProposedAt) > maxDateProposalAhead {
+			return errors.New("proposed_at must be in the next year")
+		}
+		if n := utf8.RuneCountInString(strings.TrimSpace(p.PlaceName)); n == 0 || n > maxPlaceNameLength {
+			return fmt.Errorf("place_name must be 1-%d characters", maxPlaceNameLength)
+		}
+		if utf8.RuneCountInString(p.Address) > maxAddressLength {
+			return errors.New("address too long")
+		}
+		if (p.Latitude == nil) != (p.Longitude == nil) {
+			return errors.New("latitude and longitude must be sent together")
+		}
+		if p.Latitude != nil {
+			if err := checkCoordinates(*p.Latitude, *p.Longitude); err != nil {
+				return err
+			}
+		}
+		if p.Status != "" && p.Status != DateProposalPending || p.RespondedAt != nil {
+			return errors.New("new date proposals must be pending")
+		}
+		p.ProposedAt = p.ProposedAt.UTC()
+		p.Status = DateProposalPending
+		payload = p
+
+	case migrations.ChatMessageKindLinkPreview:
+		if text == "" || mediaURL != "" || !hasPayload {
+			return errors.New("link previews need text and a payload")
+		}
+		if utf8.RuneCountInString(text) > maxMessageTextLength {
+			return errors.New("Message text too long")
+		}
+		var p LinkPreviewPayload
+		if err := decodeMessagePayload(kind, msg.Payload, &p); err != nil {
+			return err
+		}
+		if !isHTTPURL(p.URL) || !strings.Contains(text, p.URL) {
+			return errors.New("link preview url must be an http(s) link from the message text")
+		}
+		if p.ImageURL != "" && !isHTTPURL(p.ImageURL) {
+			return errors.New("link preview image_url must be an http(s) link")
+		}
+		if utf8.RuneCountInString(p.Title) > maxLinkTitleLength || utf8.RuneCountInString(p.SiteName) > maxLinkTitleLength || utf8.RuneCountInString(p.Description) > maxLinkDescLength {
+			return errors.New("link preview text too long")
+		}
+		payload = p
+
+	default:
+		return fmt.Errorf("unknown message kind %q", kind)
+	}
+
+	params.Kind = kind
+	if text != "" {
+		params.MessageText = pgtype.Text{String: text, Valid: true}
+	}
+	if mediaURL != "" {
+		params.MediaUrl = pgtype.Text{String: mediaURL, Valid: true}
+		params.MediaType = pgtype.Text{String: mediaType, Valid: true}
+	}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return errors.New("invalid message payload")
+		}
+		params.Payload = b
+	}
+	return nil
+}
+
+// inferMediaKind maps a legacy media message's MIME type to its kind.
+func inferMediaKind(mediaType string) migrations.ChatMessageKind {
+	switch {
+	case mediaType == "image/gif":
+		return migrations.ChatMessageKindGif
+	case strings.HasPrefix(mediaType, "image/"):
+		return migrations.ChatMessageKindImage
+	case strings.HasPrefix(mediaType, "video/"):
+		return migrations.ChatMessageKindVideo
+	case strings.HasPrefix(mediaType, "audio/"):
+		return migrations.ChatMessageKindVoice
+	}
+	return ""
+}
+
+func checkMediaFields(kind migrations.ChatMessageKind, text, mediaURL, mediaType string) error {
+	if text != "" || mediaURL == "" || mediaType == "" {
+		return fmt.Errorf("%s messages need media_url and media_type only", kind)
+	}
+	ok := false
+	switch kind {
+	case migrations.ChatMessageKindImage:
+		ok = strings.HasPrefix(mediaType, "image/")
+	case migrations.ChatMessageKindVideo:
+		ok = strings.HasPrefix(mediaType, "video/")
+	case migrations.ChatMessageKindVoice:
+		ok = strings.HasPrefix(mediaType, "audio/")
+	case migrations.ChatMessageKindGif:
+		// GIF providers serve both real GIFs and looping video renditions.
+		ok = mediaType == "image/gif" || mediaType == "image/webp" || mediaType == "video/mp4"
+	}
+	if !ok {
+		return fmt.Errorf("media_type %q does not match kind %s", mediaType, kind)
+	}
+	return nil
+}
+
+// decodeMessagePayload decodes exactly one JSON object into v, rejecting
+// fields v doesn't define.
+func decodeMessagePayload(kind migrations.ChatMessageKind, raw json.RawMessage, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid %s payload: %v", kind, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid %s payload: trailing data", kind)
+	}
+	return nil
+}
+
+func checkCoordinates(lat, lng float64) error {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return errors.New("invalid coordinates")
+	}
+	return nil
+}
+
+func isHTTPURL(raw string) bool {
+	if raw == "" || len(raw) > maxLinkURLLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// ProcessDateProposalResponse records the recipient's answer to a pending
+// date proposal and notifies the proposer.
+func ProcessDateProposalResponse(ctx context.Context, queries *migrations.Queries, hub *Hub, userID int32, messageID int64, status string) (migrations.ChatMessage, error) {
+	if messageID <= 0 {
+		return migrations.ChatMessage{}, errors.New("valid message_id is required")
+	}
+	if status != DateProposalAccepted && status != DateProposalDeclined {
+		return migrations.ChatMessage{}, errors.New("status must be accepted or declined")
+	}
+
+	updated, err := queries.RespondToDateProposal(ctx, migrations.RespondToDateProposalParams{
+		Status:          status,
+		ID:              messageID,
+		RecipientUserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return migrations.ChatMessage{}, errors.New("no pending date proposal to you with that message_id")
+		}
+		log.Printf("ERROR: ProcessDateProposalResponse: Failed update proposal %d for user %d: %v", messageID, userID, err)
+		return migrations.ChatMessage{}, errors.New("failed to save response")
+	}
+
+	log.Printf("INFO: Date proposal %d %s by user %d", messageID, status, userID)
+	if hub != nil {
+		hub.SendEvent(updated.SenderUserID, userID, messageChangeEvent("date_proposal_updated", updated))
+	}
+	return updated, nil
+}
@@ -0,0 +1,187 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chatMessage builds an incoming chat_message; empty strings are left unset.
+func chatMessage(kind, text, mediaURL, mediaType, payload string) WsMessage {
+	msg := WsMessage{Type: "chat_message"}
+	if kind != "" {
+		msg.Kind = Ptr(kind)
+	}
+	if text != "" {
+		msg.Text = Ptr(text)
+	}
+	if mediaURL != "" {
+		msg.MediaURL = Ptr(mediaURL)
+	}
+	if mediaType != "" {
+		msg.MediaType = Ptr(mediaType)
+	}
+	if payload != "" {
+		msg.Payload = json.RawMessage(payload)
+	}
+	return msg
+}
+
+func futureDate() string {
+	return time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+}
+
+func TestBuildChatMessageContentLegacy(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       WsMessage
+		wantKind  migrations.ChatMessageKind
+		wantError string
+	}{
+		{"text", chatMessage("", "hi", "", "", ""), migrations.ChatMessageKindText, ""},
+		{"image", chatMessage("", "", "https://cdn/x.jpg", "image/jpeg", ""), migrations.ChatMessageKindImage, ""},
+		{"gif", chatMessage("", "", "https://cdn/x.gif", "image/gif", ""), migrations.ChatMessageKindGif, ""},
+		{"video", chatMessage("", "", "https://cdn/x.mp4", "video/mp4", ""), migrations.ChatMessageKindVideo, ""},
+		{"voice", chatMessage("", "", "https://cdn/x.m4a", "audio/mp4", ""), migrations.ChatMessageKindVoice, ""},
+		{"unsupported media", chatMessage("", "", "https://cdn/x.pdf", "application/pdf", ""), "", "unsupported media type"},
+		{"media without type", chatMessage("", "", "https://cdn/x.jpg", "", ""), "", "text or media required"},
+		{"empty", chatMessage("", "", "", "", ""), "", "text or media required"},
+		{"text with media", chatMessage("", "hi", "https://cdn/x.jpg", "image/jpeg", ""), "", "text only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params migrations.CreateChatMessageParams
+			err := buildChatMessageContent(tt.msg, &params)
+			if tt.wantError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKind, params.Kind)
+			assert.Nil(t, params.Payload)
+		})
+	}
+}
+
+func TestBuildChatMessageContentKinds(t *testing.T) {
+	oversize := `{"width":1,"height":1,"pad":"` + strings.Repeat("x", maxMessagePayloadBytes) + `"}`
+	tests := []struct {
+		name      string
+		msg       WsMessage
+		wantError string // empty when the message is valid
+	}{
+		{"text", chatMessage("text", "hi", "", "", ""), ""},
+		{"text missing", chatMessage("text", "", "", "", ""), "text only"},
+		{"text with payload", chatMessage("text", "hi", "", "", `{}`), "text only"},
+		{"text too long", chatMessage("text", strings.Repeat("a", maxMessageTextLength+1), "", "", ""), "too long"},
+		{"text at limit in multibyte runes", chatMessage("text", strings.Repeat("é", maxMessageTextLength), "", "", ""), ""},
+
+		{"image", chatMessage("image", "", "https://cdn/x.jpg", "image/jpeg", `{"width":640,"height":480}`), ""},
+		{"image without payload", chatMessage("image", "", "https://cdn/x.jpg", "image/jpeg", ""), ""},
+		{"image missing media", chatMessage("image", "", "", "", `{"width":640,"height":480}`), "media_url and media_type only"},
+		{"image wrong media type", chatMessage("image", "", "https://cdn/x.mp4", "video/mp4", ""), "does not match"},
+		{"image zero size", chatMessage("image", "", "https://cdn/x.jpg", "image/jpeg", `{"width":0,"height":480}`), "width and height"},
+		{"image with duration", chatMessage("image", "", "https://cdn/x.jpg", "image/jpeg", `{"width":1,"height":1,"duration_ms":5}`), "duration"},
+		{"image unknown field", chatMessage("image", "", "https://cdn/x.jpg", "image/jpeg", `{"width":1,"height":1,"alt":"x"}`), "unknown field"},
+		{"image trailing data", chatMessage("image", "", "https://cdn/x.jpg", "image/jpeg", `{"width":1,"height":1}{}`), "trailing data"},
+		{"image oversize payload", chatMessage("image", "", "https://cdn/x.jpg", "image/jpeg", oversize), "too large"},
+
+		{"video", chatMessage("video", "", "https://cdn/x.mp4", "video/mp4", `{"width":1280,"height":720,"duration_ms":15000}`), ""},
+		{"video too long", chatMessage("video", "", "https://cdn/x.mp4", "video/mp4", fmt.Sprintf(`{"width":1,"height":1,"duration_ms":%d}`, maxMediaDurationMs+1)), "duration"},
+		{"gif as video", chatMessage("gif", "", "https://cdn/x.mp4", "video/mp4", `{"width":200,"height":200}`), ""},
+		{"gif as png", chatMessage("gif", "", "https://cdn/x.png", "image/png", ""), "does not match"},
+
+		{"voice", chatMessage("voice", "", "https://cdn/x.m4a", "audio/mp4", `{"duration_ms":3000,"waveform":[0,128,255]}`), ""},
+		{"voice zero duration", chatMessage("voice", "", "https://cdn/x.m4a", "audio/mp4", `{"duration_ms":0}`), "duration"},
+		{"voice waveform sample", chatMessage("voice", "", "https://cdn/x.m4a", "audio/mp4", `{"duration_ms":1,"waveform":[256]}`), "0-255"},
+		{"voice waveform length", chatMessage("voice", "", "https://cdn/x.m4a", "audio/mp4",
+			fmt.Sprintf(`{"duration_ms":1,"waveform":[%s0]}`, strings.Repeat("0,", maxVoiceWaveformPoints))), "at most"},
+		{"voice unknown field", chatMessage("voice", "", "https://cdn/x.m4a", "audio/mp4", `{"duration_ms":1,"codec":"aac"}`), "unknown field"},
+
+		{"location", chatMessage("location", "", "", "", `{"latitude":28.6,"longitude":77.2,"name":"India Gate"}`), ""},
+		{"location missing payload", chatMessage("location", "", "", "", ""), "payload only"},
+		{"location null payload", chatMessage("location", "", "", "", `null`), "payload only"},
+		{"location with text", chatMessage("location", "here", "", "", `{"latitude":0,"longitude":0}`), "payload only"},
+		{"location out of range", chatMessage("location", "", "", "", `{"latitude":91,"longitude":0}`), "coordinates"},
+		{"location name too long", chatMessage("location", "", "", "", fmt.Sprintf(`{"latitude":0,"longitude":0,"name":%q}`, strings.Repeat("n", maxPlaceNameLength+1))), "too long"},
+		{"location unknown field", chatMessage("location", "", "", "", `{"latitude":0,"longitude":0,"accuracy":5}`), "unknown field"},
+		{"location not an object", chatMessage("location", "", "", "", `[1,2]`), "invalid location payload"},
+
+		{"date proposal", chatMessage("date_proposal", "", "", "", fmt.Sprintf(`{"proposed_at":%q,"place_name":"Cafe"}`, futureDate())), ""},
+		{"date proposal missing payload", chatMessage("date_proposal", "", "", "", ""), "payload only"},
+		{"date proposal in the past", chatMessage("date_proposal", "", "", "", `{"proposed_at":"2000-01-01T00:00:00Z","place_name":"Cafe"}`), "next year"},
+		{"date proposal too far ahead", chatMessage("date_proposal", "", "", "", fmt.Sprintf(`{"proposed_at":%q,"place_name":"Cafe"}`,
+			time.Now().Add(maxDateProposalAhead+time.Hour).UTC().Format(time.RFC3339))), "next year"},
+		{"date proposal blank place", chatMessage("date_proposal", "", "", "", fmt.Sprintf(`{"proposed_at":%q,"place_name":"  "}`, futureDate())), "place_name"},
+		{"date proposal half coordinates", chatMessage("date_proposal", "", "", "", fmt.Sprintf(`{"proposed_at":%q,"place_name":"Cafe","latitude":1}`, futureDate())), "together"},
+		{"date proposal already accepted", chatMessage("date_proposal", "", "", "", fmt.Sprintf(`{"proposed_at":%q,"place_name":"Cafe","status":"accepted"}`, futureDate())), "must be pending"},
+		{"date proposal already answered", chatMessage("date_proposal", "", "", "", fmt.Sprintf(`{"proposed_at":%q,"place_name":"Cafe","responded_at":%q}`, futureDate(), futureDate())), "must be pending"},
+		{"date proposal unknown field", chatMessage("date_proposal", "", "", "", fmt.Sprintf(`{"proposed_at":%q,"place_name":"Cafe","rsvp":true}`, futureDate())), "unknown field"},
+
+		{"link preview", chatMessage("link_preview", "see https://example.com/a", "", "", `{"url":"https://example.com/a","title":"A"}`), ""},
+		{"link preview missing text", chatMessage("link_preview", "", "", "", `{"url":"https://example.com/a"}`), "text and a payload"},
+		{"link preview url not in text", chatMessage("link_preview", "see this", "", "", `{"url":"https://example.com/a"}`), "from the message text"},
+		{"link preview javascript url", chatMessage("link_preview", "javascript:alert(1)", "", "", `{"url":"javascript:alert(1)"}`), "http(s)"},
+		{"link preview bad image", chatMessage("link_preview", "https://example.com", "", "", `{"url":"https://example.com","image_url":"ftp://x/y.png"}`), "image_url"},
+		{"link preview unknown field", chatMessage("link_preview", "https://example.com", "", "", `{"url":"https://example.com","favicon":"x"}`), "unknown field"},
+
+		{"unknown kind", chatMessage("sticker", "", "", "", `{}`), "unknown message kind"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params migrations.CreateChatMessageParams
+			err := buildChatMessageContent(tt.msg, &params)
+			if tt.wantError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, migrations.ChatMessageKind(*tt.msg.Kind), params.Kind)
+		})
+	}
+}
+
+func TestBuildChatMessageContentStoresNewProposalsPending(t *testing.T) {
+	proposedAt := time.Now().Add(72 * time.Hour).In(time.FixedZone("IST", 5*3600+1800)).Truncate(time.Second)
+	payload := fmt.Sprintf(`{"proposed_at":%q,"place_name":"Cafe","status":"pending"}`, proposedAt.Format(time.RFC3339))
+
+	var params migrations.CreateChatMessageParams
+	require.NoError(t, buildChatMessageContent(chatMessage("date_proposal", "", "", "", payload), &params))
+
+	var stored DateProposalPayload
+	require.NoError(t, json.Unmarshal(params.Payload, &stored))
+	assert.Equal(t, DateProposalPending, stored.Status)
+	assert.Nil(t, stored.RespondedAt)
+	assert.Equal(t, time.UTC, stored.ProposedAt.Location())
+	assert.True(t, proposedAt.Equal(stored.ProposedAt))
+}
+
+func TestProcessDateProposalResponseValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID int64
+		status    string
+		wantError string
+	}{
+		{"missing message", 0, DateProposalAccepted, "message_id"},
+		{"back to pending", 1, DateProposalPending, "accepted or declined"},
+		{"unknown status", 1, "maybe", "accepted or declined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Rejected before the database is touched.
+			_, err := ProcessDateProposalResponse(context.Background(), nil, nil, 2, tt.messageID, tt.status)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantError)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package ws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+)
+
+// Events reach Redis through event_outbox: QueueEvent writes them in the
+// caller's transaction and the hub's relay publishes them, so an event is
+// delivered if and only if the change it describes commits. Publishing is
+// at least once; clients dedupe by event_id.
+const (
+	eventRelayInterval     = time.Second
+	eventRelayBatchSize    = 100
+	eventRelayLeaseSeconds = 10
+	// Published events are kept this long for debugging before pruning.
+	publishedEventRetention = time.Hour
+)
+
+func newEventID() string {
+	return randomID(16)
+}
+
+// QueueEvent appends msg to userID's event log, stamping it with the next
+// sequence number and an event ID, and adds it to the outbox. Pass queries
+// bound to the transaction making the change the event describes and call
+// FlushEvents once it commits.
+func (h *Hub) QueueEvent(ctx context.Context, queries *migrations.Queries, userID int32, senderUserID int32, msg WsMessage) error {
+	if msg.EventID == nil {
+		msg.EventID = Ptr(newEventID())
+	}
+	msg.Seq = nil
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", msg.Type, err)
+	}
+	seq, err := queries.AppendUserEvent(ctx, migrations.AppendUserEventParams{
+		UserID:    userID,
+		EventType: msg.Type,
+		Payload:   payload,
+	})
+	if err != nil {
+		return fmt.Errorf("log %s event: %w", msg.Type, err)
+	}
+
+	msg.Seq = &seq
+	if payload, err = json.Marshal(msg); err != nil {
+		return fmt.Errorf("marshal %s event: %w", msg.Type, err)
+	}
+	if err := queries.EnqueueOutboxEvent(ctx, migrations.EnqueueOutboxEventParams{
+		UserID:       userID,
+		SenderUserID: senderUserID,
+		EventType:    msg.Type,
+		Payload:      payload,
+	}); err != nil {
+		return fmt.Errorf("queue %s event: %w", msg.Type, err)
+	}
+	return nil
+}
+
+// FlushEvents wakes this instance's relay so committed events go out now
+// instead of at its next poll.
+func (h *Hub) FlushEvents() {
+	select {
+	case h.relayWake <- struct{}{}:
+	default:
+	}
+}
+
+// runEventRelay publishes queued events to Redis until ctx is cancelled.
+// Every instance's hub runs one; each claims its own events.
+func (h *Hub) runEventRelay(ctx context.Context) {
+	log.Printf("Event relay started (poll %s)", eventRelayInterval)
+	ticker := time.NewTicker(eventRelayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Event relay stopped.")
+			return
+		case <-ticker.C:
+		case <-h.relayWake:
+		}
+
+		for {
+			n, err := h.relayOnce(ctx)
+			if err != nil {
+				log.Printf("ERROR: event relay: %v", err)
+				break
+			}
+			if n < eventRelayBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// relayOnce publishes one batch of due events and returns how many it
+// claimed. Events that fail to publish are retried once their lease runs
+// out.
+func (h *Hub) relayOnce(ctx context.Context) (int, error) {
+	events, err := h.dbQueries.ClaimOutboxEvents(ctx, migrations.ClaimOutboxEventsParams{
+		LeaseSeconds: eventRelayLeaseSeconds,
+		BatchSize:    eventRelayBatchSize,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("claim events: %w", err)
+	}
+	slices.SortFunc(events, func(a, b migrations.EventOutbox) int { return cmp.Compare(a.ID, b.ID) })
+
+	published := make([]int64, 0, len(events))
+	failed := 0
+	for _, event := range events {
+		// Retries skip the push so a Redis outage doesn't repeat it.
+		if event.Attempts == 1 {
+			var msg WsMessage
+			if err := json.Unmarshal(event.Payload, &msg); err != nil {
+				log.Printf("Hub ERROR: Corrupt outbox event %d for user %d: %v", event.ID, event.UserID, err)
+			} else {
+				h.notifyIfOffline(ctx, event.UserID, msg)
+			}
+		}
+
+		userID := event.UserID
+		if err := h.publishToRedis(ctx, RedisWsMessage{
+			Type:            RedisMsgTypeDirect,
+			TargetUserID:    &userID,
+			OriginalPayload: event.Payload,
+			SenderUserID:    event.SenderUserID,
+		}); err != nil {
+			failed++
+			continue
+		}
+		published = append(published, event.ID)
+	}
+
+	if len(published) > 0 {
+		if err := h.dbQueries.MarkOutboxEventsPublished(ctx, published); err != nil {
+			return len(events), fmt.Errorf("mark %d events published: %w", len(published), err)
+		}
+	}
+	if failed > 0 {
+		return len(events), fmt.Errorf("%d of %d events not published, will retry", failed, len(events))
+	}
+	return len(events), nil
+}
@@ -0,0 +1,357 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+// Presence is kept in Redis so every instance sees the same state. Each
+// connection is a member of its user's set, scored by when it expires;
+// instances heartbeat their connections, so those of a crashed instance
+// lapse within presenceTTL and the sweeper reports the user offline.
+//
+//	presence:user:<id>  the user's connections ("<instance>:<conn>") by expiry
+//	presence:online     online user IDs by their latest connection expiry
+//	presence:last_seen  user ID -> unix seconds last seen online
+//	presence:dirty      user IDs not yet written back to users.last_online
+const (
+	presenceUserKeyPrefix = "presence:user:"
+	presenceOnlineKey     = "presence:online"
+	presenceLastSeenKey   = "presence:last_seen"
+	presenceDirtyKey      = "presence:dirty"
+
+	presenceTTL               = 90 * time.Second
+	presenceHeartbeatInterval = 30 * time.Second
+	presenceWritebackInterval = time.Minute
+	presenceSweepBatch        = 500
+	presenceWritebackBatch    = 1000
+)
+
+func presenceUserKey(userID int32) string {
+	return fmt.Sprintf("%s%d", presenceUserKeyPrefix, userID)
+}
+
+func newConnID() string {
+	return randomID(12)
+}
+
+// randomID returns n random bytes, hex encoded.
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// touchPresenceScript records or refreshes a connection and returns 1 if
+// the user was not online before.
+// KEYS: user set, online, last_seen, dirty. ARGV: member, user ID, now ms,
+// expiry ms, TTL ms, now s.
+var touchPresenceScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[4], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+local prev = tonumber(redis.call('ZSCORE', KEYS[2], ARGV[2]))
+if prev == nil or prev < tonumber(ARGV[4]) then
+	redis.call('ZADD', KEYS[2], ARGV[4], ARGV[2])
+end
+redis.call('HSET', KEYS[3], ARGV[2], ARGV[6])
+redis.call('SADD', KEYS[4], ARGV[2])
+if prev == nil or prev <= tonumber(ARGV[3]) then
+	return 1
+end
+return 0
+`)
+
+// removePresenceScript drops a connection and returns 1 if it was the
+// user's last one. Only one caller gets 1 for a given offline transition.
+// KEYS: user set, online, last_seen, dirty. ARGV: member, user ID, now ms,
+// now s.
+var removePresenceScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+redis.call('HSET', KEYS[3], ARGV[2], ARGV[4])
+redis.call('SADD', KEYS[4], ARGV[2])
+local rest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if #rest > 0 then
+	redis.call('ZADD', KEYS[2], rest[2], ARGV[2])
+	return 0
+end
+return redis.call('ZREM', KEYS[2], ARGV[2])
+`)
+
+// expirePresenceScript takes a user whose connections all lapsed offline
+// and returns 1 if this caller did so.
+// KEYS: user set, online, dirty. ARGV: user ID, now ms.
+var expirePresenceScript = redis.NewScript(`
+local score = tonumber(redis.call('ZSCORE', KEYS[2], ARGV[1]))
+if score == nil or score > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local rest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if #rest > 0 then
+	redis.call('ZADD', KEYS[2], rest[2], ARGV[1])
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('SADD', KEYS[3], ARGV[1])
+return 1
+`)
+
+func (h *Hub) presenceMember(c *Client) string {
+	return h.instanceID + ":" + c.connID
+}
+
+func (h *Hub) touchPresenceArgs(c *Client, now time.Time) ([]string, []any) {
+	keys := []string{presenceUserKey(c.UserID), presenceOnlineKey, presenceLastSeenKey, presenceDirtyKey}
+	args := []any{h.presenceMember(c), c.UserID, now.UnixMilli(), now.Add(presenceTTL).UnixMilli(), presenceTTL.Milliseconds(), now.Unix()}
+	return keys, args
+}
+
+// addSession records the connection and reports whether the user just came
+// online. On Redis errors it assumes so, as before presence was shared.
+func (h *Hub) addSession(ctx context.Context, c *Client) bool {
+	keys, args := h.touchPresenceArgs(c, time.Now())
+	first, err := touchPresenceScript.Run(ctx, h.redisClient, keys, args...).Int()
+	if err != nil {
+		log.Printf("Hub WARN: Failed to record presence for user %d: %v", c.UserID, err)
+		return true
+	}
+	return first == 1
+}
+
+// removeSession drops the connection and reports whether the user has no
+// connections left on any instance.
+func (h *Hub) removeSession(ctx context.Context, c *Client) bool {
+	now := time.Now()
+	last, err := removePresenceScript.Run(ctx, h.redisClient,
+		[]string{presenceUserKey(c.UserID), presenceOnlineKey, presenceLastSeenKey, presenceDirtyKey},
+		h.presenceMember(c), c.UserID, now.UnixMilli(), now.Unix()).Int()
+	if err != nil {
+		log.Printf("Hub WARN: Failed to remove presence for user %d: %v", c.UserID, err)
+		return true
+	}
+	return last == 1
+}
+
+// connectedUsers returns which of userIDs have a live connection on any
+// instance.
+func (h *Hub) connectedUsers(ctx context.Context, userIDs []int32) (map[int32]bool, error) {
+	presence, err := h.Presence(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	connected := make(map[int32]bool, len(presence))
+	for id, p := range presence {
+		if p.Online {
+			connected[id] = true
+		}
+	}
+	return connected, nil
+}
+
+// UserPresence is a user's presence as tracked in Redis.
+type UserPresence struct {
+	Online   bool
+	LastSeen *time.Time // nil if not seen since Redis was last emptied
+}
+
+// LastOnline returns the later of LastSeen and dbLastOnline, the value in
+// users.last_online, which lags by up to a write-back interval.
+func (p UserPresence) LastOnline(dbLastOnline *time.Time) *time.Time {
+	if p.LastSeen == nil || (dbLastOnline != nil && dbLastOnline.After(*p.LastSeen)) {
+		return dbLastOnline
+	}
+	return p.LastSeen
+}
+
+// ResolvePresence is userID's online state and last-online time, taking
+// presence from Presence when it has the user and otherwise the values
+// last written back to the users table.
+func ResolvePresence(presence map[int32]UserPresence, userID int32, dbIsOnline bool, dbLastOnline pgtype.Timestamptz) (bool, *time.Time) {
+	lastOnline := pgTimestampToTimePtr(dbLastOnline)
+	p, ok := presence[userID]
+	if !ok {
+		return dbIsOnline, lastOnline
+	}
+	return p.Online, p.LastOnline(lastOnline)
+}
+
+// Presence looks up userIDs' presence across all instances.
+func (h *Hub) Presence(ctx context.Context, userIDs []int32) (map[int32]UserPresence, error) {
+	if len(userIDs) == 0 {
+		return map[int32]UserPresence{}, nil
+	}
+	pipe := h.redisClient.Pipeline()
+	scores := make([]*redis.FloatCmd, len(userIDs))
+	seen := make([]*redis.StringCmd, len(userIDs))
+	for i, id := range userIDs {
+		member := strconv.Itoa(int(id))
+		scores[i] = pipe.ZScore(ctx, presenceOnlineKey, member)
+		seen[i] = pipe.HGet(ctx, presenceLastSeenKey, member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	nowMs := float64(time.Now().UnixMilli())
+	presence := make(map[int32]UserPresence, len(userIDs))
+	for i, id := range userIDs {
+		var p UserPresence
+		if score, err := scores[i].Result(); err == nil && score > nowMs {
+			p.Online = true
+		}
+		if sec, err := seen[i].Int64(); err == nil {
+			t := time.Unix(sec, 0).UTC()
+			p.LastSeen = &t
+		}
+		presence[id] = p
+	}
+	return presence, nil
+}
+
+// runPresence heartbeats this instance's connections, takes users whose
+// connections lapsed offline and writes last_online back to Postgres,
+// until ctx is cancelled.
+func (h *Hub) runPresence(ctx context.Context) {
+	heartbeat := time.NewTicker(presenceHeartbeatInterval)
+	defer heartbeat.Stop()
+	writeback := time.NewTicker(presenceWritebackInterval)
+	defer writeback.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			h.heartbeatPresence(ctx)
+			h.sweepPresence(ctx)
+		case <-writeback.C:
+			h.writeBackPresence(ctx)
+		}
+	}
+}
+
+func (h *Hub) heartbeatPresence(ctx context.Context) {
+	h.clientsMu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, conns := range h.clients {
+		for c := range conns {
+			clients = append(clients, c)
+		}
+	}
+	h.clientsMu.RUnlock()
+	if len(clients) == 0 {
+		return
+	}
+
+	now := time.Now()
+	pipe := h.redisClient.Pipeline()
+	cmds := make([]*redis.Cmd, len(clients))
+	for i, c := range clients {
+		// Eval, not EvalSha: a pipeline can't fall back on NOSCRIPT.
+		keys, args := h.touchPresenceArgs(c, now)
+		cmds[i] = touchPresenceScript.Eval(ctx, pipe, keys, args...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Hub WARN: Presence heartbeat failed: %v", err)
+	}
+	// A user whose presence lapsed (e.g. Redis was unreachable for longer
+	// than presenceTTL) is online again.
+	for i, cmd := range cmds {
+		if first, err := cmd.Int(); err == nil && first == 1 {
+			go h.broadcastStatusChange(clients[i].UserID, true)
+		}
+	}
+}
+
+func (h *Hub) sweepPresence(ctx context.Context) {
+	now := time.Now()
+	expired, err := h.redisClient.ZRangeByScore(ctx, presenceOnlineKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: presenceSweepBatch,
+	}).Result()
+	if err != nil {
+		log.Printf("Hub WARN: Presence sweep failed: %v", err)
+		return
+	}
+	for _, member := range expired {
+		id, err := strconv.ParseInt(member, 10, 32)
+		if err != nil {
+			continue
+		}
+		userID := int32(id)
+		took, err := expirePresenceScript.Run(ctx, h.redisClient,
+			[]string{presenceUserKey(userID), presenceOnlineKey, presenceDirtyKey},
+			userID, now.UnixMilli()).Int()
+		if err != nil {
+			log.Printf("Hub WARN: Failed to expire presence for user %d: %v", userID, err)
+			continue
+		}
+		if took == 1 {
+			log.Printf("Hub INFO: Presence of user %d lapsed, marking offline", userID)
+			h.broadcastStatusChange(userID, false)
+		}
+	}
+}
+
+// writeBackPresence copies last_seen and online state of users changed
+// since the last run to the users table, for queries that filter on it.
+func (h *Hub) writeBackPresence(ctx context.Context) {
+	for {
+		members, err := h.redisClient.SPopN(ctx, presenceDirtyKey, presenceWritebackBatch).Result()
+		if err != nil {
+			log.Printf("Hub WARN: Presence write-back failed to read dirty users: %v", err)
+			return
+		}
+		if len(members) == 0 {
+			return
+		}
+
+		userIDs := make([]int32, 0, len(members))
+		for _, m := range members {
+			if id, err := strconv.ParseInt(m, 10, 32); err == nil {
+				userIDs = append(userIDs, int32(id))
+			}
+		}
+		presence, err := h.Presence(ctx, userIDs)
+		if err == nil {
+			params := migrations.SyncUserPresenceParams{
+				UserIds:     userIDs,
+				LastOnlines: make([]pgtype.Timestamptz, len(userIDs)),
+				OnlineFlags: make([]bool, len(userIDs)),
+			}
+			for i, id := range userIDs {
+				p := presence[id]
+				params.OnlineFlags[i] = p.Online
+				if p.LastSeen != nil {
+					params.LastOnlines[i] = pgtype.Timestamptz{Time: *p.LastSeen, Valid: true}
+				}
+			}
+			err = h.dbQueries.SyncUserPresence(ctx, params)
+		}
+		if err != nil {
+			log.Printf("ERROR: Presence write-back of %d users failed: %v", len(userIDs), err)
+			if err := h.redisClient.SAdd(ctx, presenceDirtyKey, members).Err(); err != nil {
+				log.Printf("Hub WARN: Failed to requeue %d users for presence write-back: %v", len(members), err)
+			}
+			return
+		}
+		if len(members) < presenceWritebackBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/arnnvv/peeple-api/migrations"
+	"github.com/arnnvv/peeple-api/pkg/push"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxPushPreviewRunes = 100
+
+// SetPushDispatcher makes SendEvent queue push notifications for chat
+// messages, likes and matches sent to users with no open connection.
+func (h *Hub) SetPushDispatcher(d *push.Dispatcher) {
+	h.pusher = d
+}
+
+// notifyIfOffline queues a push for msg if it is a pushable event and
+// userID has no connection on any instance. If presence can't be checked
+// the push is queued anyway; a duplicate beats a missed message.
+func (h *Hub) notifyIfOffline(ctx context.Context, userID int32, msg WsMessage) {
+	if h.pusher == nil {
+		return
+	}
+	n, ok := h.pushNotificationFor(ctx, userID, msg)
+	if !ok {
+		return
+	}
+	connected, err := h.connectedUsers(ctx, []int32{userID})
+	if err != nil {
+		log.Printf("Hub WARN: Failed presence check before push for user %d: %v", userID, err)
+	} else if connected[userID] {
+		return
+	}
+	if err := h.pusher.Enqueue(ctx, userID, n); err != nil {
+		log.Printf("Hub ERROR: Failed to queue %s push for user %d: %v", msg.Type, userID, err)
+	}
+}
+
+// pushNotificationFor describes msg as a push to userID, if it warrants one.
+func (h *Hub) pushNotificationFor(ctx context.Context, userID int32, msg WsMessage) (push.Notification, bool) {
+	switch msg.Type {
+	case "chat_message":
+		if msg.SenderUserID == nil || msg.ID == nil {
+			return push.Notification{}, false
+		}
+		senderID := *msg.SenderUserID
+		if h.conversationMuted(ctx, userID, senderID) {
+			return push.Notification{}, false
+		}
+		return push.Notification{
+			Type:        migrations.NotificationTypeNewMessage,
+			CollapseKey: fmt.Sprintf("message:%d", senderID),
+			Title:       h.pushDisplayName(ctx, senderID),
+			Body:        messagePreview(msg),
+			Data: map[string]string{
+				"type":           "chat_message",
+				"sender_user_id": strconv.Itoa(int(senderID)),
+				"message_id":     strconv.FormatInt(*msg.ID, 10),
+			},
+		}, true
+
+	case "new_like_received":
+		if msg.LikerInfo == nil {
+			return push.Notification{}, false
+		}
+		body := fmt.Sprintf("%s liked you", msg.LikerInfo.Name)
+		if msg.LikerInfo.IsRose {
+			body = fmt.Sprintf("%s sent you a rose", msg.LikerInfo.Name)
+		}
+		return push.Notification{
+			Type:        migrations.NotificationTypeNewLike,
+			CollapseKey: "likes",
+			Title:       "New like",
+			Body:        body,
+			Data: map[string]string{
+				"type":          "new_like",
+				"liker_user_id": strconv.Itoa(int(msg.LikerInfo.LikerUserID)),
+			},
+		}, true
+
+	case "new_match":
+		if msg.MatchInfo == nil {
+			return push.Notification{}, false
+		}
+		return push.Notification{
+			Type:        migrations.NotificationTypeNewMatch,
+			CollapseKey: fmt.Sprintf("match:%d", msg.MatchInfo.MatchedUserID),
+			Title:       "It's a match!",
+			Body:        fmt.Sprintf("You and %s liked each other", msg.MatchInfo.Name),
+			Data: map[string]string{
+				"type":            "new_match",
+				"matched_user_id": strconv.Itoa(int(msg.MatchInfo.MatchedUserID)),
+			},
+		}, true
+	}
+	return push.Notification{}, false
+}
+
+func (h *Hub) conversationMuted(ctx context.Context, userID, peerUserID int32) bool {
+	settings, err := h.dbQueries.GetConversationSettings(ctx, migrations.GetConversationSettingsParams{
+		UserID:     userID,
+		PeerUserID: peerUserID,
+	})
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Hub WARN: Failed to load conversation settings %d -> %d: %v", userID, peerUserID, err)
+		}
+		return false
+	}
+	return IsMuted(settings.MutedUntil)
+}
+
+func (h *Hub) pushDisplayName(ctx context.Context, userID int32) string {
+	info, err := h.dbQueries.GetBasicUserInfo(ctx, userID)
+	if err != nil || !info.Name.Valid || info.Name.String == "" {
+		return "New message"
+	}
+	return info.Name.String
+}
+
+// messagePreview is the push body for a chat message: its text, or a
+// description of what was sent.
+func messagePreview(msg WsMessage) string {
+	switch derefString(msg.Kind) {
+	case string(migrations.ChatMessageKindImage):
+		return "Sent a photo"
+	case string(migrations.ChatMessageKindVideo):
+		return "Sent a video"
+	case string(migrations.ChatMessageKindVoice):
+		return "Sent a voice note"
+	case string(migrations.ChatMessageKindGif):
+		return "Sent a GIF"
+	case string(migrations.ChatMessageKindLocation):
+		return "Shared a location"
+	case string(migrations.ChatMessageKindDateProposal):
+		return "Proposed a date"
+	}
+	text := []rune(derefString(msg.Text))
+	if len(text) == 0 {
+		return "Sent a message"
+	}
+	if len(text) > maxPushPreviewRunes {
+		return string(text[:maxPushPreviewRunes]) + "…"
+	}
+	return string(text)
+}
@@ -77,6 +77,14 @@ func ProcessUnmatch(ctx context.Context, queries *migrations.Queries, pool *pgxp
 	}
 	log.Printf("DEBUG: ProcessUnmatch: Marked %d chat messages read.", cmdTag.RowsAffected())
 
+	if hub != nil {
+		err = hub.QueueEvent(ctx, qtx, req.TargetUserID, requesterUserID, matchRemovedEvent(requesterUserID))
+		if err != nil {
+			log.Printf("ERROR: ProcessUnmatch: Failed queue match_removed for %d: %v", req.TargetUserID, err)
+			return errors.New("failed to remove existing connection")
+		}
+	}
+
 	err = tx.Commit(ctx)
 	if err != nil {
 		log.Printf("ERROR: ProcessUnmatch: Failed commit transaction user %d unmatching %d: %v", requesterUserID, req.TargetUserID, err)
@@ -87,10 +95,7 @@ func ProcessUnmatch(ctx context.Context, queries *migrations.Queries, pool *pgxp
 	log.Printf("INFO: Unmatch processed DB successfully: User %d -> User %d", requesterUserID, req.TargetUserID)
 
 	if hub != nil {
-		go func(recipientID int32, unmatcherID int32) {
-			log.Printf("ProcessUnmatch INFO: Triggering WS match_removed broadcast to %d about %d", recipientID, unmatcherID)
-			hub.BroadcastMatchRemoved(recipientID, unmatcherID)
-		}(req.TargetUserID, requesterUserID)
+		hub.FlushEvents()
 	} else {
 		log.Printf("WARN: ProcessUnmatch: Hub is nil, cannot send WS notification.")
 	}